@@ -0,0 +1,87 @@
+package jsonschema
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// cborDecMode decodes CBOR, rejecting maps with duplicate keys
+var cborDecMode, _ = cbor.DecOptions{DupMapKey: cbor.DupMapKeyEnforcedAPF}.DecMode()
+
+// ValidateCBOR performs schema validation against a CBOR encoded item. The
+// item is converted to the JSON data model the keywords expect: integers,
+// big integers included, are kept as json.Number, floats as float64, byte
+// strings become base64 strings like encoding/json encodes them, timestamps
+// become RFC 3339 strings and tags are replaced by their content. As in
+// JSON, a float with a zero fractional part counts as an integer. Maps
+// must only have text string keys, other keys are reported as an error
+func (s *Schema) ValidateCBOR(ctx context.Context, data []byte) ([]KeyError, error) {
+	var item interface{}
+	if err := cborDecMode.Unmarshal(data, &item); err != nil {
+		return nil, fmt.Errorf("error parsing CBOR bytes: %w", err)
+	}
+	value, err := fromCBOR(item)
+	if err != nil {
+		return nil, fmt.Errorf("error converting CBOR to JSON: %w", err)
+	}
+	return s.ValidateDecoded(ctx, value)
+}
+
+// fromCBOR converts a value decoded by the CBOR decoder to the
+// value encoding/json would decode from its JSON equivalent
+func fromCBOR(v interface{}) (interface{}, error) {
+	switch val := v.(type) {
+	case map[interface{}]interface{}:
+		obj := make(map[string]interface{}, len(val))
+		for key, elem := range val {
+			name, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("map key %v of type %T isn't a text string, JSON objects only have string keys", key, key)
+			}
+			conv, err := fromCBOR(elem)
+			if err != nil {
+				return nil, err
+			}
+			obj[name] = conv
+		}
+		return obj, nil
+	case []interface{}:
+		arr := make([]interface{}, len(val))
+		for i, elem := range val {
+			conv, err := fromCBOR(elem)
+			if err != nil {
+				return nil, err
+			}
+			arr[i] = conv
+		}
+		return arr, nil
+	case uint64:
+		return json.Number(strconv.FormatUint(val, 10)), nil
+	case int64:
+		return json.Number(strconv.FormatInt(val, 10)), nil
+	case big.Int:
+		return json.Number(val.String()), nil
+	case float64:
+		if math.IsInf(val, 0) || math.IsNaN(val) {
+			return nil, fmt.Errorf("%v can't be represented in JSON", val)
+		}
+		return val, nil
+	case []byte:
+		return base64.StdEncoding.EncodeToString(val), nil
+	case time.Time:
+		return val.Format(time.RFC3339Nano), nil
+	case cbor.Tag:
+		return fromCBOR(val.Content)
+	case nil, bool, string:
+		return val, nil
+	}
+	return nil, fmt.Errorf("unsupported CBOR value %v of type %T", v, v)
+}
@@ -0,0 +1,165 @@
+package jsonschema
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+
+	jptr "github.com/qri-io/jsonpointer"
+)
+
+// ValidateCoerced performs schema validation against data with the Coerce
+// option enabled, whatever the provided options set. It returns a copy of data
+// in which the strings that were coerced to the type of their schema are
+// replaced by their typed values, along with the validation errors
+func (s *Schema) ValidateCoerced(ctx context.Context, data interface{}, opts *ValidationOptions) (interface{}, []KeyError, error) {
+	ctx = backgroundIfNil(ctx)
+	o := ValidationOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	o.Coerce = true
+	vs := s.ValidateWithOptions(ctx, data, &o)
+	doc := applyCoercions(copyJSON(data), *vs.coercions)
+	if err := ctx.Err(); err != nil {
+		return doc, *vs.Errs, fmt.Errorf("validation aborted: %w", err)
+	}
+	return doc, *vs.Errs, nil
+}
+
+// coerce converts a string instance to the integer, number or boolean type
+// declared by the schema when coercion is enabled and the type doesn't allow
+// strings, recording the coerced value at its instance location. The types
+// of the allOf and $ref subschemas of the schema count as its own, so every
+// keyword applied to the instance sees the coerced value. anyOf, oneOf, then
+// and else subschemas coerce the instance on their own, only for their own
+// keywords. Coercions made by if only decide the condition, and are dropped
+func (vs *ValidationState) coerce(s *Schema, data interface{}) interface{} {
+	str, ok := data.(string)
+	if !ok || !vs.Options.coerce() {
+		return data
+	}
+	types := s.coercionTypes(nil, map[*Schema]bool{})
+	for _, typ := range types {
+		if typ == "string" {
+			return data
+		}
+	}
+	for _, typ := range types {
+		if val, ok := coerceString(str, typ, vs.Options.UseNumber); ok {
+			if vs.coercions == nil {
+				vs.coercions = &map[string]interface{}{}
+			}
+			(*vs.coercions)[vs.InstanceLocation.String()] = val
+			return val
+		}
+	}
+	return data
+}
+
+// coercionTypes appends the types declared by the schema and the schemas
+// it applies in full to the same instance through allOf and $ref to types
+func (s *Schema) coercionTypes(types []string, visited map[*Schema]bool) []string {
+	if s == nil || visited[s] {
+		return types
+	}
+	visited[s] = true
+	if t, ok := s.keywords["type"].(*Type); ok {
+		types = append(types, t.vals...)
+	}
+	if ref, ok := s.keywords["$ref"].(*Ref); ok {
+		types = ref.resolved.coercionTypes(types, visited)
+	}
+	if allOf, ok := s.keywords["allOf"].(*AllOf); ok {
+		for _, sch := range *allOf {
+			types = sch.coercionTypes(types, visited)
+		}
+	}
+	return types
+}
+
+// coerceString parses a string as a JSON value of the given type, keeping
+// numbers as json.Number when useNumber is set
+func coerceString(str, typ string, useNumber bool) (interface{}, bool) {
+	switch typ {
+	case "boolean":
+		switch str {
+		case "true":
+			return true, true
+		case "false":
+			return false, true
+		}
+	case "integer", "number":
+		// only the JSON number syntax is accepted, ruling out
+		// forms such as "0x10", "Inf" or "NaN"
+		if len(str) == 0 || !(str[0] == '-' || isDigit(str[0])) || !isDigit(str[len(str)-1]) || !json.Valid([]byte(str)) {
+			return nil, false
+		}
+		f, err := strconv.ParseFloat(str, 64)
+		if err != nil && !useNumber {
+			return nil, false
+		}
+		if typ == "integer" {
+			if r, ok := numberRat(json.Number(str)); !ok || !r.IsInt() {
+				return nil, false
+			}
+		}
+		if useNumber {
+			return json.Number(str), true
+		}
+		if math.IsInf(f, 0) {
+			return nil, false
+		}
+		return f, true
+	}
+	return nil, false
+}
+
+// isDigit checks if a byte is an ASCII digit
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+// applyCoercions replaces the values of a document at the
+// instance locations of the coercions by their coerced value
+func applyCoercions(doc interface{}, coercions map[string]interface{}) interface{} {
+	for loc, val := range coercions {
+		ptr, err := jptr.Parse(loc)
+		if err != nil {
+			continue
+		}
+		if len(ptr) == 0 {
+			doc = val
+			continue
+		}
+		parent := doc
+		for _, token := range ptr[:len(ptr)-1] {
+			parent = jsonChild(parent, token)
+		}
+		last := ptr[len(ptr)-1]
+		switch p := parent.(type) {
+		case map[string]interface{}:
+			p[last] = val
+		case []interface{}:
+			if i, err := strconv.Atoi(last); err == nil && i >= 0 && i < len(p) {
+				p[i] = val
+			}
+		}
+	}
+	return doc
+}
+
+// jsonChild returns the member or element of a decoded JSON value named by token
+func jsonChild(data interface{}, token string) interface{} {
+	switch v := data.(type) {
+	case map[string]interface{}:
+		return v[token]
+	case []interface{}:
+		if i, err := strconv.Atoi(token); err == nil && i >= 0 && i < len(v) {
+			return v[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,383 @@
+package jsonschema
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// CompiledSchema is a schema with all of its references resolved ahead of
+// validation. It is meant to be reused when validating many documents
+// against the same schema
+type CompiledSchema struct {
+	schema *Schema
+}
+
+// Compile resolves every $ref, $recursiveRef and $dynamicRef of the schema
+// once, including the references of the schemas they point to. It returns
+// an error if a reference can't be resolved. Resolved schemas are stored
+// on the reference keywords, so circular references are only followed once.
+// Reference cycles that never descend into the instance would recurse
+// forever during validation, and are reported as errors. Remote schemas are
+// fetched without blocking the preparation of other schemas, and a schema
+// that compiles is prepared for validation
+func (s *Schema) Compile(ctx context.Context) (*CompiledSchema, error) {
+	ctx = backgroundIfNil(ctx)
+	fetches := &deferredFetches{failed: map[string]bool{}}
+	deferCtx := context.WithValue(ctx, deferredFetchesKey{}, fetches)
+	for {
+		fetches.pending = nil
+		prepareLock.Lock()
+		c := &compiler{visited: map[*Schema]bool{}, fetches: fetches}
+		c.compile(deferCtx, NewValidationState(s), s)
+		if c.err == nil && len(fetches.pending) == 0 {
+			err := s.finishCompile(c.visited)
+			prepareLock.Unlock()
+			if err != nil {
+				return nil, err
+			}
+			return &CompiledSchema{schema: s}, nil
+		}
+		prepareLock.Unlock()
+		if c.err != nil {
+			return nil, c.err
+		}
+		// fetch the remote schemas the pass reached and compile again,
+		// following the references of the fetched schemas
+		for _, uri := range fetches.pending {
+			if GetSchemaRegistry().Get(ctx, uri) == nil {
+				fetches.failed[uri] = true
+			}
+		}
+	}
+}
+
+// finishCompile checks a schema that compiled and marks it prepared,
+// it must be called holding prepareLock
+func (s *Schema) finishCompile(visited map[*Schema]bool) error {
+	if err := s.checkAnchors(); err != nil {
+		return err
+	}
+	if err := findRefCycle(s); err != nil {
+		return err
+	}
+	s.markPrepared(visited)
+	return nil
+}
+
+// Schema returns the schema that was compiled
+func (cs *CompiledSchema) Schema() *Schema {
+	return cs.schema
+}
+
+// Validate uses the compiled schema to check an instance
+func (cs *CompiledSchema) Validate(ctx context.Context, data interface{}) *ValidationState {
+	return cs.schema.Validate(ctx, data)
+}
+
+// ValidateBytes performs schema validation against a slice of json
+// byte data using the compiled schema
+func (cs *CompiledSchema) ValidateBytes(ctx context.Context, data []byte) ([]KeyError, error) {
+	return cs.schema.ValidateBytes(ctx, data)
+}
+
+// ValidateDecoded performs schema validation against an already
+// decoded instance using the compiled schema
+func (cs *CompiledSchema) ValidateDecoded(ctx context.Context, data interface{}) ([]KeyError, error) {
+	return cs.schema.ValidateDecoded(ctx, data)
+}
+
+// prepareLock serializes compiling and preparing schemas, which write the
+// resolved references and anchor indexes validation reads
+var prepareLock sync.Mutex
+
+// prepare resolves the references of the schema and the schemas it reaches
+// and indexes their anchors ahead of its first validation, so validating the
+// schema doesn't write to it and is safe from multiple goroutines. References
+// that can't be resolved are reported by validation instead of retried
+func (s *Schema) prepare(ctx context.Context) {
+	if atomic.LoadUint32(&s.prepared) == 1 {
+		return
+	}
+	prepareLock.Lock()
+	defer prepareLock.Unlock()
+	if atomic.LoadUint32(&s.prepared) == 1 {
+		return
+	}
+	c := &compiler{visited: map[*Schema]bool{}, lenient: true}
+	c.compile(ctx, NewValidationState(s), s)
+	if c.err != nil {
+		// cancelled, the next validation prepares the schema again
+		return
+	}
+	s.markPrepared(c.visited)
+}
+
+// markPrepared indexes the anchors of a schema and the schema resources
+// it reaches, after which validation only reads them
+func (s *Schema) markPrepared(visited map[*Schema]bool) {
+	s.scalar = s.hasScalarKeywords()
+	s.indexAnchors()
+	for sch := range visited {
+		if sch.isResource() {
+			sch.indexAnchors()
+		}
+	}
+	atomic.StoreUint32(&s.prepared, 1)
+}
+
+// deferredFetches collects the remote schemas a compilation pass needs
+// instead of fetching them while holding prepareLock
+type deferredFetches struct {
+	pending []string
+	// failed lists the schemas that couldn't be fetched,
+	// which later passes report as unresolved
+	failed map[string]bool
+}
+
+// deferredFetchesKey is the context key for deferredFetches
+type deferredFetchesKey struct{}
+
+// deferFetch reports whether fetching uri is deferred by ctx, recording it as pending
+func deferFetch(ctx context.Context, uri string) bool {
+	if ctx == nil {
+		return false
+	}
+	fetches, ok := ctx.Value(deferredFetchesKey{}).(*deferredFetches)
+	if !ok || fetches.failed[uri] {
+		return false
+	}
+	for _, p := range fetches.pending {
+		if p == uri {
+			return true
+		}
+	}
+	fetches.pending = append(fetches.pending, uri)
+	return true
+}
+
+// compiler walks a schema tree, resolving references with the
+// same state validation would resolve them with
+type compiler struct {
+	visited map[*Schema]bool
+	err     error
+	// lenient skips the references that can't be resolved
+	// instead of failing, marking them as prepared
+	lenient bool
+	// fetches collects the remote schemas Compile fetches between passes
+	fetches *deferredFetches
+}
+
+// compile resolves the references of a schema and its subschemas
+func (c *compiler) compile(ctx context.Context, currentState *ValidationState, s *Schema) {
+	if s == nil || c.visited[s] || c.err != nil {
+		return
+	}
+	c.visited[s] = true
+	if s.schemaType != schemaTypeObject {
+		return
+	}
+	if err := ctx.Err(); err != nil {
+		c.err = fmt.Errorf("compilation aborted: %w", err)
+		return
+	}
+
+	s.enterState(currentState)
+	for _, keyword := range s.orderedkeywords {
+		switch kw := s.keywords[keyword].(type) {
+		case *RecursiveAnchor:
+			kw.ValidateKeyword(ctx, currentState, nil)
+		case *Ref:
+			if kw.resolved == nil {
+				kw._resolveRef(ctx, currentState)
+			}
+			kw.locateResolved(currentState)
+			if c.lenient && !kw.prepared {
+				kw.prepared = true
+			}
+			if kw.resolved == nil {
+				if c.fail(fmt.Errorf("failed to resolve schema for ref %s", kw.reference)) {
+					return
+				}
+				continue
+			}
+			c.compile(ctx, kw.newSubState(currentState), kw.resolved)
+		case *RecursiveRef:
+			if kw.resolved == nil {
+				pending := c.pendingFetches()
+				kw._resolveRef(ctx, currentState)
+				if c.pendingFetches() > pending {
+					// the recursive anchor depends on the schema
+					// yet to be fetched, resolve it in the next pass
+					kw.resolved, kw.resolvedRoot = nil, nil
+				}
+			}
+			if c.lenient && !kw.prepared {
+				kw.prepared = true
+			}
+			if kw.resolved == nil {
+				if c.fail(fmt.Errorf("failed to resolve schema for ref %s", kw.reference)) {
+					return
+				}
+				continue
+			}
+			c.compile(ctx, kw.newSubState(currentState), kw.resolved)
+		case *DynamicRef:
+			// only the static part of the reference can be resolved,
+			// the dynamic scope is only known during validation
+			if kw.resolved == nil {
+				kw._resolveRef(ctx, currentState)
+			}
+			if c.lenient && !kw.prepared {
+				kw.prepared = true
+			}
+			if kw.resolved == nil {
+				if c.fail(fmt.Errorf("failed to resolve schema for dynamic ref %s", kw.reference)) {
+					return
+				}
+				continue
+			}
+			c.compile(ctx, newDynamicRefSubState(currentState, kw.resolved, kw.resolvedRoot), kw.resolved)
+		}
+	}
+
+	for _, sub := range s.subschemas() {
+		subState := currentState.NewSubState()
+		subState.ClearState()
+		c.compile(ctx, subState, sub)
+	}
+}
+
+// pendingFetches returns the number of remote schemas the pass deferred
+func (c *compiler) pendingFetches() int {
+	if c.fetches == nil {
+		return 0
+	}
+	return len(c.fetches.pending)
+}
+
+// fail records a reference that can't be resolved and reports
+// if it stops compilation, which it does unless the compiler is lenient
+func (c *compiler) fail(err error) bool {
+	if c.lenient || c.pendingFetches() > 0 {
+		// references to schemas that are yet to be
+		// fetched are checked again by the next pass
+		return false
+	}
+	c.err = err
+	return true
+}
+
+// inPlaceApplicators lists the keywords applying their subschemas
+// to the same instance as the schema they belong to
+var inPlaceApplicators = map[string]bool{
+	"allOf":            true,
+	"anyOf":            true,
+	"oneOf":            true,
+	"not":              true,
+	"if":               true,
+	"then":             true,
+	"else":             true,
+	"dependentSchemas": true,
+	"dependencies":     true,
+}
+
+// inPlaceSchemas returns the schemas a schema applies to the same
+// instance, following its resolved references and in-place applicators
+func (s *Schema) inPlaceSchemas() []*Schema {
+	subs := []*Schema{}
+	for _, keyword := range s.orderedkeywords {
+		switch kw := s.keywords[keyword].(type) {
+		case *Ref:
+			subs = append(subs, kw.resolved)
+		case *RecursiveRef:
+			subs = append(subs, kw.resolved)
+		case *DynamicRef:
+			subs = append(subs, kw.resolved)
+		default:
+			if inPlaceApplicators[keyword] {
+				subs = collectSubschemas(kw, subs)
+			}
+		}
+	}
+	return subs
+}
+
+// findRefCycle looks for a chain of references that leads back to a
+// schema without descending into the instance, starting from every schema
+// reachable from root. It returns an error naming the schemas in the cycle
+func findRefCycle(root *Schema) error {
+	const (
+		visiting = iota + 1
+		done
+	)
+	state := map[*Schema]int{}
+	stack := []*Schema{}
+
+	var visit func(s *Schema) []*Schema
+	visit = func(s *Schema) []*Schema {
+		if s == nil || s.schemaType != schemaTypeObject {
+			return nil
+		}
+		switch state[s] {
+		case visiting:
+			for i := len(stack) - 1; i >= 0; i-- {
+				if stack[i] == s {
+					return append(append([]*Schema{}, stack[i:]...), s)
+				}
+			}
+		case done:
+			return nil
+		}
+		state[s] = visiting
+		stack = append(stack, s)
+		for _, sub := range s.inPlaceSchemas() {
+			if cycle := visit(sub); cycle != nil {
+				return cycle
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[s] = done
+		return nil
+	}
+
+	walked := map[*Schema]bool{}
+	var walk func(s *Schema) error
+	walk = func(s *Schema) error {
+		if s == nil || walked[s] {
+			return nil
+		}
+		walked[s] = true
+		if cycle := visit(s); cycle != nil {
+			locations := make([]string, len(cycle))
+			for i, sch := range cycle {
+				locations[i] = root.describeLocation(sch)
+			}
+			return fmt.Errorf("infinite $ref cycle: %s", strings.Join(locations, " -> "))
+		}
+		for _, sub := range append(s.subschemas(), s.inPlaceSchemas()...) {
+			if err := walk(sub); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return walk(root)
+}
+
+// describeLocation names a schema by its location within s, falling back
+// to the URI of the schema resource for schemas outside of s
+func (s *Schema) describeLocation(target *Schema) string {
+	if target == s {
+		return "#"
+	}
+	if loc, ok := s.locate(target); ok {
+		return "#" + loc.String()
+	}
+	if target.docPath != "" {
+		return target.docPath
+	}
+	return "<unknown>"
+}
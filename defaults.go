@@ -0,0 +1,139 @@
+package jsonschema
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// ApplyDefaults returns a copy of data in which every property missing from
+// an object is set to a copy of the default of its subschema. Defaults are
+// looked up through properties, items and prefixItems, the allOf applicator
+// and references, and are applied to nested objects and arrays. The input is
+// left untouched, use ApplyDefaultsInPlace to modify it instead
+func (s *Schema) ApplyDefaults(ctx context.Context, data interface{}) (interface{}, error) {
+	return s.ApplyDefaultsInPlace(ctx, copyJSON(data))
+}
+
+// ApplyDefaultsInPlace sets the defaults of missing properties like
+// ApplyDefaults, but modifies the objects of data rather than a copy.
+// It returns data for symmetry with ApplyDefaults
+func (s *Schema) ApplyDefaultsInPlace(ctx context.Context, data interface{}) (interface{}, error) {
+	ctx = backgroundIfNil(ctx)
+	// references are followed to their defaults, so they must all resolve
+	if _, err := s.Compile(ctx); err != nil {
+		return nil, err
+	}
+	if err := s.applyDefaults(ctx, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// applyDefaults sets the defaults of the schema and its subschemas on data
+func (s *Schema) applyDefaults(ctx context.Context, data interface{}) error {
+	if s == nil || s.schemaType != schemaTypeObject {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("applying defaults aborted: %w", err)
+	}
+
+	switch v := data.(type) {
+	case map[string]interface{}:
+		if props, ok := s.keywords["properties"].(*Properties); ok {
+			keys := make([]string, 0, len(*props))
+			for key := range *props {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				sch := (*props)[key]
+				if _, ok := v[key]; !ok {
+					if def, ok := sch.defaultValue(); ok {
+						v[key] = def
+					}
+				}
+				if val, ok := v[key]; ok {
+					if err := sch.applyDefaults(ctx, val); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	case []interface{}:
+		start := 0
+		if prefix, ok := s.keywords["prefixItems"].(*PrefixItems); ok {
+			for i, sch := range *prefix {
+				if i < len(v) {
+					if err := sch.applyDefaults(ctx, v[i]); err != nil {
+						return err
+					}
+				}
+			}
+			start = len(*prefix)
+		}
+		if items, ok := s.keywords["items"].(*Items); ok {
+			for i := start; i < len(v); i++ {
+				var sch *Schema
+				if items.single {
+					sch = items.Schemas[0]
+				} else if i < len(items.Schemas) {
+					sch = items.Schemas[i]
+				} else {
+					break
+				}
+				if err := sch.applyDefaults(ctx, v[i]); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	// in-place applicators whose subschemas all apply to the instance
+	if allOf, ok := s.keywords["allOf"].(*AllOf); ok {
+		for _, sch := range *allOf {
+			if err := sch.applyDefaults(ctx, data); err != nil {
+				return err
+			}
+		}
+	}
+	if ref, ok := s.keywords["$ref"].(*Ref); ok {
+		if err := ref.resolved.applyDefaults(ctx, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// defaultValue returns a copy of the default of the schema, if any
+func (s *Schema) defaultValue() (interface{}, bool) {
+	if s == nil || s.schemaType != schemaTypeObject {
+		return nil, false
+	}
+	def, ok := s.keywords["default"].(*Default)
+	if !ok {
+		return nil, false
+	}
+	return copyJSON(def.data), true
+}
+
+// copyJSON returns a deep copy of a decoded JSON value
+func copyJSON(data interface{}) interface{} {
+	switch v := data.(type) {
+	case map[string]interface{}:
+		res := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			res[key] = copyJSON(val)
+		}
+		return res
+	case []interface{}:
+		res := make([]interface{}, len(v))
+		for i, val := range v {
+			res[i] = copyJSON(val)
+		}
+		return res
+	default:
+		return data
+	}
+}
@@ -0,0 +1,143 @@
+package jsonschema
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Draft identifies a version of the JSON Schema specification
+type Draft int
+
+const (
+	// Draft4 is the draft-04 JSON Schema specification
+	Draft4 Draft = iota + 1
+	// Draft7 is the draft-07 JSON Schema specification
+	Draft7
+	// Draft2019_09 is the 2019-09 JSON Schema specification
+	Draft2019_09
+	// Draft2020_12 is the 2020-12 JSON Schema specification
+	Draft2020_12
+)
+
+const (
+	// DefaultDraft is the draft used for schemas which do not declare
+	// $schema, or declare a $schema that is not recognized
+	DefaultDraft = Draft2019_09
+	// LatestDraft is the newest supported draft
+	LatestDraft = Draft2020_12
+)
+
+var draftURIs = map[string]Draft{
+	"json-schema.org/draft-04/schema":      Draft4,
+	"json-schema.org/draft-07/schema":      Draft7,
+	"json-schema.org/draft/2019-09/schema": Draft2019_09,
+	"json-schema.org/draft/2020-12/schema": Draft2020_12,
+}
+
+// String returns the name of the draft
+func (d Draft) String() string {
+	switch d {
+	case Draft4:
+		return "draft-04"
+	case Draft7:
+		return "draft-07"
+	case Draft2019_09:
+		return "2019-09"
+	case Draft2020_12:
+		return "2020-12"
+	default:
+		return "unknown"
+	}
+}
+
+// DraftFromURI returns the draft identified by a $schema URI, reporting
+// whether the URI matched a supported draft
+func DraftFromURI(uri string) (Draft, bool) {
+	uri = strings.TrimRight(strings.TrimSpace(uri), "#")
+	uri = strings.TrimPrefix(uri, "https://")
+	uri = strings.TrimPrefix(uri, "http://")
+	d, ok := draftURIs[uri]
+	return d, ok
+}
+
+// draftKeywordRegistry returns a snapshot of the global keyword registry
+// adjusted to the keyword set of the given draft
+func draftKeywordRegistry(d Draft) *KeywordRegistry {
+	r := copyGlobalKeywordRegistry()
+	r.DefaultIfEmpty()
+	switch d {
+	case Draft4:
+		r.applyDraft4()
+	case Draft7:
+		r.applyDraft7()
+	case Draft2020_12:
+		r.applyDraft2020_12()
+	}
+	return r
+}
+
+// draftMetaSchemas maps drafts to the URI of their meta-schema
+var draftMetaSchemas = map[Draft]string{
+	Draft4:       "http://json-schema.org/draft-04/schema",
+	Draft7:       "http://json-schema.org/draft-07/schema",
+	Draft2019_09: "https://json-schema.org/draft/2019-09/schema",
+	Draft2020_12: "https://json-schema.org/draft/2020-12/schema",
+}
+
+// metaSchemaLock serializes registering the bundled meta-schemas
+var metaSchemaLock sync.Mutex
+
+// ValidateSchema checks a schema document against the meta-schema of the
+// draft its $schema declares, or DefaultDraft if it declares none, reporting
+// the errors of the document as an instance of the meta-schema. The
+// meta-schemas are bundled, and registered with the registry returned by
+// GetSchemaRegistry on first use unless it already holds them. It returns an
+// error if raw isn't JSON or declares a $schema of an unsupported draft
+func ValidateSchema(ctx context.Context, raw []byte) ([]KeyError, error) {
+	var doc interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("error parsing JSON bytes: %w", err)
+	}
+	d := DefaultDraft
+	if obj, ok := doc.(map[string]interface{}); ok {
+		if uri, ok := obj["$schema"]; ok {
+			str, _ := uri.(string)
+			if d, ok = DraftFromURI(str); !ok {
+				return nil, fmt.Errorf("unsupported $schema %v", uri)
+			}
+		}
+	}
+	meta, err := metaSchema(d)
+	if err != nil {
+		return nil, err
+	}
+	return meta.ValidateDecoded(ctx, doc)
+}
+
+// metaSchema returns the meta-schema of a draft, registering the
+// bundled meta-schemas the registry doesn't hold yet
+func metaSchema(d Draft) (*Schema, error) {
+	metaSchemaLock.Lock()
+	defer metaSchemaLock.Unlock()
+	registry := GetSchemaRegistry()
+	for uri, src := range metaSchemaSources {
+		if registry.GetKnown(uri) != nil {
+			continue
+		}
+		sch := &Schema{}
+		if err := json.Unmarshal([]byte(src), sch); err != nil {
+			return nil, fmt.Errorf("error parsing meta-schema %s: %w", uri, err)
+		}
+		if err := registry.AddSchema(sch); err != nil {
+			return nil, fmt.Errorf("error registering meta-schema %s: %w", uri, err)
+		}
+	}
+	meta := registry.GetKnown(draftMetaSchemas[d])
+	if meta == nil {
+		return nil, fmt.Errorf("no meta-schema for draft %s", d)
+	}
+	return meta, nil
+}
@@ -26,6 +26,7 @@ func (r *KeywordRegistry) DefaultIfEmpty() {
 func (r *KeywordRegistry) LoadDraft2019_09() {
 	// core keywords
 	r.RegisterKeyword("$schema", NewSchemaURI)
+	r.RegisterKeyword("$vocabulary", NewVocabulary)
 	r.RegisterKeyword("$id", NewID)
 	r.RegisterKeyword("description", NewDescription)
 	r.RegisterKeyword("title", NewTitle)
@@ -33,6 +34,7 @@ func (r *KeywordRegistry) LoadDraft2019_09() {
 	r.RegisterKeyword("examples", NewExamples)
 	r.RegisterKeyword("readOnly", NewReadOnly)
 	r.RegisterKeyword("writeOnly", NewWriteOnly)
+	r.RegisterKeyword("deprecated", NewDeprecated)
 	r.RegisterKeyword("$ref", NewRef)
 	r.RegisterKeyword("$recursiveRef", NewRecursiveRef)
 	r.RegisterKeyword("$anchor", NewAnchor)
@@ -78,6 +80,9 @@ func (r *KeywordRegistry) LoadDraft2019_09() {
 	r.RegisterKeyword("dependentRequired", NewDependentRequired)
 	r.RegisterKeyword("unevaluatedProperties", NewUnevaluatedProperties)
 
+	// backward compatibility with draft7
+	r.RegisterKeyword("dependencies", NewDependencies)
+
 	r.SetKeywordOrder("properties", 2)
 	r.SetKeywordOrder("additionalProperties", 3)
 	r.SetKeywordOrder("unevaluatedProperties", 4)
@@ -108,4 +113,12 @@ func (r *KeywordRegistry) LoadDraft2019_09() {
 
 	//optional formats
 	r.RegisterKeyword("format", NewFormat)
+
+	// content keywords
+	r.RegisterKeyword("contentEncoding", NewContentEncoding)
+	r.RegisterKeyword("contentMediaType", NewContentMediaType)
+	r.RegisterKeyword("contentSchema", NewContentSchema)
+
+	r.SetKeywordOrder("contentMediaType", 2)
+	r.SetKeywordOrder("contentSchema", 3)
 }
@@ -0,0 +1,35 @@
+package jsonschema
+
+// LoadDraft2020_12 loads the keywords for schema validation
+// based on draft2020_12
+func LoadDraft2020_12() {
+	r, release := getGlobalKeywordRegistry()
+	defer release()
+
+	r.LoadDraft2020_12()
+}
+
+// LoadDraft2020_12 loads the keywords for schema validation
+// based on draft2020_12
+func (r *KeywordRegistry) LoadDraft2020_12() {
+	r.LoadDraft2019_09()
+	r.applyDraft2020_12()
+}
+
+// applyDraft2020_12 turns a draft2019_09 keyword set
+// into a draft2020_12 one
+func (r *KeywordRegistry) applyDraft2020_12() {
+	// core keywords
+	r.removeKeyword("$recursiveRef")
+	r.removeKeyword("$recursiveAnchor")
+	r.RegisterKeyword("$dynamicRef", NewDynamicRef)
+	r.RegisterKeyword("$dynamicAnchor", NewDynamicAnchor)
+
+	r.SetKeywordOrder("$dynamicRef", 0)
+
+	// array keywords
+	// tuple validation moved from items and additionalItems to prefixItems
+	r.removeKeyword("additionalItems")
+	r.RegisterKeyword("items", newSchemaOnlyItems)
+	r.RegisterKeyword("prefixItems", NewPrefixItems)
+}
@@ -0,0 +1,56 @@
+package jsonschema
+
+// LoadDraft4 loads the keywords for schema validation
+// based on draft4
+func LoadDraft4() {
+	r, release := getGlobalKeywordRegistry()
+	defer release()
+
+	r.LoadDraft4()
+}
+
+// LoadDraft4 loads the keywords for schema validation
+// based on draft4
+func (r *KeywordRegistry) LoadDraft4() {
+	r.LoadDraft2019_09()
+	r.applyDraft4()
+}
+
+// applyDraft4 turns a draft2019_09 keyword set
+// into a draft4 one
+func (r *KeywordRegistry) applyDraft4() {
+	r.applyDraft7()
+
+	// core keywords
+	// schemas are identified by id
+	r.removeKeyword("$id")
+	r.RegisterKeyword("id", NewID)
+	r.removeKeyword("$comment")
+	r.removeKeyword("examples")
+	r.removeKeyword("readOnly")
+	r.removeKeyword("writeOnly")
+
+	// standard keywords
+	r.removeKeyword("const")
+
+	// numeric keywords
+	// exclusiveMaximum and exclusiveMinimum are booleans
+	// modifying maximum and minimum
+	r.RegisterKeyword("exclusiveMaximum", NewExclusiveMaximumDraft4)
+	r.RegisterKeyword("exclusiveMinimum", NewExclusiveMinimumDraft4)
+
+	// object keywords
+	r.removeKeyword("propertyNames")
+
+	// array keywords
+	r.removeKeyword("contains")
+
+	// conditional keywords
+	r.removeKeyword("if")
+	r.removeKeyword("then")
+	r.removeKeyword("else")
+
+	// content keywords
+	r.removeKeyword("contentEncoding")
+	r.removeKeyword("contentMediaType")
+}
@@ -0,0 +1,46 @@
+package jsonschema
+
+// LoadDraft7 loads the keywords for schema validation
+// based on draft7
+func LoadDraft7() {
+	r, release := getGlobalKeywordRegistry()
+	defer release()
+
+	r.LoadDraft7()
+}
+
+// LoadDraft7 loads the keywords for schema validation
+// based on draft7
+func (r *KeywordRegistry) LoadDraft7() {
+	r.LoadDraft2019_09()
+	r.applyDraft7()
+}
+
+// applyDraft7 removes the keywords introduced after draft7
+// from a draft2019_09 keyword set
+func (r *KeywordRegistry) applyDraft7() {
+	// core keywords
+	// $ref replaces the keywords next to it,
+	// and subschemas are defined in definitions
+	r.RegisterKeyword("$ref", newSiblingIgnoringRef)
+	r.RegisterKeyword("definitions", NewDefs)
+	r.removeKeyword("$vocabulary")
+	r.removeKeyword("$anchor")
+	r.removeKeyword("$recursiveRef")
+	r.removeKeyword("$recursiveAnchor")
+	r.removeKeyword("$defs")
+	r.removeKeyword("deprecated")
+
+	// object keywords
+	r.removeKeyword("dependentSchemas")
+	r.removeKeyword("dependentRequired")
+	r.removeKeyword("unevaluatedProperties")
+
+	// array keywords
+	r.removeKeyword("maxContains")
+	r.removeKeyword("minContains")
+	r.removeKeyword("unevaluatedItems")
+
+	// content keywords
+	r.removeKeyword("contentSchema")
+}
@@ -0,0 +1,77 @@
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	jptr "github.com/qri-io/jsonpointer"
+)
+
+// DuplicateKeysError reports the objects of a JSON document that hold a
+// key more than once, which encoding/json silently decodes to the last value
+type DuplicateKeysError struct {
+	// Paths are the JSON pointers to the duplicated keys, in document order
+	Paths []string
+}
+
+// Error implements the error interface for DuplicateKeysError
+func (e *DuplicateKeysError) Error() string {
+	return fmt.Sprintf("duplicate object keys: %s", strings.Join(e.Paths, ", "))
+}
+
+// checkDuplicateKeys streams the tokens of a JSON document, returning a
+// *DuplicateKeysError if any of its objects repeats a key
+func checkDuplicateKeys(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	dups := []string{}
+	if err := scanDuplicateKeys(dec, jptr.Pointer{}, &dups); err != nil {
+		return err
+	}
+	if len(dups) > 0 {
+		return &DuplicateKeysError{Paths: dups}
+	}
+	return nil
+}
+
+// scanDuplicateKeys reads the next value from dec, adding the path of
+// every key repeated within one of its objects to dups
+func scanDuplicateKeys(dec *json.Decoder, path jptr.Pointer, dups *[]string) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	switch tok {
+	case json.Delim('{'):
+		seen := map[string]bool{}
+		for dec.More() {
+			keyTok, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			key := keyTok.(string)
+			keyPath := append(append(jptr.Pointer{}, path...), key)
+			if seen[key] {
+				*dups = append(*dups, keyPath.String())
+			}
+			seen[key] = true
+			if err := scanDuplicateKeys(dec, keyPath, dups); err != nil {
+				return err
+			}
+		}
+		_, err = dec.Token()
+		return err
+	case json.Delim('['):
+		for i := 0; dec.More(); i++ {
+			if err := scanDuplicateKeys(dec, append(append(jptr.Pointer{}, path...), strconv.Itoa(i)), dups); err != nil {
+				return err
+			}
+		}
+		_, err = dec.Token()
+		return err
+	}
+	return nil
+}
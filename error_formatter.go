@@ -0,0 +1,48 @@
+package jsonschema
+
+import "sync"
+
+// ErrorFormatter renders the message of a KeyError. It is called with the
+// name of the keyword that produced the error, and can use the invalid
+// value and limit recorded on the error to build a localized message
+type ErrorFormatter interface {
+	Format(keyword string, e *KeyError) string
+}
+
+// EnglishFormatter is the default ErrorFormatter, producing
+// the messages built by the keywords themselves
+type EnglishFormatter struct{}
+
+// Format implements the ErrorFormatter interface for EnglishFormatter
+func (EnglishFormatter) Format(keyword string, e *KeyError) string {
+	return e.Message
+}
+
+var (
+	errorFormatter     ErrorFormatter = EnglishFormatter{}
+	errorFormatterLock sync.RWMutex
+)
+
+// SetErrorFormatter sets the ErrorFormatter used for all schemas that don't
+// set their own. Passing nil restores the default EnglishFormatter
+func SetErrorFormatter(f ErrorFormatter) {
+	errorFormatterLock.Lock()
+	defer errorFormatterLock.Unlock()
+	if f == nil {
+		f = EnglishFormatter{}
+	}
+	errorFormatter = f
+}
+
+// getErrorFormatter returns the global ErrorFormatter
+func getErrorFormatter() ErrorFormatter {
+	errorFormatterLock.RLock()
+	defer errorFormatterLock.RUnlock()
+	return errorFormatter
+}
+
+// SetErrorFormatter sets the ErrorFormatter used when validating
+// against this schema, overriding the global formatter
+func (s *Schema) SetErrorFormatter(f ErrorFormatter) {
+	s.errorFormatter = f
+}
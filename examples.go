@@ -0,0 +1,70 @@
+package jsonschema
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+
+	jptr "github.com/qri-io/jsonpointer"
+)
+
+// ValidateExamples checks that the default, examples and example values of
+// the schema and each of its subschemas are valid against the subschema
+// that declares them, catching examples that drifted from the schema. The
+// PropertyPath and InstanceLocation of the errors point to the invalid
+// value within the schema, such as /properties/age/examples/1, and their
+// KeywordLocation to the keyword it fails from the root of the schema.
+// Checking stops with the errors found so far if the context is cancelled
+func (s *Schema) ValidateExamples(ctx context.Context) []KeyError {
+	ctx = backgroundIfNil(ctx)
+	errs := []KeyError{}
+	s.Walk(func(path jptr.Pointer, sch *Schema) error {
+		if sch.schemaType != schemaTypeObject {
+			return nil
+		}
+		for _, ex := range sch.exampleValues() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			currentState := NewValidationState(s)
+			instanceLocation := append(childPointer(path, ex.keyword), ex.tokens...)
+			relativeLocation := childPointer(path, ".")
+			baseRelativeLocation := childPointer(path, ".")
+			currentState.InstanceLocation = &instanceLocation
+			currentState.RelativeLocation = &relativeLocation
+			currentState.BaseRelativeLocation = &baseRelativeLocation
+			sch.ValidateKeyword(ctx, currentState, ex.value)
+			errs = append(errs, *currentState.Errs...)
+		}
+		return nil
+	})
+	return errs
+}
+
+// exampleValue is a value a schema gives as an example of its instances
+type exampleValue struct {
+	keyword string
+	tokens  []string
+	value   interface{}
+}
+
+// exampleValues returns the default, examples and example values of the
+// schema. example isn't a JSON Schema keyword, but is common in OpenAPI
+func (s *Schema) exampleValues() []exampleValue {
+	values := []exampleValue{}
+	if def, ok := s.keywords["default"].(*Default); ok {
+		values = append(values, exampleValue{keyword: "default", value: def.data})
+	}
+	if examples, ok := s.keywords["examples"].(*Examples); ok {
+		for i, ex := range *examples {
+			values = append(values, exampleValue{keyword: "examples", tokens: []string{strconv.Itoa(i)}, value: ex})
+		}
+	}
+	if raw, ok := s.extraDefinitions["example"]; ok {
+		var ex interface{}
+		if err := json.Unmarshal(raw, &ex); err == nil {
+			values = append(values, exampleValue{keyword: "example", value: ex})
+		}
+	}
+	return values
+}
@@ -3,7 +3,10 @@ module github.com/qri-io/jsonschema
 go 1.13
 
 require (
+	github.com/fxamacker/cbor/v2 v2.5.0
 	github.com/qri-io/jsonpointer v0.1.1
 	github.com/sergi/go-diff v1.0.0
 	github.com/stretchr/testify v1.3.0 // indirect
+	golang.org/x/net v0.0.0-20210405180319-a5a99cb37ef4
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,133 @@
+package jsonschema
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// stringLength returns the length of a string as counted by minLength and
+// maxLength: its number of code points, or its number of grapheme clusters
+// when the CountGraphemes option is set
+func (o *ValidationOptions) stringLength(str string) int {
+	if o != nil && o.CountGraphemes {
+		return graphemeCount(str)
+	}
+	return utf8.RuneCountInString(str)
+}
+
+// graphemeCount returns the number of user-perceived characters of a string.
+// It approximates the extended grapheme clusters of Unicode Standard Annex #29
+// using the tables of the unicode package, without the full segmentation
+// property data: combining marks, variation selectors, emoji modifiers and
+// tag characters extend the character before them, a zero width joiner joins
+// the pictographs around it, regional indicators pair up into flags, Hangul
+// jamo compose into syllables and CR LF counts as a single character
+func graphemeCount(str string) int {
+	count := 0
+	prev := rune(-1)
+	// regionalIndicators counts the consecutive regional indicators before r
+	regionalIndicators := 0
+	for _, r := range str {
+		if prev < 0 || graphemeBreak(prev, r, regionalIndicators) {
+			count++
+		}
+		if isRegionalIndicator(r) {
+			regionalIndicators++
+		} else {
+			regionalIndicators = 0
+		}
+		prev = r
+	}
+	return count
+}
+
+// graphemeBreak checks if a grapheme cluster boundary falls between
+// two code points, given the number of regional indicators before r
+func graphemeBreak(prev, r rune, regionalIndicators int) bool {
+	switch {
+	case prev == '\r' && r == '\n':
+		return false
+	case isGraphemeControl(prev) || isGraphemeControl(r):
+		return true
+	case !hangulBreak(prev, r):
+		return false
+	case isGraphemeExtend(r):
+		return false
+	case prev == '\u200d' && isPictographic(r):
+		return false
+	case isRegionalIndicator(prev) && isRegionalIndicator(r):
+		// flags are pairs of regional indicators
+		return regionalIndicators%2 == 0
+	}
+	return true
+}
+
+// isGraphemeControl checks if a code point always stands on its own
+func isGraphemeControl(r rune) bool {
+	return r == '\r' || r == '\n' || unicode.Is(unicode.Cc, r) || unicode.Is(unicode.Zl, r) || unicode.Is(unicode.Zp, r)
+}
+
+// isGraphemeExtend checks if a code point extends the character before it
+func isGraphemeExtend(r rune) bool {
+	return unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc) ||
+		r == '\u200d' ||
+		// emoji skin tone modifiers
+		r >= 0x1f3fb && r <= 0x1f3ff ||
+		// tag characters of emoji tag sequences
+		r >= 0xe0020 && r <= 0xe007f
+}
+
+// isPictographic approximates the Extended_Pictographic property
+// with the symbols and emoji blocks
+func isPictographic(r rune) bool {
+	return unicode.Is(unicode.So, r) || r >= 0x1f000 && r <= 0x1faff
+}
+
+// isRegionalIndicator checks if a code point is one of the
+// regional indicator symbols flags are made of
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1f1e6 && r <= 0x1f1ff
+}
+
+// hangulBreak checks if a cluster boundary falls between two Hangul code
+// points, which compose into syllables from leading consonants (L), vowels
+// (V) and trailing consonants (T). Code points other than Hangul always break
+func hangulBreak(prev, r rune) bool {
+	p, c := hangulType(prev), hangulType(r)
+	switch p {
+	case hangulL:
+		return !(c == hangulL || c == hangulV || c == hangulLV || c == hangulLVT)
+	case hangulLV, hangulV:
+		return !(c == hangulV || c == hangulT)
+	case hangulLVT, hangulT:
+		return c != hangulT
+	}
+	return true
+}
+
+const (
+	hangulNone = iota
+	hangulL
+	hangulV
+	hangulT
+	hangulLV
+	hangulLVT
+)
+
+// hangulType returns the Hangul syllable type of a code point
+func hangulType(r rune) int {
+	switch {
+	case r >= 0x1100 && r <= 0x115f, r >= 0xa960 && r <= 0xa97c:
+		return hangulL
+	case r >= 0x1160 && r <= 0x11a7, r >= 0xd7b0 && r <= 0xd7c6:
+		return hangulV
+	case r >= 0x11a8 && r <= 0x11ff, r >= 0xd7cb && r <= 0xd7fb:
+		return hangulT
+	case r >= 0xac00 && r <= 0xd7a3:
+		if (r-0xac00)%28 == 0 {
+			return hangulLV
+		}
+		return hangulLVT
+	}
+	return hangulNone
+}
@@ -0,0 +1,48 @@
+// Package idn registers format checkers for internationalized domain names
+// with the jsonschema package. It is kept apart from jsonschema so programs
+// that don't need them don't link the IDNA tables of golang.org/x/net/idna
+package idn
+
+import (
+	"fmt"
+
+	"github.com/qri-io/jsonschema"
+	"golang.org/x/net/idna"
+)
+
+// registration checks labels the way registries do, rejecting names that
+// would only be valid once mapped, such as names with uppercase letters
+var registration = idna.New(
+	idna.ValidateForRegistration(),
+	idna.VerifyDNSLength(true),
+	idna.BidiRule(),
+)
+
+// RegisterIDNFormats replaces the idn-hostname checker of
+// jsonschema.FormatCheckers, which only rejects a list of disallowed
+// characters, with one validating the IDNA 2008 rules of RFC 5891 and
+// checking the name round-trips through Punycode. Like the other format
+// checkers it only applies when jsonschema.AssertFormat is set, and it
+// must not be called while validation is running
+func RegisterIDNFormats() {
+	jsonschema.FormatCheckers["idn-hostname"] = IsValidHostname
+}
+
+// IsValidHostname checks that a hostname is a valid internationalized
+// domain name according to RFC 5890, section 2.3.2.3, whose labels convert
+// to A-labels and back without change
+// https://tools.ietf.org/html/rfc5890#section-2.3.2.3
+func IsValidHostname(hostname string) error {
+	ascii, err := registration.ToASCII(hostname)
+	if err != nil {
+		return fmt.Errorf("invalid idn hostname: %s", err.Error())
+	}
+	unicode, err := registration.ToUnicode(ascii)
+	if err != nil {
+		return fmt.Errorf("invalid idn hostname: %s", err.Error())
+	}
+	if again, err := registration.ToASCII(unicode); err != nil || again != ascii {
+		return fmt.Errorf("invalid idn hostname: %q doesn't round-trip through punycode", hostname)
+	}
+	return nil
+}
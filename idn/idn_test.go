@@ -0,0 +1,57 @@
+package idn
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/qri-io/jsonschema"
+)
+
+func TestIsValidHostname(t *testing.T) {
+	cases := []struct {
+		hostname string
+		valid    bool
+	}{
+		{"실례.테스트", true},
+		{"bücher.example", true},
+		{"xn--bcher-kva.example", true},
+		{"example.com", true},
+		{"example.com.", true},
+		{"〮실례.테스트", false},
+		{strings.Repeat("a", 64) + ".example", false},
+		{"실실실실실실실실실실실실실실실실실실실실실실실실실실실실실실실실실실실실실실실실실실실실실실실실실실실실례례테스트례례례례례례례례례례례례례례례례례테스트례례례례례례례례례례례례례례례례례례례테스트례례례례례례례례례례례례테스트례례실례.테스트", false},
+		{strings.Repeat("a.", 127) + "example", false},
+		{"Bücher.example", false},
+		{"xn--bcher-kvb.example", false},
+		{"a..b", false},
+		{"-bücher.example", false},
+		{"", false},
+	}
+	for _, c := range cases {
+		if err := IsValidHostname(c.hostname); (err == nil) != c.valid {
+			t.Errorf("%q: expected valid: %t, got error: %v", c.hostname, c.valid, err)
+		}
+	}
+}
+
+func TestRegisterIDNFormats(t *testing.T) {
+	check := jsonschema.FormatCheckers["idn-hostname"]
+	assert := jsonschema.AssertFormat
+	defer func() {
+		jsonschema.FormatCheckers["idn-hostname"] = check
+		jsonschema.AssertFormat = assert
+	}()
+	jsonschema.AssertFormat = true
+	RegisterIDNFormats()
+
+	rs := jsonschema.Must(`{ "format": "idn-hostname" }`)
+	ctx := context.Background()
+	if errs, _ := rs.ValidateBytes(ctx, []byte(`"bücher.example"`)); len(errs) != 0 {
+		t.Errorf("expected a valid idn hostname, got: %v", errs)
+	}
+	// the default checker accepts a name with a nonexistent A-label
+	if errs, _ := rs.ValidateBytes(ctx, []byte(`"xn--bcher-kvb.example"`)); len(errs) != 1 {
+		t.Errorf("expected 1 error for an invalid A-label, got: %v", errs)
+	}
+}
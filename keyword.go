@@ -11,18 +11,8 @@ import (
 )
 
 var notSupported = map[string]bool{
-	// core
-	"$vocabulary": true,
-
-	// other
-	"contentEncoding":  true,
-	"contentMediaType": true,
-	"contentSchema":    true,
-	"deprecated":       true,
-
 	// backward compatibility with draft7
-	"definitions":  true,
-	"dependencies": true,
+	"definitions": true,
 }
 
 var kr *KeywordRegistry
@@ -34,16 +24,24 @@ type KeywordRegistry struct {
 	keywordRegistry    map[string]KeyMaker
 	keywordOrder       map[string]int
 	keywordInsertOrder map[string]int
+	// insertCount is the insert index of the next new keyword
+	insertCount int
+}
+
+// NewKeywordRegistry allocates an empty KeywordRegistry, to be populated
+// with a draft keyword set and custom keywords and used with ParseSchema
+func NewKeywordRegistry() *KeywordRegistry {
+	return &KeywordRegistry{
+		keywordRegistry:    make(map[string]KeyMaker, 0),
+		keywordOrder:       make(map[string]int, 0),
+		keywordInsertOrder: make(map[string]int, 0),
+	}
 }
 
 func getGlobalKeywordRegistry() (*KeywordRegistry, func()) {
 	krLock.Lock()
 	if kr == nil {
-		kr = &KeywordRegistry{
-			keywordRegistry:    make(map[string]KeyMaker, 0),
-			keywordOrder:       make(map[string]int, 0),
-			keywordInsertOrder: make(map[string]int, 0),
-		}
+		kr = NewKeywordRegistry()
 	}
 	return kr, func() { krLock.Unlock() }
 }
@@ -60,6 +58,7 @@ func (r *KeywordRegistry) Copy() *KeywordRegistry {
 		keywordRegistry:    make(map[string]KeyMaker, len(r.keywordRegistry)),
 		keywordOrder:       make(map[string]int, len(r.keywordOrder)),
 		keywordInsertOrder: make(map[string]int, len(r.keywordInsertOrder)),
+		insertCount:        r.insertCount,
 	}
 
 	for k, v := range r.keywordRegistry {
@@ -138,7 +137,36 @@ func (r *KeywordRegistry) IsRegistryLoaded() bool {
 // RegisterKeyword registers a keyword with the registry
 func (r *KeywordRegistry) RegisterKeyword(prop string, maker KeyMaker) {
 	r.keywordRegistry[prop] = maker
-	r.keywordInsertOrder[prop] = len(r.keywordInsertOrder)
+	// keywords keep the position they were first registered at, so
+	// switching drafts doesn't change the order schemas are marshaled in
+	if _, ok := r.keywordInsertOrder[prop]; !ok {
+		r.keywordInsertOrder[prop] = r.insertCount
+		r.insertCount++
+	}
+}
+
+// RegisterKeywordE registers a keyword with the registry, returning an
+// error instead of replacing a keyword that is already registered
+func (r *KeywordRegistry) RegisterKeywordE(prop string, maker KeyMaker) error {
+	if r.IsRegisteredKeyword(prop) {
+		return fmt.Errorf("keyword %q is already registered", prop)
+	}
+	r.RegisterKeyword(prop, maker)
+	return nil
+}
+
+// UnregisterKeyword removes a keyword from the registry, forgetting its
+// order. It is meant for tearing down custom keywords in tests and
+// when reloading plugins
+func (r *KeywordRegistry) UnregisterKeyword(prop string) {
+	r.removeKeyword(prop)
+	delete(r.keywordInsertOrder, prop)
+}
+
+// removeKeyword removes a keyword from the registry
+func (r *KeywordRegistry) removeKeyword(prop string) {
+	delete(r.keywordRegistry, prop)
+	delete(r.keywordOrder, prop)
 }
 
 // RegisterKeyword registers a keyword with the registry
@@ -149,9 +177,30 @@ func RegisterKeyword(prop string, maker KeyMaker) {
 	r.RegisterKeyword(prop, maker)
 }
 
+// UnregisterKeyword removes a keyword from the global registry. It is
+// meant for tearing down custom keywords in tests and when reloading plugins
+func UnregisterKeyword(prop string) {
+	r, release := getGlobalKeywordRegistry()
+	defer release()
+
+	r.UnregisterKeyword(prop)
+}
+
+// RegisterKeywordE registers a keyword with the global registry, returning
+// an error if the keyword is already registered. The default keywords are
+// loaded first, so collisions with them are reported too
+func RegisterKeywordE(prop string, maker KeyMaker) error {
+	r, release := getGlobalKeywordRegistry()
+	defer release()
+
+	r.DefaultIfEmpty()
+	return r.RegisterKeywordE(prop, maker)
+}
+
 // MaxKeywordErrStringLen sets how long a value can be before it's length is truncated
 // when printing error strings
-// a special value of -1 disables output trimming
+// a special value of -1 disables output trimming.
+// ValidationOptions can override it for a validation run
 var MaxKeywordErrStringLen = 20
 
 // Keyword is an interface for anything that can validate.
@@ -179,6 +228,33 @@ type Keyword interface {
 	Resolve(pointer jptr.Pointer, uri string) *Schema
 }
 
+// KeywordE is a Keyword that returns its validation errors instead of adding
+// them to the ValidationState. Schemas call Validate in place of ValidateKeyword
+// for keywords implementing it. Returned errors without a PropertyPath are
+// located at the instance and keyword being evaluated
+type KeywordE interface {
+	Keyword
+	// Validate checks decoded JSON data, returning the validation errors
+	Validate(ctx context.Context, currentState *ValidationState, data interface{}) []KeyError
+}
+
+// BaseKeyword provides no-op implementations of the Keyword interface.
+// Terminal keywords that don't wrap a schema can embed it and only implement
+// ValidateKeyword, or Validate of the KeywordE interface
+type BaseKeyword struct{}
+
+// ValidateKeyword implements the Keyword interface for BaseKeyword
+func (BaseKeyword) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
+}
+
+// Register implements the Keyword interface for BaseKeyword
+func (BaseKeyword) Register(uri string, registry *SchemaRegistry) {}
+
+// Resolve implements the Keyword interface for BaseKeyword
+func (BaseKeyword) Resolve(pointer jptr.Pointer, uri string) *Schema {
+	return nil
+}
+
 // SchemaKeyword is a kind of Keyword which exposes a GetSchema method for returning the underlying Schema. This should
 // be implemented by other keywords whose value is a Schema (i.e. via a type definition like `type Not Schema`).
 type SchemaKeyword interface {
@@ -197,31 +273,165 @@ type KeyError struct {
 	// PropertyPath is a string path that leads to the
 	// property that produced the error
 	PropertyPath string `json:"propertyPath,omitempty"`
+	// InstanceLocation is the RFC 6901 JSON pointer to the property that
+	// produced the error, with the instance root as the empty pointer
+	InstanceLocation string `json:"instanceLocation"`
 	// InvalidValue is the value that returned the error
 	InvalidValue interface{} `json:"invalidValue,omitempty"`
 	// Message is a human-readable description of the error
 	Message string `json:"message"`
+	// KeywordLocation is a JSON pointer to the keyword that produced the
+	// error, following the path taken through the schema including references
+	KeywordLocation string `json:"keywordLocation,omitempty"`
+	// Limit is the value the keyword checked the instance against,
+	// set by keywords such as minimum or maxLength
+	Limit interface{} `json:"limit,omitempty"`
+	// AbsoluteKeywordLocation is the absolute URI of the keyword that
+	// produced the error, set when the schema resource has a base URI
+	AbsoluteKeywordLocation string `json:"absoluteKeywordLocation,omitempty"`
+	// Keyword is the keyword that produced the error
+	Keyword string `json:"keyword,omitempty"`
+	// maxValueLen is the length InvalidValue is truncated at when printed,
+	// zero for MaxKeywordErrStringLen
+	maxValueLen int
 }
 
 // Error implements the error interface for KeyError
 func (v KeyError) Error() string {
 	if v.PropertyPath != "" && v.InvalidValue != nil {
-		return fmt.Sprintf("%s: %s %s", v.PropertyPath, InvalidValueString(v.InvalidValue), v.Message)
+		return fmt.Sprintf("%s: %s %s", v.PropertyPath, InvalidValueStringN(v.InvalidValue, v.valueLen()), v.Message)
 	} else if v.PropertyPath != "" {
 		return fmt.Sprintf("%s: %s", v.PropertyPath, v.Message)
 	}
 	return v.Message
 }
 
-// InvalidValueString returns the errored value as a string
+// ValidationError is an error aggregating the KeyErrors of a failed validation
+type ValidationError struct {
+	errs []KeyError
+}
+
+// Error implements the error interface for ValidationError, summarizing
+// the errors with the first of them
+func (e *ValidationError) Error() string {
+	switch len(e.errs) {
+	case 0:
+		return "validation failed"
+	case 1:
+		return e.errs[0].Error()
+	default:
+		return fmt.Sprintf("%s (and %d more errors)", e.errs[0].Error(), len(e.errs)-1)
+	}
+}
+
+// Errors returns the KeyErrors of the validation
+func (e *ValidationError) Errors() []KeyError {
+	return e.errs
+}
+
+// Unwrap returns the KeyErrors of the validation as errors, so errors.Is
+// and errors.As inspect each of them
+func (e *ValidationError) Unwrap() []error {
+	errs := make([]error, len(e.errs))
+	for i, err := range e.errs {
+		errs[i] = err
+	}
+	return errs
+}
+
+// valueLen returns the length the invalid value is truncated at when printed
+func (v KeyError) valueLen() int {
+	if v.maxValueLen == 0 {
+		return MaxKeywordErrStringLen
+	}
+	return v.maxValueLen
+}
+
+// Is reports whether target is the KeywordError of the keyword that produced
+// the error, so errors.Is(err, ErrRequired) checks for a failed required keyword
+func (v KeyError) Is(target error) bool {
+	kw, ok := target.(KeywordError)
+	return ok && v.Keyword != "" && string(kw) == v.Keyword
+}
+
+// KeywordError is a sentinel error standing for the errors produced by a
+// keyword, to compare KeyErrors against with errors.Is. Sentinels for custom
+// keywords are declared by converting the keyword name
+type KeywordError string
+
+// Error implements the error interface for KeywordError
+func (e KeywordError) Error() string {
+	return fmt.Sprintf("%s keyword validation failed", string(e))
+}
+
+// Sentinel errors of the standard keywords
+var (
+	ErrType                  = KeywordError("type")
+	ErrEnum                  = KeywordError("enum")
+	ErrConst                 = KeywordError("const")
+	ErrRequired              = KeywordError("required")
+	ErrDependentRequired     = KeywordError("dependentRequired")
+	ErrMultipleOf            = KeywordError("multipleOf")
+	ErrMinimum               = KeywordError("minimum")
+	ErrMaximum               = KeywordError("maximum")
+	ErrExclusiveMinimum      = KeywordError("exclusiveMinimum")
+	ErrExclusiveMaximum      = KeywordError("exclusiveMaximum")
+	ErrMinLength             = KeywordError("minLength")
+	ErrMaxLength             = KeywordError("maxLength")
+	ErrPattern               = KeywordError("pattern")
+	ErrFormat                = KeywordError("format")
+	ErrMinItems              = KeywordError("minItems")
+	ErrMaxItems              = KeywordError("maxItems")
+	ErrUniqueItems           = KeywordError("uniqueItems")
+	ErrContains              = KeywordError("contains")
+	ErrMinContains           = KeywordError("minContains")
+	ErrMaxContains           = KeywordError("maxContains")
+	ErrMinProperties         = KeywordError("minProperties")
+	ErrMaxProperties         = KeywordError("maxProperties")
+	ErrAdditionalProperties  = KeywordError("additionalProperties")
+	ErrAdditionalItems       = KeywordError("additionalItems")
+	ErrUnevaluatedProperties = KeywordError("unevaluatedProperties")
+	ErrUnevaluatedItems      = KeywordError("unevaluatedItems")
+	ErrPropertyNames         = KeywordError("propertyNames")
+	ErrAllOf                 = KeywordError("allOf")
+	ErrAnyOf                 = KeywordError("anyOf")
+	ErrOneOf                 = KeywordError("oneOf")
+	ErrNot                   = KeywordError("not")
+)
+
+// Annotation represents a single piece of information collected
+// about an instance while it is validated against a schema
+type Annotation struct {
+	// PropertyPath is a string path that leads to the
+	// property that produced the annotation
+	PropertyPath string `json:"propertyPath,omitempty"`
+	// Keyword is the keyword that produced the annotation
+	Keyword string `json:"keyword"`
+	// KeywordLocation is a JSON pointer to the keyword that produced the
+	// annotation, following the path taken through the schema
+	KeywordLocation string `json:"keywordLocation,omitempty"`
+	// Value is the annotation value
+	Value interface{} `json:"value,omitempty"`
+	// Message is a human-readable description of the annotation
+	Message string `json:"message,omitempty"`
+}
+
+// InvalidValueString returns the errored value as a string,
+// truncated at MaxKeywordErrStringLen
 func InvalidValueString(data interface{}) string {
+	return InvalidValueStringN(data, MaxKeywordErrStringLen)
+}
+
+// InvalidValueStringN returns the errored value as a string, truncated
+// at max bytes. A max of -1 disables output trimming
+func InvalidValueStringN(data interface{}, max int) string {
 	bt, err := json.Marshal(data)
 	if err != nil {
 		return ""
 	}
 	bt = bytes.Replace(bt, []byte{'\n', '\r'}, []byte{' '}, -1)
-	if MaxKeywordErrStringLen != -1 && len(bt) > MaxKeywordErrStringLen {
-		bt = append(bt[:MaxKeywordErrStringLen], []byte("...")...)
+	if max != -1 && len(bt) > max {
+		bt = append(bt[:max], []byte("...")...)
 	}
 	return string(bt)
 }
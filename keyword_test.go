@@ -4,7 +4,13 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
 	"testing"
 
 	"github.com/qri-io/jsonpointer"
@@ -43,6 +49,1287 @@ func TestErrorMessage(t *testing.T) {
 	}
 }
 
+func TestFormatCheckers(t *testing.T) {
+	cases := []struct {
+		format, value string
+		valid         bool
+	}{
+		{"email", "joe.bloggs@example.com", true},
+		{"email", "te~st@example.com", true},
+		{"email", `"joe bloggs"@example.com`, true},
+		{"email", `"joe\"bloggs"@example.com`, true},
+		{"email", "joe@[127.0.0.1]", true},
+		{"email", "joe@[IPv6:::1]", true},
+		{"email", "Joe Bloggs <joe@example.com>", false},
+		{"email", "joe..bloggs@example.com", false},
+		{"email", ".joe@example.com", false},
+		{"email", "joe@", false},
+		{"email", "@example.com", false},
+		{"email", "joe@exa_mple.com", false},
+		{"email", "jöe@example.com", false},
+		{"email", "joe@[300.0.0.1]", false},
+		{"idn-email", "jöe@example.com", true},
+		{"idn-email", "실례@실례.테스트", true},
+		{"idn-email", "2962", false},
+		{"idn-email", "jöe..bloggs@example.com", false},
+		{"date", "2021-02-28", true},
+		{"date", "2020-02-29", true},
+		{"date", "2021-02-29", false},
+		{"date", "2021-13-99", false},
+		{"date", "2021-1-01", false},
+		{"duration", "P3DT4H", true},
+		{"duration", "PT0S", true},
+		{"duration", "P1Y2M3DT4H5M6S", true},
+		{"duration", "P1Y6D", true},
+		{"duration", "PT36H", true},
+		{"duration", "PT1H30S", true},
+		{"duration", "P1W", true},
+		{"duration", "P", false},
+		{"duration", "PT", false},
+		{"duration", "P1DT", false},
+		{"duration", "P1", false},
+		{"duration", "3D", false},
+		{"duration", "P2D1Y", false},
+		{"duration", "P1D2H", false},
+		{"duration", "PT1D", false},
+		{"duration", "P1.5D", false},
+		{"duration", "P1Y1D1D", false},
+		{"duration", "PW", false},
+		{"duration", "P1Y2W", false},
+		{"duration", "P1WT1H", false},
+		{"duration", "P١D", false},
+		{"time", "08:30:06.283185Z", true},
+		{"time", "08:30:06+02:00", true},
+		{"time", "23:59:60Z", true},
+		{"time", "15:59:60-08:00", true},
+		{"time", "22:59:60Z", false},
+		{"time", "23:59:61Z", false},
+		{"time", "24:00:00Z", false},
+		{"time", "08:30:06", false},
+		{"date-time", "1963-06-19t08:30:06.283185z", true},
+		{"date-time", "1998-12-31T23:59:60Z", true},
+		{"date-time", "1998-12-31T23:58:60Z", false},
+		{"date-time", "2021-13-99T08:30:06Z", false},
+		{"date-time", "1963-06-19 08:30:06Z", false},
+		{"uri", "https://example.com/a?b=c#d", true},
+		{"uri", "urn:isbn:0451450523", true},
+		{"uri", "../foo", false},
+		{"uri", "//example.com/a", false},
+		{"uri", "https://ƒøø.com/", false},
+		{"uri", "https://example.com/a b", false},
+		{"uri-reference", "../foo", true},
+		{"uri-reference", "#fragment", true},
+		{"uri-reference", "", true},
+		{"uri-reference", "#frag\\ment", false},
+		{"uri-reference", "/%zz", false},
+		{"iri", "https://ƒøø.ßår/?∂éœ=πîx", true},
+		{"iri", "https://[2001:db8::7]/", true},
+		{"iri", "https://2001:db8::7/", false},
+		{"iri", "../âππ", false},
+		{"iri-reference", "../âππ", true},
+		{"ipv4", "192.168.0.1", true},
+		{"ipv4", "0.0.0.0", true},
+		{"ipv4", "087.10.0.1", false},
+		{"ipv4", "192.168.0.01", false},
+		{"ipv4", "256.0.0.1", false},
+		{"ipv4", "192.168.0", false},
+		{"ipv4", "::1", false},
+		{"ipv4", "::ffff:192.168.0.1", false},
+		{"ipv6", "::1", true},
+		{"ipv6", "2001:db8::7", true},
+		{"ipv6", "::ffff:192.168.0.1", true},
+		{"ipv6", "192.168.0.1", false},
+		{"ipv6", "12345::", false},
+		{"ipv6", "fe80::1%eth0", false},
+		{"hostname", "www.example.com", true},
+		{"hostname", "xn--4gbwdl.xn--wgbh1c", true},
+		{"hostname", "localhost", true},
+		{"hostname", "www.example.com.", false},
+		{"hostname", "-a.example.com", false},
+		{"hostname", "a-.example.com", false},
+		{"hostname", "a..example.com", false},
+		{"hostname", "not_a_valid_host_name", false},
+		{"hostname", strings.Repeat("a", 64) + ".com", false},
+		{"regex", "^[a-z]+(\\d{2,3})?$", true},
+		{"regex", "(?i)abc", true},
+		{"regex", "^[a-z", false},
+		{"regex", "(?=a)b", false},
+		{"regex", "(a)\\1", false},
+		{"json-pointer", "", true},
+		{"json-pointer", "/", true},
+		{"json-pointer", "/foo/bar~0/baz~1/%a", true},
+		{"json-pointer", "/foo//bar", true},
+		{"json-pointer", "#/foo", false},
+		{"json-pointer", "foo", false},
+		{"json-pointer", "/foo~", false},
+		{"json-pointer", "/foo~2", false},
+		{"relative-json-pointer", "0", true},
+		{"relative-json-pointer", "0#", true},
+		{"relative-json-pointer", "1/foo/bar", true},
+		{"relative-json-pointer", "10/0", true},
+		{"relative-json-pointer", "", false},
+		{"relative-json-pointer", "#", false},
+		{"relative-json-pointer", "-1/foo", false},
+		{"relative-json-pointer", "01/foo", false},
+		{"relative-json-pointer", "0##", false},
+		{"relative-json-pointer", "0foo", false},
+		{"relative-json-pointer", "1/foo~", false},
+		{"uuid", "2eb8aa08-aa98-11ea-b4aa-73b441d16380", true},
+		{"uuid", "2EB8AA08-AA98-11EA-B4AA-73B441D16380", true},
+		{"uuid", "00000000-0000-0000-0000-000000000000", true},
+		{"uuid", "2eb8aa08-aa98-11ea-b4aa-73b441d1638", false},
+		{"uuid", "{2eb8aa08-aa98-11ea-b4aa-73b441d16380}", false},
+		{"uuid", "urn:uuid:2eb8aa08-aa98-11ea-b4aa-73b441d16380", false},
+		{"uuid", "2eb8aa08aa9811eab4aa73b441d16380", false},
+		{"uuid", "2eb8aa08-aa98-11ea-b4aa-73b441d1638g", false},
+	}
+
+	for i, c := range cases {
+		err := FormatCheckers[c.format](c.value)
+		if c.valid && err != nil {
+			t.Errorf("case %d: expected %q to be a valid %s, got error: %s", i, c.value, c.format, err)
+		} else if !c.valid && err == nil {
+			t.Errorf("case %d: expected %q to be an invalid %s", i, c.value, c.format)
+		}
+	}
+}
+
+func TestStringLength(t *testing.T) {
+	cases := []struct {
+		str                   string
+		codePoints, graphemes int
+	}{
+		{"", 0, 0},
+		{"abc", 3, 3},
+		{"héllo", 5, 5},
+		// e followed by a combining acute accent
+		{"he\u0301llo", 6, 5},
+		{"日本語", 3, 3},
+		// flags are pairs of regional indicators
+		{"\U0001F1F3\U0001F1F1", 2, 1},
+		{"\U0001F1F3\U0001F1F1\U0001F1E7", 3, 2},
+		// thumbs up with a skin tone modifier
+		{"\U0001F44D\U0001F3FD", 2, 1},
+		// family joined by zero width joiners
+		{"\U0001F468\u200d\U0001F469\u200d\U0001F467", 5, 1},
+		// heart with an emoji variation selector
+		{"\u2764\ufe0f", 2, 1},
+		// hangul syllable from conjoining jamo
+		{"\u1100\u1161\u11a8", 3, 1},
+		{"a\r\nb", 4, 3},
+	}
+	graphemes := &ValidationOptions{CountGraphemes: true}
+	for i, c := range cases {
+		if got := (*ValidationOptions)(nil).stringLength(c.str); got != c.codePoints {
+			t.Errorf("case %d: expected %d code points, got: %d", i, c.codePoints, got)
+		}
+		if got := graphemes.stringLength(c.str); got != c.graphemes {
+			t.Errorf("case %d: expected %d grapheme clusters, got: %d", i, c.graphemes, got)
+		}
+	}
+
+	ctx := context.Background()
+	rs := Must(`{"maxLength": 1, "minLength": 1}`)
+	flag := "\U0001F1F3\U0001F1F1"
+	if state := rs.Validate(ctx, flag); len(*state.Errs) != 1 {
+		t.Errorf("expected maxLength to count code points by default, got: %v", *state.Errs)
+	}
+	if state := rs.ValidateWithOptions(ctx, flag, graphemes); len(*state.Errs) != 0 {
+		t.Errorf("expected maxLength to count grapheme clusters, got: %v", *state.Errs)
+	}
+	if state := rs.ValidateWithOptions(ctx, "", graphemes); len(*state.Errs) != 1 {
+		t.Errorf("expected minLength to count grapheme clusters, got: %v", *state.Errs)
+	}
+}
+
+func TestPatternSemantics(t *testing.T) {
+	cases := []struct {
+		pattern, str string
+		match        bool
+	}{
+		// patterns aren't implicitly anchored
+		{"b", "abc", true},
+		{"^b", "abc", false},
+		{"a.c", "abc", true},
+		{"a.c", "a\nc", false},
+		{"a.c", "a\rc", false},
+		{"a.c", "a\u2028c", false},
+		{"a[.]c", "a.c", true},
+		{"a\\.c", "a.c", true},
+		{"^abc$", "abc\n", false},
+		{"^\\cC$", "\u0003", true},
+		{"^\\u0041$", "A", true},
+		{"^\\0$", "\u0000", true},
+		{"^[^]$", "\n", true},
+		{"[]", "a", false},
+		{"^\\s$", "\t", true},
+		{"^\\s$", "\u00a0", false},
+	}
+	ctx := context.Background()
+	for i, c := range cases {
+		rs := &Schema{}
+		if err := json.Unmarshal([]byte(fmt.Sprintf(`{"pattern": %q}`, c.pattern)), rs); err != nil {
+			t.Fatalf("case %d: unexpected error: %s", i, err)
+		}
+		if got := rs.IsValid(ctx, c.str); got != c.match {
+			t.Errorf("case %d: expected %q matching %q to be %t", i, c.pattern, c.str, c.match)
+		}
+	}
+
+	rs := Must(`{"pattern": "^a.c$"}`)
+	data, err := json.Marshal(rs)
+	if err != nil {
+		t.Fatalf("unexpected marshal error: %s", err)
+	}
+	if string(data) != `{"pattern":"^a.c$"}` {
+		t.Errorf("expected the pattern source to be marshaled, got: %s", data)
+	}
+	state := rs.Validate(ctx, "abd")
+	if len(*state.Errs) != 1 || (*state.Errs)[0].Message != "regexp pattern ^a.c$ mismatch on string: abd" {
+		t.Errorf("expected a mismatch error showing the pattern source, got: %v", *state.Errs)
+	}
+
+	// a pattern changed after parsing is shown as its Go expression
+	*rs.Keyword("pattern").(*Pattern) = Pattern(*regexp.MustCompile("^x$"))
+	state = rs.Validate(ctx, "abc")
+	if len(*state.Errs) != 1 || (*state.Errs)[0].Message != "regexp pattern ^x$ mismatch on string: abc" {
+		t.Errorf("expected a mismatch error showing the changed pattern, got: %v", *state.Errs)
+	}
+	if data, err := json.Marshal(rs); err != nil || string(data) != `{"pattern":"^x$"}` {
+		t.Errorf("expected the changed pattern to be marshaled, got: %s, %v", data, err)
+	}
+	if !(&Pattern{}).validScalar("a") {
+		t.Errorf("expected an unparsed pattern to match any string")
+	}
+}
+
+func TestECMARegexCompat(t *testing.T) {
+	cases := []struct {
+		regex, message string
+	}{
+		{"^a(?=b)", "regex lookaround assertions are not supported"},
+		{"(?<!a)b", "regex lookaround assertions are not supported"},
+		{"(a)\\1", "regex backreferences are not supported"},
+		{"(?<x>a)\\k<x>", "regex backreferences are not supported"},
+		{"[a", "invalid regex expression: error parsing regexp: missing closing ]: `[a`"},
+	}
+
+	ECMARegexCompat = true
+	defer func() { ECMARegexCompat = false }()
+	for i, c := range cases {
+		err := isValidRegex(c.regex)
+		if err == nil {
+			t.Errorf("case %d: expected %q to be invalid", i, c.regex)
+		} else if err.Error() != c.message {
+			t.Errorf("case %d: expected message %q, got %q", i, c.message, err.Error())
+		}
+	}
+	if err := isValidRegex(`\d+\(?=x`); err != nil {
+		t.Errorf("expected escaped parentheses to be accepted, got: %s", err)
+	}
+}
+
+func TestInvalidPattern(t *testing.T) {
+	cases := []struct {
+		schema, message string
+	}{
+		{`{ "pattern": "[a" }`, "error unmarshaling pattern from json: invalid pattern: [a: error parsing regexp: missing closing ]: `[a`"},
+		{`{ "patternProperties": { "[a": {} } }`, "error unmarshaling patternProperties from json: invalid pattern: [a: error parsing regexp: missing closing ]: `[a`"},
+	}
+
+	for i, c := range cases {
+		rs := &Schema{}
+		err := json.Unmarshal([]byte(c.schema), rs)
+		if err == nil {
+			t.Errorf("case %d: expected an error unmarshaling %s", i, c.schema)
+		} else if err.Error() != c.message {
+			t.Errorf("case %d: expected message %q, got %q", i, c.message, err.Error())
+		}
+	}
+}
+
+func TestAssertFormat(t *testing.T) {
+	ctx := context.Background()
+	rs := Must(`{ "format": "email" }`)
+
+	if errs, _ := rs.ValidateBytes(ctx, []byte(`"not an email"`)); len(errs) != 0 {
+		t.Errorf("expected format to be an annotation by default, got: %v", errs)
+	}
+
+	AssertFormat = true
+	defer func() { AssertFormat = false }()
+	if errs, _ := rs.ValidateBytes(ctx, []byte(`"not an email"`)); len(errs) != 1 {
+		t.Errorf("expected a single error when asserting formats, got: %v", errs)
+	}
+
+	check := FormatCheckers["email"]
+	defer func() { FormatCheckers["email"] = check }()
+	FormatCheckers["email"] = func(str string) error {
+		if !strings.HasSuffix(str, "@example.com") {
+			return fmt.Errorf("only example.com addresses are allowed")
+		}
+		return check(str)
+	}
+	errs, _ := rs.ValidateBytes(ctx, []byte(`"joe@example.org"`))
+	if len(errs) != 1 || errs[0].Message != "invalid email: only example.com addresses are allowed" {
+		t.Errorf("expected the custom email checker to be used, got: %v", errs)
+	}
+}
+
+func TestFormatAnnotation(t *testing.T) {
+	ctx := context.Background()
+	rs := Must(`{
+		"properties": {
+			"created": { "format": "date-time" },
+			"email": { "format": "email" }
+		}
+	}`)
+	doc := map[string]interface{}{"created": "2021-13-99", "email": "joe@example.com"}
+
+	expect := map[string]Annotation{
+		"/created": {PropertyPath: "/created", Keyword: "format", KeywordLocation: "/properties/created/format", Value: "date-time", Message: "value has format date-time"},
+		"/email":   {PropertyPath: "/email", Keyword: "format", KeywordLocation: "/properties/email/format", Value: "email", Message: "value has format email"},
+	}
+	for _, assert := range []bool{false, true} {
+		AssertFormat = assert
+		state := rs.Validate(ctx, doc)
+		if expectValid := !assert; state.IsValid() != expectValid {
+			t.Errorf("assert %t: expected valid to be %t, got errors: %v", assert, expectValid, *state.Errs)
+		}
+
+		annotations := state.Annotations()
+		if len(annotations) != len(expect) {
+			t.Errorf("assert %t: expected %d annotations, got: %v", assert, len(expect), annotations)
+			continue
+		}
+		for _, a := range annotations {
+			if a != expect[a.PropertyPath] {
+				t.Errorf("assert %t: annotation mismatch. expected: %v, got: %v", assert, expect[a.PropertyPath], a)
+			}
+		}
+	}
+	AssertFormat = false
+}
+
+func TestContentEncoding(t *testing.T) {
+	ctx := context.Background()
+	cases := []struct {
+		schema, doc string
+		valid       bool
+		decoded     string
+	}{
+		{`{ "contentEncoding": "base64" }`, `"Zm9vYmFy"`, true, "foobar"},
+		{`{ "contentEncoding": "base64" }`, `"Zm9v%mFy"`, false, ""},
+		{`{ "contentEncoding": "base64url" }`, `"_-8"`, true, "\xff\xef"},
+		{`{ "contentEncoding": "base64url" }`, `"_-8="`, true, "\xff\xef"},
+		{`{ "contentEncoding": "base64url" }`, `"/+8="`, false, ""},
+		{`{ "contentEncoding": "base64" }`, `100`, true, ""},
+		{`{ "contentEncoding": "7bit" }`, `"%%%"`, true, "%%%"},
+	}
+
+	for i, c := range cases {
+		rs := &Schema{}
+		if err := rs.UnmarshalJSON([]byte(c.schema)); err != nil {
+			t.Errorf("case %d schema is invalid: %s", i, err.Error())
+			continue
+		}
+
+		var doc interface{}
+		if err := json.Unmarshal([]byte(c.doc), &doc); err != nil {
+			t.Errorf("case %d doc is invalid: %s", i, err.Error())
+			continue
+		}
+
+		state := rs.Validate(ctx, doc)
+		if state.IsValid() != c.valid {
+			t.Errorf("case %d validity mismatch. expected: %t, got errors: %v", i, c.valid, *state.Errs)
+			continue
+		}
+
+		decoded, _ := state.Misc["contentDecoded"].([]byte)
+		if string(decoded) != c.decoded {
+			t.Errorf("case %d decoded content mismatch. expected: %q, got: %q", i, c.decoded, string(decoded))
+		}
+	}
+}
+
+func TestRegisterMediaType(t *testing.T) {
+	ctx := context.Background()
+	RegisterMediaType("application/x-foo", func(content []byte) error {
+		if string(content) != "foo" {
+			return fmt.Errorf("expected foo")
+		}
+		return nil
+	})
+
+	cases := []struct {
+		schema, doc string
+		valid       bool
+	}{
+		{`{ "contentMediaType": "application/x-foo" }`, `"foo"`, true},
+		{`{ "contentMediaType": "application/x-foo; charset=utf-8" }`, `"bar"`, false},
+		{`{ "contentMediaType": "application/x-foo", "contentEncoding": "base64" }`, `"Zm9v"`, true},
+		{`{ "contentMediaType": "text/plain" }`, `"{:}"`, true},
+		{`{ "contentMediaType": "application/x-unknown" }`, `"{:}"`, true},
+	}
+
+	for i, c := range cases {
+		rs := &Schema{}
+		if err := rs.UnmarshalJSON([]byte(c.schema)); err != nil {
+			t.Errorf("case %d schema is invalid: %s", i, err.Error())
+			continue
+		}
+
+		errs, err := rs.ValidateBytes(ctx, []byte(c.doc))
+		if err != nil {
+			t.Errorf("case %d error validating: %s", i, err)
+			continue
+		}
+		if (len(errs) == 0) != c.valid {
+			t.Errorf("case %d validity mismatch. expected: %t, got errors: %v", i, c.valid, errs)
+		}
+	}
+}
+
+func TestContentSchema(t *testing.T) {
+	ctx := context.Background()
+	defer func() { StrictContentValidation = false }()
+
+	schema := `{
+		"contentMediaType": "application/json",
+		"contentEncoding": "base64",
+		"contentSchema": { "required": ["foo"] }
+	}`
+	cases := []struct {
+		doc    string
+		strict bool
+		valid  bool
+	}{
+		// {"foo": "bar"}
+		{`"eyJmb28iOiAiYmFyIn0="`, false, true},
+		{`"eyJmb28iOiAiYmFyIn0="`, true, true},
+		// {"boo": "bar"}
+		{`"eyJib28iOiAiYmFyIn0="`, false, true},
+		{`"eyJib28iOiAiYmFyIn0="`, true, false},
+		{`100`, true, true},
+	}
+
+	for i, c := range cases {
+		StrictContentValidation = c.strict
+		rs := &Schema{}
+		if err := rs.UnmarshalJSON([]byte(schema)); err != nil {
+			t.Errorf("case %d schema is invalid: %s", i, err.Error())
+			continue
+		}
+
+		errs, err := rs.ValidateBytes(ctx, []byte(c.doc))
+		if err != nil {
+			t.Errorf("case %d error validating: %s", i, err)
+			continue
+		}
+		if (len(errs) == 0) != c.valid {
+			t.Errorf("case %d validity mismatch. expected: %t, got errors: %v", i, c.valid, errs)
+		}
+	}
+
+	StrictContentValidation = false
+	rs := Must(schema)
+	state := rs.Validate(ctx, "eyJib28iOiAiYmFyIn0=")
+	if !state.IsValid() {
+		t.Errorf("expected non-strict content validation to pass, got: %v", *state.Errs)
+	}
+	if len(state.Annotations()) != 1 {
+		t.Errorf("expected contentSchema failure to be annotated, got: %v", state.Annotations())
+	}
+}
+
+func TestDeprecatedAnnotation(t *testing.T) {
+	ctx := context.Background()
+	rs := Must(`{
+		"properties": {
+			"old": { "deprecated": true },
+			"older": { "deprecated": "yes" },
+			"new": { "deprecated": false }
+		}
+	}`)
+
+	var doc interface{}
+	if err := json.Unmarshal([]byte(`{ "old": 1, "older": 2, "new": 3 }`), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	state := rs.Validate(ctx, doc)
+	if !state.IsValid() {
+		t.Errorf("expected deprecated values to be valid, got: %v", *state.Errs)
+	}
+
+	annotations := state.Annotations()
+	if len(annotations) != 1 {
+		t.Fatalf("expected exactly 1 annotation, got: %v", annotations)
+	}
+	expect := Annotation{PropertyPath: "/old", Keyword: "deprecated", KeywordLocation: "/properties/old/deprecated", Value: true, Message: "value is deprecated"}
+	if annotations[0] != expect {
+		t.Errorf("annotation mismatch. expected: %v, got: %v", expect, annotations[0])
+	}
+}
+
+func TestReadWriteOnlyModes(t *testing.T) {
+	ctx := context.Background()
+	rs := Must(`{
+		"properties": {
+			"id": { "type": "integer", "readOnly": true },
+			"password": { "type": "string", "writeOnly": true },
+			"name": { "type": "string", "readOnly": false, "writeOnly": false }
+		}
+	}`)
+	doc := map[string]interface{}{"id": 1.0, "password": "secret", "name": "x"}
+
+	cases := []struct {
+		opts   *ValidationOptions
+		errors []string
+	}{
+		{nil, nil},
+		{&ValidationOptions{Mode: ModeNone}, nil},
+		{&ValidationOptions{Mode: ModeRead}, []string{`/password: "secret" value is write-only`}},
+		{&ValidationOptions{Mode: ModeWrite}, []string{`/id: 1 value is read-only`}},
+	}
+	for i, c := range cases {
+		state := rs.ValidateWithOptions(ctx, doc, c.opts)
+		errs := *state.Errs
+		if len(errs) != len(c.errors) {
+			t.Errorf("case %d: expected %d errors, got: %v", i, len(c.errors), errs)
+			continue
+		}
+		for j, e := range errs {
+			if e.Error() != c.errors[j] {
+				t.Errorf("case %d: error %d mismatch. expected: '%s', got: '%s'", i, j, c.errors[j], e.Error())
+			}
+		}
+	}
+
+	state := rs.ValidateWithOptions(ctx, map[string]interface{}{"name": "x"}, &ValidationOptions{Mode: ModeWrite})
+	if !state.IsValid() {
+		t.Errorf("expected absent read-only properties to be valid, got: %v", *state.Errs)
+	}
+}
+
+func TestMultipleOfTolerance(t *testing.T) {
+	cases := []struct {
+		multipleOf, num float64
+		exact, valid    bool
+	}{
+		{0.1, 0.3, false, true},
+		{0.1, 0.35, false, false},
+		{0.01, 19.99, false, true},
+		{1.5, 35, false, false},
+		{0.1, 0.3, true, true},
+		{0.01, 19.99, true, true},
+		{0.01, 19.995, true, false},
+		{0.1, 1e20 + 0.1, true, true},
+		{0.123456789, math.MaxFloat64, false, false},
+		{3, 1e-10, false, false},
+		{3, -1e-10, false, false},
+		{3, 0, false, true},
+		{0.1, 0.09999999999, false, true},
+		{3, 1e12 + 1, false, false},
+	}
+
+	defer func() { MultipleOfExact = false }()
+	for i, c := range cases {
+		MultipleOfExact = c.exact
+		state := NewValidationState(&Schema{})
+		MultipleOf(c.multipleOf).ValidateKeyword(context.Background(), state, c.num)
+		if state.IsValid() != c.valid {
+			t.Errorf("case %d: expected %v multiple of %v to be valid: %t", i, c.num, c.multipleOf, c.valid)
+		}
+	}
+
+	MultipleOfEpsilon = 0
+	defer func() { MultipleOfEpsilon = 1e-9 }()
+	state := NewValidationState(&Schema{})
+	MultipleOf(0.1).ValidateKeyword(context.Background(), state, 0.3)
+	if state.IsValid() {
+		t.Errorf("expected a zero epsilon to reject the inexact quotient of 0.3 and 0.1")
+	}
+}
+
+func TestUseNumber(t *testing.T) {
+	ctx := context.Background()
+	cases := []struct {
+		schema, doc string
+		valid       bool
+	}{
+		{`{ "const": 9007199254740993 }`, `9007199254740993`, true},
+		{`{ "const": 9007199254740993 }`, `9007199254740992`, false},
+		{`{ "enum": [1, 9007199254740993] }`, `9007199254740992`, false},
+		{`{ "enum": [1, 9007199254740993] }`, `1.0`, true},
+		{`{ "const": { "a": [1e2] } }`, `{ "a": [100] }`, true},
+		{`{ "maximum": 9007199254740992 }`, `9007199254740993`, false},
+		{`{ "exclusiveMinimum": 9007199254740992 }`, `9007199254740993`, true},
+		{`{ "minimum": 0.1 }`, `0.1`, true},
+		{`{ "multipleOf": 0.1 }`, `0.3`, true},
+		{`{ "multipleOf": 2 }`, `9007199254740993`, false},
+		{`{ "type": "integer" }`, `9007199254740993.0`, true},
+		{`{ "type": "integer" }`, `1.5`, false},
+		{`{ "uniqueItems": true }`, `[1, 1.0]`, false},
+		{`{ "maximum": 10 }`, `1e99999`, false},
+	}
+
+	for i, c := range cases {
+		errs, err := Must(c.schema).ValidateBytesWithOptions(ctx, []byte(c.doc), &ValidationOptions{UseNumber: true})
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %s", i, err)
+			continue
+		}
+		if (len(errs) == 0) != c.valid {
+			t.Errorf("case %d: expected %s against %s to be valid: %t, got errors: %v", i, c.doc, c.schema, c.valid, errs)
+		}
+	}
+
+	// without UseNumber the instance loses precision decoding to float64
+	errs, err := Must(`{ "maximum": 9007199254740992 }`).ValidateBytesWithOptions(ctx, []byte(`9007199254740993`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 0 {
+		t.Errorf("expected the float64 instance to equal the maximum, got errors: %v", errs)
+	}
+	if _, err := Must(`{}`).ValidateBytesWithOptions(ctx, []byte(`1 2`), nil); err == nil {
+		t.Errorf("expected an error validating trailing data")
+	}
+}
+
+func TestExactNumberLimits(t *testing.T) {
+	ctx := context.Background()
+	// 2^53+1 is the first integer a float64 can't represent
+	cases := []struct {
+		schema, doc string
+		valid       bool
+	}{
+		{`{ "maximum": 9007199254740993 }`, `9007199254740993`, true},
+		{`{ "maximum": 9007199254740993 }`, `9007199254740994`, false},
+		{`{ "maximum": 9007199254740992 }`, `9007199254740993`, false},
+		{`{ "minimum": 9007199254740993 }`, `9007199254740993`, true},
+		{`{ "minimum": 9007199254740993 }`, `9007199254740992`, false},
+		{`{ "exclusiveMaximum": 9007199254740993 }`, `9007199254740992`, true},
+		{`{ "exclusiveMaximum": 9007199254740993 }`, `9007199254740993`, false},
+		{`{ "exclusiveMinimum": 9007199254740993 }`, `9007199254740994`, true},
+		{`{ "exclusiveMinimum": 9007199254740993 }`, `9007199254740993`, false},
+		{`{ "multipleOf": 9007199254740993 }`, `18014398509481986`, true},
+		{`{ "multipleOf": 9007199254740993 }`, `18014398509481984`, false},
+	}
+
+	for i, c := range cases {
+		errs, err := Must(c.schema).ValidateBytesWithOptions(ctx, []byte(c.doc), &ValidationOptions{UseNumber: true})
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %s", i, err)
+			continue
+		}
+		if (len(errs) == 0) != c.valid {
+			t.Errorf("case %d: expected %s against %s to be valid: %t, got errors: %v", i, c.doc, c.schema, c.valid, errs)
+		}
+	}
+
+	data, err := json.Marshal(Must(`{ "maximum": 9007199254740993 }`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"maximum":9007199254740993}` {
+		t.Errorf("expected the limit to marshal as written, got: %s", data)
+	}
+
+	// json.Number instances validated without a validation state
+	if errs, err := Must(`{ "maximum": 9007199254740993 }`).ValidateDecoded(ctx, json.Number("9007199254740993")); err != nil || len(errs) != 0 {
+		t.Errorf("expected the scalar check to compare the limit exactly, got: %v, %v", errs, err)
+	}
+	draft4 := Must(`{ "$schema": "http://json-schema.org/draft-04/schema#", "maximum": 9007199254740993, "exclusiveMaximum": true }`)
+	if errs, err := draft4.ValidateBytesWithOptions(ctx, []byte(`9007199254740992`), &ValidationOptions{UseNumber: true}); err != nil || len(errs) != 0 {
+		t.Errorf("expected draft4 exclusiveMaximum to compare the limit exactly, got: %v, %v", errs, err)
+	}
+
+	// a limit changed after parsing no longer uses the number written in the schema
+	rs := Must(`{ "maximum": 9007199254740993 }`)
+	*rs.Keyword("maximum").(*Maximum) = 1
+	if errs, err := rs.ValidateBytesWithOptions(ctx, []byte(`2`), &ValidationOptions{UseNumber: true}); err != nil || len(errs) != 1 {
+		t.Errorf("expected the changed limit to apply, got: %v, %v", errs, err)
+	}
+	if data, err := json.Marshal(rs); err != nil || string(data) != `{"maximum":1}` {
+		t.Errorf("expected the changed limit to marshal, got: %s, %v", data, err)
+	}
+}
+
+func TestCompositionErrors(t *testing.T) {
+	ctx := context.Background()
+	cases := []struct {
+		schema, doc string
+		errors      []string
+	}{
+		{`{ "oneOf": [ { "type": "integer" }, { "minimum": 2 }, { "maximum": 3 } ] }`, `3`, []string{
+			"/oneOf: matched more than one specified OneOf schemas, at indexes 0 and 1",
+		}},
+		{`{ "oneOf": [ { "type": "string" }, { "minimum": 2 } ] }`, `1`, []string{
+			"/oneOf: did not match any of the specified OneOf schemas",
+			"/oneOf/0/type: type should be string, got integer",
+			"/oneOf/1/minimum: must be greater than or equal to 2",
+		}},
+		{`{ "anyOf": [ { "type": "string" }, { "properties": { "a": { "maxLength": 1 } } } ] }`, `{ "a": "bc" }`, []string{
+			"/anyOf: did Not match any specified AnyOf schemas",
+			"/anyOf/0/type: type should be string, got object",
+			"/anyOf/1/properties/a/maxLength: max length of 1 characters exceeded: bc",
+		}},
+		{`{ "anyOf": [ { "type": "string" }, { "type": "integer" } ] }`, `1`, nil},
+	}
+
+	for i, c := range cases {
+		errs, err := Must(c.schema).ValidateBytes(ctx, []byte(c.doc))
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %s", i, err)
+			continue
+		}
+		got := make([]string, len(errs))
+		for j, e := range errs {
+			got[j] = e.KeywordLocation + ": " + e.Message
+		}
+		if len(got) != len(c.errors) || (len(got) > 0 && !reflect.DeepEqual(got, c.errors)) {
+			t.Errorf("case %d: errors mismatch.\nexpected: %q\ngot: %q", i, c.errors, got)
+		}
+	}
+}
+
+func TestApplicatorErrorLocations(t *testing.T) {
+	ctx := context.Background()
+	cases := []struct {
+		schema, doc string
+		locations   []string
+	}{
+		{`{ "allOf": [ {}, { "type": "object" }, { "properties": { "x": { "type": "string" } } } ] }`, `{ "x": 1 }`, []string{
+			"/allOf/2/properties/x/type",
+		}},
+		{`{ "if": { "type": "integer" }, "then": { "minimum": 2 }, "else": { "maxLength": 1 } }`, `1`, []string{
+			"/then/minimum",
+		}},
+		{`{ "if": { "type": "integer" }, "then": { "minimum": 2 }, "else": { "maxLength": 1 } }`, `"ab"`, []string{
+			"/else/maxLength",
+		}},
+		{`{ "allOf": [ { "$ref": "#/$defs/a" } ], "$defs": { "a": { "oneOf": [ { "type": "string" } ] } } }`, `1`, []string{
+			"/allOf/0/$ref/oneOf",
+			"/allOf/0/$ref/oneOf/0/type",
+		}},
+	}
+
+	for i, c := range cases {
+		errs, err := Must(c.schema).ValidateBytes(ctx, []byte(c.doc))
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %s", i, err)
+			continue
+		}
+		got := make([]string, len(errs))
+		for j, e := range errs {
+			got[j] = e.KeywordLocation
+		}
+		if !reflect.DeepEqual(got, c.locations) {
+			t.Errorf("case %d: keyword locations mismatch.\nexpected: %q\ngot: %q", i, c.locations, got)
+		}
+	}
+}
+
+func TestPropertyNames(t *testing.T) {
+	rs := Must(`{
+		"propertyNames": { "$ref": "#/$defs/name" },
+		"$defs": { "name": { "pattern": "^[a-z]+$", "maxLength": 3 } }
+	}`)
+	errs, err := rs.ValidateBytes(context.Background(), []byte(`{ "ok": "A", "Bad": 1, "long": 2 }`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{
+		`/Bad: "Bad" regexp pattern ^[a-z]+$ mismatch on string: Bad`,
+		`/long: "long" max length of 3 characters exceeded: long`,
+	}
+	if len(errs) != len(expect) {
+		t.Fatalf("error length mismatch. expected: %d, got: %v", len(expect), errs)
+	}
+	for i, e := range errs {
+		if e.Error() != expect[i] {
+			t.Errorf("error %d mismatch. expected: '%s', got: '%s'", i, expect[i], e.Error())
+		}
+	}
+	if errs[0].KeywordLocation != "/propertyNames/$ref/pattern" {
+		t.Errorf("expected the error to be located under the name schema, got: %s", errs[0].KeywordLocation)
+	}
+
+	state := rs.ValidateWithOptions(context.Background(), map[string]interface{}{"A": 1.0, "B": 2.0}, &ValidationOptions{FailFast: true})
+	if len(*state.Errs) != 1 {
+		t.Errorf("expected fail-fast validation to stop after the first name, got: %v", *state.Errs)
+	}
+}
+
+func TestUnevaluatedProperties(t *testing.T) {
+	ctx := context.Background()
+	cases := []struct {
+		schema, doc string
+		valid       bool
+	}{
+		// properties of a nested instance are not evaluated for the parent
+		{`{ "properties": { "a": { "properties": { "b": {} } } }, "unevaluatedProperties": false }`, `{ "a": { "b": 1 } }`, true},
+		{`{ "properties": { "a": { "properties": { "b": {} } } }, "unevaluatedProperties": false }`, `{ "a": { "b": 1 }, "b": 2 }`, false},
+		{`{ "patternProperties": { "^a": { "properties": { "b": {} } } }, "unevaluatedProperties": false }`, `{ "a": { "b": 1 }, "b": 2 }`, false},
+		{`{ "additionalProperties": { "properties": { "b": {} } }, "properties": { "c": { "unevaluatedProperties": false } } }`, `{ "a": { "b": 1 }, "c": { "b": 2 } }`, false},
+		// properties of in-place applicators are evaluated when they pass
+		{`{ "allOf": [ { "properties": { "a": {} } } ], "unevaluatedProperties": false }`, `{ "a": 1 }`, true},
+		{`{ "anyOf": [ { "properties": { "a": { "type": "string" } } }, { "properties": { "b": {} } } ], "unevaluatedProperties": false }`, `{ "a": 1, "b": 2 }`, false},
+		{`{ "if": { "properties": { "a": { "const": 1 } } }, "unevaluatedProperties": false }`, `{ "a": 1 }`, true},
+		{`{ "if": { "properties": { "a": { "const": 1 } } }, "unevaluatedProperties": false }`, `{ "a": 2 }`, false},
+		{`{ "if": false, "else": { "properties": { "a": {} } }, "unevaluatedProperties": false }`, `{ "a": 1 }`, true},
+		// only the applied then or else branch is evaluated
+		{`{ "if": { "required": ["a"] }, "then": { "properties": { "a": {}, "b": {} } }, "unevaluatedProperties": false }`, `{ "a": 1, "b": 2 }`, true},
+		{`{ "if": { "required": ["a"] }, "then": { "properties": { "b": {} } }, "unevaluatedProperties": false }`, `{ "b": 2 }`, false},
+		{`{ "if": { "required": ["a"] }, "then": { "properties": { "a": {} } }, "else": { "properties": { "b": {} } }, "unevaluatedProperties": false }`, `{ "a": 1, "b": 2 }`, false},
+		{`{ "if": { "required": ["a"] }, "then": { "properties": { "a": {} } }, "else": { "properties": { "b": {} } }, "unevaluatedProperties": false }`, `{ "b": 2 }`, true},
+		{`{ "if": true, "then": { "properties": { "a": {}, "b": { "type": "string" } } }, "unevaluatedProperties": false }`, `{ "b": 2 }`, false},
+		{`{ "dependentSchemas": { "a": { "properties": { "b": {} } } }, "properties": { "a": {} }, "unevaluatedProperties": false }`, `{ "a": 1, "b": 2 }`, true},
+		{`{ "not": { "not": { "properties": { "a": {} } } }, "unevaluatedProperties": false }`, `{ "a": 1 }`, false},
+		// additionalProperties only considers sibling keywords
+		{`{ "dependentSchemas": { "a": { "properties": { "b": {} } } }, "properties": { "a": {} }, "additionalProperties": false }`, `{ "a": 1, "b": 2 }`, false},
+		{`{ "then": { "properties": { "b": {} } }, "if": true, "additionalProperties": false }`, `{ "b": 2 }`, false},
+	}
+
+	for i, c := range cases {
+		rs := &Schema{}
+		if err := rs.UnmarshalJSON([]byte(c.schema)); err != nil {
+			t.Errorf("case %d schema is invalid: %s", i, err.Error())
+			continue
+		}
+
+		errs, err := rs.ValidateBytes(ctx, []byte(c.doc))
+		if err != nil {
+			t.Errorf("case %d error validating: %s", i, err)
+			continue
+		}
+		if (len(errs) == 0) != c.valid {
+			t.Errorf("case %d validity mismatch. expected: %t, got errors: %v", i, c.valid, errs)
+		}
+	}
+}
+
+func TestNotIsolation(t *testing.T) {
+	rs := Must(`{
+		"properties": { "a": true },
+		"not": {
+			"properties": { "b": { "deprecated": true } },
+			"required": ["c"]
+		},
+		"unevaluatedProperties": false
+	}`)
+	state := rs.Validate(context.Background(), map[string]interface{}{"a": 1.0, "b": 1.0})
+	errs := *state.Errs
+	expect := `/: {"a":1,"b":1} unevaluated properties are not allowed`
+	if len(errs) != 1 || errs[0].Error() != expect {
+		t.Errorf("expected properties evaluated under not to stay unevaluated. expected: %s, got: %v", expect, errs)
+	}
+	if annotations := state.Annotations(); len(annotations) != 0 {
+		t.Errorf("expected annotations under not to be discarded, got: %v", annotations)
+	}
+
+	state = Must(`{"items": [true], "not": {"items": [true, true], "minItems": 3}, "unevaluatedItems": false}`).
+		Validate(context.Background(), []interface{}{1.0, 2.0})
+	if len(*state.Errs) != 1 {
+		t.Errorf("expected items evaluated under not to stay unevaluated, got: %v", *state.Errs)
+	}
+}
+
+func TestAdditionalPropertiesSchema(t *testing.T) {
+	rs := Must(`{
+		"properties": { "id": { "type": "integer" } },
+		"patternProperties": { "^x-": { "type": "boolean" } },
+		"additionalProperties": { "type": "string", "maxLength": 3 },
+		"unevaluatedProperties": false
+	}`)
+	data := map[string]interface{}{
+		"id":    1.0,
+		"x-new": true,
+		"a":     "abc",
+		"b":     "abcd",
+		"c":     1.0,
+	}
+	state := rs.Validate(context.Background(), data)
+	expect := []string{
+		`/additionalProperties/maxLength /b: "abcd" max length of 3 characters exceeded: abcd`,
+		`/additionalProperties/type /c: 1 type should be string, got integer`,
+	}
+	errs := *state.Errs
+	if len(errs) != len(expect) {
+		t.Fatalf("expected %d errors, got: %v", len(expect), errs)
+	}
+	for i, e := range expect {
+		if got := errs[i].KeywordLocation + " " + errs[i].Error(); got != e {
+			t.Errorf("error %d mismatch. expected: %s, got: %s", i, e, got)
+		}
+	}
+
+	// the additional keys failing additionalProperties are still evaluated
+	for _, key := range []string{"id", "x-new", "a", "b", "c"} {
+		if !state.IsEvaluatedKey(key) {
+			t.Errorf("expected %q to be evaluated", key)
+		}
+	}
+
+	state = Must(`{"properties": {"a": true}, "additionalProperties": false}`).
+		Validate(context.Background(), map[string]interface{}{"a": 1.0, "b": 1.0, "c": 1.0})
+	if len(*state.Errs) != 2 || (*state.Errs)[0].PropertyPath != "/b" || (*state.Errs)[1].PropertyPath != "/c" {
+		t.Errorf("expected an error for each additional property, got: %v", *state.Errs)
+	}
+}
+
+func TestUnevaluatedItems(t *testing.T) {
+	ctx := context.Background()
+	cases := []struct {
+		schema, doc string
+		valid       bool
+	}{
+		{`{ "items": [ {} ], "unevaluatedItems": false }`, `[ 1 ]`, true},
+		{`{ "items": [ {} ], "unevaluatedItems": false }`, `[ 1, 2 ]`, false},
+		// nested allOf contributes to the evaluated set
+		{`{ "allOf": [ { "allOf": [ { "items": [ {}, {} ] } ] } ], "unevaluatedItems": false }`, `[ 1, 2 ]`, true},
+		{`{ "allOf": [ { "allOf": [ { "items": [ {}, {} ] } ] } ], "unevaluatedItems": false }`, `[ 1, 2, 3 ]`, false},
+		{`{ "allOf": [ { "items": [ {} ] }, { "allOf": [ { "unevaluatedItems": true } ] } ], "unevaluatedItems": false }`, `[ 1, 2 ]`, true},
+		// contains marks matching items as evaluated
+		{`{ "contains": { "type": "string" }, "unevaluatedItems": false }`, `[ "a", "b" ]`, true},
+		{`{ "contains": { "type": "string" }, "unevaluatedItems": false }`, `[ "a", 1 ]`, false},
+		{`{ "items": [ { "type": "string" } ], "contains": { "type": "integer" }, "unevaluatedItems": false }`, `[ "a", 1, 2 ]`, true},
+		{`{ "allOf": [ { "contains": { "const": 2 } } ], "unevaluatedItems": { "type": "string" } }`, `[ "a", 2, "b" ]`, true},
+		// items of a nested array are not evaluated for the parent
+		{`{ "items": [ { "items": [ {}, {} ] } ], "unevaluatedItems": false }`, `[ [ 1, 2 ], 3 ]`, false},
+		{`{ "items": { "unevaluatedItems": false } }`, `[ [], [] ]`, true},
+		// failing branches don't contribute
+		{`{ "anyOf": [ { "items": [ { "type": "string" } ] }, true ], "unevaluatedItems": false }`, `[ 1 ]`, false},
+	}
+
+	for i, c := range cases {
+		rs := &Schema{}
+		if err := rs.UnmarshalJSON([]byte(c.schema)); err != nil {
+			t.Errorf("case %d schema is invalid: %s", i, err.Error())
+			continue
+		}
+
+		errs, err := rs.ValidateBytes(ctx, []byte(c.doc))
+		if err != nil {
+			t.Errorf("case %d error validating: %s", i, err)
+			continue
+		}
+		if (len(errs) == 0) != c.valid {
+			t.Errorf("case %d validity mismatch. expected: %t, got errors: %v", i, c.valid, errs)
+		}
+	}
+}
+
+func TestEvaluatedPropertiesAndItems(t *testing.T) {
+	ctx := context.Background()
+	props := []struct {
+		schema, doc string
+		expect      []string
+	}{
+		{`{ "properties": { "b": {}, "a": {}, "z": {} } }`, `{ "a": 1, "b": 2, "c": 3 }`, []string{"a", "b"}},
+		{`{ "patternProperties": { "^x-": {} }, "additionalProperties": { "type": "string" } }`, `{ "x-a": 1, "b": 2 }`, []string{"b", "x-a"}},
+		{`{ "allOf": [ { "properties": { "a": {} } } ], "properties": { "b": {} } }`, `{ "a": 1, "b": 2, "c": 3 }`, []string{"a", "b"}},
+		{`{ "properties": { "a": { "properties": { "b": {} } } } }`, `{ "a": { "b": 1 } }`, []string{"a"}},
+		{`{ "anyOf": [ { "properties": { "a": { "type": "string" } } } ] }`, `{ "a": 1 }`, []string{}},
+		{`{ "type": "object" }`, `{ "a": 1 }`, []string{}},
+	}
+	for i, c := range props {
+		var doc interface{}
+		if err := json.Unmarshal([]byte(c.doc), &doc); err != nil {
+			t.Fatal(err)
+		}
+		state := Must(c.schema).Validate(ctx, doc)
+		if got := state.EvaluatedProperties(); !reflect.DeepEqual(got, c.expect) {
+			t.Errorf("case %d: evaluated properties mismatch. expected: %v, got: %v", i, c.expect, got)
+		}
+	}
+
+	items := []struct {
+		schema, doc string
+		expect      []int
+	}{
+		{`{ "items": [ {}, {} ] }`, `[1, 2, 3]`, []int{0, 1}},
+		{`{ "items": [ {} ], "contains": { "const": 3 } }`, `[1, 2, 3, 4, 3]`, []int{0, 2, 4}},
+		{`{ "items": { "type": "number" } }`, `[1, 2, 3]`, []int{0, 1, 2}},
+		{`{ "allOf": [ { "items": [ {} ] } ], "unevaluatedItems": { "type": "number" } }`, `[1, 2]`, []int{0, 1}},
+		{`{ "contains": { "const": 70 } }`, "[" + strings.Repeat("0, ", 70) + "70]", []int{70}},
+		{`{ "type": "array" }`, `[1]`, []int{}},
+	}
+	for i, c := range items {
+		var doc interface{}
+		if err := json.Unmarshal([]byte(c.doc), &doc); err != nil {
+			t.Fatal(err)
+		}
+		state := Must(c.schema).Validate(ctx, doc)
+		if got := state.EvaluatedItems(); !reflect.DeepEqual(got, c.expect) {
+			t.Errorf("case %d: evaluated items mismatch. expected: %v, got: %v", i, c.expect, got)
+		}
+	}
+}
+
+func TestPropertyNamesEvaluation(t *testing.T) {
+	ctx := context.Background()
+	cases := []struct {
+		schema, doc string
+		evaluated   []string
+		errs        []string
+	}{
+		// propertyNames checks keys, it doesn't evaluate their values
+		{`{ "propertyNames": { "maxLength": 3 } }`, `{ "a": 1, "bc": 2 }`, []string{}, nil},
+		{`{ "propertyNames": { "maxLength": 3 }, "unevaluatedProperties": false }`, `{ "a": 1 }`, []string{},
+			[]string{`/unevaluatedProperties /: {"a":1} unevaluated properties are not allowed`}},
+		{`{ "allOf": [ { "propertyNames": true } ], "unevaluatedProperties": { "type": "string" } }`, `{ "a": 1 }`, []string{},
+			[]string{`/unevaluatedProperties/type /a: 1 type should be string, got integer`}},
+		{`{ "propertyNames": { "pattern": "^[a-z]+$" }, "additionalProperties": { "type": "number" } }`, `{ "ab": 1, "cd": "x", "E": 2 }`, []string{"E", "ab", "cd"},
+			[]string{
+				`/additionalProperties/type /cd: "x" type should be number, got string`,
+				`/propertyNames/pattern /E: "E" regexp pattern ^[a-z]+$ mismatch on string: E`,
+			}},
+		{`{ "properties": { "a": {} }, "propertyNames": { "enum": ["a", "b"] }, "additionalProperties": false }`, `{ "a": 1, "b": 2 }`, []string{"a", "b"},
+			[]string{`/additionalProperties /b: {"a":1,"b":2} additional properties are not allowed`}},
+		{`{ "propertyNames": { "enum": ["a"] }, "additionalProperties": false, "unevaluatedProperties": false }`, `{ "b": 1 }`, []string{"b"},
+			[]string{
+				`/additionalProperties /b: {"b":1} additional properties are not allowed`,
+				`/propertyNames/enum /b: "b" should be one of ["a"]`,
+			}},
+	}
+
+	for i, c := range cases {
+		var doc interface{}
+		if err := json.Unmarshal([]byte(c.doc), &doc); err != nil {
+			t.Fatal(err)
+		}
+		state := Must(c.schema).Validate(ctx, doc)
+		if got := state.EvaluatedProperties(); !reflect.DeepEqual(got, c.evaluated) {
+			t.Errorf("case %d: evaluated properties mismatch. expected: %v, got: %v", i, c.evaluated, got)
+		}
+		errs := []string{}
+		for _, e := range *state.Errs {
+			errs = append(errs, e.KeywordLocation+" "+e.Error())
+		}
+		sort.Strings(errs)
+		if len(c.errs) == 0 {
+			c.errs = []string{}
+		}
+		if !reflect.DeepEqual(errs, c.errs) {
+			t.Errorf("case %d: errors mismatch.\nexpected: %q\ngot:      %q", i, c.errs, errs)
+		}
+	}
+}
+
+func TestContainsBounds(t *testing.T) {
+	ctx := context.Background()
+	cases := []struct {
+		schema, doc string
+		valid       bool
+	}{
+		{`{ "contains": { "const": 1 }, "minContains": 2, "maxContains": 4 }`, `[ 1, 2 ]`, false},
+		{`{ "contains": { "const": 1 }, "minContains": 2, "maxContains": 4 }`, `[ 1, 2, 1 ]`, true},
+		{`{ "contains": { "const": 1 }, "minContains": 2, "maxContains": 4 }`, `[ 1, 1, 1, 1 ]`, true},
+		{`{ "contains": { "const": 1 }, "minContains": 2, "maxContains": 4 }`, `[ 1, 1, 1, 1, 1 ]`, false},
+		{`{ "contains": { "const": 1 }, "minContains": 2, "maxContains": 4 }`, `[ 2 ]`, false},
+		// minContains of 0 makes contains always pass
+		{`{ "contains": { "const": 1 }, "minContains": 0 }`, `[ 2 ]`, true},
+		{`{ "contains": { "const": 1 }, "minContains": 0 }`, `[]`, true},
+		{`{ "contains": { "const": 1 }, "minContains": 0, "maxContains": 1 }`, `[ 1, 1 ]`, false},
+		// the bounds are ignored without contains, and before 2019-09
+		{`{ "minContains": 2 }`, `[ 1 ]`, true},
+		{`{ "$schema": "http://json-schema.org/draft-07/schema#", "contains": { "const": 1 }, "minContains": 2 }`, `[ 1 ]`, true},
+		{`{ "$schema": "http://json-schema.org/draft-07/schema#", "contains": { "const": 1 }, "minContains": 0 }`, `[ 2 ]`, false},
+	}
+
+	for i, c := range cases {
+		rs := &Schema{}
+		if err := rs.UnmarshalJSON([]byte(c.schema)); err != nil {
+			t.Errorf("case %d schema is invalid: %s", i, err.Error())
+			continue
+		}
+
+		errs, err := rs.ValidateBytes(ctx, []byte(c.doc))
+		if err != nil {
+			t.Errorf("case %d error validating: %s", i, err)
+			continue
+		}
+		if (len(errs) == 0) != c.valid {
+			t.Errorf("case %d validity mismatch. expected: %t, got errors: %v", i, c.valid, errs)
+		}
+	}
+
+	rs := Must(`{ "contains": { "const": 1 }, "maxContains": 1 }`)
+	errs, _ := rs.ValidateBytes(ctx, []byte(`[ 1, 1, 2 ]`))
+	if len(errs) != 1 || errs[0].Message != "contained items 2 exceeds 1 max" {
+		t.Errorf("expected the matching items to be counted, got: %v", errs)
+	}
+
+	rs = Must(`{ "contains": { "const": 1 }, "minContains": 2 }`)
+	if errs := *rs.Validate(ctx, []interface{}{2.0}).Errs; len(errs) != 1 {
+		t.Errorf("expected only contains to report an array without matches, got: %v", errs)
+	}
+}
+
+func TestContainsCount(t *testing.T) {
+	ctx := context.Background()
+	rs := Must(`{ "contains": { "const": 1 } }`)
+
+	state := rs.Validate(ctx, []interface{}{1.0, 2.0, 1.0})
+	if count, ok := state.ContainsCount(); !ok || count != 2 {
+		t.Errorf("expected a contains count of 2, got: %d, %t", count, ok)
+	}
+	for i, evaluated := range []bool{true, false, true} {
+		if state.IsEvaluatedIndex(i) != evaluated {
+			t.Errorf("index %d: expected evaluated to be %t", i, evaluated)
+		}
+	}
+
+	state = rs.Validate(ctx, []interface{}{2.0})
+	if count, ok := state.ContainsCount(); !ok || count != 0 {
+		t.Errorf("expected a contains count of 0, got: %d, %t", count, ok)
+	}
+
+	state = Must(`{ "items": {} }`).Validate(ctx, []interface{}{2.0})
+	if _, ok := state.ContainsCount(); ok {
+		t.Errorf("expected no contains count without contains")
+	}
+}
+
+func TestContainsAnnotation(t *testing.T) {
+	ctx := context.Background()
+	rs := Must(`{ "properties": { "tags": { "contains": { "const": "a" } } } }`)
+
+	state := rs.Validate(ctx, map[string]interface{}{"tags": []interface{}{"a", "b", "a"}})
+	expect := []Annotation{{
+		PropertyPath:    "/tags",
+		Keyword:         "contains",
+		KeywordLocation: "/properties/tags/contains",
+		Value:           []int{0, 2},
+		Message:         "2 items match contains",
+	}}
+	if !reflect.DeepEqual(state.Annotations(), expect) {
+		t.Errorf("annotation mismatch. expected: %v, got: %v", expect, state.Annotations())
+	}
+
+	state = rs.Validate(ctx, map[string]interface{}{"tags": []interface{}{"b"}})
+	if len(state.Annotations()) != 0 {
+		t.Errorf("expected no annotation without matching items, got: %v", state.Annotations())
+	}
+
+	// annotations of failed branches are discarded
+	rs = Must(`{ "anyOf": [{ "contains": { "const": "a" }, "maxItems": 1 }, true] }`)
+	state = rs.Validate(ctx, []interface{}{"a", "b"})
+	if !state.IsValid() || len(state.Annotations()) != 0 {
+		t.Errorf("expected no annotation from the failed branch, got: %v", state.Annotations())
+	}
+}
+
+func TestUniqueItemsEquality(t *testing.T) {
+	ctx := context.Background()
+	rs := Must(`{ "uniqueItems": true }`)
+	cases := []struct {
+		doc    string
+		expect string
+	}{
+		{`[{"a": 1, "b": 2}, {"b": 2, "a": 1}]`, `items 0 and 1 are equal`},
+		{`[1, 2, 1.0]`, `items 0 and 2 are equal`},
+		{`[[1, {"a": [1e2]}], [1.0, {"a": [100]}]]`, `items 0 and 1 are equal`},
+		{`[1, 2, 2.0, 1]`, `items 1 and 2 are equal`},
+		{`[{"a": {"b": [1, 2]}}, {"a": {"b": [2, 1]}}]`, ``},
+		{`[1, true, "1", [1], {"1": 1}]`, ``},
+		{`[0, false, null, "", [], {}]`, ``},
+	}
+
+	for i, c := range cases {
+		for _, opts := range []*ValidationOptions{nil, {UseNumber: true}} {
+			errs, err := rs.ValidateBytesWithOptions(ctx, []byte(c.doc), opts)
+			if err != nil {
+				t.Fatalf("case %d: %s", i, err)
+			}
+			if c.expect == "" {
+				if len(errs) != 0 {
+					t.Errorf("case %d: expected %s to be unique, got: %v", i, c.doc, errs)
+				}
+				continue
+			}
+			if len(errs) != 1 || !strings.HasPrefix(errs[0].Message, "array items must be unique. "+c.expect+": ") {
+				t.Errorf("case %d: expected duplicate %s, got: %v", i, c.expect, errs)
+			}
+		}
+	}
+
+	// numbers decoded into different Go types compare by value
+	state := rs.Validate(ctx, []interface{}{int64(3), uint8(2), float32(3)})
+	if len(*state.Errs) != 1 || (*state.Errs)[0].Message != "array items must be unique. items 0 and 2 are equal: 3" {
+		t.Errorf("expected the numbers to be equal, got: %v", *state.Errs)
+	}
+}
+
+func TestPatternPropertiesMatch(t *testing.T) {
+	rs := Must(`{
+		"patternProperties": { "^x-": {}, "^x-a": { "type": "string" }, "b$": {} },
+		"unevaluatedProperties": false
+	}`)
+
+	pp, ok := rs.Keyword("patternProperties").(*PatternProperties)
+	if !ok {
+		t.Fatalf("expected patternProperties to be a PatternProperties keyword, got: %T", rs.Keyword("patternProperties"))
+	}
+	cases := map[string][]string{
+		"x-ab": {"^x-", "^x-a", "b$"},
+		"x-c":  {"^x-"},
+		"b":    {"b$"},
+		"c":    {},
+	}
+	for key, expect := range cases {
+		if got := pp.Match(key); !reflect.DeepEqual(got, expect) {
+			t.Errorf("key %q: expected patterns %v, got: %v", key, expect, got)
+		}
+	}
+
+	state := rs.Validate(context.Background(), map[string]interface{}{"x-ab": "a", "b": 1.0, "c": 1.0})
+	for key, evaluated := range map[string]bool{"x-ab": true, "b": true, "c": false} {
+		if state.IsEvaluatedKey(key) != evaluated {
+			t.Errorf("key %q: expected evaluated to be %t", key, evaluated)
+		}
+	}
+	if len(*state.Errs) != 1 {
+		t.Errorf("expected only the unevaluated property c to be an error, got: %v", *state.Errs)
+	}
+}
+
+func TestEnumConstValues(t *testing.T) {
+	rs := Must(`{ "enum": ["a", 1, null, {"b": [true]}], "const": "c" }`)
+
+	enum, ok := rs.Keyword("enum").(*Enum)
+	if !ok {
+		t.Fatalf("expected enum to be an Enum keyword, got: %T", rs.Keyword("enum"))
+	}
+	expect := []interface{}{"a", 1.0, nil, map[string]interface{}{"b": []interface{}{true}}}
+	if !reflect.DeepEqual(enum.Values(), expect) {
+		t.Errorf("enum values mismatch. expected: %v, got: %v", expect, enum.Values())
+	}
+
+	con, ok := rs.Keyword("const").(*Const)
+	if !ok {
+		t.Fatalf("expected const to be a Const keyword, got: %T", rs.Keyword("const"))
+	}
+	if con.Value() != "c" {
+		t.Errorf("const value mismatch. expected: c, got: %v", con.Value())
+	}
+
+	data, err := json.Marshal(Enum{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "[]" {
+		t.Errorf("expected an empty enum to marshal as [], got: %s", string(data))
+	}
+	if (Enum{}).String() != "[]" {
+		t.Errorf("expected an empty enum to print as [], got: %s", (Enum{}).String())
+	}
+}
+
 type IsFoo bool
 
 func newIsFoo() Keyword {
@@ -65,17 +1352,17 @@ func (f *IsFoo) ValidateKeyword(ctx context.Context, currentState *ValidationSta
 	}
 }
 
-// ContentEncoding represents a "custom" Schema property
-type ContentEncoding string
+// CustomContentEncoding represents a "custom" Schema property
+type CustomContentEncoding string
 
-// newContentEncoding allocates a new ContentEncoding validator
+// newContentEncoding allocates a new CustomContentEncoding validator
 func newContentEncoding() Keyword {
-	return new(ContentEncoding)
+	return new(CustomContentEncoding)
 }
 
-func (c ContentEncoding) Validate(propPath string, data interface{}, errs *[]KeyError) {}
+func (c CustomContentEncoding) Validate(propPath string, data interface{}, errs *[]KeyError) {}
 
-func (c ContentEncoding) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
+func (c CustomContentEncoding) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
 	if obj, ok := data.(string); ok {
 		switch c {
 		case "base64":
@@ -91,13 +1378,13 @@ func (c ContentEncoding) ValidateKeyword(ctx context.Context, currentState *Vali
 	}
 }
 
-func (c ContentEncoding) Register(uri string, registry *SchemaRegistry) {}
+func (c CustomContentEncoding) Register(uri string, registry *SchemaRegistry) {}
 
-func (c ContentEncoding) Resolve(pointer jsonpointer.Pointer, uri string) *Schema {
+func (c CustomContentEncoding) Resolve(pointer jsonpointer.Pointer, uri string) *Schema {
 	return nil
 }
 
-func ExampleCustomValidator() {
+func Example_customValidator() {
 
 	// register a custom validator by supplying a function
 	// that creates new instances of your Validator.
@@ -121,7 +1408,7 @@ func ExampleCustomValidator() {
 	// Output: /: "bar" should be foo. plz make 'bar' == foo. plz
 }
 
-func ExampleCustomSchemaValidator() {
+func Example_customSchemaValidator() {
 
 	// register a custom validator by supplying a function
 	// that creates new instances of your Validator.
@@ -154,6 +1441,297 @@ func ExampleCustomSchemaValidator() {
 	// Output: /file: "abc123" invalid base64 value: abc123
 }
 
+// references stands in for a database of known record IDs
+var references = map[string]map[string]bool{
+	"users": {"ada": true, "grace": true},
+}
+
+// IsReference checks a string is the ID of a record in a table. Embedding
+// BaseKeyword provides Register and Resolve, as the keyword wraps no schema
+type IsReference struct {
+	BaseKeyword
+	Table string
+}
+
+// newIsReference is a KeyMaker for IsReference
+func newIsReference() Keyword {
+	return new(IsReference)
+}
+
+// ValidateKeyword implements the Keyword interface for IsReference
+func (r *IsReference) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
+	if str, ok := data.(string); ok {
+		if !references[r.Table][str] {
+			currentState.AddError(data, fmt.Sprintf("no %s record with id %s", r.Table, str))
+		}
+	}
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface for IsReference
+func (r *IsReference) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &r.Table)
+}
+
+// MarshalJSON implements the json.Marshaler interface for IsReference
+func (r IsReference) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.Table)
+}
+
+func Example_baseKeyword() {
+	registry := NewKeywordRegistry()
+	registry.LoadDraft2019_09()
+	registry.RegisterKeyword("isReference", newIsReference)
+	ctx := context.Background()
+
+	rs, err := ParseSchema([]byte(`{
+		"type": "object",
+		"properties": {
+			"author": { "type": "string", "isReference": "users" }
+		}
+	}`), registry)
+	if err != nil {
+		panic(err)
+	}
+
+	errs, err := rs.ValidateBytes(ctx, []byte(`{ "author": "linus" }`))
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(errs[0].Error())
+
+	errs, err = rs.ValidateBytes(ctx, []byte(`{ "author": "ada" }`))
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(len(errs))
+	// Output: /author: "linus" no users record with id linus
+	// 0
+}
+
+// NonEmpty rejects empty strings or arrays depending on the sibling type keyword
+type NonEmpty struct {
+	BaseKeyword
+}
+
+// ValidateKeyword implements the Keyword interface for NonEmpty
+func (n *NonEmpty) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
+	typ, ok := currentState.CurrentSchema().Keyword("type").(*Type)
+	if !ok || len(typ.vals) != 1 {
+		return
+	}
+	switch typ.vals[0] {
+	case "string":
+		if str, ok := data.(string); ok && str == "" {
+			currentState.AddError(data, "string must not be empty")
+		}
+	case "array":
+		if arr, ok := data.([]interface{}); ok && len(arr) == 0 {
+			currentState.AddError(data, "array must not be empty")
+		}
+	}
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface for NonEmpty
+func (n *NonEmpty) UnmarshalJSON(data []byte) error {
+	return nil
+}
+
+func TestEnumIndex(t *testing.T) {
+	rs := Must(`{ "enum": ["a", 1, 2.5, 1e400, 9007199254740993, true, null, {"b": [1, 2]}, [{"c": 1}]] }`)
+	cases := []struct {
+		data  interface{}
+		valid bool
+	}{
+		{"a", true},
+		{"b", false},
+		{1.0, true},
+		{int64(1), true},
+		{uint8(1), true},
+		{json.Number("1.0"), true},
+		{json.Number("10e-1"), true},
+		{2.5, true},
+		{json.Number("2.50"), true},
+		{float32(2.5), true},
+		{3.0, false},
+		{json.Number("9007199254740993"), true},
+		{json.Number("9007199254740992"), false},
+		{float64(9007199254740992), true},
+		{json.Number("1e400"), true},
+		{json.Number("1e401"), false},
+		{true, true},
+		{false, false},
+		{nil, true},
+		{map[string]interface{}{"b": []interface{}{1.0, json.Number("2")}}, true},
+		{map[string]interface{}{"b": []interface{}{2.0, 1.0}}, false},
+		{[]interface{}{map[string]interface{}{"c": 1.0}}, true},
+		{[]interface{}{}, false},
+		{"1", false},
+	}
+	for i, c := range cases {
+		state := rs.Validate(context.Background(), c.data)
+		if state.IsValid() != c.valid {
+			t.Errorf("case %d: expected %v to be valid: %t, got errors: %v", i, c.data, c.valid, *state.Errs)
+		}
+	}
+
+	// an enum changed after parsing is indexed anew
+	*rs.Keyword("enum").(*Enum) = Enum{Const(`"z"`)}
+	if errs, err := rs.ValidateDecoded(context.Background(), "z"); err != nil || len(errs) != 0 {
+		t.Errorf("expected the changed enum to allow z, got: %v, %v", errs, err)
+	}
+	if errs, err := rs.ValidateDecoded(context.Background(), "a"); err != nil || len(errs) != 1 {
+		t.Errorf("expected the changed enum to reject a, got: %v, %v", errs, err)
+	}
+}
+
+func TestCurrentSchema(t *testing.T) {
+	registry := NewKeywordRegistry()
+	registry.LoadDraft2019_09()
+	registry.RegisterKeyword("x-non-empty", func() Keyword { return new(NonEmpty) })
+
+	rs, err := ParseSchema([]byte(`{
+		"type": "array",
+		"items": { "type": "string", "x-non-empty": true },
+		"x-non-empty": true
+	}`), registry)
+	if err != nil {
+		t.Fatalf("unexpected error parsing schema: %s", err)
+	}
+	cases := []struct {
+		data   []interface{}
+		expect []string
+	}{
+		{[]interface{}{"a"}, nil},
+		{[]interface{}{"a", ""}, []string{`/1: "" string must not be empty`}},
+		// the sibling of items sees its own schema, not the items subschema
+		{[]interface{}{}, []string{"/: [] array must not be empty"}},
+	}
+	for i, c := range cases {
+		state := rs.Validate(context.Background(), c.data)
+		got := []string{}
+		for _, err := range *state.Errs {
+			got = append(got, err.Error())
+		}
+		if len(got) != len(c.expect) {
+			t.Errorf("case %d: expected errors %v, got: %v", i, c.expect, got)
+			continue
+		}
+		for j := range got {
+			if got[j] != c.expect[j] {
+				t.Errorf("case %d: expected error %q, got: %q", i, c.expect[j], got[j])
+			}
+		}
+	}
+
+	if got := NewValidationState(rs).CurrentSchema(); got != nil {
+		t.Errorf("expected no current schema before validating, got: %v", got)
+	}
+}
+
+// MultipleOfLength requires strings to have a length that is a multiple of its value
+type MultipleOfLength struct {
+	BaseKeyword
+	n int
+}
+
+// Validate implements the KeywordE interface for MultipleOfLength
+func (m *MultipleOfLength) Validate(ctx context.Context, currentState *ValidationState, data interface{}) []KeyError {
+	if str, ok := data.(string); ok && len(str)%m.n != 0 {
+		return []KeyError{{Message: fmt.Sprintf("length %d is not a multiple of %d", len(str), m.n), Limit: m.n}}
+	}
+	return nil
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface for MultipleOfLength
+func (m *MultipleOfLength) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &m.n)
+}
+
+func TestKeywordE(t *testing.T) {
+	ctx := context.Background()
+	kw := &MultipleOfLength{n: 2}
+	if errs := kw.Validate(ctx, nil, "ab"); len(errs) != 0 {
+		t.Errorf("expected no errors, got: %v", errs)
+	}
+	if errs := kw.Validate(ctx, nil, "abc"); len(errs) != 1 {
+		t.Errorf("expected one error, got: %v", errs)
+	}
+
+	registry := NewKeywordRegistry()
+	registry.LoadDraft2019_09()
+	registry.RegisterKeyword("x-multiple-of-length", func() Keyword { return new(MultipleOfLength) })
+	rs, err := ParseSchema([]byte(`{ "properties": { "a": { "x-multiple-of-length": 2 } } }`), registry)
+	if err != nil {
+		t.Fatalf("unexpected error parsing schema: %s", err)
+	}
+
+	state := rs.Validate(ctx, map[string]interface{}{"a": "abc"})
+	if len(*state.Errs) != 1 {
+		t.Fatalf("expected one error, got: %v", *state.Errs)
+	}
+	got := (*state.Errs)[0]
+	expect := KeyError{
+		PropertyPath:     "/a",
+		InstanceLocation: "/a",
+		InvalidValue:     "abc",
+		Message:          "length 3 is not a multiple of 2",
+		KeywordLocation:  "/properties/a/x-multiple-of-length",
+		Limit:            2,
+		Keyword:          "x-multiple-of-length",
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("error mismatch. expected: %#v, got: %#v", expect, got)
+	}
+
+	// errors that are already located are kept as returned
+	located := KeyError{PropertyPath: "/b", InstanceLocation: "/b", Message: "located"}
+	state = NewValidationState(rs)
+	state.addKeyErrors("abc", []KeyError{located})
+	if !reflect.DeepEqual(*state.Errs, []KeyError{located}) {
+		t.Errorf("expected the located error to be kept, got: %v", *state.Errs)
+	}
+}
+
+func TestKeyErrorIs(t *testing.T) {
+	rs := Must(`{
+		"type": "object",
+		"properties": { "a": { "type": "string" }, "b": { "minimum": 2 } },
+		"required": ["c"]
+	}`)
+	errs, err := rs.ValidateBytes(context.Background(), []byte(`{"a": 1, "b": 1}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	got := map[string]KeywordError{}
+	for _, e := range errs {
+		for _, sentinel := range []KeywordError{ErrType, ErrRequired, ErrMinimum, ErrMaximum} {
+			if errors.Is(e, sentinel) {
+				got[e.PropertyPath] = sentinel
+			}
+		}
+	}
+	expect := map[string]KeywordError{"/a": ErrType, "/b": ErrMinimum, "/": ErrRequired}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("expected errors matching %v, got: %v", expect, got)
+	}
+
+	var wrapped error = fmt.Errorf("validating: %w", errs[0])
+	var keyErr KeyError
+	if !errors.As(wrapped, &keyErr) || keyErr.Keyword == "" {
+		t.Errorf("expected a wrapped KeyError to be extracted with errors.As, got: %#v", keyErr)
+	}
+	if !errors.Is(wrapped, KeywordError(keyErr.Keyword)) {
+		t.Errorf("expected a wrapped KeyError to match its keyword")
+	}
+	if errors.Is(KeyError{Message: "no keyword"}, KeywordError("")) {
+		t.Errorf("expected an error without a keyword to match no sentinel")
+	}
+	if ErrRequired.Error() != "required keyword validation failed" {
+		t.Errorf("unexpected sentinel message: %s", ErrRequired.Error())
+	}
+}
+
 type FooKeyword uint8
 
 func (f *FooKeyword) Validate(propPath string, data interface{}, errs *[]KeyError) {}
@@ -178,3 +1756,93 @@ func TestRegisterFooKeyword(t *testing.T) {
 		t.Errorf("expected %s to be added as a default validator", "foo")
 	}
 }
+
+func TestRegisterKeywordE(t *testing.T) {
+	if err := RegisterKeywordE("type", NewVoid); err == nil {
+		t.Errorf("expected an error registering the built-in type keyword")
+	}
+	if _, ok := kr.GetKeyword("type").(*Type); !ok {
+		t.Errorf("expected a failed registration to keep the existing keyword")
+	}
+
+	if err := RegisterKeywordE("x-register-e", NewVoid); err != nil {
+		t.Errorf("unexpected error registering a new keyword: %s", err)
+	}
+	expect := `keyword "x-register-e" is already registered`
+	if err := RegisterKeywordE("x-register-e", NewVoid); err == nil || err.Error() != expect {
+		t.Errorf("expected error %q, got: %v", expect, err)
+	}
+
+	r := NewKeywordRegistry()
+	if err := r.RegisterKeywordE("foo", NewVoid); err != nil {
+		t.Errorf("unexpected error registering with a new registry: %s", err)
+	}
+	if err := r.RegisterKeywordE("foo", NewVoid); err == nil {
+		t.Errorf("expected an error registering foo twice")
+	}
+}
+
+func TestUnregisterKeyword(t *testing.T) {
+	RegisterKeyword("x-unregister", NewVoid)
+	SetKeywordOrder("x-unregister", 3)
+	UnregisterKeyword("x-unregister")
+
+	if kr.IsRegisteredKeyword("x-unregister") {
+		t.Errorf("expected x-unregister to be removed")
+	}
+	if kr.GetKeywordOrder("x-unregister") != 1 || kr.GetKeywordInsertOrder("x-unregister") != 1000 {
+		t.Errorf("expected the order of x-unregister to be forgotten")
+	}
+	if err := RegisterKeywordE("x-unregister", NewVoid); err != nil {
+		t.Errorf("expected x-unregister to be registrable again, got: %s", err)
+	}
+	for key, order := range kr.keywordInsertOrder {
+		if key != "x-unregister" && order == kr.GetKeywordInsertOrder("x-unregister") {
+			t.Errorf("expected a new insert order, shared with %s", key)
+		}
+	}
+	UnregisterKeyword("x-unregister")
+
+	rs := &Schema{}
+	if err := json.Unmarshal([]byte(`{ "x-unregister": 1 }`), rs); err != nil {
+		t.Fatal(err)
+	}
+	if rs.Keyword("x-unregister") != nil {
+		t.Errorf("expected an unregistered keyword to be kept as an extra definition")
+	}
+}
+
+func TestVoidRawValue(t *testing.T) {
+	RegisterKeyword("x-vendor", NewVoid)
+
+	schema := `{"type":"object","x-vendor":{"owner":"team-a","tags":["a","b"]}}`
+	rs := &Schema{}
+	if err := json.Unmarshal([]byte(schema), rs); err != nil {
+		t.Fatalf("error unmarshaling schema: %s", err.Error())
+	}
+
+	void, ok := rs.Keyword("x-vendor").(*Void)
+	if !ok {
+		t.Fatalf("expected x-vendor to be a Void keyword, got: %T", rs.Keyword("x-vendor"))
+	}
+	expect := `{"owner":"team-a","tags":["a","b"]}`
+	if string(void.RawValue()) != expect {
+		t.Errorf("raw value mismatch. expected: %s, got: %s", expect, string(void.RawValue()))
+	}
+
+	output, err := json.Marshal(rs)
+	if err != nil {
+		t.Fatalf("error marshaling schema: %s", err.Error())
+	}
+	if string(output) != schema {
+		t.Errorf("round trip mismatch. expected: %s, got: %s", schema, string(output))
+	}
+
+	errs, err := rs.ValidateBytes(context.Background(), []byte(`{"foo":"bar"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 0 {
+		t.Errorf("expected Void to always be valid, got: %v", errs)
+	}
+}
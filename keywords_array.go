@@ -1,10 +1,10 @@
 package jsonschema
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
-	"reflect"
 	"strconv"
 
 	jptr "github.com/qri-io/jsonpointer"
@@ -12,8 +12,11 @@ import (
 
 // Items defines the items JSON Schema keyword
 type Items struct {
-	single  bool
-	Schemas []*Schema
+	single bool
+	// schemaOnly rejects the array form of items, as draft 2020-12
+	// declares tuples with prefixItems instead
+	schemaOnly bool
+	Schemas    []*Schema
 }
 
 // NewItems allocates a new Items keyword
@@ -21,6 +24,12 @@ func NewItems() Keyword {
 	return &Items{}
 }
 
+// newSchemaOnlyItems allocates a new Items keyword that only
+// accepts a single schema, as draft 2020-12 requires
+func newSchemaOnlyItems() Keyword {
+	return &Items{schemaOnly: true}
+}
+
 // Register implements the Keyword interface for Items
 func (it *Items) Register(uri string, registry *SchemaRegistry) {
 	for _, v := range it.Schemas {
@@ -30,6 +39,9 @@ func (it *Items) Register(uri string, registry *SchemaRegistry) {
 
 // Resolve implements the Keyword interface for Items
 func (it *Items) Resolve(pointer jptr.Pointer, uri string) *Schema {
+	if it.single {
+		return it.Schemas[0].Resolve(pointer, uri)
+	}
 	if pointer == nil {
 		return nil
 	}
@@ -48,8 +60,6 @@ func (it *Items) Resolve(pointer jptr.Pointer, uri string) *Schema {
 	}
 
 	return it.Schemas[pos].Resolve(pointer.Tail(), uri)
-
-	return nil
 }
 
 // ValidateKeyword implements the Keyword interface for Items
@@ -60,33 +70,65 @@ func (it Items) ValidateKeyword(ctx context.Context, currentState *ValidationSta
 			subState := currentState.NewSubState()
 			subState.DescendBase("items")
 			subState.DescendRelative("items")
+			start := 0
+			if currentState.Local != nil {
+				if prefix, ok := currentState.Local.keywords["prefixItems"].(*PrefixItems); ok {
+					// items only applies to elements beyond the prefixItems tuple
+					start = len(*prefix)
+				}
+			}
+			if currentState.workers != nil && it.validateParallel(ctx, currentState, arr, start) {
+				return
+			}
 			for i, elem := range arr {
+				if currentState.stopEarly() {
+					return
+				}
+				if i < start {
+					continue
+				}
 				subState.ClearState()
 				subState.DescendInstanceFromState(currentState, strconv.Itoa(i))
 				it.Schemas[0].ValidateKeyword(ctx, subState, elem)
-				subState.SetEvaluatedIndex(i)
-				// TODO(arqu): this might clash with additional/unevaluated
-				// Properties/Items, should separate out
-				currentState.UpdateEvaluatedPropsAndItems(subState)
+				currentState.SetEvaluatedIndex(i)
 			}
 		} else {
 			subState := currentState.NewSubState()
-			subState.DescendBase("items")
 			for i, vs := range it.Schemas {
+				if currentState.stopEarly() {
+					return
+				}
 				if i < len(arr) {
 					subState.ClearState()
+					subState.DescendBaseFromState(currentState, "items", strconv.Itoa(i))
 					subState.DescendRelativeFromState(currentState, "items", strconv.Itoa(i))
 					subState.DescendInstanceFromState(currentState, strconv.Itoa(i))
 
 					vs.ValidateKeyword(ctx, subState, arr[i])
-					subState.SetEvaluatedIndex(i)
-					currentState.UpdateEvaluatedPropsAndItems(subState)
+					currentState.SetEvaluatedIndex(i)
 				}
 			}
 		}
 	}
 }
 
+// validateParallel validates the elements of arr from start against the
+// single items schema concurrently, reporting false if they have to be
+// validated sequentially
+func (it Items) validateParallel(ctx context.Context, currentState *ValidationState, arr []interface{}, start int) bool {
+	branches := []*parallelBranch{}
+	for i := start; i < len(arr); i++ {
+		branches = append(branches, &parallelBranch{token: strconv.Itoa(i), data: arr[i], sch: it.Schemas[0]})
+	}
+	if !runParallel(ctx, currentState, branches, false, "items") {
+		return false
+	}
+	for i := start; i < len(arr); i++ {
+		currentState.SetEvaluatedIndex(i)
+	}
+	return true
+}
+
 // JSONProp implements the JSONPather for Items
 func (it Items) JSONProp(name string) interface{} {
 	idx, err := strconv.Atoi(name)
@@ -117,13 +159,24 @@ func (it Items) JSONChildren() (res map[string]interface{}) {
 
 // UnmarshalJSON implements the json.Unmarshaler interface for Items
 func (it *Items) UnmarshalJSON(data []byte) error {
-	s := &Schema{}
-	if err := json.Unmarshal(data, s); err == nil {
-		*it = Items{single: true, Schemas: []*Schema{s}}
+	return it.unmarshalSubschemas(data, nil)
+}
+
+// unmarshalSubschemas implements the subschemaUnmarshaler interface for Items
+func (it *Items) unmarshalSubschemas(data []byte, pc *parseContext) error {
+	s, err := pc.parseSchema(data)
+	if err == nil {
+		*it = Items{single: true, schemaOnly: it.schemaOnly, Schemas: []*Schema{s}}
 		return nil
 	}
-	ss := []*Schema{}
-	if err := json.Unmarshal(data, &ss); err != nil {
+	if it.schemaOnly {
+		if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+			return fmt.Errorf("items must be a schema, tuples are declared with prefixItems")
+		}
+		return err
+	}
+	ss, err := pc.parseSchemaList(data)
+	if err != nil {
 		return err
 	}
 	*it = Items{Schemas: ss}
@@ -138,6 +191,96 @@ func (it Items) MarshalJSON() ([]byte, error) {
 	return json.Marshal([]*Schema(it.Schemas))
 }
 
+// PrefixItems defines the prefixItems JSON Schema keyword
+type PrefixItems []*Schema
+
+// NewPrefixItems allocates a new PrefixItems keyword
+func NewPrefixItems() Keyword {
+	return &PrefixItems{}
+}
+
+// unmarshalSubschemas implements the subschemaUnmarshaler interface for PrefixItems
+func (p *PrefixItems) unmarshalSubschemas(data []byte, pc *parseContext) error {
+	list, err := pc.parseSchemaList(data)
+	if err != nil {
+		return err
+	}
+	*p = PrefixItems(list)
+	return nil
+}
+
+// Register implements the Keyword interface for PrefixItems
+func (p *PrefixItems) Register(uri string, registry *SchemaRegistry) {
+	for _, v := range *p {
+		v.Register(uri, registry)
+	}
+}
+
+// Resolve implements the Keyword interface for PrefixItems
+func (p *PrefixItems) Resolve(pointer jptr.Pointer, uri string) *Schema {
+	if pointer == nil {
+		return nil
+	}
+	current := pointer.Head()
+	if current == nil {
+		return nil
+	}
+
+	pos, err := strconv.Atoi(*current)
+	if err != nil {
+		return nil
+	}
+
+	if pos < 0 || pos >= len(*p) {
+		return nil
+	}
+
+	return (*p)[pos].Resolve(pointer.Tail(), uri)
+}
+
+// ValidateKeyword implements the Keyword interface for PrefixItems
+func (p PrefixItems) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
+	schemaDebug("[PrefixItems] Validating")
+	if arr, ok := data.([]interface{}); ok {
+		subState := currentState.NewSubState()
+		for i, vs := range p {
+			if currentState.stopEarly() {
+				return
+			}
+			if i < len(arr) {
+				subState.ClearState()
+				subState.DescendBaseFromState(currentState, "prefixItems", strconv.Itoa(i))
+				subState.DescendRelativeFromState(currentState, "prefixItems", strconv.Itoa(i))
+				subState.DescendInstanceFromState(currentState, strconv.Itoa(i))
+
+				vs.ValidateKeyword(ctx, subState, arr[i])
+				currentState.SetEvaluatedIndex(i)
+			}
+		}
+	}
+}
+
+// JSONProp implements the JSONPather for PrefixItems
+func (p PrefixItems) JSONProp(name string) interface{} {
+	idx, err := strconv.Atoi(name)
+	if err != nil {
+		return nil
+	}
+	if idx >= len(p) || idx < 0 {
+		return nil
+	}
+	return p[idx]
+}
+
+// JSONChildren implements the JSONContainer interface for PrefixItems
+func (p PrefixItems) JSONChildren() (res map[string]interface{}) {
+	res = map[string]interface{}{}
+	for i, sch := range p {
+		res[strconv.Itoa(i)] = sch
+	}
+	return
+}
+
 // MaxItems defines the maxItems JSON Schema keyword
 type MaxItems int
 
@@ -159,7 +302,7 @@ func (m MaxItems) ValidateKeyword(ctx context.Context, currentState *ValidationS
 	schemaDebug("[MaxItems] Validating")
 	if arr, ok := data.([]interface{}); ok {
 		if len(arr) > int(m) {
-			currentState.AddError(data, fmt.Sprintf("array length %d exceeds %d max", len(arr), m))
+			currentState.AddErrorWithLimit(data, int(m), fmt.Sprintf("array length %d exceeds %d max", len(arr), m))
 			return
 		}
 	}
@@ -186,7 +329,7 @@ func (m MinItems) ValidateKeyword(ctx context.Context, currentState *ValidationS
 	schemaDebug("[MinItems] Validating")
 	if arr, ok := data.([]interface{}); ok {
 		if len(arr) < int(m) {
-			currentState.AddError(data, fmt.Sprintf("array length %d below %d minimum items", len(arr), m))
+			currentState.AddErrorWithLimit(data, int(m), fmt.Sprintf("array length %d below %d minimum items", len(arr), m))
 			return
 		}
 	}
@@ -212,15 +355,13 @@ func (u *UniqueItems) Resolve(pointer jptr.Pointer, uri string) *Schema {
 func (u UniqueItems) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
 	schemaDebug("[UniqueItems] Validating")
 	if arr, ok := data.([]interface{}); ok {
-		found := []interface{}{}
-		for _, elem := range arr {
-			for _, f := range found {
-				if reflect.DeepEqual(f, elem) {
-					currentState.AddError(data, fmt.Sprintf("array items must be unique. duplicated entry: %v", elem))
+		for i := range arr {
+			for j := 0; j < i; j++ {
+				if jsonEqual(arr[j], arr[i]) {
+					currentState.AddError(data, fmt.Sprintf("array items must be unique. items %d and %d are equal: %s", j, i, InvalidValueStringN(arr[i], currentState.Options.maxErrStringLen())))
 					return
 				}
 			}
-			found = append(found, elem)
 		}
 	}
 }
@@ -248,27 +389,40 @@ func (c *Contains) ValidateKeyword(ctx context.Context, currentState *Validation
 	schemaDebug("[Contains] Validating")
 	v := Schema(*c)
 	if arr, ok := data.([]interface{}); ok {
-		valid := false
-		matchCount := 0
+		matched := []int{}
 		subState := currentState.NewSubState()
 		subState.ClearState()
 		subState.DescendBase("contains")
 		subState.DescendRelative("contains")
+		subState.Errs = &[]KeyError{}
 		for i, elem := range arr {
 			subState.ClearState()
 			subState.DescendInstanceFromState(currentState, strconv.Itoa(i))
-			subState.Errs = &[]KeyError{}
+			*subState.Errs = (*subState.Errs)[:0]
 			v.ValidateKeyword(ctx, subState, elem)
 			if subState.IsValid() {
-				valid = true
-				matchCount++
+				matched = append(matched, i)
+				// matching items are evaluated for unevaluatedItems
+				currentState.evaluatedIndexes.add(i)
 			}
 		}
-		if valid {
-			currentState.Misc["containsCount"] = matchCount
-		} else {
-			currentState.AddError(data, fmt.Sprintf("must contain at least one of: %v", c))
+		currentState.Misc["containsCount"] = len(matched)
+		if len(matched) > 0 {
+			// the indexes of matching items are annotated for reporting
+			currentState.AddAnnotation("contains", matched, fmt.Sprintf("%d items match contains", len(matched)))
+			return
+		}
+		if currentState.Local != nil {
+			if min, ok := currentState.Local.keywords["minContains"].(*MinContains); ok && *min == 0 {
+				// minContains of 0 allows arrays without matching items
+				return
+			}
 		}
+		schema, err := json.Marshal(c)
+		if err != nil {
+			schema = []byte(err.Error())
+		}
+		currentState.AddError(data, fmt.Sprintf("must contain at least one of: %s", schema))
 	}
 }
 
@@ -289,14 +443,24 @@ func (c Contains) JSONChildren() (res map[string]interface{}) {
 
 // UnmarshalJSON implements the json.Unmarshaler interface for Contains
 func (c *Contains) UnmarshalJSON(data []byte) error {
-	var sch Schema
-	if err := json.Unmarshal(data, &sch); err != nil {
+	return c.unmarshalSubschemas(data, nil)
+}
+
+// unmarshalSubschemas implements the subschemaUnmarshaler interface for Contains
+func (c *Contains) unmarshalSubschemas(data []byte, pc *parseContext) error {
+	sch, err := pc.parseSchema(data)
+	if err != nil {
 		return err
 	}
-	*c = Contains(sch)
+	*c = Contains(*sch)
 	return nil
 }
 
+// MarshalJSON implements the json.Marshaler interface for Contains
+func (c Contains) MarshalJSON() ([]byte, error) {
+	return json.Marshal(Schema(c))
+}
+
 // MaxContains defines the maxContains JSON Schema keyword
 type MaxContains int
 
@@ -316,10 +480,10 @@ func (m *MaxContains) Resolve(pointer jptr.Pointer, uri string) *Schema {
 // ValidateKeyword implements the Keyword interface for MaxContains
 func (m MaxContains) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
 	schemaDebug("[MaxContains] Validating")
-	if arr, ok := data.([]interface{}); ok {
-		if containsCount, ok := currentState.Misc["containsCount"]; ok {
-			if containsCount.(int) > int(m) {
-				currentState.AddError(data, fmt.Sprintf("contained items %d exceeds %d max", len(arr), m))
+	if _, ok := data.([]interface{}); ok {
+		if containsCount, ok := currentState.ContainsCount(); ok {
+			if containsCount > int(m) {
+				currentState.AddErrorWithLimit(data, int(m), fmt.Sprintf("contained items %d exceeds %d max", containsCount, m))
 			}
 		}
 	}
@@ -344,10 +508,11 @@ func (m *MinContains) Resolve(pointer jptr.Pointer, uri string) *Schema {
 // ValidateKeyword implements the Keyword interface for MinContains
 func (m MinContains) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
 	schemaDebug("[MinContains] Validating")
-	if arr, ok := data.([]interface{}); ok {
-		if containsCount, ok := currentState.Misc["containsCount"]; ok {
-			if containsCount.(int) < int(m) {
-				currentState.AddError(data, fmt.Sprintf("contained items %d bellow %d min", len(arr), m))
+	if _, ok := data.([]interface{}); ok {
+		// without any match contains has already reported the error
+		if containsCount, ok := currentState.ContainsCount(); ok && containsCount > 0 {
+			if containsCount < int(m) {
+				currentState.AddErrorWithLimit(data, int(m), fmt.Sprintf("contained items %d bellow %d min", containsCount, m))
 			}
 		}
 	}
@@ -377,19 +542,21 @@ func (ai *AdditionalItems) ValidateKeyword(ctx context.Context, currentState *Va
 	if arr, ok := data.([]interface{}); ok {
 		if currentState.LastEvaluatedIndex > -1 && currentState.LastEvaluatedIndex < len(arr) {
 			for i := currentState.LastEvaluatedIndex + 1; i < len(arr); i++ {
+				if currentState.stopEarly() {
+					return
+				}
 				if ai.schemaType == schemaTypeFalse {
 					currentState.AddError(data, "additional items are not allowed")
 					return
 				}
 				subState := currentState.NewSubState()
 				subState.ClearState()
-				subState.SetEvaluatedIndex(i)
 				subState.DescendBase("additionalItems")
 				subState.DescendRelative("additionalItems")
 				subState.DescendInstance(strconv.Itoa(i))
 
 				(*Schema)(ai).ValidateKeyword(ctx, subState, arr[i])
-				currentState.UpdateEvaluatedPropsAndItems(subState)
+				currentState.SetEvaluatedIndex(i)
 			}
 		}
 	}
@@ -402,14 +569,24 @@ func (ai *AdditionalItems) GetSchema() *Schema {
 
 // UnmarshalJSON implements the json.Unmarshaler interface for AdditionalItems
 func (ai *AdditionalItems) UnmarshalJSON(data []byte) error {
-	sch := &Schema{}
-	if err := json.Unmarshal(data, sch); err != nil {
+	return ai.unmarshalSubschemas(data, nil)
+}
+
+// unmarshalSubschemas implements the subschemaUnmarshaler interface for AdditionalItems
+func (ai *AdditionalItems) unmarshalSubschemas(data []byte, pc *parseContext) error {
+	sch, err := pc.parseSchema(data)
+	if err != nil {
 		return err
 	}
-	*ai = (AdditionalItems)(*sch)
+	*ai = AdditionalItems(*sch)
 	return nil
 }
 
+// MarshalJSON implements the json.Marshaler interface for AdditionalItems
+func (ai AdditionalItems) MarshalJSON() ([]byte, error) {
+	return json.Marshal(Schema(ai))
+}
+
 // UnevaluatedItems defines the unevaluatedItems JSON Schema keyword
 type UnevaluatedItems Schema
 
@@ -432,20 +609,25 @@ func (ui *UnevaluatedItems) Resolve(pointer jptr.Pointer, uri string) *Schema {
 func (ui *UnevaluatedItems) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
 	schemaDebug("[UnevaluatedItems] Validating")
 	if arr, ok := data.([]interface{}); ok {
-		if currentState.LastEvaluatedIndex < len(arr) {
-			for i := currentState.LastEvaluatedIndex + 1; i < len(arr); i++ {
-				if ui.schemaType == schemaTypeFalse {
-					currentState.AddError(data, "unevaluated items are not allowed")
-					return
-				}
-				subState := currentState.NewSubState()
-				subState.ClearState()
-				subState.DescendBase("unevaluatedItems")
-				subState.DescendRelative("unevaluatedItems")
-				subState.DescendInstance(strconv.Itoa(i))
-
-				(*Schema)(ui).ValidateKeyword(ctx, subState, arr[i])
+		for i := range arr {
+			if currentState.stopEarly() {
+				return
 			}
+			if currentState.IsEvaluatedIndex(i) {
+				continue
+			}
+			if ui.schemaType == schemaTypeFalse {
+				currentState.AddError(data, "unevaluated items are not allowed")
+				return
+			}
+			subState := currentState.NewSubState()
+			subState.ClearState()
+			subState.DescendBase("unevaluatedItems")
+			subState.DescendRelative("unevaluatedItems")
+			subState.DescendInstance(strconv.Itoa(i))
+
+			(*Schema)(ui).ValidateKeyword(ctx, subState, arr[i])
+			currentState.evaluatedIndexes.add(i)
 		}
 	}
 }
@@ -457,10 +639,20 @@ func (ui *UnevaluatedItems) GetSchema() *Schema {
 
 // UnmarshalJSON implements the json.Unmarshaler interface for UnevaluatedItems
 func (ui *UnevaluatedItems) UnmarshalJSON(data []byte) error {
-	sch := &Schema{}
-	if err := json.Unmarshal(data, sch); err != nil {
+	return ui.unmarshalSubschemas(data, nil)
+}
+
+// unmarshalSubschemas implements the subschemaUnmarshaler interface for UnevaluatedItems
+func (ui *UnevaluatedItems) unmarshalSubschemas(data []byte, pc *parseContext) error {
+	sch, err := pc.parseSchema(data)
+	if err != nil {
 		return err
 	}
-	*ui = (UnevaluatedItems)(*sch)
+	*ui = UnevaluatedItems(*sch)
 	return nil
 }
+
+// MarshalJSON implements the json.Marshaler interface for UnevaluatedItems
+func (ui UnevaluatedItems) MarshalJSON() ([]byte, error) {
+	return json.Marshal(Schema(ui))
+}
@@ -3,6 +3,7 @@ package jsonschema
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"strconv"
 
 	jptr "github.com/qri-io/jsonpointer"
@@ -16,6 +17,16 @@ func NewAllOf() Keyword {
 	return &AllOf{}
 }
 
+// unmarshalSubschemas implements the subschemaUnmarshaler interface for AllOf
+func (a *AllOf) unmarshalSubschemas(data []byte, pc *parseContext) error {
+	list, err := pc.parseSchemaList(data)
+	if err != nil {
+		return err
+	}
+	*a = AllOf(list)
+	return nil
+}
+
 // Register implements the Keyword interface for AllOf
 func (a *AllOf) Register(uri string, registry *SchemaRegistry) {
 	for _, sch := range *a {
@@ -43,31 +54,29 @@ func (a *AllOf) Resolve(pointer jptr.Pointer, uri string) *Schema {
 	}
 
 	return (*a)[pos].Resolve(pointer.Tail(), uri)
-
-	return nil
 }
 
 // ValidateKeyword implements the Keyword interface for AllOf
 func (a *AllOf) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
 	schemaDebug("[AllOf] Validating")
-	stateCopy := currentState.NewSubState()
-	stateCopy.ClearState()
+	stateCopy := currentState.Clone()
 	invalid := false
 	for i, sch := range *a {
-		subState := currentState.NewSubState()
-		subState.ClearState()
+		if currentState.stopEarly() {
+			return
+		}
+		subState := currentState.Clone()
 		subState.DescendBase("allOf", strconv.Itoa(i))
 		subState.DescendRelative("allOf", strconv.Itoa(i))
-		subState.Errs = &[]KeyError{}
 		sch.ValidateKeyword(ctx, subState, data)
 		currentState.AddSubErrors(*subState.Errs...)
-		stateCopy.UpdateEvaluatedPropsAndItems(subState)
+		stateCopy.Merge(subState)
 		if !subState.IsValid() {
 			invalid = true
 		}
 	}
 	if !invalid {
-		currentState.UpdateEvaluatedPropsAndItems(stateCopy)
+		currentState.Merge(stateCopy)
 	}
 }
 
@@ -100,6 +109,16 @@ func NewAnyOf() Keyword {
 	return &AnyOf{}
 }
 
+// unmarshalSubschemas implements the subschemaUnmarshaler interface for AnyOf
+func (a *AnyOf) unmarshalSubschemas(data []byte, pc *parseContext) error {
+	list, err := pc.parseSchemaList(data)
+	if err != nil {
+		return err
+	}
+	*a = AnyOf(list)
+	return nil
+}
+
 // Register implements the Keyword interface for AnyOf
 func (a *AnyOf) Register(uri string, registry *SchemaRegistry) {
 	for _, sch := range *a {
@@ -127,27 +146,27 @@ func (a *AnyOf) Resolve(pointer jptr.Pointer, uri string) *Schema {
 	}
 
 	return (*a)[pos].Resolve(pointer.Tail(), uri)
-
-	return nil
 }
 
 // ValidateKeyword implements the Keyword interface for AnyOf
 func (a *AnyOf) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
 	schemaDebug("[AnyOf] Validating")
+	branchErrs := []KeyError{}
 	for i, sch := range *a {
-		subState := currentState.NewSubState()
-		subState.ClearState()
+		subState := currentState.Clone()
 		subState.DescendBase("anyOf", strconv.Itoa(i))
 		subState.DescendRelative("anyOf", strconv.Itoa(i))
-		subState.Errs = &[]KeyError{}
 		sch.ValidateKeyword(ctx, subState, data)
 		if subState.IsValid() {
-			currentState.UpdateEvaluatedPropsAndItems(subState)
+			currentState.Merge(subState)
 			return
 		}
+		branchErrs = append(branchErrs, *subState.Errs...)
 	}
 
 	currentState.AddError(data, "did Not match any specified AnyOf schemas")
+	// the errors of each branch are located under anyOf/<index>
+	currentState.AddSubErrors(branchErrs...)
 }
 
 // JSONProp implements the JSONPather for AnyOf
@@ -179,6 +198,16 @@ func NewOneOf() Keyword {
 	return &OneOf{}
 }
 
+// unmarshalSubschemas implements the subschemaUnmarshaler interface for OneOf
+func (o *OneOf) unmarshalSubschemas(data []byte, pc *parseContext) error {
+	list, err := pc.parseSchemaList(data)
+	if err != nil {
+		return err
+	}
+	*o = OneOf(list)
+	return nil
+}
+
 // Register implements the Keyword interface for OneOf
 func (o *OneOf) Register(uri string, registry *SchemaRegistry) {
 	for _, sch := range *o {
@@ -206,36 +235,36 @@ func (o *OneOf) Resolve(pointer jptr.Pointer, uri string) *Schema {
 	}
 
 	return (*o)[pos].Resolve(pointer.Tail(), uri)
-
-	return nil
 }
 
 // ValidateKeyword implements the Keyword interface for OneOf
 func (o *OneOf) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
 	schemaDebug("[OneOf] Validating")
-	matched := false
-	stateCopy := currentState.NewSubState()
-	stateCopy.ClearState()
+	matched := -1
+	var matchedState *ValidationState
+	branchErrs := []KeyError{}
 	for i, sch := range *o {
-		subState := currentState.NewSubState()
-		subState.ClearState()
+		subState := currentState.Clone()
 		subState.DescendBase("oneOf", strconv.Itoa(i))
 		subState.DescendRelative("oneOf", strconv.Itoa(i))
-		subState.Errs = &[]KeyError{}
 		sch.ValidateKeyword(ctx, subState, data)
-		stateCopy.UpdateEvaluatedPropsAndItems(subState)
 		if subState.IsValid() {
-			if matched {
-				currentState.AddError(data, "matched more than one specified OneOf schemas")
+			if matched >= 0 {
+				currentState.AddError(data, fmt.Sprintf("matched more than one specified OneOf schemas, at indexes %d and %d", matched, i))
 				return
 			}
-			matched = true
+			matched = i
+			matchedState = subState
+		} else {
+			branchErrs = append(branchErrs, *subState.Errs...)
 		}
 	}
-	if !matched {
+	if matched < 0 {
 		currentState.AddError(data, "did not match any of the specified OneOf schemas")
+		// the errors of each branch are located under oneOf/<index>
+		currentState.AddSubErrors(branchErrs...)
 	} else {
-		currentState.UpdateEvaluatedPropsAndItems(stateCopy)
+		currentState.Merge(matchedState)
 	}
 }
 
@@ -281,11 +310,13 @@ func (n *Not) Resolve(pointer jptr.Pointer, uri string) *Schema {
 // ValidateKeyword implements the Keyword interface for Not
 func (n *Not) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
 	schemaDebug("[Not] Validating")
-	subState := currentState.NewSubState()
+	// not only passes when its subschema fails, so the branch is never merged
+	// and the errors, annotations and evaluated properties and items of the
+	// subschema are all discarded
+	subState := currentState.Clone()
 	subState.DescendBase("not")
 	subState.DescendRelative("not")
 
-	subState.Errs = &[]KeyError{}
 	sch := Schema(*n)
 	sch.ValidateKeyword(ctx, subState, data)
 	if subState.IsValid() {
@@ -310,11 +341,16 @@ func (n Not) JSONChildren() (res map[string]interface{}) {
 
 // UnmarshalJSON implements the json.Unmarshaler interface for Not
 func (n *Not) UnmarshalJSON(data []byte) error {
-	var sch Schema
-	if err := json.Unmarshal(data, &sch); err != nil {
+	return n.unmarshalSubschemas(data, nil)
+}
+
+// unmarshalSubschemas implements the subschemaUnmarshaler interface for Not
+func (n *Not) unmarshalSubschemas(data []byte, pc *parseContext) error {
+	sch, err := pc.parseSchema(data)
+	if err != nil {
 		return err
 	}
-	*n = Not(sch)
+	*n = Not(*sch)
 	return nil
 }
 
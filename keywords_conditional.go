@@ -28,25 +28,22 @@ func (f *If) Resolve(pointer jptr.Pointer, uri string) *Schema {
 // ValidateKeyword implements the Keyword interface for If
 func (f *If) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
 	schemaDebug("[If] Validating")
-	thenKW := currentState.Local.keywords["then"]
-	elseKW := currentState.Local.keywords["else"]
-
-	if thenKW == nil && elseKW == nil {
-		// no then or else for if, aborting validation
-		schemaDebug("[If] Aborting validation as no then or else is present")
-		return
-	}
-
-	subState := currentState.NewSubState()
-	subState.ClearState()
+	subState := currentState.Clone()
 	subState.DescendBase("if")
 	subState.DescendRelative("if")
 
-	subState.Errs = &[]KeyError{}
 	sch := Schema(*f)
 	sch.ValidateKeyword(ctx, subState, data)
 
 	currentState.Misc["ifResult"] = subState.IsValid()
+	// if is only a condition, then and else don't see
+	// the instance as it coerced it, so neither does the result
+	*subState.coercions = map[string]interface{}{}
+	if subState.IsValid() {
+		// properties evaluated by a passing if are kept even
+		// when there is no then keyword
+		currentState.Merge(subState)
+	}
 }
 
 // GetSchema implements the SchemaKeyword for If
@@ -66,11 +63,16 @@ func (f If) JSONChildren() (res map[string]interface{}) {
 
 // UnmarshalJSON implements the json.Unmarshaler interface for If
 func (f *If) UnmarshalJSON(data []byte) error {
-	var sch Schema
-	if err := json.Unmarshal(data, &sch); err != nil {
+	return f.unmarshalSubschemas(data, nil)
+}
+
+// unmarshalSubschemas implements the subschemaUnmarshaler interface for If
+func (f *If) unmarshalSubschemas(data []byte, pc *parseContext) error {
+	sch, err := pc.parseSchema(data)
+	if err != nil {
 		return err
 	}
-	*f = If(sch)
+	*f = If(*sch)
 	return nil
 }
 
@@ -112,13 +114,16 @@ func (t *Then) ValidateKeyword(ctx context.Context, currentState *ValidationStat
 		return
 	}
 
-	subState := currentState.NewSubState()
+	subState := currentState.Clone()
 	subState.DescendBase("then")
 	subState.DescendRelative("then")
 
 	sch := Schema(*t)
 	sch.ValidateKeyword(ctx, subState, data)
-	currentState.UpdateEvaluatedPropsAndItems(subState)
+	currentState.AddSubErrors(*subState.Errs...)
+	if subState.IsValid() {
+		currentState.Merge(subState)
+	}
 }
 
 // GetSchema implements the SchemaKeyword for Then
@@ -138,11 +143,16 @@ func (t Then) JSONChildren() (res map[string]interface{}) {
 
 // UnmarshalJSON implements the json.Unmarshaler interface for Then
 func (t *Then) UnmarshalJSON(data []byte) error {
-	var sch Schema
-	if err := json.Unmarshal(data, &sch); err != nil {
+	return t.unmarshalSubschemas(data, nil)
+}
+
+// unmarshalSubschemas implements the subschemaUnmarshaler interface for Then
+func (t *Then) unmarshalSubschemas(data []byte, pc *parseContext) error {
+	sch, err := pc.parseSchema(data)
+	if err != nil {
 		return err
 	}
-	*t = Then(sch)
+	*t = Then(*sch)
 	return nil
 }
 
@@ -182,12 +192,16 @@ func (e *Else) ValidateKeyword(ctx context.Context, currentState *ValidationStat
 		return
 	}
 
-	subState := currentState.NewSubState()
+	subState := currentState.Clone()
 	subState.DescendBase("else")
 	subState.DescendRelative("else")
 
 	sch := Schema(*e)
 	sch.ValidateKeyword(ctx, subState, data)
+	currentState.AddSubErrors(*subState.Errs...)
+	if subState.IsValid() {
+		currentState.Merge(subState)
+	}
 }
 
 // GetSchema implements the SchemaKeyword for Else
@@ -207,11 +221,16 @@ func (e Else) JSONChildren() (res map[string]interface{}) {
 
 // UnmarshalJSON implements the json.Unmarshaler interface for Else
 func (e *Else) UnmarshalJSON(data []byte) error {
-	var sch Schema
-	if err := json.Unmarshal(data, &sch); err != nil {
+	return e.unmarshalSubschemas(data, nil)
+}
+
+// unmarshalSubschemas implements the subschemaUnmarshaler interface for Else
+func (e *Else) unmarshalSubschemas(data []byte, pc *parseContext) error {
+	sch, err := pc.parseSchema(data)
+	if err != nil {
 		return err
 	}
-	*e = Else(sch)
+	*e = Else(*sch)
 	return nil
 }
 
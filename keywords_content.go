@@ -0,0 +1,249 @@
+package jsonschema
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"strings"
+	"sync"
+
+	jptr "github.com/qri-io/jsonpointer"
+)
+
+// StrictContentValidation promotes contentSchema failures to validation
+// errors. Per the 2019-09 spec they are only recorded as annotations by default
+var StrictContentValidation = false
+
+var (
+	mediaTypeCheckers = map[string]func([]byte) error{
+		"application/json": isValidJSONContent,
+	}
+	mediaTypeLock sync.RWMutex
+)
+
+// RegisterMediaType registers a function used by the contentMediaType
+// keyword to check content of the given media type. Registering
+// a media type that is already present replaces the existing check
+func RegisterMediaType(name string, check func([]byte) error) {
+	mediaTypeLock.Lock()
+	defer mediaTypeLock.Unlock()
+	mediaTypeCheckers[normalizeMediaType(name)] = check
+}
+
+// getMediaTypeChecker returns the check registered for a given media type
+func getMediaTypeChecker(name string) (func([]byte) error, bool) {
+	mediaTypeLock.RLock()
+	defer mediaTypeLock.RUnlock()
+	check, ok := mediaTypeCheckers[name]
+	return check, ok
+}
+
+// normalizeMediaType strips any parameters from a media type
+// and lowercases the result
+func normalizeMediaType(name string) string {
+	if mt, _, err := mime.ParseMediaType(name); err == nil {
+		return mt
+	}
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// decodedContent returns the content of a string instance, preferring the
+// bytes decoded by contentEncoding if it ran. It returns false if decoding failed
+func decodedContent(currentState *ValidationState, str string) ([]byte, bool) {
+	if decoded, ok := currentState.Misc["contentDecoded"].([]byte); ok {
+		return decoded, true
+	}
+	if currentState.Local != nil && currentState.Local.HasKeyword("contentEncoding") {
+		// contentEncoding failed to decode the instance and
+		// has already reported the error
+		return nil, false
+	}
+	return []byte(str), true
+}
+
+func isValidJSONContent(content []byte) error {
+	var v interface{}
+	return json.Unmarshal(content, &v)
+}
+
+// ContentEncoding defines the contentEncoding JSON Schema keyword
+type ContentEncoding string
+
+// NewContentEncoding allocates a new ContentEncoding keyword
+func NewContentEncoding() Keyword {
+	return new(ContentEncoding)
+}
+
+// Register implements the Keyword interface for ContentEncoding
+func (c *ContentEncoding) Register(uri string, registry *SchemaRegistry) {}
+
+// Resolve implements the Keyword interface for ContentEncoding
+func (c *ContentEncoding) Resolve(pointer jptr.Pointer, uri string) *Schema {
+	return nil
+}
+
+// ValidateKeyword implements the Keyword interface for ContentEncoding
+func (c ContentEncoding) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
+	schemaDebug("[ContentEncoding] Validating")
+	str, ok := data.(string)
+	if !ok {
+		return
+	}
+
+	var (
+		decoded []byte
+		err     error
+	)
+	switch c {
+	case "base64":
+		decoded, err = base64.StdEncoding.DecodeString(str)
+	case "base64url":
+		// padding is optional for base64url
+		decoded, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(str, "="))
+	default:
+		// unknown encodings are treated as annotations and
+		// the content is passed on as is
+		decoded = []byte(str)
+	}
+	if err != nil {
+		currentState.AddError(data, fmt.Sprintf("invalid %s encoding: %s", c, err.Error()))
+		return
+	}
+
+	currentState.Misc["contentDecoded"] = decoded
+}
+
+// ContentMediaType defines the contentMediaType JSON Schema keyword
+type ContentMediaType string
+
+// NewContentMediaType allocates a new ContentMediaType keyword
+func NewContentMediaType() Keyword {
+	return new(ContentMediaType)
+}
+
+// Register implements the Keyword interface for ContentMediaType
+func (c *ContentMediaType) Register(uri string, registry *SchemaRegistry) {}
+
+// Resolve implements the Keyword interface for ContentMediaType
+func (c *ContentMediaType) Resolve(pointer jptr.Pointer, uri string) *Schema {
+	return nil
+}
+
+// ValidateKeyword implements the Keyword interface for ContentMediaType
+func (c ContentMediaType) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
+	schemaDebug("[ContentMediaType] Validating")
+	str, ok := data.(string)
+	if !ok {
+		return
+	}
+
+	content, ok := decodedContent(currentState, str)
+	if !ok {
+		return
+	}
+
+	mediaType := normalizeMediaType(string(c))
+	if strings.HasPrefix(mediaType, "text/") {
+		return
+	}
+	check, ok := getMediaTypeChecker(mediaType)
+	if !ok {
+		// unknown media types are treated as annotations
+		return
+	}
+	if err := check(content); err != nil {
+		currentState.AddError(data, fmt.Sprintf("invalid %s content: %s", mediaType, err.Error()))
+	}
+}
+
+// ContentSchema defines the contentSchema JSON Schema keyword
+type ContentSchema Schema
+
+// NewContentSchema allocates a new ContentSchema keyword
+func NewContentSchema() Keyword {
+	return &ContentSchema{}
+}
+
+// Register implements the Keyword interface for ContentSchema
+func (c *ContentSchema) Register(uri string, registry *SchemaRegistry) {
+	(*Schema)(c).Register(uri, registry)
+}
+
+// Resolve implements the Keyword interface for ContentSchema
+func (c *ContentSchema) Resolve(pointer jptr.Pointer, uri string) *Schema {
+	return (*Schema)(c).Resolve(pointer, uri)
+}
+
+// ValidateKeyword implements the Keyword interface for ContentSchema
+func (c *ContentSchema) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
+	schemaDebug("[ContentSchema] Validating")
+	str, ok := data.(string)
+	if !ok || currentState.Local == nil {
+		return
+	}
+	mediaType, ok := currentState.Local.keywords["contentMediaType"].(*ContentMediaType)
+	if !ok || normalizeMediaType(string(*mediaType)) != "application/json" {
+		return
+	}
+	content, ok := decodedContent(currentState, str)
+	if !ok {
+		return
+	}
+	var doc interface{}
+	if err := json.Unmarshal(content, &doc); err != nil {
+		// contentMediaType has already reported the error
+		return
+	}
+
+	subState := currentState.NewSubState()
+	subState.ClearState()
+	subState.DescendBase("contentSchema")
+	subState.DescendRelative("contentSchema")
+	subState.Errs = &[]KeyError{}
+	(*Schema)(c).ValidateKeyword(ctx, subState, doc)
+
+	if StrictContentValidation {
+		currentState.AddSubErrors(*subState.Errs...)
+		return
+	}
+	for _, err := range *subState.Errs {
+		currentState.AddAnnotation("contentSchema", err.InvalidValue, err.Error())
+	}
+}
+
+// GetSchema implements the SchemaKeyword for ContentSchema
+func (c *ContentSchema) GetSchema() *Schema {
+	return (*Schema)(c)
+}
+
+// JSONProp implements the JSONPather for ContentSchema
+func (c ContentSchema) JSONProp(name string) interface{} {
+	return Schema(c).JSONProp(name)
+}
+
+// JSONChildren implements the JSONContainer interface for ContentSchema
+func (c ContentSchema) JSONChildren() (res map[string]interface{}) {
+	return Schema(c).JSONChildren()
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface for ContentSchema
+func (c *ContentSchema) UnmarshalJSON(data []byte) error {
+	return c.unmarshalSubschemas(data, nil)
+}
+
+// unmarshalSubschemas implements the subschemaUnmarshaler interface for ContentSchema
+func (c *ContentSchema) unmarshalSubschemas(data []byte, pc *parseContext) error {
+	sch, err := pc.parseSchema(data)
+	if err != nil {
+		return err
+	}
+	*c = ContentSchema(*sch)
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface for ContentSchema
+func (c ContentSchema) MarshalJSON() ([]byte, error) {
+	return json.Marshal(Schema(c))
+}
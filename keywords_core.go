@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/url"
+	"sort"
 	"strings"
+	"sync"
 
 	jptr "github.com/qri-io/jsonpointer"
 )
@@ -21,6 +23,9 @@ func NewSchemaURI() Keyword {
 // ValidateKeyword implements the Keyword interface for SchemaURI
 func (s *SchemaURI) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
 	schemaDebug("[SchemaURI] Validating")
+	if _, ok := DraftFromURI(string(*s)); !ok {
+		currentState.AddAnnotation("$schema", string(*s), fmt.Sprintf("unknown $schema, validating as draft %s", DefaultDraft))
+	}
 }
 
 // Register implements the Keyword interface for SchemaURI
@@ -31,6 +36,89 @@ func (s *SchemaURI) Resolve(pointer jptr.Pointer, uri string) *Schema {
 	return nil
 }
 
+var (
+	supportedVocabularies = map[string]bool{
+		"https://json-schema.org/draft/2019-09/vocab/core":       true,
+		"https://json-schema.org/draft/2019-09/vocab/applicator": true,
+		"https://json-schema.org/draft/2019-09/vocab/validation": true,
+		"https://json-schema.org/draft/2019-09/vocab/meta-data":  true,
+		"https://json-schema.org/draft/2019-09/vocab/format":     true,
+		"https://json-schema.org/draft/2019-09/vocab/content":    true,
+
+		"https://json-schema.org/draft/2020-12/vocab/core":              true,
+		"https://json-schema.org/draft/2020-12/vocab/applicator":        true,
+		"https://json-schema.org/draft/2020-12/vocab/unevaluated":       true,
+		"https://json-schema.org/draft/2020-12/vocab/validation":        true,
+		"https://json-schema.org/draft/2020-12/vocab/meta-data":         true,
+		"https://json-schema.org/draft/2020-12/vocab/format-annotation": true,
+		"https://json-schema.org/draft/2020-12/vocab/content":           true,
+	}
+	vocabularyLock sync.RWMutex
+)
+
+// RegisterVocabulary marks a vocabulary URI as supported. Authors of custom
+// keywords should register the vocabularies they implement before parsing
+// any schema that requires them
+func RegisterVocabulary(uri string) {
+	vocabularyLock.Lock()
+	defer vocabularyLock.Unlock()
+	supportedVocabularies[uri] = true
+}
+
+// IsSupportedVocabulary checks if a vocabulary URI has been registered
+func IsSupportedVocabulary(uri string) bool {
+	vocabularyLock.RLock()
+	defer vocabularyLock.RUnlock()
+	return supportedVocabularies[uri]
+}
+
+// Vocabulary defines the $vocabulary JSON Schema keyword
+type Vocabulary map[string]bool
+
+// NewVocabulary allocates a new Vocabulary keyword
+func NewVocabulary() Keyword {
+	return &Vocabulary{}
+}
+
+// ValidateKeyword implements the Keyword interface for Vocabulary
+func (v *Vocabulary) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
+	schemaDebug("[Vocabulary] Validating")
+}
+
+// Register implements the Keyword interface for Vocabulary
+func (v *Vocabulary) Register(uri string, registry *SchemaRegistry) {}
+
+// Resolve implements the Keyword interface for Vocabulary
+func (v *Vocabulary) Resolve(pointer jptr.Pointer, uri string) *Schema {
+	return nil
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface for Vocabulary
+// required vocabularies which are not supported error out
+func (v *Vocabulary) UnmarshalJSON(data []byte) error {
+	vocab := map[string]bool{}
+	if err := json.Unmarshal(data, &vocab); err != nil {
+		return err
+	}
+	// URIs are checked in order, so the same one is always reported
+	uris := make([]string, 0, len(vocab))
+	for uri := range vocab {
+		uris = append(uris, uri)
+	}
+	sort.Strings(uris)
+	for _, uri := range uris {
+		if vocab[uri] && !IsSupportedVocabulary(uri) {
+			return KeyError{
+				PropertyPath: "/$vocabulary",
+				InvalidValue: uri,
+				Message:      "required vocabulary is not supported",
+			}
+		}
+	}
+	*v = Vocabulary(vocab)
+	return nil
+}
+
 // ID defines the $id JSON Schema keyword
 type ID string
 
@@ -151,6 +239,16 @@ func (d *Default) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// MarshalJSON implements the json.Marshaler interface for Default
+func (d Default) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.data)
+}
+
+// Value returns the default value
+func (d Default) Value() interface{} {
+	return d.data
+}
+
 // Examples defines the examples JSON Schema keyword
 type Examples []interface{}
 
@@ -183,6 +281,9 @@ func NewReadOnly() Keyword {
 // ValidateKeyword implements the Keyword interface for ReadOnly
 func (r *ReadOnly) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
 	schemaDebug("[ReadOnly] Validating")
+	if *r && currentState.Options.mode() == ModeWrite {
+		currentState.AddError(data, "value is read-only")
+	}
 }
 
 // Register implements the Keyword interface for ReadOnly
@@ -204,6 +305,9 @@ func NewWriteOnly() Keyword {
 // ValidateKeyword implements the Keyword interface for WriteOnly
 func (w *WriteOnly) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
 	schemaDebug("[WriteOnly] Validating")
+	if *w && currentState.Options.mode() == ModeRead {
+		currentState.AddError(data, "value is write-only")
+	}
 }
 
 // Register implements the Keyword interface for WriteOnly
@@ -214,6 +318,41 @@ func (w *WriteOnly) Resolve(pointer jptr.Pointer, uri string) *Schema {
 	return nil
 }
 
+// Deprecated defines the deprecated JSON Schema keyword
+type Deprecated bool
+
+// NewDeprecated allocates a new Deprecated keyword
+func NewDeprecated() Keyword {
+	return new(Deprecated)
+}
+
+// ValidateKeyword implements the Keyword interface for Deprecated
+func (d *Deprecated) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
+	schemaDebug("[Deprecated] Validating")
+	if *d {
+		currentState.AddAnnotation("deprecated", true, "value is deprecated")
+	}
+}
+
+// Register implements the Keyword interface for Deprecated
+func (d *Deprecated) Register(uri string, registry *SchemaRegistry) {}
+
+// Resolve implements the Keyword interface for Deprecated
+func (d *Deprecated) Resolve(pointer jptr.Pointer, uri string) *Schema {
+	return nil
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface for Deprecated
+func (d *Deprecated) UnmarshalJSON(data []byte) error {
+	var b bool
+	if err := json.Unmarshal(data, &b); err != nil {
+		// non-boolean values carry no meaning and are ignored
+		schemaDebug("[Deprecated] WARN: ignoring non-boolean value %s", string(data))
+	}
+	*d = Deprecated(b)
+	return nil
+}
+
 // Ref defines the $ref JSON Schema keyword
 type Ref struct {
 	reference         string
@@ -221,6 +360,15 @@ type Ref struct {
 	resolvedRoot      *Schema
 	resolvedFragment  *jptr.Pointer
 	fragmentLocalized bool
+	// resolvedLocation is the location of the resolved
+	// schema within resolvedRoot, if known
+	resolvedLocation *jptr.Pointer
+	// ignoreSiblings makes the ref replace the other keywords
+	// of its schema, as it does in draft7 and earlier
+	ignoreSiblings bool
+	// prepared is set once resolving the ref ahead of validation was
+	// attempted, after which validation no longer resolves it lazily
+	prepared bool
 }
 
 // NewRef allocates a new Ref keyword
@@ -228,35 +376,76 @@ func NewRef() Keyword {
 	return new(Ref)
 }
 
+// newSiblingIgnoringRef allocates a new Ref keyword that ignores the
+// other keywords of its schema, as draft7 and earlier require
+func newSiblingIgnoringRef() Keyword {
+	return &Ref{ignoreSiblings: true}
+}
+
 // ValidateKeyword implements the Keyword interface for Ref
 func (r *Ref) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
 	schemaDebug("[Ref] Validating")
-	if r.resolved == nil {
+	if r.resolved == nil && !r.prepared {
 		r._resolveRef(ctx, currentState)
-		if r.resolved == nil {
-			currentState.AddError(data, fmt.Sprintf("failed to resolve schema for ref %s", r.reference))
-		}
+		r.locateResolved(currentState)
+	}
+	if r.resolved == nil {
+		currentState.AddError(data, fmt.Sprintf("failed to resolve schema for ref %s", r.reference))
+	}
+
+	subState := r.newSubState(currentState)
+	subState.DescendRelative("$ref")
+
+	r.resolved.ValidateKeyword(ctx, subState, data)
+
+	currentState.UpdateEvaluatedPropsAndItems(subState)
+}
+
+// locateResolved records the location of the resolved schema within the
+// root it is evaluated against. Preparing a schema calls it under
+// prepareLock, after which validation only reads the location
+func (r *Ref) locateResolved(currentState *ValidationState) {
+	if r.resolved == nil || r.resolvedLocation != nil {
+		return
+	}
+	root := currentState.Root
+	if r.resolvedRoot != nil {
+		root = r.resolvedRoot
+	}
+	if root == nil {
+		return
 	}
+	if r.resolvedRoot != nil && !r.fragmentLocalized && r.resolvedFragment != nil {
+		r.resolvedLocation = r.resolvedFragment
+	} else if loc, ok := root.locate(r.resolved); ok {
+		r.resolvedLocation = &loc
+	}
+}
 
+// newSubState creates the state the resolved schema is evaluated with
+func (r *Ref) newSubState(currentState *ValidationState) *ValidationState {
 	subState := currentState.NewSubState()
 	subState.ClearState()
 	if r.resolvedRoot != nil {
 		subState.BaseURI = r.resolvedRoot.docPath
 		subState.Root = r.resolvedRoot
 	}
-	if r.resolvedFragment != nil && !r.resolvedFragment.IsEmpty() {
-		subState.BaseRelativeLocation = r.resolvedFragment
+	if r.resolvedLocation != nil {
+		subState.BaseRelativeLocation = r.resolvedLocation
 	}
-	subState.DescendRelative("$ref")
-
-	r.resolved.ValidateKeyword(ctx, subState, data)
-
-	currentState.UpdateEvaluatedPropsAndItems(subState)
+	return subState
 }
 
 // _resolveRef attempts to resolve the reference from the top-level context
 func (r *Ref) _resolveRef(ctx context.Context, currentState *ValidationState) {
 	if IsLocalSchemaID(r.reference) {
+		// plain name fragments address the anchors of the current schema resource
+		if resource := currentState.currentResource(); resource != nil && strings.HasPrefix(r.reference, "#") {
+			if sch, _ := resource.findAnchor(r.reference[1:]); sch != nil {
+				r.resolved = sch
+				return
+			}
+		}
 		r.resolved = currentState.LocalRegistry.GetLocal(r.reference)
 		if r.resolved != nil {
 			return
@@ -290,7 +479,10 @@ func (r *Ref) _resolveRef(ctx context.Context, currentState *ValidationState) {
 
 	if address != "" {
 		if u, err := url.Parse(address); err == nil {
-			if !u.IsAbs() {
+			if !u.IsAbs() && currentState.Local.isResource() && currentState.Local.docPath != "" {
+				// the reference is relative to the $id declared alongside it
+				address, _ = SafeResolveURL(currentState.Local.docPath, address)
+			} else if !u.IsAbs() {
 				address = currentState.Local.id + address
 				if docPath != "" {
 					uriFolder := ""
@@ -326,6 +518,10 @@ func (r *Ref) _resolveRef(ctx context.Context, currentState *ValidationState) {
 		localURI = r.resolvedRoot.docPath
 		if r.fragmentLocalized && !r.resolvedFragment.IsEmpty() {
 			current := r.resolvedFragment.Head()
+			if sch, _ := r.resolvedRoot.findAnchor(*current); sch != nil {
+				r.resolved = sch
+				return
+			}
 			sch := currentState.LocalRegistry.GetLocal("#" + *current)
 			if sch != nil {
 				r.resolved = sch
@@ -364,7 +560,8 @@ func (r *Ref) UnmarshalJSON(data []byte) error {
 	}
 	normalizedRef, _ := url.QueryUnescape(ref)
 	*r = Ref{
-		reference: normalizedRef,
+		reference:      normalizedRef,
+		ignoreSiblings: r.ignoreSiblings,
 	}
 	return nil
 }
@@ -380,8 +577,15 @@ type RecursiveRef struct {
 	resolved         *Schema
 	resolvedRoot     *Schema
 	resolvedFragment *jptr.Pointer
+	// prepared is set once resolving the ref ahead of validation was
+	// attempted, after which validation no longer resolves it lazily
+	prepared bool
+}
 
-	validatingLocations map[string]bool
+// recursiveVisit identifies a $recursiveRef being evaluated at an instance location
+type recursiveVisit struct {
+	ref      *RecursiveRef
+	location string
 }
 
 // NewRecursiveRef allocates a new RecursiveRef keyword
@@ -392,49 +596,43 @@ func NewRecursiveRef() Keyword {
 // ValidateKeyword implements the Keyword interface for RecursiveRef
 func (r *RecursiveRef) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
 	schemaDebug("[RecursiveRef] Validating")
-	if r.isLocationVisited(currentState.InstanceLocation.String()) {
+	visit := recursiveVisit{ref: r, location: currentState.InstanceLocation.String()}
+	if currentState.recursiveRefs == nil {
+		// the guard is created before any sub state, which share it
+		currentState.recursiveRefs = &map[recursiveVisit]bool{}
+	}
+	if (*currentState.recursiveRefs)[visit] {
 		// recursion detected aborting further descent
 		return
 	}
 
-	if r.resolved == nil {
+	if r.resolved == nil && !r.prepared {
 		r._resolveRef(ctx, currentState)
-		if r.resolved == nil {
-			currentState.AddError(data, fmt.Sprintf("failed to resolve schema for ref %s", r.reference))
-		}
-	}
-
-	subState := currentState.NewSubState()
-	subState.ClearState()
-	if r.resolvedRoot != nil {
-		subState.BaseURI = r.resolvedRoot.docPath
-		subState.Root = r.resolvedRoot
 	}
-	if r.resolvedFragment != nil && !r.resolvedFragment.IsEmpty() {
-		subState.BaseRelativeLocation = r.resolvedFragment
+	if r.resolved == nil {
+		currentState.AddError(data, fmt.Sprintf("failed to resolve schema for ref %s", r.reference))
 	}
-	subState.DescendRelative("$recursiveRef")
 
-	if r.validatingLocations == nil {
-		r.validatingLocations = map[string]bool{}
-	}
+	subState := r.newSubState(currentState)
+	subState.DescendRelative("$recursiveRef")
 
-	r.validatingLocations[currentState.InstanceLocation.String()] = true
+	(*currentState.recursiveRefs)[visit] = true
 	r.resolved.ValidateKeyword(ctx, subState, data)
-	r.validatingLocations[currentState.InstanceLocation.String()] = false
+	delete(*currentState.recursiveRefs, visit)
 
 	currentState.UpdateEvaluatedPropsAndItems(subState)
 }
 
-func (r *RecursiveRef) isLocationVisited(location string) bool {
-	if r.validatingLocations == nil {
-		return false
-	}
-	v, ok := r.validatingLocations[location]
-	if !ok {
-		return false
+// newSubState creates the state the resolved schema is evaluated with
+func (r *RecursiveRef) newSubState(currentState *ValidationState) *ValidationState {
+	subState := currentState.NewSubState()
+	subState.ClearState()
+	if r.resolvedRoot != nil {
+		subState.BaseURI = r.resolvedRoot.docPath
+		subState.Root = r.resolvedRoot
+		subState.BaseRelativeLocation = r.resolvedFragment
 	}
-	return v
+	return subState
 }
 
 // _resolveRef attempts to resolve the reference from the top-level context
@@ -561,6 +759,141 @@ func (r RecursiveRef) MarshalJSON() ([]byte, error) {
 	return json.Marshal(r.reference)
 }
 
+// DynamicRef defines the $dynamicRef JSON Schema keyword
+type DynamicRef struct {
+	reference    string
+	baseURI      string
+	resolved     *Schema
+	resolvedRoot *Schema
+	// anchor is set when the reference initially resolves to
+	// a matching $dynamicAnchor, enabling dynamic scope resolution
+	anchor string
+	// prepared is set once resolving the ref ahead of validation was
+	// attempted, after which validation no longer resolves it lazily
+	prepared bool
+}
+
+// NewDynamicRef allocates a new DynamicRef keyword
+func NewDynamicRef() Keyword {
+	return new(DynamicRef)
+}
+
+// ValidateKeyword implements the Keyword interface for DynamicRef
+func (r *DynamicRef) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
+	schemaDebug("[DynamicRef] Validating")
+	if r.resolved == nil && !r.prepared {
+		r._resolveRef(ctx, currentState)
+	}
+	if r.resolved == nil {
+		currentState.AddError(data, fmt.Sprintf("failed to resolve schema for dynamic ref %s", r.reference))
+		return
+	}
+
+	resolved, resolvedRoot := r.resolved, r.resolvedRoot
+	if r.anchor != "" {
+		if resource, sch := currentState.resolveDynamicAnchor(r.anchor); sch != nil {
+			resolved, resolvedRoot = sch, resource
+		}
+	}
+
+	subState := newDynamicRefSubState(currentState, resolved, resolvedRoot)
+	subState.DescendRelative("$dynamicRef")
+
+	resolved.ValidateKeyword(ctx, subState, data)
+
+	currentState.UpdateEvaluatedPropsAndItems(subState)
+}
+
+// newDynamicRefSubState creates the state a schema resolved
+// by a dynamic reference is evaluated with
+func newDynamicRefSubState(currentState *ValidationState, resolved, resolvedRoot *Schema) *ValidationState {
+	subState := currentState.NewSubState()
+	subState.ClearState()
+	if resolvedRoot != nil {
+		if resolvedRoot.docPath != "" {
+			subState.BaseURI = resolvedRoot.docPath
+		}
+		subState.Root = resolvedRoot
+		subState.BaseRelativeLocation = nil
+		if loc, ok := resolvedRoot.locate(resolved); ok {
+			subState.BaseRelativeLocation = &loc
+		}
+	}
+	return subState
+}
+
+// _resolveRef statically resolves the reference against the
+// schema resource the keyword is declared in
+func (r *DynamicRef) _resolveRef(ctx context.Context, currentState *ValidationState) {
+	address, fragment := r.reference, ""
+	if i := strings.Index(r.reference, "#"); i >= 0 {
+		address, fragment = r.reference[:i], r.reference[i+1:]
+	}
+
+	resource := currentState.Root
+	if r.baseURI != "" {
+		if sch := GetSchemaRegistry().GetKnown(r.baseURI); sch != nil {
+			resource = sch
+		}
+	}
+	if address != "" {
+		uri := address
+		if r.baseURI != "" {
+			uri, _ = SafeResolveURL(r.baseURI, address)
+		}
+		resource = GetSchemaRegistry().Get(ctx, uri)
+	}
+	if resource == nil {
+		return
+	}
+	r.resolvedRoot = resource
+
+	switch {
+	case fragment == "":
+		r.resolved = resource
+	case fragment[0] == '/':
+		ptr, err := jptr.Parse(fragment)
+		if err != nil {
+			return
+		}
+		r.resolved = resource.Resolve(ptr, resource.docPath)
+	default:
+		sch, dynamic := resource.findAnchor(fragment)
+		r.resolved = sch
+		if dynamic {
+			r.anchor = fragment
+		}
+	}
+}
+
+// Register implements the Keyword interface for DynamicRef
+func (r *DynamicRef) Register(uri string, registry *SchemaRegistry) {
+	r.baseURI = strings.TrimRight(uri, "#")
+}
+
+// Resolve implements the Keyword interface for DynamicRef
+func (r *DynamicRef) Resolve(pointer jptr.Pointer, uri string) *Schema {
+	return nil
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface for DynamicRef
+func (r *DynamicRef) UnmarshalJSON(data []byte) error {
+	var ref string
+	if err := json.Unmarshal(data, &ref); err != nil {
+		return err
+	}
+	normalizedRef, _ := url.QueryUnescape(ref)
+	*r = DynamicRef{
+		reference: normalizedRef,
+	}
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface for DynamicRef
+func (r DynamicRef) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.reference)
+}
+
 // Anchor defines the $anchor JSON Schema keyword
 type Anchor string
 
@@ -572,6 +905,9 @@ func NewAnchor() Keyword {
 // ValidateKeyword implements the Keyword interface for Anchor
 func (a *Anchor) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
 	schemaDebug("[Anchor] Validating")
+	if resource := currentState.currentResource(); resource != nil && resource.isDuplicateAnchor(string(*a)) {
+		currentState.AddError(data, fmt.Sprintf("duplicate anchor %q in schema resource", string(*a)))
+	}
 }
 
 // Register implements the Keyword interface for Anchor
@@ -618,6 +954,32 @@ func (r *RecursiveAnchor) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// MarshalJSON implements the json.Marshaler interface for RecursiveAnchor
+func (r RecursiveAnchor) MarshalJSON() ([]byte, error) {
+	return json.Marshal(Schema(r))
+}
+
+// DynamicAnchor defines the $dynamicAnchor JSON Schema keyword
+type DynamicAnchor string
+
+// NewDynamicAnchor allocates a new DynamicAnchor keyword
+func NewDynamicAnchor() Keyword {
+	return new(DynamicAnchor)
+}
+
+// ValidateKeyword implements the Keyword interface for DynamicAnchor
+func (a *DynamicAnchor) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
+	schemaDebug("[DynamicAnchor] Validating")
+}
+
+// Register implements the Keyword interface for DynamicAnchor
+func (a *DynamicAnchor) Register(uri string, registry *SchemaRegistry) {}
+
+// Resolve implements the Keyword interface for DynamicAnchor
+func (a *DynamicAnchor) Resolve(pointer jptr.Pointer, uri string) *Schema {
+	return nil
+}
+
 // Defs defines the $defs JSON Schema keyword
 type Defs map[string]*Schema
 
@@ -626,6 +988,16 @@ func NewDefs() Keyword {
 	return &Defs{}
 }
 
+// unmarshalSubschemas implements the subschemaUnmarshaler interface for Defs
+func (d *Defs) unmarshalSubschemas(data []byte, pc *parseContext) error {
+	schemas, err := pc.parseSchemaMap(data)
+	if err != nil {
+		return err
+	}
+	*d = Defs(schemas)
+	return nil
+}
+
 // Register implements the Keyword interface for Defs
 func (d *Defs) Register(uri string, registry *SchemaRegistry) {
 	for _, v := range *d {
@@ -669,8 +1041,11 @@ func (d Defs) JSONChildren() (res map[string]interface{}) {
 	return
 }
 
-// Void is a placeholder definition for a keyword
-type Void struct{}
+// Void is a placeholder definition for a keyword. It doesn't validate
+// anything, but retains its value so it is preserved when marshaling
+type Void struct {
+	raw json.RawMessage
+}
 
 // NewVoid allocates a new Void keyword
 func NewVoid() Keyword {
@@ -691,3 +1066,22 @@ func (vo *Void) ValidateKeyword(ctx context.Context, currentState *ValidationSta
 	schemaDebug("[Void] WARNING this is a placeholder and should not be used")
 	schemaDebug("[Void] Void is always true")
 }
+
+// RawValue returns the JSON value the keyword was unmarshaled from
+func (vo *Void) RawValue() json.RawMessage {
+	return vo.raw
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface for Void
+func (vo *Void) UnmarshalJSON(data []byte) error {
+	vo.raw = append(json.RawMessage(nil), data...)
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface for Void
+func (vo Void) MarshalJSON() ([]byte, error) {
+	if len(vo.raw) == 0 {
+		return []byte("{}"), nil
+	}
+	return vo.raw, nil
+}
@@ -1,12 +1,93 @@
 package jsonschema
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
 
 	jptr "github.com/qri-io/jsonpointer"
 )
 
+// MultipleOfEpsilon is how far a number may be from the nearest multiple of
+// its multipleOf, relative to the smaller of the two, absorbing the rounding
+// error of binary floating point division so 0.3 is a multiple of 0.1. It is
+// accurate for quotients up to about 1e7, and numbers within the tolerance
+// of a multiple are accepted too. Numbers smaller than the multipleOf are
+// held to a tolerance relative to themselves, so they aren't taken for a
+// multiple of zero. Set it to 0 to require an exact quotient
+var MultipleOfEpsilon = 1e-9
+
+// MultipleOfExact makes multipleOf compare numbers as the shortest decimals
+// representing them, with exact rational arithmetic instead of
+// MultipleOfEpsilon. It is exact at any magnitude but slower
+var MultipleOfExact = false
+
+// numberLimit is the number a numeric keyword checks instances against.
+// Parsing a numeric keyword derives the limit from the number written in the
+// schema, so limits beyond the precision of a float compare exactly with
+// json.Number instances and marshal back as written
+type numberLimit struct {
+	value float64
+	// exact is nil for limits whose exponent is beyond maxRatExponent
+	exact *big.Rat
+	// literal is the number as written in the schema
+	literal json.Number
+}
+
+// newNumberLimit creates the limit of a float not parsed from a schema
+func newNumberLimit(f float64) numberLimit {
+	exact, _ := decimalRat(f)
+	return numberLimit{value: f, exact: exact}
+}
+
+// deriveNumberLimit derives the limit of a numeric keyword parsed as value
+// from the JSON it was parsed from, returning nil for non numbers
+func deriveNumberLimit(value float64, data []byte) interface{} {
+	literal := json.Number(bytes.TrimSpace(data))
+	if _, err := literal.Float64(); err != nil {
+		return nil
+	}
+	exact, _ := numberRat(literal)
+	return numberLimit{value: value, exact: exact, literal: literal}
+}
+
+// limitOf returns the limit of a numeric keyword of value, the limit derived
+// when its schema was parsed if the keyword still holds the same value
+func limitOf(value float64, derived interface{}) numberLimit {
+	if l, ok := derived.(numberLimit); ok && l.value == value {
+		return l
+	}
+	return newNumberLimit(value)
+}
+
+// marshalKeyword implements the keywordMarshaler interface for numberLimit
+func (l numberLimit) marshalKeyword(kw Keyword) ([]byte, bool) {
+	var value float64
+	switch m := kw.(type) {
+	case *MultipleOf:
+		value = float64(*m)
+	case *Maximum:
+		value = float64(*m)
+	case *ExclusiveMaximum:
+		value = float64(*m)
+	case *Minimum:
+		value = float64(*m)
+	case *ExclusiveMinimum:
+		value = float64(*m)
+	default:
+		return nil, false
+	}
+	if l.literal == "" || value != l.value {
+		return nil, false
+	}
+	return []byte(l.literal), true
+}
+
 // MultipleOf defines the multipleOf JSON Schema keyword
 type MultipleOf float64
 
@@ -23,15 +104,84 @@ func (m *MultipleOf) Resolve(pointer jptr.Pointer, uri string) *Schema {
 	return nil
 }
 
+// derive implements the derivingKeyword interface for MultipleOf
+func (m *MultipleOf) derive(data []byte) interface{} {
+	return deriveNumberLimit(float64(*m), data)
+}
+
 // ValidateKeyword implements the Keyword interface for MultipleOf
 func (m MultipleOf) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
 	schemaDebug("[MultipleOf] Validating")
 	if num, ok := convertNumberToFloat(data); ok {
-		div := num / float64(m)
-		if float64(int(div)) != div {
-			currentState.AddError(data, fmt.Sprintf("must be a multiple of %v", m))
+		if !divides(limitOf(float64(m), currentState.derived()), data, num) {
+			currentState.AddErrorWithLimit(data, float64(m), fmt.Sprintf("must be a multiple of %v", m))
+		}
+	}
+}
+
+// divides reports whether num is a multiple of the limit. Numbers
+// decoded as a json.Number are always compared exactly
+func divides(limit numberLimit, data interface{}, num float64) bool {
+	if d := limit.exact; d != nil && d.Sign() != 0 {
+		if n, ok := data.(json.Number); ok {
+			if r, ok := numberRat(n); ok {
+				return r.Quo(r, d).IsInt()
+			}
+		}
+		if MultipleOfExact {
+			if n, ok := decimalRat(num); ok {
+				return n.Quo(n, d).IsInt()
+			}
 		}
 	}
+	div := num / limit.value
+	scale := math.Min(math.Abs(num), math.Abs(limit.value))
+	return math.Abs(num-math.Round(div)*limit.value) <= MultipleOfEpsilon*scale
+}
+
+// decimalRat converts a float to the rational of the shortest
+// decimal representing it, failing for infinities and NaN
+func decimalRat(f float64) (*big.Rat, bool) {
+	return new(big.Rat).SetString(strconv.FormatFloat(f, 'g', -1, 64))
+}
+
+// maxRatExponent bounds the exponent of numbers converted to rationals,
+// which would otherwise allocate one digit per unit of exponent
+const maxRatExponent = 1000
+
+// numberRat converts a json.Number to an exact rational, failing for
+// exponents beyond maxRatExponent
+func numberRat(n json.Number) (*big.Rat, bool) {
+	str := n.String()
+	if i := strings.IndexAny(str, "eE"); i >= 0 {
+		exp, err := strconv.Atoi(str[i+1:])
+		if err != nil || exp > maxRatExponent || exp < -maxRatExponent {
+			return nil, false
+		}
+	}
+	return new(big.Rat).SetString(str)
+}
+
+// compareNumber compares an instance number with the limit of a keyword,
+// returning -1, 0 or +1. Numbers decoded as a json.Number are compared
+// exactly with the limit written in the schema, other numbers as floats
+func compareNumber(data interface{}, limit numberLimit) (int, bool) {
+	if n, ok := data.(json.Number); ok && limit.exact != nil {
+		if r, ok := numberRat(n); ok {
+			return r.Cmp(limit.exact), true
+		}
+	}
+	num, ok := convertNumberToFloat(data)
+	if !ok {
+		return 0, false
+	}
+	switch {
+	case num < limit.value:
+		return -1, true
+	case num > limit.value:
+		return 1, true
+	}
+	return 0, true
 }
 
 // Maximum defines the maximum JSON Schema keyword
@@ -50,16 +200,27 @@ func (m *Maximum) Resolve(pointer jptr.Pointer, uri string) *Schema {
 	return nil
 }
 
+// derive implements the derivingKeyword interface for Maximum
+func (m *Maximum) derive(data []byte) interface{} {
+	return deriveNumberLimit(float64(*m), data)
+}
+
 // ValidateKeyword implements the Keyword interface for Maximum
 func (m Maximum) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
 	schemaDebug("[Maximum] Validating")
-	if num, ok := convertNumberToFloat(data); ok {
-		if num > float64(m) {
-			currentState.AddError(data, fmt.Sprintf("must be less than or equal to %v", m))
+	if cmp, ok := compareNumber(data, limitOf(float64(m), currentState.derived())); ok {
+		if cmp > 0 {
+			currentState.AddErrorWithLimit(data, float64(m), fmt.Sprintf("must be less than or equal to %v", m))
 		}
 	}
 }
 
+// validDerived implements the derivedScalarKeyword interface for Maximum
+func (m Maximum) validDerived(derived, data interface{}) bool {
+	cmp, ok := compareNumber(data, limitOf(float64(m), derived))
+	return !ok || cmp <= 0
+}
+
 // ExclusiveMaximum defines the exclusiveMaximum JSON Schema keyword
 type ExclusiveMaximum float64
 
@@ -76,16 +237,44 @@ func (m *ExclusiveMaximum) Resolve(pointer jptr.Pointer, uri string) *Schema {
 	return nil
 }
 
+// UnmarshalJSON implements the json.Unmarshaler interface for ExclusiveMaximum.
+// The boolean draft4 form sets no bound: subschemas of a draft4 schema are
+// parsed with these keywords before being parsed again with the draft4 ones
+func (m *ExclusiveMaximum) UnmarshalJSON(data []byte) error {
+	var b bool
+	if err := json.Unmarshal(data, &b); err == nil {
+		*m = ExclusiveMaximum(math.Inf(1))
+		return nil
+	}
+	var f float64
+	if err := json.Unmarshal(data, &f); err != nil {
+		return err
+	}
+	*m = ExclusiveMaximum(f)
+	return nil
+}
+
+// derive implements the derivingKeyword interface for ExclusiveMaximum
+func (m *ExclusiveMaximum) derive(data []byte) interface{} {
+	return deriveNumberLimit(float64(*m), data)
+}
+
 // ValidateKeyword implements the Keyword interface for ExclusiveMaximum
 func (m ExclusiveMaximum) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
 	schemaDebug("[ExclusiveMaximum] Validating")
-	if num, ok := convertNumberToFloat(data); ok {
-		if num >= float64(m) {
-			currentState.AddError(data, fmt.Sprintf("%v must be less than %v", num, m))
+	if cmp, ok := compareNumber(data, limitOf(float64(m), currentState.derived())); ok {
+		if cmp >= 0 {
+			currentState.AddErrorWithLimit(data, float64(m), fmt.Sprintf("%v must be less than %v", data, m))
 		}
 	}
 }
 
+// validDerived implements the derivedScalarKeyword interface for ExclusiveMaximum
+func (m ExclusiveMaximum) validDerived(derived, data interface{}) bool {
+	cmp, ok := compareNumber(data, limitOf(float64(m), derived))
+	return !ok || cmp < 0
+}
+
 // Minimum defines the minimum JSON Schema keyword
 type Minimum float64
 
@@ -102,16 +291,27 @@ func (m *Minimum) Resolve(pointer jptr.Pointer, uri string) *Schema {
 	return nil
 }
 
+// derive implements the derivingKeyword interface for Minimum
+func (m *Minimum) derive(data []byte) interface{} {
+	return deriveNumberLimit(float64(*m), data)
+}
+
 // ValidateKeyword implements the Keyword interface for Minimum
 func (m Minimum) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
 	schemaDebug("[Minimum] Validating")
-	if num, ok := convertNumberToFloat(data); ok {
-		if num < float64(m) {
-			currentState.AddError(data, fmt.Sprintf("must be greater than or equal to %v", m))
+	if cmp, ok := compareNumber(data, limitOf(float64(m), currentState.derived())); ok {
+		if cmp < 0 {
+			currentState.AddErrorWithLimit(data, float64(m), fmt.Sprintf("must be greater than or equal to %v", m))
 		}
 	}
 }
 
+// validDerived implements the derivedScalarKeyword interface for Minimum
+func (m Minimum) validDerived(derived, data interface{}) bool {
+	cmp, ok := compareNumber(data, limitOf(float64(m), derived))
+	return !ok || cmp >= 0
+}
+
 // ExclusiveMinimum defines the exclusiveMinimum JSON Schema keyword
 type ExclusiveMinimum float64
 
@@ -128,16 +328,105 @@ func (m *ExclusiveMinimum) Resolve(pointer jptr.Pointer, uri string) *Schema {
 	return nil
 }
 
+// UnmarshalJSON implements the json.Unmarshaler interface for ExclusiveMinimum.
+// The boolean draft4 form sets no bound, see ExclusiveMaximum
+func (m *ExclusiveMinimum) UnmarshalJSON(data []byte) error {
+	var b bool
+	if err := json.Unmarshal(data, &b); err == nil {
+		*m = ExclusiveMinimum(math.Inf(-1))
+		return nil
+	}
+	var f float64
+	if err := json.Unmarshal(data, &f); err != nil {
+		return err
+	}
+	*m = ExclusiveMinimum(f)
+	return nil
+}
+
+// derive implements the derivingKeyword interface for ExclusiveMinimum
+func (m *ExclusiveMinimum) derive(data []byte) interface{} {
+	return deriveNumberLimit(float64(*m), data)
+}
+
 // ValidateKeyword implements the Keyword interface for ExclusiveMinimum
 func (m ExclusiveMinimum) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
 	schemaDebug("[ExclusiveMinimum] Validating")
-	if num, ok := convertNumberToFloat(data); ok {
-		if num <= float64(m) {
-			currentState.AddError(data, fmt.Sprintf("%v must be greater than %v", num, m))
+	if cmp, ok := compareNumber(data, limitOf(float64(m), currentState.derived())); ok {
+		if cmp <= 0 {
+			currentState.AddErrorWithLimit(data, float64(m), fmt.Sprintf("%v must be greater than %v", data, m))
 		}
 	}
 }
 
+// validDerived implements the derivedScalarKeyword interface for ExclusiveMinimum
+func (m ExclusiveMinimum) validDerived(derived, data interface{}) bool {
+	cmp, ok := compareNumber(data, limitOf(float64(m), derived))
+	return !ok || cmp > 0
+}
+
+// ExclusiveMaximumDraft4 defines the boolean exclusiveMaximum JSON Schema
+// keyword of draft4, which makes the maximum of its schema exclusive
+type ExclusiveMaximumDraft4 bool
+
+// NewExclusiveMaximumDraft4 allocates a new ExclusiveMaximumDraft4 keyword
+func NewExclusiveMaximumDraft4() Keyword {
+	return new(ExclusiveMaximumDraft4)
+}
+
+// Register implements the Keyword interface for ExclusiveMaximumDraft4
+func (m *ExclusiveMaximumDraft4) Register(uri string, registry *SchemaRegistry) {}
+
+// Resolve implements the Keyword interface for ExclusiveMaximumDraft4
+func (m *ExclusiveMaximumDraft4) Resolve(pointer jptr.Pointer, uri string) *Schema {
+	return nil
+}
+
+// ValidateKeyword implements the Keyword interface for ExclusiveMaximumDraft4
+func (m ExclusiveMaximumDraft4) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
+	schemaDebug("[ExclusiveMaximumDraft4] Validating")
+	max, ok := currentState.CurrentSchema().Keyword("maximum").(*Maximum)
+	if !bool(m) || !ok {
+		return
+	}
+	// maximum rejects greater numbers, leaving the maximum itself
+	limit := limitOf(float64(*max), currentState.CurrentSchema().derived["maximum"])
+	if cmp, ok := compareNumber(data, limit); ok && cmp == 0 {
+		currentState.AddErrorWithLimit(data, float64(*max), fmt.Sprintf("%v must be less than %v", data, *max))
+	}
+}
+
+// ExclusiveMinimumDraft4 defines the boolean exclusiveMinimum JSON Schema
+// keyword of draft4, which makes the minimum of its schema exclusive
+type ExclusiveMinimumDraft4 bool
+
+// NewExclusiveMinimumDraft4 allocates a new ExclusiveMinimumDraft4 keyword
+func NewExclusiveMinimumDraft4() Keyword {
+	return new(ExclusiveMinimumDraft4)
+}
+
+// Register implements the Keyword interface for ExclusiveMinimumDraft4
+func (m *ExclusiveMinimumDraft4) Register(uri string, registry *SchemaRegistry) {}
+
+// Resolve implements the Keyword interface for ExclusiveMinimumDraft4
+func (m *ExclusiveMinimumDraft4) Resolve(pointer jptr.Pointer, uri string) *Schema {
+	return nil
+}
+
+// ValidateKeyword implements the Keyword interface for ExclusiveMinimumDraft4
+func (m ExclusiveMinimumDraft4) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
+	schemaDebug("[ExclusiveMinimumDraft4] Validating")
+	min, ok := currentState.CurrentSchema().Keyword("minimum").(*Minimum)
+	if !bool(m) || !ok {
+		return
+	}
+	// minimum rejects smaller numbers, leaving the minimum itself
+	limit := limitOf(float64(*min), currentState.CurrentSchema().derived["minimum"])
+	if cmp, ok := compareNumber(data, limit); ok && cmp == 0 {
+		currentState.AddErrorWithLimit(data, float64(*min), fmt.Sprintf("%v must be greater than %v", data, *min))
+	}
+}
+
 func convertNumberToFloat(data interface{}) (float64, bool) {
 	switch v := data.(type) {
 	case uint:
@@ -166,6 +455,13 @@ func convertNumberToFloat(data interface{}) (float64, bool) {
 		return float64(v), true
 	case uintptr:
 		return float64(v), true
+	case json.Number:
+		// numbers out of range convert to an infinity
+		f, err := v.Float64()
+		if ne, ok := err.(*strconv.NumError); ok && ne.Err != strconv.ErrRange {
+			return 0, false
+		}
+		return f, true
 	}
 
 	return 0, false
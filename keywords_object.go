@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"regexp"
+	"sort"
 	"strconv"
 
 	jptr "github.com/qri-io/jsonpointer"
@@ -18,6 +19,16 @@ func NewProperties() Keyword {
 	return &Properties{}
 }
 
+// unmarshalSubschemas implements the subschemaUnmarshaler interface for Properties
+func (p *Properties) unmarshalSubschemas(data []byte, pc *parseContext) error {
+	schemas, err := pc.parseSchemaMap(data)
+	if err != nil {
+		return err
+	}
+	*p = Properties(schemas)
+	return nil
+}
+
 // Register implements the Keyword interface for Properties
 func (p *Properties) Register(uri string, registry *SchemaRegistry) {
 	for _, v := range *p {
@@ -46,8 +57,15 @@ func (p *Properties) Resolve(pointer jptr.Pointer, uri string) *Schema {
 func (p Properties) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
 	schemaDebug("[Properties] Validating")
 	if obj, ok := data.(map[string]interface{}); ok {
+		if currentState.workers != nil && p.validateParallel(ctx, currentState, obj) {
+			return
+		}
 		subState := currentState.NewSubState()
+		subState.Errs = &[]KeyError{}
 		for key := range p {
+			if currentState.stopEarly() {
+				return
+			}
 			if _, ok := obj[key]; ok {
 				currentState.SetEvaluatedKey(key)
 				subState.ClearState()
@@ -55,17 +73,33 @@ func (p Properties) ValidateKeyword(ctx context.Context, currentState *Validatio
 				subState.DescendRelativeFromState(currentState, "properties", key)
 				subState.DescendInstanceFromState(currentState, key)
 
-				subState.Errs = &[]KeyError{}
+				// the errors are copied to currentState, so the buffer is reused
+				*subState.Errs = (*subState.Errs)[:0]
 				p[key].ValidateKeyword(ctx, subState, obj[key])
 				currentState.AddSubErrors(*subState.Errs...)
-				if subState.IsValid() {
-					currentState.UpdateEvaluatedPropsAndItems(subState)
-				}
 			}
 		}
 	}
 }
 
+// validateParallel validates the values of the properties of obj
+// concurrently, reporting false if they have to be validated sequentially
+func (p Properties) validateParallel(ctx context.Context, currentState *ValidationState, obj map[string]interface{}) bool {
+	branches := []*parallelBranch{}
+	for _, key := range sortedBranchKeys(obj) {
+		if sch, ok := p[key]; ok {
+			branches = append(branches, &parallelBranch{token: key, data: obj[key], sch: sch})
+		}
+	}
+	if !runParallel(ctx, currentState, branches, true, "properties") {
+		return false
+	}
+	for _, b := range branches {
+		currentState.SetEvaluatedKey(b.token)
+	}
+	return true
+}
+
 // JSONProp implements the JSONPather for Properties
 func (p Properties) JSONProp(name string) interface{} {
 	return p[name]
@@ -100,9 +134,10 @@ func (r *Required) Resolve(pointer jptr.Pointer, uri string) *Schema {
 func (r Required) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
 	schemaDebug("[Required] Validating")
 	if obj, ok := data.(map[string]interface{}); ok {
+		nullIsAbsent := currentState.Options.treatNullAsAbsent()
 		for _, key := range r {
-			if _, ok := obj[key]; !ok {
-				currentState.AddError(data, fmt.Sprintf(`"%s" value is required`, key))
+			if val, ok := obj[key]; !ok || (nullIsAbsent && val == nil) {
+				currentState.AddErrorWithLimit(data, key, fmt.Sprintf(`"%s" value is required`, key))
 			}
 		}
 	}
@@ -141,7 +176,7 @@ func (m MaxProperties) ValidateKeyword(ctx context.Context, currentState *Valida
 	schemaDebug("[MaxProperties] Validating")
 	if obj, ok := data.(map[string]interface{}); ok {
 		if len(obj) > int(m) {
-			currentState.AddError(data, fmt.Sprintf("%d object Properties exceed %d maximum", len(obj), m))
+			currentState.AddErrorWithLimit(data, int(m), fmt.Sprintf("%d object Properties exceed %d maximum", len(obj), m))
 		}
 	}
 }
@@ -167,7 +202,7 @@ func (m MinProperties) ValidateKeyword(ctx context.Context, currentState *Valida
 	schemaDebug("[MinProperties] Validating")
 	if obj, ok := data.(map[string]interface{}); ok {
 		if len(obj) < int(m) {
-			currentState.AddError(data, fmt.Sprintf("%d object Properties below %d minimum", len(obj), m))
+			currentState.AddErrorWithLimit(data, int(m), fmt.Sprintf("%d object Properties below %d minimum", len(obj), m))
 		}
 	}
 }
@@ -221,26 +256,38 @@ func (p PatternProperties) ValidateKeyword(ctx context.Context, currentState *Va
 	if obj, ok := data.(map[string]interface{}); ok {
 		for key, val := range obj {
 			for _, ptn := range p {
-				if ptn.re.Match([]byte(key)) {
+				if currentState.stopEarly() {
+					return
+				}
+				if ptn.re.MatchString(key) {
 					currentState.SetEvaluatedKey(key)
 					subState := currentState.NewSubState()
-					subState.DescendBase("patternProperties", key)
-					subState.DescendRelative("patternProperties", key)
+					subState.ClearState()
+					subState.DescendBase("patternProperties", ptn.key)
+					subState.DescendRelative("patternProperties", ptn.key)
 					subState.DescendInstance(key)
 
 					subState.Errs = &[]KeyError{}
 					ptn.schema.ValidateKeyword(ctx, subState, val)
 					currentState.AddSubErrors(*subState.Errs...)
-
-					if subState.IsValid() {
-						currentState.UpdateEvaluatedPropsAndItems(subState)
-					}
 				}
 			}
 		}
 	}
 }
 
+// Match returns the patterns matching a property name, in
+// lexical order of the patterns
+func (p *PatternProperties) Match(key string) []string {
+	matched := []string{}
+	for _, ptn := range *p {
+		if ptn.re.MatchString(key) {
+			matched = append(matched, ptn.key)
+		}
+	}
+	return matched
+}
+
 // JSONProp implements the JSONPather for PatternProperties
 func (p PatternProperties) JSONProp(name string) interface{} {
 	for _, pp := range p {
@@ -262,15 +309,20 @@ func (p PatternProperties) JSONChildren() (res map[string]interface{}) {
 
 // UnmarshalJSON implements the json.Unmarshaler interface for PatternProperties
 func (p *PatternProperties) UnmarshalJSON(data []byte) error {
-	var props map[string]*Schema
-	if err := json.Unmarshal(data, &props); err != nil {
+	return p.unmarshalSubschemas(data, nil)
+}
+
+// unmarshalSubschemas implements the subschemaUnmarshaler interface for PatternProperties
+func (p *PatternProperties) unmarshalSubschemas(data []byte, pc *parseContext) error {
+	props, err := pc.parseSchemaMap(data)
+	if err != nil {
 		return err
 	}
 
 	ptn := make(PatternProperties, len(props))
 	i := 0
 	for key, sch := range props {
-		re, err := regexp.Compile(key)
+		re, err := compileRegex(key)
 		if err != nil {
 			return fmt.Errorf("invalid pattern: %s: %s", key, err.Error())
 		}
@@ -281,6 +333,8 @@ func (p *PatternProperties) UnmarshalJSON(data []byte) error {
 		}
 		i++
 	}
+	// patterns are compiled once here, kept in a stable order
+	sort.Slice(ptn, func(i, j int) bool { return ptn[i].key < ptn[j].key })
 
 	*p = ptn
 	return nil
@@ -321,24 +375,50 @@ func (ap *AdditionalProperties) ValidateKeyword(ctx context.Context, currentStat
 		subState.ClearState()
 		subState.DescendBase("additionalProperties")
 		subState.DescendRelative("additionalProperties")
-		for key := range obj {
-			if currentState.IsLocallyEvaluatedKey(key) {
-				continue
+		subState.Errs = &[]KeyError{}
+		for _, key := range ap.additionalKeys(currentState, obj) {
+			if currentState.stopEarly() {
+				return
 			}
 
 			currentState.SetEvaluatedKey(key)
 			subState.ClearState()
 			subState.DescendInstanceFromState(currentState, key)
 
+			// the errors are copied to currentState, so the buffer is reused
+			*subState.Errs = (*subState.Errs)[:0]
 			if ap.schemaType == schemaTypeFalse {
 				subState.AddError(data, "additional properties are not allowed")
-				return
+			} else {
+				(*Schema)(ap).ValidateKeyword(ctx, subState, obj[key])
 			}
+			currentState.AddSubErrors(*subState.Errs...)
+		}
+	}
+}
 
-			(*Schema)(ap).ValidateKeyword(ctx, subState, obj[key])
-			currentState.UpdateEvaluatedPropsAndItems(subState)
+// additionalKeys returns the keys of obj, in sorted order, that neither
+// the properties nor the patternProperties sibling keywords match
+func (ap *AdditionalProperties) additionalKeys(currentState *ValidationState, obj map[string]interface{}) []string {
+	var props *Properties
+	var patterns *PatternProperties
+	if currentState.Local != nil {
+		props, _ = currentState.Local.keywords["properties"].(*Properties)
+		patterns, _ = currentState.Local.keywords["patternProperties"].(*PatternProperties)
+	}
+	keys := make([]string, 0, len(obj))
+	for _, key := range sortedBranchKeys(obj) {
+		if props != nil {
+			if _, ok := (*props)[key]; ok {
+				continue
+			}
 		}
+		if patterns != nil && len(patterns.Match(key)) > 0 {
+			continue
+		}
+		keys = append(keys, key)
 	}
+	return keys
 }
 
 // GetSchema implements the SchemaKeyword for AdditionalProperties
@@ -348,14 +428,24 @@ func (ap *AdditionalProperties) GetSchema() *Schema {
 
 // UnmarshalJSON implements the json.Unmarshaler interface for AdditionalProperties
 func (ap *AdditionalProperties) UnmarshalJSON(data []byte) error {
-	sch := &Schema{}
-	if err := json.Unmarshal(data, sch); err != nil {
+	return ap.unmarshalSubschemas(data, nil)
+}
+
+// unmarshalSubschemas implements the subschemaUnmarshaler interface for AdditionalProperties
+func (ap *AdditionalProperties) unmarshalSubschemas(data []byte, pc *parseContext) error {
+	sch, err := pc.parseSchema(data)
+	if err != nil {
 		return err
 	}
-	*ap = (AdditionalProperties)(*sch)
+	*ap = AdditionalProperties(*sch)
 	return nil
 }
 
+// MarshalJSON implements the json.Marshaler interface for AdditionalProperties
+func (ap AdditionalProperties) MarshalJSON() ([]byte, error) {
+	return json.Marshal(Schema(ap))
+}
+
 // JSONProp implements the JSONPather for AdditionalProperties
 func (ap AdditionalProperties) JSONProp(name string) interface{} {
 	return Schema(ap).JSONProp(name)
@@ -388,8 +478,20 @@ func (p *PropertyNames) Resolve(pointer jptr.Pointer, uri string) *Schema {
 func (p *PropertyNames) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
 	schemaDebug("[PropertyNames] Validating")
 	if obj, ok := data.(map[string]interface{}); ok {
+		// names are checked in order so errors are reported deterministically
+		keys := make([]string, 0, len(obj))
 		for key := range obj {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if currentState.stopEarly() {
+				return
+			}
+			// the cleared state keeps the evaluated properties of the name's
+			// schema apart, only the value of a property can be evaluated
 			subState := currentState.NewSubState()
+			subState.ClearState()
 			subState.DescendBase("propertyNames")
 			subState.DescendRelative("propertyNames")
 			subState.DescendInstance(key)
@@ -415,11 +517,16 @@ func (p PropertyNames) JSONChildren() (res map[string]interface{}) {
 
 // UnmarshalJSON implements the json.Unmarshaler interface for PropertyNames
 func (p *PropertyNames) UnmarshalJSON(data []byte) error {
-	var sch Schema
-	if err := json.Unmarshal(data, &sch); err != nil {
+	return p.unmarshalSubschemas(data, nil)
+}
+
+// unmarshalSubschemas implements the subschemaUnmarshaler interface for PropertyNames
+func (p *PropertyNames) unmarshalSubschemas(data []byte, pc *parseContext) error {
+	sch, err := pc.parseSchema(data)
+	if err != nil {
 		return err
 	}
-	*p = PropertyNames(sch)
+	*p = PropertyNames(*sch)
 	return nil
 }
 
@@ -453,8 +560,8 @@ func (d *DependentSchemas) Resolve(pointer jptr.Pointer, uri string) *Schema {
 		return nil
 	}
 
-	if schema, ok := (*d)[*current]; ok {
-		return schema.Resolve(pointer.Tail(), uri)
+	if dep, ok := (*d)[*current]; ok {
+		return dep.schema.Resolve(pointer.Tail(), uri)
 	}
 
 	return nil
@@ -465,26 +572,35 @@ func (d *DependentSchemas) ValidateKeyword(ctx context.Context, currentState *Va
 	schemaDebug("[DependentSchemas] Validating")
 	for _, v := range *d {
 		subState := currentState.NewSubState()
+		subState.ClearState()
 		subState.DescendBase("dependentSchemas")
 		subState.DescendRelative("dependentSchemas")
 		subState.Misc["dependencyParent"] = "dependentSchemas"
-		v.ValidateKeyword(ctx, subState, data)
+		subState.Errs = &[]KeyError{}
+		dep := v
+		dep.ValidateKeyword(ctx, subState, data)
+		currentState.AddSubErrors(*subState.Errs...)
+		if subState.IsValid() {
+			currentState.UpdateEvaluatedPropsAndItems(subState)
+		}
 	}
 }
 
-type _dependentSchemas map[string]Schema
-
 // UnmarshalJSON implements the json.Unmarshaler interface for DependentSchemas
 func (d *DependentSchemas) UnmarshalJSON(data []byte) error {
-	_d := _dependentSchemas{}
-	if err := json.Unmarshal(data, &_d); err != nil {
+	return d.unmarshalSubschemas(data, nil)
+}
+
+// unmarshalSubschemas implements the subschemaUnmarshaler interface for DependentSchemas
+func (d *DependentSchemas) unmarshalSubschemas(data []byte, pc *parseContext) error {
+	schemas, err := pc.parseSchemaMap(data)
+	if err != nil {
 		return err
 	}
 	ds := DependentSchemas{}
-	for k, v := range _d {
-		sch := Schema(v)
+	for k, sch := range schemas {
 		ds[k] = SchemaDependency{
-			schema: &sch,
+			schema: sch,
 			prop:   k,
 		}
 	}
@@ -497,11 +613,13 @@ func (d DependentSchemas) JSONProp(name string) interface{} {
 	return d[name]
 }
 
-// JSONChildren implements the JSONContainer interface for DependentSchemas
+// JSONChildren implements the JSONContainer interface for DependentSchemas.
+// Children are returned as pointers, so they are seen as schema keywords
 func (d DependentSchemas) JSONChildren() (r map[string]interface{}) {
 	r = map[string]interface{}{}
 	for key, val := range d {
-		r[key] = val
+		dep := val
+		r[key] = &dep
 	}
 	return
 }
@@ -554,6 +672,11 @@ func (d SchemaDependency) JSONProp(name string) interface{} {
 	return d.schema.JSONProp(name)
 }
 
+// JSONChildren implements the JSONContainer interface for SchemaDependency
+func (d SchemaDependency) JSONChildren() (res map[string]interface{}) {
+	return d.schema.JSONChildren()
+}
+
 // DependentRequired defines the dependentRequired JSON Schema keyword
 type DependentRequired map[string]PropertyDependency
 
@@ -642,12 +765,14 @@ func (p *PropertyDependency) Resolve(pointer jptr.Pointer, uri string) *Schema {
 func (p *PropertyDependency) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
 	schemaDebug("[PropertyDependency] Validating")
 	if obj, ok := data.(map[string]interface{}); ok {
-		if obj[p.prop] == nil {
+		if _, ok := obj[p.prop]; !ok {
 			return
 		}
 		for _, dep := range p.dependencies {
-			if obj[dep] == nil {
-				currentState.AddError(data, fmt.Sprintf(`"%s" property is required`, dep))
+			if _, ok := obj[dep]; !ok {
+				subState := currentState.NewSubState()
+				subState.DescendInstance(dep)
+				subState.AddError(data, fmt.Sprintf(`"%s" property is required by "%s"`, dep, p.prop))
 			}
 		}
 	}
@@ -665,6 +790,119 @@ func (p PropertyDependency) JSONProp(name string) interface{} {
 	return p.dependencies[idx]
 }
 
+// Dependencies defines the draft7 dependencies JSON Schema keyword.
+// Each dependency is either a list of property names or a schema
+// which the object must satisfy when the given property is present
+type Dependencies map[string]Keyword
+
+// NewDependencies allocates a new Dependencies keyword
+func NewDependencies() Keyword {
+	return &Dependencies{}
+}
+
+// Register implements the Keyword interface for Dependencies
+func (d *Dependencies) Register(uri string, registry *SchemaRegistry) {
+	for _, v := range *d {
+		v.Register(uri, registry)
+	}
+}
+
+// Resolve implements the Keyword interface for Dependencies
+func (d *Dependencies) Resolve(pointer jptr.Pointer, uri string) *Schema {
+	if pointer == nil {
+		return nil
+	}
+	current := pointer.Head()
+	if current == nil {
+		return nil
+	}
+
+	if dep, ok := (*d)[*current]; ok {
+		return dep.Resolve(pointer.Tail(), uri)
+	}
+
+	return nil
+}
+
+// ValidateKeyword implements the Keyword interface for Dependencies
+func (d *Dependencies) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
+	schemaDebug("[Dependencies] Validating")
+	for _, v := range *d {
+		subState := currentState.NewSubState()
+		subState.ClearState()
+		subState.DescendBase("dependencies")
+		subState.DescendRelative("dependencies")
+		subState.Misc["dependencyParent"] = "dependencies"
+		subState.Errs = &[]KeyError{}
+		v.ValidateKeyword(ctx, subState, data)
+		currentState.AddSubErrors(*subState.Errs...)
+		if subState.IsValid() {
+			currentState.UpdateEvaluatedPropsAndItems(subState)
+		}
+	}
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface for Dependencies
+func (d *Dependencies) UnmarshalJSON(data []byte) error {
+	return d.unmarshalSubschemas(data, nil)
+}
+
+// unmarshalSubschemas implements the subschemaUnmarshaler interface for Dependencies
+func (d *Dependencies) unmarshalSubschemas(data []byte, pc *parseContext) error {
+	_d := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &_d); err != nil {
+		return err
+	}
+	deps := Dependencies{}
+	for k, v := range _d {
+		props := []string{}
+		if err := json.Unmarshal(v, &props); err == nil {
+			deps[k] = &PropertyDependency{
+				dependencies: props,
+				prop:         k,
+			}
+			continue
+		}
+		sch, err := pc.parseSchema(v)
+		if err != nil {
+			return fmt.Errorf("dependency %q must be an array of strings or a schema: %s", k, err.Error())
+		}
+		deps[k] = &SchemaDependency{
+			schema: sch,
+			prop:   k,
+		}
+	}
+	*d = deps
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface for Dependencies
+func (d Dependencies) MarshalJSON() ([]byte, error) {
+	obj := map[string]interface{}{}
+	for key, dep := range d {
+		if prop, ok := dep.(*PropertyDependency); ok {
+			obj[key] = prop.dependencies
+			continue
+		}
+		obj[key] = dep
+	}
+	return json.Marshal(obj)
+}
+
+// JSONProp implements the JSONPather for Dependencies
+func (d Dependencies) JSONProp(name string) interface{} {
+	return d[name]
+}
+
+// JSONChildren implements the JSONContainer interface for Dependencies
+func (d Dependencies) JSONChildren() (r map[string]interface{}) {
+	r = map[string]interface{}{}
+	for key, val := range d {
+		r[key] = val
+	}
+	return
+}
+
 // UnevaluatedProperties defines the unevaluatedProperties JSON Schema keyword
 type UnevaluatedProperties Schema
 
@@ -692,6 +930,9 @@ func (up *UnevaluatedProperties) ValidateKeyword(ctx context.Context, currentSta
 		subState.DescendBase("unevaluatedProperties")
 		subState.DescendRelative("unevaluatedProperties")
 		for key := range obj {
+			if currentState.stopEarly() {
+				return
+			}
 			if currentState.IsEvaluatedKey(key) {
 				continue
 			}
@@ -713,10 +954,20 @@ func (up *UnevaluatedProperties) GetSchema() *Schema {
 
 // UnmarshalJSON implements the json.Unmarshaler interface for UnevaluatedProperties
 func (up *UnevaluatedProperties) UnmarshalJSON(data []byte) error {
-	sch := &Schema{}
-	if err := json.Unmarshal(data, sch); err != nil {
+	return up.unmarshalSubschemas(data, nil)
+}
+
+// unmarshalSubschemas implements the subschemaUnmarshaler interface for UnevaluatedProperties
+func (up *UnevaluatedProperties) unmarshalSubschemas(data []byte, pc *parseContext) error {
+	sch, err := pc.parseSchema(data)
+	if err != nil {
 		return err
 	}
-	*up = (UnevaluatedProperties)(*sch)
+	*up = UnevaluatedProperties(*sch)
 	return nil
 }
+
+// MarshalJSON implements the json.Marshaler interface for UnevaluatedProperties
+func (up UnevaluatedProperties) MarshalJSON() ([]byte, error) {
+	return json.Marshal(Schema(up))
+}
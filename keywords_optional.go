@@ -4,37 +4,68 @@ import (
 	"context"
 	"fmt"
 	"net"
-	"net/mail"
 	"net/url"
 	"regexp"
-	"strconv"
 	"strings"
 	"time"
+	"unicode"
 
 	jptr "github.com/qri-io/jsonpointer"
 )
 
 const (
-	hostname       string = `^([a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9\-]{0,61}[a-zA-Z0-9])(\.([a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9\-]{0,61}[a-zA-Z0-9]))*$`
-	unescapedTilda        = `\~[^01]`
-	endingTilda           = `\~$`
-	schemePrefix          = `^[^\:]+\:`
-	uriTemplate           = `\{[^\{\}\\]*\}`
-	uuid                  = `^[[:xdigit:]]{8}-[[:xdigit:]]{4}-[[:xdigit:]]{4}-[[:xdigit:]]{4}-[[:xdigit:]]{12}$`
+	hostname    string = `^([a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9\-]{0,61}[a-zA-Z0-9])(\.([a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9\-]{0,61}[a-zA-Z0-9]))*$`
+	uriTemplate        = `\{[^\{\}\\]*\}`
+	uuid               = `^[[:xdigit:]]{8}-[[:xdigit:]]{4}-[[:xdigit:]]{4}-[[:xdigit:]]{4}-[[:xdigit:]]{12}$`
+
+	// fullDateLayout and fullTimeLayout are the time.Parse layouts
+	// of the RFC 3339 "full-date" and "full-time" productions
+	fullDateLayout = "2006-01-02"
+	fullTimeLayout = "15:04:05Z07:00"
 )
 
 var (
-	// emailPattern           = regexp.MustCompile(email)
-	hostnamePattern        = regexp.MustCompile(hostname)
-	unescaptedTildaPattern = regexp.MustCompile(unescapedTilda)
-	endingTildaPattern     = regexp.MustCompile(endingTilda)
-	schemePrefixPattern    = regexp.MustCompile(schemePrefix)
-	uriTemplatePattern     = regexp.MustCompile(uriTemplate)
-	uuidPattern            = regexp.MustCompile(uuid)
+	hostnamePattern    = regexp.MustCompile(hostname)
+	uriTemplatePattern = regexp.MustCompile(uriTemplate)
+	uuidPattern        = regexp.MustCompile(uuid)
 
 	disallowedIdnChars = map[string]bool{"\u0020": true, "\u002D": true, "\u00A2": true, "\u00A3": true, "\u00A4": true, "\u00A5": true, "\u034F": true, "\u0640": true, "\u07FA": true, "\u180B": true, "\u180C": true, "\u180D": true, "\u200B": true, "\u2060": true, "\u2104": true, "\u2108": true, "\u2114": true, "\u2117": true, "\u2118": true, "\u211E": true, "\u211F": true, "\u2123": true, "\u2125": true, "\u2282": true, "\u2283": true, "\u2284": true, "\u2285": true, "\u2286": true, "\u2287": true, "\u2288": true, "\u2616": true, "\u2617": true, "\u2619": true, "\u262F": true, "\u2638": true, "\u266C": true, "\u266D": true, "\u266F": true, "\u2752": true, "\u2756": true, "\u2758": true, "\u275E": true, "\u2761": true, "\u2775": true, "\u2794": true, "\u2798": true, "\u27AF": true, "\u27B1": true, "\u27BE": true, "\u3004": true, "\u3012": true, "\u3013": true, "\u3020": true, "\u302E": true, "\u302F": true, "\u3031": true, "\u3032": true, "\u3035": true, "\u303B": true, "\u3164": true, "\uFFA0": true}
 )
 
+// AssertFormat enables validation of the format keyword. Per the 2019-09 spec
+// format is an annotation by default, and instances are not checked against it
+var AssertFormat = false
+
+// ECMARegexCompat makes the regex format reject the ECMA 262 lookaround
+// assertions and backreferences that Go's regexp package doesn't support,
+// with an explanatory message rather than a generic syntax error
+var ECMARegexCompat = false
+
+// FormatCheckers maps format names to the functions checking string instances
+// against them when AssertFormat is enabled. Entries can be added or replaced
+// to support custom formats, but not while validation is running
+var FormatCheckers = map[string]func(string) error{
+	"date-time":             isValidDateTime,
+	"date":                  isValidDate,
+	"duration":              isValidDuration,
+	"email":                 isValidEmail,
+	"hostname":              isValidHostname,
+	"idn-email":             isValidIDNEmail,
+	"idn-hostname":          isValidIDNHostname,
+	"ipv4":                  isValidIPv4,
+	"ipv6":                  isValidIPv6,
+	"iri-reference":         isValidIriRef,
+	"iri":                   isValidIri,
+	"json-pointer":          isValidJSONPointer,
+	"regex":                 isValidRegex,
+	"relative-json-pointer": isValidRelJSONPointer,
+	"time":                  isValidTime,
+	"uri-reference":         isValidURIRef,
+	"uri-template":          isValidURITemplate,
+	"uri":                   isValidURI,
+	"uuid":                  isValidUUID,
+}
+
 // Format defines the format JSON Schema keyword
 type Format string
 
@@ -54,63 +85,50 @@ func (f *Format) Resolve(pointer jptr.Pointer, uri string) *Schema {
 // ValidateKeyword implements the Keyword interface for Format
 func (f Format) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
 	schemaDebug("[Format] Validating")
-	var err error
-	if str, ok := data.(string); ok {
-		switch f {
-		case "date-time":
-			err = isValidDateTime(str)
-		case "date":
-			err = isValidDate(str)
-		case "email":
-			err = isValidEmail(str)
-		case "hostname":
-			err = isValidHostname(str)
-		case "idn-email":
-			err = isValidIDNEmail(str)
-		case "idn-hostname":
-			err = isValidIDNHostname(str)
-		case "ipv4":
-			err = isValidIPv4(str)
-		case "ipv6":
-			err = isValidIPv6(str)
-		case "iri-reference":
-			err = isValidIriRef(str)
-		case "iri":
-			err = isValidIri(str)
-		case "json-pointer":
-			err = isValidJSONPointer(str)
-		case "regex":
-			err = isValidRegex(str)
-		case "relative-json-pointer":
-			err = isValidRelJSONPointer(str)
-		case "time":
-			err = isValidTime(str)
-		case "uri-reference":
-			err = isValidURIRef(str)
-		case "uri-template":
-			err = isValidURITemplate(str)
-		case "uri":
-			err = isValidURI(str)
-		case "uuid":
-			err = isValidUUID(str)
-		default:
-			err = nil
-		}
-		if err != nil {
-			currentState.AddError(data, fmt.Sprintf("invalid %s: %s", f, err.Error()))
-		}
+	currentState.AddAnnotation("format", string(f), fmt.Sprintf("value has format %s", f))
+	if !AssertFormat {
+		return
+	}
+	str, ok := data.(string)
+	if !ok {
+		return
+	}
+	check, ok := FormatCheckers[string(f)]
+	if !ok {
+		// unknown formats are treated as annotations
+		return
+	}
+	if err := check(str); err != nil {
+		currentState.AddError(data, fmt.Sprintf("invalid %s: %s", f, err.Error()))
 	}
 }
 
+// validScalar implements the scalarKeyword interface for Format
+func (f Format) validScalar(data interface{}) bool {
+	if !AssertFormat {
+		return true
+	}
+	str, ok := data.(string)
+	if !ok {
+		return true
+	}
+	check, ok := FormatCheckers[string(f)]
+	return !ok || check(str) == nil
+}
+
 // A string instance is valid against "date-time" if it is a valid
 // representation according to the "date-time" production derived
 // from RFC 3339, section 5.6 [RFC3339]
 // https://tools.ietf.org/html/rfc3339#section-5.6
 func isValidDateTime(dateTime string) error {
-	if _, err := time.Parse(time.RFC3339, strings.ToUpper(dateTime)); err != nil {
-		return fmt.Errorf("date-time incorrectly Formatted: %s", err.Error())
+	parts := strings.SplitN(strings.ToUpper(dateTime), "T", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("date-time must separate the date and time with a 'T'")
 	}
-	return nil
+	if err := isValidDate(parts[0]); err != nil {
+		return err
+	}
+	return isValidTime(parts[1])
 }
 
 // A string instance is valid against "date" if it is a valid
@@ -118,22 +136,78 @@ func isValidDateTime(dateTime string) error {
 // from RFC 3339, section 5.6 [RFC3339]
 // https://tools.ietf.org/html/rfc3339#section-5.6
 func isValidDate(date string) error {
-	arbitraryTime := "T08:30:06.283185Z"
-	dateTime := fmt.Sprintf("%s%s", date, arbitraryTime)
-	return isValidDateTime(dateTime)
+	if _, err := time.Parse(fullDateLayout, date); err != nil {
+		return fmt.Errorf("date incorrectly Formatted: %s", err.Error())
+	}
+	return nil
+}
+
+// A string instance is valid against "duration" if it is a valid
+// representation according to the "duration" production of RFC 3339,
+// appendix A, an ISO 8601 duration such as P3DT4H. Components with a
+// value of zero may be left out, as ISO 8601 allows, but the others must
+// be in order, and a number of weeks can't be combined with other components
+// https://tools.ietf.org/html/rfc3339#appendix-A
+func isValidDuration(duration string) error {
+	duration = strings.ToUpper(duration)
+	if !strings.HasPrefix(duration, "P") {
+		return fmt.Errorf("duration must start with P")
+	}
+	date, durTime := duration[1:], ""
+	hasTime := false
+	if i := strings.IndexByte(date, 'T'); i >= 0 {
+		date, durTime, hasTime = date[:i], date[i+1:], true
+		if durTime == "" {
+			return fmt.Errorf("duration time must have a component after T")
+		}
+	} else if date == "" {
+		return fmt.Errorf("duration must have a component after P")
+	}
+	if strings.HasSuffix(date, "W") {
+		if hasTime || strings.IndexFunc(date[:len(date)-1], func(r rune) bool { return r < '0' || r > '9' }) >= 0 {
+			return fmt.Errorf("duration weeks can't be combined with other components")
+		}
+		if len(date) == 1 {
+			return fmt.Errorf("duration component %q must be a number followed by a unit", date)
+		}
+		return nil
+	}
+	if err := checkDurationComponents(date, "YMD"); err != nil {
+		return err
+	}
+	return checkDurationComponents(durTime, "HMS")
+}
+
+// checkDurationComponents checks that s is a series of numbers, each
+// followed by one of units, with the units in the order they are given
+func checkDurationComponents(s, units string) error {
+	for s != "" {
+		i := 0
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+		if i == 0 || i == len(s) {
+			return fmt.Errorf("duration component %q must be a number followed by a unit", s)
+		}
+		next := strings.IndexByte(units, s[i])
+		if next < 0 {
+			return fmt.Errorf("duration unit %q is out of order or not one of %s", s[i], units)
+		}
+		units, s = units[next+1:], s[i+1:]
+	}
+	return nil
 }
 
 // A string instance is valid against "email" if it is a valid
-// representation as defined by RFC 5322, section 3.4.1 [RFC5322].
-// https://tools.ietf.org/html/rfc5322#section-3.4.1
+// representation as defined by RFC 5321, section 4.1.2 [RFC5321].
+// https://tools.ietf.org/html/rfc5321#section-4.1.2
 func isValidEmail(email string) error {
-	// if !emailPattern.MatchString(email) {
-	// 	return fmt.Errorf("invalid email Format")
-	// }
-	if _, err := mail.ParseAddress(email); err != nil {
-		return fmt.Errorf("email address incorrectly Formatted: %s", err.Error())
+	for _, r := range email {
+		if r > unicode.MaxASCII {
+			return fmt.Errorf("email address must only contain ASCII characters")
+		}
 	}
-	return nil
+	return isValidMailbox(email, isValidHostname)
 }
 
 // A string instance is valid against "hostname" if it is a valid
@@ -153,10 +227,68 @@ func isValidHostname(hostname string) error {
 // representation as defined by RFC 6531 [RFC6531]
 // https://tools.ietf.org/html/rfc6531
 func isValidIDNEmail(idnEmail string) error {
-	if _, err := mail.ParseAddress(idnEmail); err != nil {
-		return fmt.Errorf("email address incorrectly Formatted: %s", err.Error())
+	return isValidMailbox(idnEmail, isValidIDNHostname)
+}
+
+// isValidMailbox checks the "Mailbox" production of RFC 5321: a dot-atom or
+// quoted local part, followed by a domain or an address literal. Non-ASCII
+// characters are allowed in the local part as extended by RFC 6531
+func isValidMailbox(mailbox string, isValidDomain func(string) error) error {
+	at := strings.LastIndex(mailbox, "@")
+	if at < 1 || at == len(mailbox)-1 {
+		return fmt.Errorf("email address must have a local part and a domain")
 	}
-	return nil
+	local, domain := mailbox[:at], mailbox[at+1:]
+	if len(local) > 64 {
+		return fmt.Errorf("email local part exceeds 64 characters")
+	}
+
+	if strings.HasPrefix(local, `"`) {
+		if len(local) < 2 || !strings.HasSuffix(local, `"`) {
+			return fmt.Errorf("email local part has an unterminated quoted string")
+		}
+		quoted := local[1 : len(local)-1]
+		for i := 0; i < len(quoted); i++ {
+			switch c := quoted[i]; {
+			case c == '\\':
+				i++
+				if i == len(quoted) {
+					return fmt.Errorf("email local part ends with an escape character")
+				}
+			case c == '"' || c < ' ' || c == 0x7f:
+				return fmt.Errorf("email local part has an invalid character in a quoted string")
+			}
+		}
+	} else {
+		for _, atom := range strings.Split(local, ".") {
+			if atom == "" {
+				return fmt.Errorf("email local part has an empty atom")
+			}
+			for _, r := range atom {
+				if r <= unicode.MaxASCII && !isMailAtext(byte(r)) {
+					return fmt.Errorf("email local part contains illegal character %#U", r)
+				}
+			}
+		}
+	}
+
+	if strings.HasPrefix(domain, "[") && strings.HasSuffix(domain, "]") {
+		literal := domain[1 : len(domain)-1]
+		if strings.HasPrefix(literal, "IPv6:") {
+			return isValidIPv6(strings.TrimPrefix(literal, "IPv6:"))
+		}
+		return isValidIPv4(literal)
+	}
+	return isValidDomain(domain)
+}
+
+// isMailAtext reports whether an ASCII character is valid in an atom
+// as defined by RFC 5322, section 3.2.3
+func isMailAtext(c byte) bool {
+	if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' {
+		return true
+	}
+	return strings.IndexByte("!#$%&'*+-/=?^_`{|}~", c) >= 0
 }
 
 // A string instance is valid against "hostname" if it is a valid
@@ -185,10 +317,14 @@ func isValidIDNHostname(idnHostname string) error {
 // https://tools.ietf.org/html/rfc2673#section-3.2
 func isValidIPv4(ipv4 string) error {
 	parsedIP := net.ParseIP(ipv4)
-	hasDots := strings.Contains(ipv4, ".")
-	if !hasDots || parsedIP == nil {
+	if parsedIP == nil || strings.Contains(ipv4, ":") || len(parsedIP.To4()) != net.IPv4len {
 		return fmt.Errorf("invalid IPv4 address")
 	}
+	for _, octet := range strings.Split(ipv4, ".") {
+		if len(octet) > 1 && octet[0] == '0' {
+			return fmt.Errorf("invalid IPv4 address: octet %s has a leading zero", octet)
+		}
+	}
 	return nil
 }
 
@@ -200,7 +336,7 @@ func isValidIPv6(ipv6 string) error {
 	parsedIP := net.ParseIP(ipv6)
 	hasColons := strings.Contains(ipv6, ":")
 	if !hasColons || parsedIP == nil {
-		return fmt.Errorf("invalid IPv4 address")
+		return fmt.Errorf("invalid IPv6 address")
 	}
 	return nil
 }
@@ -210,14 +346,22 @@ func isValidIPv6(ipv6 string) error {
 // according to [RFC3987].
 // https://tools.ietf.org/html/rfc3987
 func isValidIriRef(iriRef string) error {
-	return isValidURIRef(iriRef)
+	_, err := parseURIReference(iriRef, true)
+	return err
 }
 
 // A string instance is a valid against "iri" if it is a valid IRI,
 // according to [RFC3987].
 // https://tools.ietf.org/html/rfc3987
 func isValidIri(iri string) error {
-	return isValidURI(iri)
+	u, err := parseURIReference(iri, true)
+	if err != nil {
+		return err
+	}
+	if !u.IsAbs() {
+		return fmt.Errorf("iri missing scheme prefix")
+	}
+	return nil
 }
 
 // A string instance is a valid against "json-pointer" if it is a
@@ -231,12 +375,13 @@ func isValidJSONPointer(jsonPointer string) error {
 	if jsonPointer[0] != '/' {
 		return fmt.Errorf("non-empty references must begin with a '/' character")
 	}
-	str := jsonPointer[1:]
-	if unescaptedTildaPattern.MatchString(str) {
-		return fmt.Errorf("unescaped tilda error")
+	for i := 0; i < len(jsonPointer); i++ {
+		if jsonPointer[i] == '~' && (i+1 == len(jsonPointer) || jsonPointer[i+1] != '0' && jsonPointer[i+1] != '1') {
+			return fmt.Errorf("unescaped tilda error")
+		}
 	}
-	if endingTildaPattern.MatchString(str) {
-		return fmt.Errorf("unescaped tilda error")
+	if _, err := jptr.Parse(jsonPointer); err != nil {
+		return fmt.Errorf("invalid json pointer: %s", err.Error())
 	}
 	return nil
 }
@@ -247,43 +392,90 @@ func isValidJSONPointer(jsonPointer string) error {
 // accept at least the subset of ECMA 262 defined in the Regular
 // Expressions [regexInterop] section of this specification, and
 // SHOULD accept all valid ECMA 262 expressions.
+// Patterns are compiled with Go's RE2 based regexp package, which doesn't
+// support ECMA 262 lookaround assertions or backreferences
 // http://www.ecma-international.org/publications/files/ECMA-ST/Ecma-262.pdf
 // http://json-schema.org/latest/jsoxn-schema-validation.html#regexInterop
 // https://tools.ietf.org/html/rfc7159
 func isValidRegex(regex string) error {
-	if _, err := regexp.Compile(regex); err != nil {
-		return fmt.Errorf("invalid regex expression")
+	if ECMARegexCompat {
+		if err := checkUnsupportedECMARegex(regex); err != nil {
+			return err
+		}
+	}
+	if _, err := compileRegex(regex); err != nil {
+		return fmt.Errorf("invalid regex expression: %s", err.Error())
+	}
+	return nil
+}
+
+// checkUnsupportedECMARegex reports ECMA 262 constructs RE2 can't evaluate
+func checkUnsupportedECMARegex(regex string) error {
+	for i := 0; i < len(regex); i++ {
+		switch regex[i] {
+		case '\\':
+			if i+1 < len(regex) {
+				next := regex[i+1]
+				if next >= '1' && next <= '9' || next == 'k' && strings.HasPrefix(regex[i+2:], "<") {
+					return fmt.Errorf("regex backreferences are not supported")
+				}
+			}
+			i++
+		case '(':
+			rest := regex[i+1:]
+			for _, prefix := range []string{"?=", "?!", "?<=", "?<!"} {
+				if strings.HasPrefix(rest, prefix) {
+					return fmt.Errorf("regex lookaround assertions are not supported")
+				}
+			}
+		}
 	}
 	return nil
 }
 
 // A string instance is a valid against "relative-json-pointer" if it
-// is a valid Relative JSON Pointer [relative-json-pointer].
-// https://tools.ietf.org/html/draft-handrews-relative-json-pointer-00
+// is a valid Relative JSON Pointer [relative-json-pointer]: a
+// non-negative integer followed by either a '#' or a JSON Pointer
+// https://tools.ietf.org/html/draft-handrews-relative-json-pointer-01
 func isValidRelJSONPointer(relJSONPointer string) error {
-	parts := strings.Split(relJSONPointer, "/")
-	if len(parts) == 1 {
-		parts = strings.Split(relJSONPointer, "#")
+	digits := 0
+	for digits < len(relJSONPointer) && relJSONPointer[digits] >= '0' && relJSONPointer[digits] <= '9' {
+		digits++
 	}
-	if i, err := strconv.Atoi(parts[0]); err != nil || i < 0 {
-		return fmt.Errorf("RJP must begin with positive integer")
+	if digits == 0 {
+		return fmt.Errorf("RJP must begin with a non-negative integer")
 	}
-	//skip over first part
-	str := relJSONPointer[len(parts[0]):]
-	if len(str) > 0 && str[0] == '#' {
-		return nil
+	if digits > 1 && relJSONPointer[0] == '0' {
+		return fmt.Errorf("RJP integer prefix must not have leading zeros")
+	}
+	if tail := relJSONPointer[digits:]; tail != "#" {
+		return isValidJSONPointer(tail)
 	}
-	return isValidJSONPointer(str)
+	return nil
 }
 
 // A string instance is valid against "time" if it is a valid
 // representation according to the "full-time" production derived
-// from RFC 3339, section 5.6 [RFC3339]
+// from RFC 3339, section 5.6 [RFC3339]. Leap seconds are accepted
+// at the end of a UTC day
 // https://tools.ietf.org/html/rfc3339#section-5.6
-func isValidTime(time string) error {
-	arbitraryDate := "1963-06-19"
-	dateTime := fmt.Sprintf("%sT%s", arbitraryDate, time)
-	return isValidDateTime(dateTime)
+func isValidTime(fullTime string) error {
+	fullTime = strings.ToUpper(fullTime)
+	leapSecond := len(fullTime) >= 8 && fullTime[2] == ':' && fullTime[5] == ':' && fullTime[6:8] == "60"
+	if leapSecond {
+		// time.Parse doesn't support leap seconds, check
+		// the preceding second instead
+		fullTime = fullTime[:6] + "59" + fullTime[8:]
+	}
+	t, err := time.Parse(fullTimeLayout, fullTime)
+	if err != nil {
+		return fmt.Errorf("time incorrectly Formatted: %s", err.Error())
+	}
+	if leapSecond {
+		if utc := t.UTC(); utc.Hour() != 23 || utc.Minute() != 59 {
+			return fmt.Errorf("leap seconds are only allowed at 23:59:60 UTC")
+		}
+	}
 	return nil
 }
 
@@ -292,13 +484,8 @@ func isValidTime(time string) error {
 // according to [RFC3986].
 // https://tools.ietf.org/html/rfc3986
 func isValidURIRef(uriRef string) error {
-	if _, err := url.Parse(uriRef); err != nil {
-		return fmt.Errorf("uri incorrectly Formatted: %s", err.Error())
-	}
-	if strings.Contains(uriRef, "\\") {
-		return fmt.Errorf("invalid uri")
-	}
-	return nil
+	_, err := parseURIReference(uriRef, false)
+	return err
 }
 
 // A string instance is a valid against "uri-template" if it is a
@@ -319,15 +506,41 @@ func isValidURITemplate(uriTemplate string) error {
 // according to [RFC3986].
 // https://tools.ietf.org/html/rfc3986
 func isValidURI(uri string) error {
-	if _, err := url.Parse(uri); err != nil {
-		return fmt.Errorf("uri incorrectly Formatted: %s", err.Error())
+	u, err := parseURIReference(uri, false)
+	if err != nil {
+		return err
 	}
-	if !schemePrefixPattern.MatchString(uri) {
+	if !u.IsAbs() {
 		return fmt.Errorf("uri missing scheme prefix")
 	}
 	return nil
 }
 
+// parseURIReference parses a URI reference, or an IRI reference if
+// international is set, rejecting characters that are not allowed
+// unescaped by RFC 3986 and IPv6 hosts missing their brackets
+func parseURIReference(ref string, international bool) (*url.URL, error) {
+	for _, r := range ref {
+		if r > unicode.MaxASCII {
+			if !international {
+				return nil, fmt.Errorf("uri contains non-ASCII character %#U", r)
+			}
+			continue
+		}
+		if r <= ' ' || r == 0x7f || strings.ContainsRune("\"<>\\^`{|}", r) {
+			return nil, fmt.Errorf("uri contains illegal character %#U", r)
+		}
+	}
+	u, err := url.Parse(ref)
+	if err != nil {
+		return nil, fmt.Errorf("uri incorrectly Formatted: %s", err.Error())
+	}
+	if !strings.HasPrefix(u.Host, "[") && strings.Count(u.Host, ":") > 1 {
+		return nil, fmt.Errorf("uri IPv6 host must be enclosed in brackets")
+	}
+	return u, nil
+}
+
 // A string instance is valid against "uuid" if it is a valid
 // representation as defined by RFC 4122, section 3 [RFC4122].
 // Format: xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx
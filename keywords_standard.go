@@ -1,9 +1,11 @@
 package jsonschema
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"math"
 	"reflect"
 	"strconv"
 	"strings"
@@ -30,15 +32,91 @@ func (c *Const) Resolve(pointer jptr.Pointer, uri string) *Schema {
 // ValidateKeyword implements the Keyword interface for Const
 func (c Const) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
 	schemaDebug("[Const] Validating")
-	var con interface{}
-	if err := json.Unmarshal(c, &con); err != nil {
+	con, err := decodeUseNumber(c)
+	if err != nil {
 		currentState.AddError(data, err.Error())
 		return
 	}
 
-	if !reflect.DeepEqual(con, data) {
-		currentState.AddError(data, fmt.Sprintf(`must equal %s`, InvalidValueString(con)))
+	if !jsonEqual(con, data) {
+		currentState.AddError(data, fmt.Sprintf(`must equal %s`, InvalidValueStringN(con, currentState.Options.maxErrStringLen())))
+	}
+}
+
+// validScalar implements the scalarKeyword interface for Const
+func (c Const) validScalar(data interface{}) bool {
+	con, err := decodeUseNumber(c)
+	return err == nil && jsonEqual(con, data)
+}
+
+// decodeUseNumber decodes JSON, keeping numbers as json.Number
+func decodeUseNumber(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// jsonEqual reports whether two decoded JSON values are equal, comparing
+// numbers by value and objects regardless of the order of their keys.
+// Numbers are compared exactly when both are a json.Number, and as floats
+// otherwise, so 1 and 1.0 are equal whichever Go type holds them
+func jsonEqual(a, b interface{}) bool {
+	if n, ok := a.(json.Number); ok {
+		return numberEqual(n, b)
+	}
+	if n, ok := b.(json.Number); ok {
+		return numberEqual(n, a)
+	}
+	switch av := a.(type) {
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for key, val := range av {
+			if other, ok := bv[key]; !ok || !jsonEqual(val, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !jsonEqual(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	if af, ok := convertNumberToFloat(a); ok {
+		bf, ok := convertNumberToFloat(b)
+		return ok && af == bf
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// numberEqual reports whether a json.Number equals another number
+func numberEqual(n json.Number, other interface{}) bool {
+	if on, ok := other.(json.Number); ok {
+		if r, ok := numberRat(n); ok {
+			if or, ok := numberRat(on); ok {
+				return r.Cmp(or) == 0
+			}
+		}
+	}
+	f, ok := convertNumberToFloat(other)
+	if !ok {
+		return false
 	}
+	nf, ok := convertNumberToFloat(n)
+	return ok && nf == f
 }
 
 // JSONProp implements the JSONPather for Const
@@ -51,6 +129,16 @@ func (c Const) String() string {
 	return string(c)
 }
 
+// Value returns the decoded value of the const keyword, or nil if
+// the keyword holds no valid JSON
+func (c Const) Value() interface{} {
+	var value interface{}
+	if err := json.Unmarshal(c, &value); err != nil {
+		return nil
+	}
+	return value
+}
+
 // UnmarshalJSON implements the json.Unmarshaler interface for Const
 func (c *Const) UnmarshalJSON(data []byte) error {
 	*c = data
@@ -62,9 +150,106 @@ func (c Const) MarshalJSON() ([]byte, error) {
 	return json.Marshal(json.RawMessage(c))
 }
 
-// Enum defines the enum JSON Schema keyword
+// Enum defines the enum JSON Schema keyword. Parsing the keyword indexes
+// the strings, numbers, booleans and null it allows, so checking a scalar
+// instance takes the same time however many values there are. Objects and
+// arrays are compared with each allowed object or array in turn
 type Enum []Const
 
+// enumIndex holds the decoded values of an enum by kind. Numbers are kept
+// by their exact value, to compare json.Number instances exactly, and by
+// their float64 value, to compare other numbers like jsonEqual does
+type enumIndex struct {
+	// consts are the values the index was built from
+	consts    []Const
+	strings   map[string]struct{}
+	rats      map[string]struct{}
+	floats    map[float64]struct{}
+	inexact   map[float64]struct{}
+	null      bool
+	booleans  [2]bool
+	composite []interface{}
+}
+
+// newEnumIndex indexes the values of an enum
+func newEnumIndex(consts []Const) *enumIndex {
+	idx := &enumIndex{
+		consts:  consts,
+		strings: map[string]struct{}{},
+		rats:    map[string]struct{}{},
+		floats:  map[float64]struct{}{},
+		inexact: map[float64]struct{}{},
+	}
+	for _, c := range consts {
+		val, err := decodeUseNumber(c)
+		if err != nil {
+			continue
+		}
+		switch v := val.(type) {
+		case nil:
+			idx.null = true
+		case bool:
+			idx.booleans[boolIndex(v)] = true
+		case string:
+			idx.strings[v] = struct{}{}
+		case json.Number:
+			f, _ := convertNumberToFloat(v)
+			idx.floats[f] = struct{}{}
+			if r, ok := numberRat(v); ok {
+				idx.rats[r.RatString()] = struct{}{}
+			} else {
+				idx.inexact[f] = struct{}{}
+			}
+		default:
+			idx.composite = append(idx.composite, v)
+		}
+	}
+	return idx
+}
+
+// contains reports whether the index holds a value equal to data
+func (idx *enumIndex) contains(data interface{}) bool {
+	switch v := data.(type) {
+	case nil:
+		return idx.null
+	case bool:
+		return idx.booleans[boolIndex(v)]
+	case string:
+		_, ok := idx.strings[v]
+		return ok
+	case json.Number:
+		if r, ok := numberRat(v); ok {
+			if _, ok := idx.rats[r.RatString()]; ok {
+				return true
+			}
+			// numbers too large for an exact value compare as floats
+			f, _ := convertNumberToFloat(v)
+			_, ok := idx.inexact[f]
+			return ok
+		}
+	case map[string]interface{}, []interface{}:
+		for _, c := range idx.composite {
+			if jsonEqual(c, data) {
+				return true
+			}
+		}
+		return false
+	}
+	if f, ok := convertNumberToFloat(data); ok {
+		_, ok := idx.floats[f]
+		return ok
+	}
+	return false
+}
+
+// boolIndex maps a boolean to its slot in enumIndex.booleans
+func boolIndex(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
 // NewEnum allocates a new Enum keyword
 func NewEnum() Keyword {
 	return &Enum{}
@@ -78,20 +263,32 @@ func (e *Enum) Resolve(pointer jptr.Pointer, uri string) *Schema {
 	return nil
 }
 
+// derive implements the derivingKeyword interface for Enum
+func (e *Enum) derive(data []byte) interface{} {
+	return newEnumIndex(*e)
+}
+
 // ValidateKeyword implements the Keyword interface for Enum
 func (e Enum) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
 	schemaDebug("[Enum] Validating")
-	subState := currentState.NewSubState()
-	subState.ClearState()
-	for _, v := range e {
-		subState.Errs = &[]KeyError{}
-		v.ValidateKeyword(ctx, subState, data)
-		if subState.IsValid() {
-			return
-		}
+	if !e.index(currentState.derived()).contains(data) {
+		currentState.AddError(data, fmt.Sprintf("should be one of %s", e.String()))
 	}
+}
+
+// validDerived implements the derivedScalarKeyword interface for Enum
+func (e Enum) validDerived(derived, data interface{}) bool {
+	return e.index(derived).contains(data)
+}
 
-	currentState.AddError(data, fmt.Sprintf("should be one of %s", e.String()))
+// index returns the index derived from the enum when its schema was
+// parsed, indexing the enum anew if it changed since or wasn't parsed
+func (e Enum) index(derived interface{}) *enumIndex {
+	if idx, ok := derived.(*enumIndex); ok && len(idx.consts) == len(e) &&
+		(len(e) == 0 || &idx.consts[0] == &e[0]) {
+		return idx
+	}
+	return newEnumIndex(e)
 }
 
 // JSONProp implements the JSONPather for Enum
@@ -100,7 +297,7 @@ func (e Enum) JSONProp(name string) interface{} {
 	if err != nil {
 		return nil
 	}
-	if idx > len(e) || idx < 0 {
+	if idx >= len(e) || idx < 0 {
 		return nil
 	}
 	return e[idx]
@@ -117,6 +314,9 @@ func (e Enum) JSONChildren() (res map[string]interface{}) {
 
 // String implements the Stringer for Enum
 func (e Enum) String() string {
+	if len(e) == 0 {
+		return "[]"
+	}
 	str := "["
 	for _, c := range e {
 		str += c.String() + ", "
@@ -124,6 +324,23 @@ func (e Enum) String() string {
 	return str[:len(str)-2] + "]"
 }
 
+// Values returns the decoded values allowed by the enum keyword
+func (e Enum) Values() []interface{} {
+	values := make([]interface{}, len(e))
+	for i, c := range e {
+		values[i] = c.Value()
+	}
+	return values
+}
+
+// MarshalJSON implements the json.Marshaler interface for Enum
+func (e Enum) MarshalJSON() ([]byte, error) {
+	if e == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal([]Const(e))
+}
+
 // List of primitive types supported and used by JSON Schema
 var primitiveTypes = map[string]bool{
 	"null":    true,
@@ -141,6 +358,18 @@ func DataType(data interface{}) string {
 	if data == nil {
 		return "null"
 	}
+	if n, ok := data.(json.Number); ok {
+		if r, ok := numberRat(n); ok {
+			if r.IsInt() {
+				return "integer"
+			}
+			return "number"
+		}
+		if f, ok := convertNumberToFloat(n); ok && f == math.Trunc(f) {
+			return "integer"
+		}
+		return "number"
+	}
 
 	switch reflect.TypeOf(data).Kind() {
 	case reflect.Bool:
@@ -185,6 +414,13 @@ func DataTypeWithHint(data interface{}, hint string) string {
 	return dt
 }
 
+// writtenAsFloat reports whether a number decoded as a json.Number
+// was written with a fraction or an exponent
+func writtenAsFloat(data interface{}) bool {
+	n, ok := data.(json.Number)
+	return ok && strings.ContainsAny(string(n), ".eE")
+}
+
 // Type defines the type JSON Schema keyword
 type Type struct {
 	strVal bool
@@ -208,32 +444,49 @@ func (t *Type) Resolve(pointer jptr.Pointer, uri string) *Schema {
 func (t Type) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
 	schemaDebug("[Type] Validating")
 	jt := DataType(data)
+	if jt == "integer" && currentState.Options.strictIntegerType() && writtenAsFloat(data) {
+		jt = "number"
+	}
+	if t.accepts(jt, data) {
+		return
+	}
+	if len(t.vals) == 1 {
+		currentState.AddErrorWithLimit(data, t.vals[0], fmt.Sprintf(`type should be %s, got %s`, t.vals[0], jt))
+		return
+	}
+
+	str := ""
+	for _, ts := range t.vals {
+		str += ts + ","
+	}
+
+	currentState.AddErrorWithLimit(data, str[:len(str)-1], fmt.Sprintf(`type should be one of: %s, got %s`, str[:len(str)-1], jt))
+}
+
+// accepts reports whether one of the types matches
+// an instance of the given data type
+func (t Type) accepts(jt string, data interface{}) bool {
 	for _, typestr := range t.vals {
 		if jt == typestr || jt == "integer" && typestr == "number" {
-			return
+			return true
 		}
 		if jt == "string" && (typestr == "boolean" || typestr == "number" || typestr == "integer") {
 			if DataTypeWithHint(data, typestr) == typestr {
-				return
+				return true
 			}
 		}
 		if jt == "null" && (typestr == "string") {
 			if DataTypeWithHint(data, typestr) == typestr {
-				return
+				return true
 			}
 		}
 	}
-	if len(t.vals) == 1 {
-		currentState.AddError(data, fmt.Sprintf(`type should be %s, got %s`, t.vals[0], jt))
-		return
-	}
-
-	str := ""
-	for _, ts := range t.vals {
-		str += ts + ","
-	}
+	return false
+}
 
-	currentState.AddError(data, fmt.Sprintf(`type should be one of: %s, got %s`, str[:len(str)-1], jt))
+// validScalar implements the scalarKeyword interface for Type
+func (t Type) validScalar(data interface{}) bool {
+	return t.accepts(DataType(data), data)
 }
 
 // String implements the Stringer for Type
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"regexp"
+	"strings"
 	"unicode/utf8"
 
 	jptr "github.com/qri-io/jsonpointer"
@@ -30,12 +31,18 @@ func (m *MaxLength) Resolve(pointer jptr.Pointer, uri string) *Schema {
 func (m MaxLength) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
 	schemaDebug("[MaxLength] Validating")
 	if str, ok := data.(string); ok {
-		if utf8.RuneCountInString(str) > int(m) {
-			currentState.AddError(data, fmt.Sprintf("max length of %d characters exceeded: %s", m, str))
+		if currentState.Options.stringLength(str) > int(m) {
+			currentState.AddErrorWithLimit(data, int(m), fmt.Sprintf("max length of %d characters exceeded: %s", m, str))
 		}
 	}
 }
 
+// validScalar implements the scalarKeyword interface for MaxLength
+func (m MaxLength) validScalar(data interface{}) bool {
+	str, ok := data.(string)
+	return !ok || utf8.RuneCountInString(str) <= int(m)
+}
+
 // MinLength defines the maxLenght JSON Schema keyword
 type MinLength int
 
@@ -56,15 +63,29 @@ func (m *MinLength) Resolve(pointer jptr.Pointer, uri string) *Schema {
 func (m MinLength) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
 	schemaDebug("[MinLength] Validating")
 	if str, ok := data.(string); ok {
-		if utf8.RuneCountInString(str) < int(m) {
-			currentState.AddError(data, fmt.Sprintf("min length of %d characters required: %s", m, str))
+		if currentState.Options.stringLength(str) < int(m) {
+			currentState.AddErrorWithLimit(data, int(m), fmt.Sprintf("min length of %d characters required: %s", m, str))
 		}
 	}
 }
 
-// Pattern defines the pattern JSON Schema keyword
+// validScalar implements the scalarKeyword interface for MinLength
+func (m MinLength) validScalar(data interface{}) bool {
+	str, ok := data.(string)
+	return !ok || utf8.RuneCountInString(str) >= int(m)
+}
+
+// Pattern defines the pattern JSON Schema keyword. The ECMA 262 expression
+// of the schema is compiled to its Go translation, parsing the keyword keeps
+// the expression on its schema for error messages and marshaling
 type Pattern regexp.Regexp
 
+// patternSource is the expression a pattern was parsed from
+// along with the Go expression it was translated to
+type patternSource struct {
+	source, expr string
+}
+
 // NewPattern allocates a new Pattern keyword
 func NewPattern() Keyword {
 	return &Pattern{}
@@ -78,17 +99,48 @@ func (p *Pattern) Resolve(pointer jptr.Pointer, uri string) *Schema {
 	return nil
 }
 
+// derive implements the derivingKeyword interface for Pattern
+func (p *Pattern) derive(data []byte) interface{} {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return nil
+	}
+	return patternSource{source: str, expr: (*regexp.Regexp)(p).String()}
+}
+
 // ValidateKeyword implements the Keyword interface for Pattern
-func (p Pattern) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
+func (p *Pattern) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
 	schemaDebug("[Pattern] Validating")
-	re := regexp.Regexp(p)
-	if str, ok := data.(string); ok {
-		if !re.Match([]byte(str)) {
-			currentState.AddError(data, fmt.Sprintf("regexp pattern %s mismatch on string: %s", re.String(), str))
-		}
+	if str, ok := data.(string); ok && !p.matches(str) {
+		source := p.source(currentState.derived())
+		currentState.AddErrorWithLimit(data, source, fmt.Sprintf("regexp pattern %s mismatch on string: %s", source, str))
 	}
 }
 
+// validScalar implements the scalarKeyword interface for Pattern
+func (p *Pattern) validScalar(data interface{}) bool {
+	str, ok := data.(string)
+	return !ok || p.matches(str)
+}
+
+// matches reports whether the pattern matches str. The expression is
+// compiled once when unmarshaling and used in place. The empty expression
+// matches any string, which spares matching with an unparsed Pattern
+func (p *Pattern) matches(str string) bool {
+	re := (*regexp.Regexp)(p)
+	return re.String() == "" || re.MatchString(str)
+}
+
+// source returns the expression the pattern was parsed from, or its
+// Go expression if the pattern changed since or wasn't parsed
+func (p *Pattern) source(derived interface{}) string {
+	expr := (*regexp.Regexp)(p).String()
+	if src, ok := derived.(patternSource); ok && src.expr == expr {
+		return src.source
+	}
+	return expr
+}
+
 // UnmarshalJSON implements the json.Unmarshaler interface for Pattern
 func (p *Pattern) UnmarshalJSON(data []byte) error {
 	var str string
@@ -96,18 +148,101 @@ func (p *Pattern) UnmarshalJSON(data []byte) error {
 		return err
 	}
 
-	ptn, err := regexp.Compile(str)
+	ptn, err := compileRegex(str)
 	if err != nil {
-		return err
+		return fmt.Errorf("invalid pattern: %s: %s", str, err.Error())
 	}
 
 	*p = Pattern(*ptn)
 	return nil
 }
 
-// MarshalJSON implements the json.Marshaler interface for Pattern
-func (p Pattern) MarshalJSON() ([]byte, error) {
-	re := regexp.Regexp(p)
-	rep := &re
-	return json.Marshal(rep.String())
+// MarshalJSON implements the json.Marshaler interface for Pattern. A Pattern
+// marshaled with its schema is written as the expression it was parsed from,
+// on its own it is written as its Go expression
+func (p *Pattern) MarshalJSON() ([]byte, error) {
+	return json.Marshal((*regexp.Regexp)(p).String())
+}
+
+// marshalKeyword implements the keywordMarshaler interface for patternSource
+func (src patternSource) marshalKeyword(kw Keyword) ([]byte, bool) {
+	p, ok := kw.(*Pattern)
+	if !ok || (*regexp.Regexp)(p).String() != src.expr {
+		return nil, false
+	}
+	data, err := json.Marshal(src.source)
+	return data, err == nil
+}
+
+// compileRegex compiles an ECMA 262 regular expression as used by pattern,
+// patternProperties and the regex format. Like ECMA 262 searches, Go
+// expressions are unanchored and ^ and $ only match at the ends of the
+// input, so only . and some escapes need translating
+func compileRegex(expr string) (*regexp.Regexp, error) {
+	return regexp.Compile(translateECMARegex(expr))
+}
+
+// translateECMARegex rewrites the parts of an ECMA 262 regular expression Go
+// lacks or interprets differently: . which doesn't match any line terminator,
+// the empty classes [] and [^], \cX control characters, \uXXXX code units and
+// \0. Like the test suite, \s and \S keep their ASCII meaning
+func translateECMARegex(expr string) string {
+	if !strings.ContainsAny(expr, `\.[`) {
+		return expr
+	}
+	var sb strings.Builder
+	inClass := false
+	for i := 0; i < len(expr); i++ {
+		c := expr[i]
+		switch {
+		case c == '\\' && i+1 < len(expr):
+			next := expr[i+1]
+			switch {
+			case next == 'c' && i+2 < len(expr) && isASCIILetter(expr[i+2]):
+				fmt.Fprintf(&sb, `\x{%x}`, expr[i+2]%32)
+				i++
+			case next == 'u' && i+6 <= len(expr) && isHex(expr[i+2:i+6]):
+				fmt.Fprintf(&sb, `\x{%s}`, expr[i+2:i+6])
+				i += 4
+			case next == '0' && (i+2 >= len(expr) || !isDigit(expr[i+2])):
+				sb.WriteString(`\x{0}`)
+			default:
+				sb.WriteByte(c)
+				sb.WriteByte(next)
+			}
+			i++
+		case c == '.' && !inClass:
+			sb.WriteString(`[^\n\r\x{2028}\x{2029}]`)
+		case c == '[' && !inClass && strings.HasPrefix(expr[i+1:], "^]"):
+			sb.WriteString(`[\x{0}-\x{10ffff}]`)
+			i += 2
+		case c == '[' && !inClass && strings.HasPrefix(expr[i+1:], "]"):
+			sb.WriteString(`[^\x{0}-\x{10ffff}]`)
+			i++
+		case c == '[' && !inClass:
+			inClass = true
+			sb.WriteByte(c)
+		case c == ']' && inClass:
+			inClass = false
+			sb.WriteByte(c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+// isASCIILetter checks if a byte is an ASCII letter
+func isASCIILetter(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+}
+
+// isHex checks if a string only holds hexadecimal digits
+func isHex(str string) bool {
+	for i := 0; i < len(str); i++ {
+		if !isDigit(str[i]) && !(str[i] >= 'a' && str[i] <= 'f') && !(str[i] >= 'A' && str[i] <= 'F') {
+			return false
+		}
+	}
+	return true
 }
@@ -0,0 +1,158 @@
+package jsonschema
+
+import (
+	"fmt"
+
+	jptr "github.com/qri-io/jsonpointer"
+)
+
+const (
+	// OutputFlag reports only whether validation passed
+	OutputFlag = "flag"
+	// OutputBasic reports a flat list of errors
+	OutputBasic = "basic"
+	// OutputDetailed reports errors nested by keyword location,
+	// condensing branches with a single child
+	OutputDetailed = "detailed"
+	// OutputVerbose reports errors nested by keyword location
+	// without condensing the tree
+	OutputVerbose = "verbose"
+)
+
+// OutputUnit is a node of the structured validation output defined by the
+// JSON Schema specification. Only failing evaluation paths are reported
+type OutputUnit struct {
+	Valid                   bool         `json:"valid"`
+	KeywordLocation         string       `json:"keywordLocation"`
+	AbsoluteKeywordLocation string       `json:"absoluteKeywordLocation,omitempty"`
+	InstanceLocation        string       `json:"instanceLocation"`
+	Error                   string       `json:"error,omitempty"`
+	Errors                  []OutputUnit `json:"errors,omitempty"`
+}
+
+// OutputUnit builds the validation result in one of the output formats
+// defined by the specification: flag, basic, detailed or verbose
+func (vs *ValidationState) OutputUnit(format string) (OutputUnit, error) {
+	errs := []KeyError{}
+	if vs.Errs != nil {
+		errs = *vs.Errs
+	}
+	root := OutputUnit{Valid: len(errs) == 0}
+
+	switch format {
+	case OutputFlag:
+		return root, nil
+	case OutputBasic:
+		for _, err := range errs {
+			root.Errors = append(root.Errors, err.outputUnit())
+		}
+		return root, nil
+	case OutputDetailed, OutputVerbose:
+		tree := &outputNode{}
+		for _, err := range errs {
+			tree.insert(err)
+		}
+		return tree.unit(format == OutputDetailed), nil
+	}
+	return root, fmt.Errorf("unknown output format %q", format)
+}
+
+// outputUnit converts a KeyError to a leaf OutputUnit
+func (v KeyError) outputUnit() OutputUnit {
+	return OutputUnit{
+		Valid:                   false,
+		KeywordLocation:         v.KeywordLocation,
+		AbsoluteKeywordLocation: v.AbsoluteKeywordLocation,
+		InstanceLocation:        v.outputInstanceLocation(),
+		Error:                   v.Message,
+	}
+}
+
+// outputInstanceLocation returns the instance location of the error,
+// converting the property path of errors which only set one
+func (v KeyError) outputInstanceLocation() string {
+	if v.InstanceLocation != "" || v.PropertyPath == "/" {
+		return v.InstanceLocation
+	}
+	return v.PropertyPath
+}
+
+// outputNode is an intermediate structure used to nest errors
+// by their keyword location
+type outputNode struct {
+	location jptr.Pointer
+	children []*outputNode
+	index    map[string]*outputNode
+	errs     []OutputUnit
+}
+
+// insert adds an error to the tree, creating intermediate nodes
+// for each token of the keyword location
+func (n *outputNode) insert(err KeyError) {
+	location, parseErr := jptr.Parse(err.KeywordLocation)
+	if parseErr != nil {
+		location = jptr.Pointer{}
+	}
+	node := n
+	for i := 0; i < len(location)-1; i++ {
+		tok := location[i]
+		if node.index == nil {
+			node.index = map[string]*outputNode{}
+		}
+		child, ok := node.index[tok]
+		if !ok {
+			child = &outputNode{location: append(jptr.Pointer{}, location[:i+1]...)}
+			node.index[tok] = child
+			node.children = append(node.children, child)
+		}
+		node = child
+	}
+	node.errs = append(node.errs, err.outputUnit())
+}
+
+// unit converts the node into an OutputUnit, optionally
+// replacing nodes with a single child by the child
+func (n *outputNode) unit(condense bool) OutputUnit {
+	u := OutputUnit{
+		Valid:           len(n.children) == 0 && len(n.errs) == 0,
+		KeywordLocation: n.location.String(),
+	}
+	for _, ch := range n.children {
+		cu := ch.unit(condense)
+		if condense && len(cu.Errors) == 1 && cu.Error == "" {
+			cu = cu.Errors[0]
+		}
+		u.Errors = append(u.Errors, cu)
+	}
+	u.Errors = append(u.Errors, n.errs...)
+
+	instances := make([]string, len(u.Errors))
+	for i, child := range u.Errors {
+		instances[i] = child.InstanceLocation
+	}
+	u.InstanceLocation = commonPointerPrefix(instances)
+	return u
+}
+
+// commonPointerPrefix returns the longest JSON pointer shared by all locations
+func commonPointerPrefix(locations []string) string {
+	if len(locations) == 0 {
+		return ""
+	}
+	prefix, err := jptr.Parse(locations[0])
+	if err != nil {
+		return ""
+	}
+	for _, loc := range locations[1:] {
+		ptr, err := jptr.Parse(loc)
+		if err != nil {
+			return ""
+		}
+		i := 0
+		for i < len(prefix) && i < len(ptr) && prefix[i] == ptr[i] {
+			i++
+		}
+		prefix = prefix[:i]
+	}
+	return prefix.String()
+}
@@ -0,0 +1,136 @@
+package jsonschema
+
+import (
+	"context"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	jptr "github.com/qri-io/jsonpointer"
+)
+
+// ParallelThreshold is the number of property values or array items below
+// which ValidationOptions.Parallel still validates them sequentially, as
+// starting goroutines costs more than validating a few small values
+var ParallelThreshold = 64
+
+// workerPool bounds the goroutines a parallel validation run starts,
+// including those started while validating on another goroutine
+type workerPool struct {
+	slots chan struct{}
+}
+
+// newWorkerPool creates the worker pool of a validation run, nil unless
+// the options ask for parallel validation
+func newWorkerPool(opts *ValidationOptions) *workerPool {
+	if opts == nil || !opts.Parallel {
+		return nil
+	}
+	workers := opts.ParallelWorkers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	return &workerPool{slots: make(chan struct{}, workers)}
+}
+
+// run calls task for every index from 0 to n, on a new goroutine while
+// the pool has a free worker and on the calling goroutine otherwise, and
+// returns once all tasks are done. Tasks are skipped once stop reports true
+func (p *workerPool) run(n int, stop func() bool, task func(i int)) {
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		if stop() {
+			break
+		}
+		select {
+		case p.slots <- struct{}{}:
+			wg.Add(1)
+			go func(i int) {
+				defer func() {
+					<-p.slots
+					wg.Done()
+				}()
+				task(i)
+			}(i)
+		default:
+			task(i)
+		}
+	}
+	wg.Wait()
+}
+
+// parallelBranch is a value validated on its own goroutine
+type parallelBranch struct {
+	token string
+	data  interface{}
+	sch   *Schema
+	state *ValidationState
+}
+
+// runParallel validates each branch against its schema with its own
+// state on the workers of the run, then folds the errors, annotations and
+// coercions of the branches into currentState in the order of the branches.
+// The schema locations of the branches descend by tokens, followed by the
+// token of the branch when tokenInSchema is set. The schemas are prepared
+// along with the root of the validation, so the goroutines only read them.
+// It reports false, having validated nothing, if the run is sequential or
+// there are fewer branches than ParallelThreshold
+func runParallel(ctx context.Context, currentState *ValidationState, branches []*parallelBranch, tokenInSchema bool, tokens ...string) bool {
+	if currentState.workers == nil || len(branches) < ParallelThreshold {
+		return false
+	}
+
+	var failed int32
+	failFast := currentState.Options != nil && currentState.Options.FailFast
+	stop := func() bool {
+		return ctx.Err() != nil || atomic.LoadInt32(&failed) != 0
+	}
+	for _, b := range branches {
+		b.state = currentState.branch()
+		schemaTokens := tokens
+		if tokenInSchema {
+			schemaTokens = append(append([]string{}, tokens...), b.token)
+		}
+		// pointers descend by appending to the array they share with
+		// their parent, so every branch gets locations of its own
+		b.state.BaseRelativeLocation = branchPointer(currentState.BaseRelativeLocation, schemaTokens...)
+		b.state.RelativeLocation = branchPointer(currentState.RelativeLocation, schemaTokens...)
+		b.state.InstanceLocation = branchPointer(currentState.InstanceLocation, b.token)
+	}
+	currentState.workers.run(len(branches), stop, func(i int) {
+		b := branches[i]
+		b.sch.ValidateKeyword(ctx, b.state, b.data)
+		if failFast && !b.state.IsValid() {
+			atomic.StoreInt32(&failed, 1)
+		}
+	})
+
+	for _, b := range branches {
+		currentState.AddSubErrors(*b.state.Errs...)
+		currentState.mergeResults(b.state)
+	}
+	return true
+}
+
+// branchPointer returns a copy of ptr descended by tokens that doesn't
+// share its array with ptr, nil if ptr is nil
+func branchPointer(ptr *jptr.Pointer, tokens ...string) *jptr.Pointer {
+	if ptr == nil {
+		return nil
+	}
+	cp := make(jptr.Pointer, 0, len(*ptr)+len(tokens))
+	cp = append(append(cp, *ptr...), tokens...)
+	return &cp
+}
+
+// sortedBranchKeys returns the keys of obj in sorted order, so the errors
+// of branches validated concurrently are reported in a stable order
+func sortedBranchKeys(obj map[string]interface{}) []string {
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
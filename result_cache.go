@@ -0,0 +1,110 @@
+package jsonschema
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"sync"
+)
+
+// CachedValidator validates JSON documents against a schema, memoizing
+// the errors of each document by the SHA-256 hash of its bytes so
+// byte-identical documents are only validated once. It suits workloads
+// that validate the same documents repeatedly, such as retried requests.
+// The schema must not be changed while the validator is in use. A
+// CachedValidator is safe for concurrent use
+type CachedValidator struct {
+	schema *Schema
+	opts   *ValidationOptions
+
+	lock       sync.Mutex
+	maxEntries int
+	entries    map[[sha256.Size]byte]*list.Element
+	lru        *list.List
+}
+
+// resultCacheEntry is an element of the CachedValidator eviction list
+type resultCacheEntry struct {
+	key  [sha256.Size]byte
+	errs []KeyError
+}
+
+// NewCachedValidator allocates a CachedValidator validating with s and
+// opts, which may be nil, holding the results of at most maxEntries
+// documents and evicting the least recently validated one when full.
+// A maxEntries of 0 or less never evicts
+func NewCachedValidator(s *Schema, opts *ValidationOptions, maxEntries int) *CachedValidator {
+	return &CachedValidator{
+		schema:     s,
+		opts:       opts,
+		maxEntries: maxEntries,
+		entries:    map[[sha256.Size]byte]*list.Element{},
+		lru:        list.New(),
+	}
+}
+
+// ValidateBytes returns the errors of validating data like
+// Schema.ValidateBytesWithOptions, reusing the errors of a previously
+// validated identical document. Documents that fail to parse and
+// validations aborted by the context aren't cached
+func (v *CachedValidator) ValidateBytes(ctx context.Context, data []byte) ([]KeyError, error) {
+	key := sha256.Sum256(data)
+	v.lock.Lock()
+	if elem, ok := v.entries[key]; ok {
+		v.lru.MoveToFront(elem)
+		errs := elem.Value.(*resultCacheEntry).errs
+		v.lock.Unlock()
+		return copyKeyErrors(errs), nil
+	}
+	v.lock.Unlock()
+
+	errs, err := v.schema.ValidateBytesWithOptions(ctx, data, v.opts)
+	if err != nil {
+		return errs, err
+	}
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	// another caller may have validated the same document meanwhile
+	if elem, ok := v.entries[key]; ok {
+		v.lru.MoveToFront(elem)
+		return errs, nil
+	}
+	v.entries[key] = v.lru.PushFront(&resultCacheEntry{key: key, errs: copyKeyErrors(errs)})
+	v.evict()
+	return errs, nil
+}
+
+// Len returns the number of documents whose results are cached
+func (v *CachedValidator) Len() int {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.lru.Len()
+}
+
+// Purge removes all cached results
+func (v *CachedValidator) Purge() {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.entries = map[[sha256.Size]byte]*list.Element{}
+	v.lru.Init()
+}
+
+// evict drops the least recently validated results above the maximum
+// number of entries. Callers must hold the validator lock
+func (v *CachedValidator) evict() {
+	if v.maxEntries <= 0 {
+		return
+	}
+	for v.lru.Len() > v.maxEntries {
+		elem := v.lru.Back()
+		v.lru.Remove(elem)
+		delete(v.entries, elem.Value.(*resultCacheEntry).key)
+	}
+}
+
+// copyKeyErrors copies a slice of errors, so callers appending
+// to or modifying their results don't change the cached ones
+func copyKeyErrors(errs []KeyError) []KeyError {
+	return append(make([]KeyError, 0, len(errs)), errs...)
+}
@@ -1,12 +1,14 @@
 package jsonschema
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"net/url"
 	"sort"
 	"strings"
+	"sync/atomic"
 
 	jptr "github.com/qri-io/jsonpointer"
 )
@@ -18,6 +20,9 @@ func Must(jsonString string) *Schema {
 	if err := s.UnmarshalJSON([]byte(jsonString)); err != nil {
 		panic(err)
 	}
+	if err := s.checkStrictKeywords(); err != nil {
+		panic(err)
+	}
 	return s
 }
 
@@ -29,17 +34,46 @@ const (
 	schemaTypeTrue
 )
 
-// Schema is the top-level structure defining a json schema
+// Schema is the top-level structure defining a json schema. A parsed schema
+// can be validated from multiple goroutines at once: the references it
+// reaches are resolved on its first validation, later validations only read it
 type Schema struct {
 	schemaType    schemaType
 	docPath       string
 	hasRegistered bool
+	// prepared is set atomically once the references reachable from the
+	// schema are resolved, from then on validating it only reads schemas
+	prepared uint32
+	// scalar is set when preparing a schema whose keywords all check
+	// instances on their own, which validateErrs then does directly
+	scalar bool
 
-	id string
+	id    string
+	draft Draft
+	// keywordRegistry is the registry a schema was parsed with by
+	// ParseSchema, nil when it was parsed with the global registry
+	keywordRegistry *KeywordRegistry
 
 	extraDefinitions map[string]json.RawMessage
-	keywords         map[string]Keyword
-	orderedkeywords  []string
+	// extraOrder lists the keys of extraDefinitions in source order
+	extraOrder      []string
+	keywords        map[string]Keyword
+	orderedkeywords []string
+	// derived holds the data keywords derive from the JSON they were
+	// parsed from that their exported types can't keep, by keyword name
+	derived map[string]interface{}
+
+	// anchors index the $anchor and $dynamicAnchor keywords of the
+	// schema resource, populated on first lookup
+	anchors        map[string]*Schema
+	dynamicAnchors map[string]*Schema
+	// duplicateAnchors holds the anchor names declared
+	// by more than one schema of the resource
+	duplicateAnchors map[string]bool
+
+	// errorFormatter renders error messages when validating
+	// against the schema, falling back to the global formatter
+	errorFormatter ErrorFormatter
 }
 
 // NewSchema allocates a new Schema Keyword/Validator
@@ -54,6 +88,28 @@ func (s *Schema) HasKeyword(key string) bool {
 	return ok
 }
 
+// Keyword returns the parsed instance of a keyword of the schema,
+// or nil if the schema doesn't have the keyword
+func (s *Schema) Keyword(name string) Keyword {
+	if s == nil {
+		return nil
+	}
+	return s.keywords[name]
+}
+
+// Keywords returns all keywords of the schema by name. The returned
+// map is a copy, adding or removing entries doesn't affect the schema
+func (s *Schema) Keywords() map[string]Keyword {
+	if s == nil {
+		return map[string]Keyword{}
+	}
+	keywords := make(map[string]Keyword, len(s.keywords))
+	for name, kw := range s.keywords {
+		keywords[name] = kw
+	}
+	return keywords
+}
+
 // Register implements the Keyword interface for Schema
 func (s *Schema) Register(uri string, registry *SchemaRegistry) {
 	schemaDebug("[Schema] Register")
@@ -82,6 +138,10 @@ func (s *Schema) Register(uri string, registry *SchemaRegistry) {
 		s.docPath = docURI
 		GetSchemaRegistry().Register(s)
 		uri = docURI
+	} else if s.docPath != "" && s.isResource() {
+		// documents fetched or added to the registry already know their
+		// URI, which is the base of the schema resources they embed
+		uri = s.docPath
 	}
 
 	for _, keyword := range s.keywords {
@@ -89,6 +149,142 @@ func (s *Schema) Register(uri string, registry *SchemaRegistry) {
 	}
 }
 
+// isResource checks if the schema identifies a new schema resource
+func (s *Schema) isResource() bool {
+	return s.id != "" && s.id[0] != '#'
+}
+
+// findAnchor looks up a plain name fragment within the schema resource,
+// reporting whether it matched a $dynamicAnchor
+func (s *Schema) findAnchor(name string) (*Schema, bool) {
+	s.indexAnchors()
+	if sch, ok := s.anchors[name]; ok {
+		return sch, false
+	}
+	if sch, ok := s.dynamicAnchors[name]; ok {
+		return sch, true
+	}
+	return nil, false
+}
+
+// findDynamicAnchor looks up a $dynamicAnchor within the schema resource
+func (s *Schema) findDynamicAnchor(name string) *Schema {
+	s.indexAnchors()
+	return s.dynamicAnchors[name]
+}
+
+// isDuplicateAnchor checks if more than one schema of the
+// schema resource declares the anchor name
+func (s *Schema) isDuplicateAnchor(name string) bool {
+	s.indexAnchors()
+	return s.duplicateAnchors[name]
+}
+
+// checkAnchors returns an error naming the first anchor declared more than
+// once by the schema resource, or any schema resource embedded in it
+func (s *Schema) checkAnchors() error {
+	if s.schemaType != schemaTypeObject {
+		return nil
+	}
+	s.indexAnchors()
+	if len(s.duplicateAnchors) > 0 {
+		names := make([]string, 0, len(s.duplicateAnchors))
+		for name := range s.duplicateAnchors {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("duplicate anchor %q in schema resource %q", names[0], s.id)
+	}
+
+	var walk func(sch *Schema) error
+	walk = func(sch *Schema) error {
+		for _, sub := range sch.subschemas() {
+			if sub.schemaType != schemaTypeObject {
+				continue
+			}
+			if sub.isResource() {
+				if err := sub.checkAnchors(); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := walk(sub); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return walk(s)
+}
+
+// locate returns the JSON pointer to the target subschema within the schema
+func (s *Schema) locate(target *Schema) (jptr.Pointer, bool) {
+	var find func(elem interface{}, path jptr.Pointer) (jptr.Pointer, bool)
+	find = func(elem interface{}, path jptr.Pointer) (jptr.Pointer, bool) {
+		if sk, ok := elem.(SchemaKeyword); ok && sk.GetSchema() == target {
+			return path, true
+		}
+		con, ok := elem.(JSONContainer)
+		if !ok {
+			return nil, false
+		}
+		for key, ch := range con.JSONChildren() {
+			if res, ok := find(ch, childPointer(path, key)); ok {
+				return res, true
+			}
+		}
+		return nil, false
+	}
+	return find(s, jptr.NewPointer())
+}
+
+// indexAnchors collects the anchors of the schema resource without
+// descending into embedded schema resources
+func (s *Schema) indexAnchors() {
+	if s.anchors != nil {
+		return
+	}
+	s.anchors = map[string]*Schema{}
+	s.dynamicAnchors = map[string]*Schema{}
+
+	// dynamic anchors also define a plain name fragment,
+	// which must be unique within the schema resource
+	names := map[string]*Schema{}
+	declare := func(name string, sch *Schema) {
+		if prev, ok := names[name]; ok && prev != sch {
+			if s.duplicateAnchors == nil {
+				s.duplicateAnchors = map[string]bool{}
+			}
+			s.duplicateAnchors[name] = true
+		}
+		names[name] = sch
+	}
+
+	var collect func(elem interface{})
+	collect = func(elem interface{}) {
+		if sk, ok := elem.(SchemaKeyword); ok {
+			sch := sk.GetSchema()
+			if sch != s && sch.isResource() {
+				return
+			}
+			if a, ok := sch.keywords["$anchor"].(*Anchor); ok {
+				s.anchors[string(*a)] = sch
+				declare(string(*a), sch)
+			}
+			if a, ok := sch.keywords["$dynamicAnchor"].(*DynamicAnchor); ok {
+				s.dynamicAnchors[string(*a)] = sch
+				declare(string(*a), sch)
+			}
+		}
+		if con, ok := elem.(JSONContainer); ok {
+			for _, ch := range con.JSONChildren() {
+				collect(ch)
+			}
+		}
+	}
+	collect(s)
+}
+
 // Resolve implements the Keyword interface for Schema
 func (s *Schema) Resolve(pointer jptr.Pointer, uri string) *Schema {
 	if pointer.IsEmpty() {
@@ -137,6 +333,104 @@ func (s *Schema) Resolve(pointer jptr.Pointer, uri string) *Schema {
 	return nil
 }
 
+// SubschemaAt returns the subschema at a JSON pointer within the schema, such
+// as /properties/address/properties/zip, navigating keywords the same way the
+// JSON pointer fragment of a $ref is resolved. It errors when the pointer
+// doesn't land on a schema
+func (s *Schema) SubschemaAt(pointer jptr.Pointer) (*Schema, error) {
+	if s == nil {
+		return nil, fmt.Errorf("schema is nil")
+	}
+	sch := s.Resolve(pointer, s.docPath)
+	if sch == nil {
+		return nil, fmt.Errorf("no subschema at %s", pointer.String())
+	}
+	return sch, nil
+}
+
+// ResolveRef follows a reference such as #/$defs/address or #address within
+// the schema and returns the subschema it points to, without validating
+// anything. Fragments are either JSON pointers or plain name anchors.
+// References with a URI resolve against the schema resources embedded in
+// the schema, by their $id relative to the $id of the schema
+func (s *Schema) ResolveRef(ref string) (*Schema, error) {
+	if s == nil {
+		return nil, fmt.Errorf("schema is nil")
+	}
+	normalizedRef, err := url.QueryUnescape(ref)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ref %q: %s", ref, err.Error())
+	}
+	address, fragment := normalizedRef, ""
+	if i := strings.IndexByte(normalizedRef, '#'); i >= 0 {
+		address, fragment = normalizedRef[:i], normalizedRef[i+1:]
+	}
+
+	resource := s
+	if address != "" {
+		if resource, err = s.findResource(address); err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case fragment == "":
+		return resource, nil
+	case fragment[0] == '/':
+		pointer, err := jptr.Parse(fragment)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ref %q: %s", ref, err.Error())
+		}
+		return resource.SubschemaAt(pointer)
+	default:
+		if sch, _ := resource.findAnchor(fragment); sch != nil {
+			return sch, nil
+		}
+		return nil, fmt.Errorf("no anchor %q in schema resource", fragment)
+	}
+}
+
+// findResource returns the schema resource identified by a URI, which is
+// resolved against the $id of the schema. Only the schema itself and the
+// resources embedded in it are considered
+func (s *Schema) findResource(address string) (*Schema, error) {
+	base := strings.TrimRight(s.id, "#")
+	uri, err := SafeResolveURL(base, address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ref %q: %s", address, err.Error())
+	}
+	uri = strings.TrimRight(uri, "#")
+	if uri == base {
+		return s, nil
+	}
+
+	var find func(sch *Schema, base string) *Schema
+	find = func(sch *Schema, base string) *Schema {
+		for _, sub := range sch.subschemas() {
+			if sub.schemaType != schemaTypeObject {
+				continue
+			}
+			subBase := base
+			if sub.isResource() {
+				if subBase, err = SafeResolveURL(base, sub.id); err != nil {
+					continue
+				}
+				if subBase = strings.TrimRight(subBase, "#"); subBase == uri {
+					return sub
+				}
+			}
+			if found := find(sub, subBase); found != nil {
+				return found
+			}
+		}
+		return nil
+	}
+	if found := find(s, base); found != nil {
+		return found, nil
+	}
+	return nil, fmt.Errorf("no schema resource %s in schema", uri)
+}
+
 // JSONProp implements the JSONPather for Schema
 func (s Schema) JSONProp(name string) interface{} {
 	if keyword, ok := s.keywords[name]; ok {
@@ -165,10 +459,103 @@ func (s *Schema) GetSchema() *Schema {
 // _schema is an internal struct for encoding & decoding purposes
 type _schema struct {
 	ID string `json:"$id,omitempty"`
+	// LegacyID is the id identifying draft4 schemas
+	LegacyID string `json:"id,omitempty"`
 }
 
 // UnmarshalJSON implements the json.Unmarshaler interface for Schema
 func (s *Schema) UnmarshalJSON(data []byte) error {
+	return s.unmarshal(data, nil, nil)
+}
+
+// ParseSchema parses a schema document with the keywords of the given
+// registry instead of the global keyword registry, so parts of a program
+// can use different sets of custom keywords. Subschemas declaring their
+// own $schema, the subschemas of custom keywords, and remote schemas fetched
+// while validating, are parsed with the global registry. A nil registry
+// uses the global registry
+func ParseSchema(data []byte, registry *KeywordRegistry) (*Schema, error) {
+	s := &Schema{}
+	if err := s.unmarshal(data, nil, registry); err != nil {
+		return nil, err
+	}
+	if err := s.checkStrictKeywords(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// parseContext carries the draft and keyword registry of a schema to the
+// subschemas of its keywords, which are parsed with them in the same pass
+// unless they declare their own $schema
+type parseContext struct {
+	draft    Draft
+	registry *KeywordRegistry
+	// scoped is set when registry was given to ParseSchema
+	scoped bool
+}
+
+// subschemaUnmarshaler is implemented by the keywords holding subschemas,
+// which parse them with the context of the enclosing schema. A nil context
+// parses them as documents of their own, as json.Unmarshal does
+type subschemaUnmarshaler interface {
+	unmarshalSubschemas(data []byte, pc *parseContext) error
+}
+
+// parseSchema parses a subschema in the context of its enclosing schema
+func (pc *parseContext) parseSchema(data []byte) (*Schema, error) {
+	sch := &Schema{}
+	if err := sch.unmarshal(data, pc, nil); err != nil {
+		return nil, err
+	}
+	return sch, nil
+}
+
+// parseSchemaList parses an array of subschemas
+func (pc *parseContext) parseSchemaList(data []byte) ([]*Schema, error) {
+	var raws []json.RawMessage
+	if err := json.Unmarshal(data, &raws); err != nil {
+		return nil, err
+	}
+	list := make([]*Schema, len(raws))
+	for i, raw := range raws {
+		sch, err := pc.parseSchema(raw)
+		if err != nil {
+			return nil, err
+		}
+		list[i] = sch
+	}
+	return list, nil
+}
+
+// parseSchemaMap parses an object of subschemas, in key order
+// so the error reported for several invalid subschemas is stable
+func (pc *parseContext) parseSchemaMap(data []byte) (map[string]*Schema, error) {
+	var raws map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raws); err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(raws))
+	for key := range raws {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	schemas := make(map[string]*Schema, len(raws))
+	for _, key := range keys {
+		sch, err := pc.parseSchema(raws[key])
+		if err != nil {
+			return nil, err
+		}
+		schemas[key] = sch
+	}
+	return schemas, nil
+}
+
+// unmarshal parses a schema in the context of its enclosing schema, nil for
+// a document, and the subschemas of its keywords along with it. A document
+// uses the keywords of the scoped registry when given and picks a registry
+// from the global one otherwise
+func (s *Schema) unmarshal(data []byte, enclosing *parseContext, scoped *KeywordRegistry) error {
 	var b bool
 	if err := json.Unmarshal(data, &b); err == nil {
 		if b {
@@ -181,22 +568,65 @@ func (s *Schema) UnmarshalJSON(data []byte) error {
 		return nil
 	}
 
-	keywordRegistry := copyGlobalKeywordRegistry()
-	keywordRegistry.DefaultIfEmpty()
+	valprops := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &valprops); err != nil {
+		return err
+	}
+
+	pc := enclosing
+	var uri string
+	if rawURI, ok := valprops["$schema"]; ok && json.Unmarshal(rawURI, &uri) == nil {
+		// a schema declaring its draft starts a new keyword set
+		draft, known := DraftFromURI(uri)
+		if !known {
+			// the keyword semantics of other drafts are unknown, so
+			// they are checked as DefaultDraft or the scoped registry
+			schemaDebug("[Schema] WARN: unknown $schema %q, parsing as draft %s", uri, DefaultDraft)
+			draft = DefaultDraft
+		}
+		if scoped != nil {
+			pc = &parseContext{draft: draft, registry: scoped, scoped: true}
+		} else {
+			pc = &parseContext{draft: draft, registry: draftKeywordRegistry(draft)}
+		}
+	} else if pc == nil {
+		if scoped != nil {
+			pc = &parseContext{registry: scoped, scoped: true}
+		} else {
+			registry := copyGlobalKeywordRegistry()
+			registry.DefaultIfEmpty()
+			pc = &parseContext{registry: registry}
+		}
+	}
+
+	if err := s.unmarshalKeywords(data, valprops, pc); err != nil {
+		return err
+	}
+	s.draft = pc.draft
+	if pc.scoped {
+		s.keywordRegistry = pc.registry
+	}
+	return nil
+}
 
+// unmarshalKeywords populates the schema with keywords from the registry
+// of the parse context, parsing their subschemas in the same context
+func (s *Schema) unmarshalKeywords(data []byte, valprops map[string]json.RawMessage, pc *parseContext) error {
+	keywordRegistry := pc.registry
 	_s := _schema{}
 	if err := json.Unmarshal(data, &_s); err != nil {
 		return err
 	}
 
-	sch := &Schema{
-		id:       _s.ID,
-		keywords: map[string]Keyword{},
+	id := _s.ID
+	if !keywordRegistry.IsRegisteredKeyword("$id") && keywordRegistry.IsRegisteredKeyword("id") {
+		// draft4 keyword sets identify schemas with id
+		id = _s.LegacyID
 	}
 
-	valprops := map[string]json.RawMessage{}
-	if err := json.Unmarshal(data, &valprops); err != nil {
-		return err
+	sch := &Schema{
+		id:       id,
+		keywords: map[string]Keyword{},
 	}
 
 	for prop, rawmsg := range valprops {
@@ -213,12 +643,25 @@ func (s *Schema) UnmarshalJSON(data []byte) error {
 			sch.extraDefinitions[prop] = rawmsg
 			continue
 		}
-		if _, ok := keyword.(*Void); !ok {
-			if err := json.Unmarshal(rawmsg, keyword); err != nil {
-				return fmt.Errorf("error unmarshaling %s from json: %s", prop, err.Error())
-			}
+		var err error
+		if su, ok := keyword.(subschemaUnmarshaler); ok {
+			err = su.unmarshalSubschemas(rawmsg, pc)
+		} else {
+			// custom keywords parse their subschemas as documents
+			err = json.Unmarshal(rawmsg, keyword)
+		}
+		if err != nil {
+			return fmt.Errorf("error unmarshaling %s from json: %s", prop, err.Error())
 		}
 		sch.keywords[prop] = keyword
+		if dk, ok := keyword.(derivingKeyword); ok {
+			if derived := dk.derive(rawmsg); derived != nil {
+				if sch.derived == nil {
+					sch.derived = map[string]interface{}{}
+				}
+				sch.derived[prop] = derived
+			}
+		}
 	}
 
 	// ensures proper and stable keyword validation order
@@ -245,10 +688,69 @@ func (s *Schema) UnmarshalJSON(data []byte) error {
 	}
 	sch.orderedkeywords = orderedKeys
 
+	if sch.extraDefinitions != nil {
+		for _, key := range objectKeys(data) {
+			if _, ok := sch.extraDefinitions[key]; ok {
+				sch.extraOrder = append(sch.extraOrder, key)
+			}
+		}
+	}
+
 	*s = Schema(*sch)
 	return nil
 }
 
+// derivingKeyword is implemented by keywords that derive data from the JSON
+// they are parsed from, such as the exact value of a numeric limit, which
+// their schema keeps for them. A keyword changed after parsing no longer
+// matches the data derived from it, which it must then ignore
+type derivingKeyword interface {
+	derive(data []byte) interface{}
+}
+
+// derivedScalarKeyword is a scalarKeyword checking instances
+// with the data derived from it when its schema was parsed
+type derivedScalarKeyword interface {
+	validDerived(derived, data interface{}) bool
+}
+
+// keywordMarshaler is implemented by derived data that encodes the keyword
+// it was derived from as written in its schema, while it still matches it
+type keywordMarshaler interface {
+	marshalKeyword(kw Keyword) ([]byte, bool)
+}
+
+// subschemas returns the schemas directly nested in the keywords of the schema
+func (s *Schema) subschemas() []*Schema {
+	subs := []*Schema{}
+	for _, keyword := range s.keywords {
+		subs = collectSubschemas(keyword, subs)
+	}
+	return subs
+}
+
+// collectSubschemas appends the schemas directly nested in elem to subs
+func collectSubschemas(elem interface{}, subs []*Schema) []*Schema {
+	if sk, ok := elem.(SchemaKeyword); ok {
+		return append(subs, sk.GetSchema())
+	}
+	if con, ok := elem.(JSONContainer); ok {
+		for _, ch := range con.JSONChildren() {
+			subs = collectSubschemas(ch, subs)
+		}
+	}
+	return subs
+}
+
+// Draft returns the JSON Schema draft the schema was parsed with. Schemas
+// without a $schema use the draft of the enclosing schema, or DefaultDraft
+func (s *Schema) Draft() Draft {
+	if s.draft == 0 {
+		return DefaultDraft
+	}
+	return s.draft
+}
+
 // _keyOrder is an internal struct assigning evaluation order of keywords
 type _keyOrder struct {
 	Key   string
@@ -257,6 +759,7 @@ type _keyOrder struct {
 
 // Validate initiates a fresh validation state and triggers the evaluation
 func (s *Schema) Validate(ctx context.Context, data interface{}) *ValidationState {
+	ctx = backgroundIfNil(ctx)
 	currentState := NewValidationState(s)
 	s.ValidateKeyword(ctx, currentState, data)
 	return currentState
@@ -278,6 +781,57 @@ func (s *Schema) ValidateKeyword(ctx context.Context, currentState *ValidationSt
 		return
 	}
 
+	if max := currentState.Options.maxDepth(); currentState.depth >= max {
+		currentState.AddError(data, fmt.Sprintf("maximum validation depth of %d exceeded", max))
+		return
+	}
+	if currentState.depth == 0 {
+		// references resolve against the root of the state,
+		// which is prepared along with the schemas it reaches
+		root := currentState.Root
+		if root == nil {
+			root = s
+		}
+		root.prepare(ctx)
+	}
+	currentState.depth++
+	defer func() { currentState.depth-- }()
+
+	// a schema declaring an $id only rebases the keywords it contains, so the
+	// enclosing base URI is restored for schemas validated after it
+	baseURI, baseRelative := currentState.BaseURI, currentState.BaseRelativeLocation
+	defer func() {
+		currentState.BaseURI = baseURI
+		currentState.BaseRelativeLocation = baseRelative
+	}()
+	s.enterState(currentState)
+	data = currentState.coerce(s, data)
+
+	resource := currentState.Root
+	if s.isResource() {
+		resource = s
+	}
+	if resource != nil && currentState.pushDynamicScope(resource) {
+		defer currentState.popDynamicScope()
+	}
+
+	if ref, ok := s.keywords["$ref"].(*Ref); ok && ref.ignoreSiblings {
+		// before draft 2019-09 a $ref replaces the keywords next to it
+		currentState.setKeyword("$ref")
+		if trace := currentState.Options.traceFunc(); trace != nil {
+			traceKeyword(currentState, trace, func() { ref.ValidateKeyword(ctx, currentState, data) })
+			return
+		}
+		ref.ValidateKeyword(ctx, currentState, data)
+		return
+	}
+
+	s.validateSchemakeywords(ctx, currentState, data)
+}
+
+// enterState registers the schema with the validation state and
+// updates the base URI and locations for evaluating its keywords
+func (s *Schema) enterState(currentState *ValidationState) {
 	s.Register("", currentState.LocalRegistry)
 	currentState.LocalRegistry.RegisterLocal(s)
 
@@ -297,39 +851,180 @@ func (s *Schema) ValidateKeyword(ctx context.Context, currentState *ValidationSt
 				}
 			}
 		}
+		if s.isResource() && s.docPath != "" {
+			// keyword locations are relative to the new schema resource
+			resourceRoot := jptr.NewPointer()
+			currentState.BaseRelativeLocation = &resourceRoot
+		}
 	}
 
 	if currentState.BaseURI != "" && strings.HasSuffix(currentState.BaseURI, "#") {
 		currentState.BaseURI = strings.TrimRight(currentState.BaseURI, "#")
 	}
-
-	// TODO(arqu): only on versions bellow draft2019_09
-	// if refKeyword != nil {
-	// 	refKeyword.ValidateKeyword(currentState, errs)
-	// 	return
-	// }
-
-	s.validateSchemakeywords(ctx, currentState, data)
 }
 
 // validateSchemakeywords triggers validation of sub schemas and keywords
 func (s *Schema) validateSchemakeywords(ctx context.Context, currentState *ValidationState, data interface{}) {
 	if s.keywords != nil {
 		for _, keyword := range s.orderedkeywords {
-			s.keywords[keyword].ValidateKeyword(ctx, currentState, data)
+			if ctx.Err() != nil || currentState.stopEarly() {
+				// validation was cancelled, timed out or
+				// already failed in fail-fast mode
+				return
+			}
+			currentState.setKeyword(keyword)
+			if trace := currentState.Options.traceFunc(); trace != nil {
+				kw := s.keywords[keyword]
+				traceKeyword(currentState, trace, func() { validateKeyword(ctx, currentState, kw, data) })
+				continue
+			}
+			validateKeyword(ctx, currentState, s.keywords[keyword], data)
 		}
 	}
 }
 
+// validateKeyword checks data against a keyword of the schema
+// being validated, collecting the errors of KeywordE keywords
+func validateKeyword(ctx context.Context, currentState *ValidationState, kw Keyword, data interface{}) {
+	if kwe, ok := kw.(KeywordE); ok {
+		currentState.addKeyErrors(data, kwe.Validate(ctx, currentState, data))
+		return
+	}
+	kw.ValidateKeyword(ctx, currentState, data)
+}
+
 // ValidateBytes performs schema validation against a slice of json
-// byte data
+// byte data. Validation stops early if the context is cancelled or its
+// deadline passes, returning the errors found so far alongside an error
+// wrapping the context error. A nil ctx is treated as context.Background
 func (s *Schema) ValidateBytes(ctx context.Context, data []byte) ([]KeyError, error) {
+	ctx = backgroundIfNil(ctx)
 	var doc interface{}
 	if err := json.Unmarshal(data, &doc); err != nil {
 		return nil, fmt.Errorf("error parsing JSON bytes: %w", err)
 	}
-	vs := s.Validate(ctx, doc)
-	return *vs.Errs, nil
+	errs := s.validateErrs(ctx, doc, nil)
+	if err := ctx.Err(); err != nil {
+		return errs, fmt.Errorf("validation aborted: %w", err)
+	}
+	return errs, nil
+}
+
+// ValidateDecoded performs schema validation against an already decoded
+// instance, skipping the JSON round trip of ValidateBytes. Objects and
+// arrays are expected as map[string]interface{} and []interface{}, as
+// decoded by encoding/json. Unlike Validate, it returns the errors and
+// reports a canceled context as an error. A nil ctx is treated as
+// context.Background
+func (s *Schema) ValidateDecoded(ctx context.Context, data interface{}) ([]KeyError, error) {
+	ctx = backgroundIfNil(ctx)
+	errs := s.validateErrs(ctx, data, nil)
+	if err := ctx.Err(); err != nil {
+		return errs, fmt.Errorf("validation aborted: %w", err)
+	}
+	return errs, nil
+}
+
+// backgroundIfNil returns ctx, or context.Background if ctx is nil,
+// so a nil context validates like one that is never cancelled
+func backgroundIfNil(ctx context.Context) context.Context {
+	if ctx == nil {
+		return context.Background()
+	}
+	return ctx
+}
+
+// validateErrs checks an instance like ValidateWithOptions using a root
+// state from statePool, returning a copy of the errors it collected
+func (s *Schema) validateErrs(ctx context.Context, data interface{}, opts *ValidationOptions) []KeyError {
+	if opts == nil && s.validScalar(ctx, data) {
+		return []KeyError{}
+	}
+	vs := getValidationState(s)
+	vs.Options = opts
+	vs.workers = newWorkerPool(opts)
+	s.ValidateKeyword(ctx, vs, data)
+	errs := append([]KeyError{}, *vs.Errs...)
+	putValidationState(vs)
+	return errs
+}
+
+// scalarKeyword is implemented by keywords that can check an instance on
+// their own under the default options, without a validation state
+type scalarKeyword interface {
+	validScalar(data interface{}) bool
+}
+
+// hasScalarKeywords reports whether every keyword of the schema is a
+// scalarKeyword or an annotation, as in { "type": "string", "maxLength": 10 }
+func (s *Schema) hasScalarKeywords() bool {
+	if s.schemaType != schemaTypeObject {
+		return s.schemaType == schemaTypeTrue
+	}
+	for _, keyword := range s.keywords {
+		switch keyword.(type) {
+		case scalarKeyword, derivedScalarKeyword, *SchemaURI, *Title, *Description, *Comment,
+			*Default, *Examples, *Deprecated, *ReadOnly, *WriteOnly:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// validScalar checks an instance against a schema of scalar keywords
+// without setting up a validation state. It reports false if the schema
+// has other keywords or the instance is invalid, leaving it to the
+// validation engine to collect the errors
+func (s *Schema) validScalar(ctx context.Context, data interface{}) bool {
+	s.prepare(ctx)
+	if atomic.LoadUint32(&s.prepared) == 0 || !s.scalar {
+		return false
+	}
+	for name, keyword := range s.keywords {
+		switch kw := keyword.(type) {
+		case derivedScalarKeyword:
+			if !kw.validDerived(s.derived[name], data) {
+				return false
+			}
+		case scalarKeyword:
+			if !kw.validScalar(data) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ValidateErr performs schema validation against an already decoded
+// instance like ValidateDecoded, returning a *ValidationError holding the
+// errors when the instance is invalid and nil when it's valid
+func (s *Schema) ValidateErr(ctx context.Context, data interface{}) error {
+	errs, err := s.ValidateDecoded(ctx, data)
+	if err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return &ValidationError{errs: errs}
+	}
+	return nil
+}
+
+// ValidateGoValue performs schema validation against a Go value, such as
+// a struct, converted to JSON with the semantics of encoding/json: field
+// tags, omitempty and MarshalJSON methods are honored, and error paths use
+// the JSON field names. Numbers are kept as json.Number, so integers
+// beyond the precision of float64 are compared exactly
+func (s *Schema) ValidateGoValue(ctx context.Context, v interface{}) ([]KeyError, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("error converting value to JSON: %w", err)
+	}
+	doc, err := decodeUseNumber(data)
+	if err != nil {
+		return nil, fmt.Errorf("error converting value to JSON: %w", err)
+	}
+	return s.ValidateDecoded(ctx, doc)
 }
 
 // TopLevelType returns a string representing the schema's top-level type.
@@ -348,14 +1043,140 @@ func (s Schema) MarshalJSON() ([]byte, error) {
 	case schemaTypeTrue:
 		return []byte("true"), nil
 	default:
-		obj := map[string]interface{}{}
+		buf := &bytes.Buffer{}
+		buf.WriteByte('{')
+		for i, key := range s.marshalOrder() {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			var value interface{} = s.keywords[key]
+			if extra, ok := s.extraDefinitions[key]; ok {
+				value = extra
+			}
+			keyData, err := json.Marshal(key)
+			if err != nil {
+				return nil, err
+			}
+			valueData, err := s.marshalKeyword(key, value)
+			if err != nil {
+				return nil, fmt.Errorf("error marshaling %s to json: %w", key, err)
+			}
+			buf.Write(keyData)
+			buf.WriteByte(':')
+			buf.Write(valueData)
+		}
+		buf.WriteByte('}')
+		return buf.Bytes(), nil
+	}
+}
+
+// marshalKeyword encodes the value of a key of the schema, writing
+// keywords as written in the schema when their derived data knows how
+func (s Schema) marshalKeyword(key string, value interface{}) ([]byte, error) {
+	if km, ok := s.derived[key].(keywordMarshaler); ok {
+		if kw, ok := value.(Keyword); ok {
+			if data, ok := km.marshalKeyword(kw); ok {
+				return data, nil
+			}
+		}
+	}
+	return json.Marshal(value)
+}
+
+// marshalOrder returns the keys of the schema in the order they are
+// encoded: keywords in validation order, followed by unknown keys in
+// the order they appeared in the source document
+func (s Schema) marshalOrder() []string {
+	keys := make([]string, 0, len(s.keywords)+len(s.extraDefinitions))
+	seen := map[string]bool{}
+	for _, key := range s.orderedkeywords {
+		if _, ok := s.keywords[key]; ok && !seen[key] {
+			keys = append(keys, key)
+			seen[key] = true
+		}
+	}
+	rest := []string{}
+	for key := range s.keywords {
+		if !seen[key] {
+			rest = append(rest, key)
+		}
+	}
+	sort.Strings(rest)
+	for _, key := range rest {
+		keys = append(keys, key)
+		seen[key] = true
+	}
+
+	for _, key := range s.extraOrder {
+		if _, ok := s.extraDefinitions[key]; ok && !seen[key] {
+			keys = append(keys, key)
+			seen[key] = true
+		}
+	}
+	rest = rest[:0]
+	for key := range s.extraDefinitions {
+		if !seen[key] {
+			rest = append(rest, key)
+		}
+	}
+	sort.Strings(rest)
+	return append(keys, rest...)
+}
 
-		for k, v := range s.keywords {
-			obj[k] = v
+// Equal reports whether two schemas are semantically equal, comparing their
+// keywords and unknown keys recursively regardless of the order or formatting
+// of the documents they were parsed from. Numbers are compared by value
+func (s *Schema) Equal(other *Schema) bool {
+	if s == nil || other == nil {
+		return s == other
+	}
+	if s == other {
+		return true
+	}
+	if s.schemaType != other.schemaType {
+		return false
+	}
+	a, err := s.normalized()
+	if err != nil {
+		return false
+	}
+	b, err := other.normalized()
+	if err != nil {
+		return false
+	}
+	return jsonEqual(a, b)
+}
+
+// normalized returns the schema decoded as generic JSON
+func (s *Schema) normalized() (interface{}, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	return decodeUseNumber(data)
+}
+
+// objectKeys returns the keys of a JSON object in the order they appear
+func objectKeys(data []byte) []string {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil
+	}
+	keys := []string{}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return keys
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return keys
 		}
-		for k, v := range s.extraDefinitions {
-			obj[k] = v
+		keys = append(keys, key)
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return keys
 		}
-		return json.Marshal(obj)
 	}
+	return keys
 }
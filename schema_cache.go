@@ -0,0 +1,123 @@
+package jsonschema
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sync"
+)
+
+var sc *SchemaCache
+var scLock sync.Mutex
+
+// SchemaCache maintains a lookup table between the SHA-256 hash of
+// schema documents and their parsed schemas, so identical documents are
+// only parsed once. Cached schemas are shared between callers and must
+// be treated as read-only
+type SchemaCache struct {
+	lock       sync.Mutex
+	maxEntries int
+	entries    map[[sha256.Size]byte]*list.Element
+	lru        *list.List
+}
+
+// schemaCacheEntry is an element of the SchemaCache eviction list
+type schemaCacheEntry struct {
+	key    [sha256.Size]byte
+	schema *Schema
+}
+
+// NewSchemaCache allocates a new SchemaCache holding at most maxEntries
+// schemas, evicting the least recently used schema when full.
+// A maxEntries of 0 or less never evicts
+func NewSchemaCache(maxEntries int) *SchemaCache {
+	return &SchemaCache{
+		maxEntries: maxEntries,
+		entries:    map[[sha256.Size]byte]*list.Element{},
+		lru:        list.New(),
+	}
+}
+
+// GetSchemaCache provides an accessor to the globally available schema
+// cache used by ParseCached, which never evicts by default
+func GetSchemaCache() *SchemaCache {
+	scLock.Lock()
+	defer scLock.Unlock()
+	if sc == nil {
+		sc = NewSchemaCache(0)
+	}
+	return sc
+}
+
+// ParseCached parses a schema document using the global schema cache
+func ParseCached(data []byte) (*Schema, error) {
+	return GetSchemaCache().Parse(data)
+}
+
+// Parse returns the schema parsed from data, reusing the schema of a
+// previously parsed identical document when there is one
+func (c *SchemaCache) Parse(data []byte) (*Schema, error) {
+	key := sha256.Sum256(data)
+	c.lock.Lock()
+	if elem, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(elem)
+		c.lock.Unlock()
+		return elem.Value.(*schemaCacheEntry).schema, nil
+	}
+	c.lock.Unlock()
+
+	s := &Schema{}
+	if err := s.UnmarshalJSON(data); err != nil {
+		return nil, err
+	}
+	if err := s.checkStrictKeywords(); err != nil {
+		return nil, err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	// another caller may have parsed the same document meanwhile
+	if elem, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(elem)
+		return elem.Value.(*schemaCacheEntry).schema, nil
+	}
+	c.entries[key] = c.lru.PushFront(&schemaCacheEntry{key: key, schema: s})
+	c.evict()
+	return s, nil
+}
+
+// SetMaxEntries changes the number of schemas the cache holds,
+// evicting the least recently used schemas above it
+func (c *SchemaCache) SetMaxEntries(maxEntries int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.maxEntries = maxEntries
+	c.evict()
+}
+
+// Len returns the number of schemas in the cache
+func (c *SchemaCache) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.lru.Len()
+}
+
+// Purge removes all schemas from the cache
+func (c *SchemaCache) Purge() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.entries = map[[sha256.Size]byte]*list.Element{}
+	c.lru.Init()
+}
+
+// evict drops the least recently used schemas above the maximum
+// number of entries. Callers must hold the cache lock
+func (c *SchemaCache) evict() {
+	if c.maxEntries <= 0 {
+		return
+	}
+	for c.lru.Len() > c.maxEntries {
+		elem := c.lru.Back()
+		c.lru.Remove(elem)
+		delete(c.entries, elem.Value.(*schemaCacheEntry).key)
+	}
+}
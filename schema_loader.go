@@ -7,6 +7,8 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"path/filepath"
+	"strings"
 )
 
 var lr *LoaderRegistry
@@ -70,20 +72,46 @@ func FetchSchema(ctx context.Context, uri string, schema *Schema) error {
 	return loader(ctx, u, schema)
 }
 
-// HTTPSchemaLoader loads a schema from a http or https URI
-func HTTPSchemaLoader(ctx context.Context, uri *url.URL, schema *Schema) error {
-	var req *http.Request
-	if ctx != nil {
-		req, _ = http.NewRequestWithContext(ctx, "GET", uri.String(), nil)
-	} else {
-		req, _ = http.NewRequest("GET", uri.String(), nil)
+// RemoteSchemaLoader fetches the raw json of the schema document
+// identified by a uri. Loaders must respect context cancellation
+type RemoteSchemaLoader interface {
+	Load(ctx context.Context, uri string) ([]byte, error)
+}
+
+// HTTPLoader is a RemoteSchemaLoader that fetches schemas over http or https
+type HTTPLoader struct {
+	// Client is the http client used for requests, defaults to http.DefaultClient
+	Client *http.Client
+}
+
+// Load implements the RemoteSchemaLoader interface for HTTPLoader,
+// responses with a non-2xx status are returned as errors
+func (l *HTTPLoader) Load(ctx context.Context, uri string) ([]byte, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := l.Client
+	if client == nil {
+		client = http.DefaultClient
 	}
-	client := &http.Client{}
 	res, err := client.Do(req)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, fmt.Errorf("fetching %s: unexpected status %s", uri, res.Status)
 	}
-	body, err := ioutil.ReadAll(res.Body)
+	return ioutil.ReadAll(res.Body)
+}
+
+// HTTPSchemaLoader loads a schema from a http or https URI
+func HTTPSchemaLoader(ctx context.Context, uri *url.URL, schema *Schema) error {
+	body, err := (&HTTPLoader{}).Load(ctx, uri.String())
 	if err != nil {
 		return err
 	}
@@ -93,6 +121,68 @@ func HTTPSchemaLoader(ctx context.Context, uri *url.URL, schema *Schema) error {
 	return json.Unmarshal(body, schema)
 }
 
+// FileLoader is a RemoteSchemaLoader that reads schemas from a local
+// directory. URIs starting with BaseURI map to files relative to Root,
+// requests for files outside of Root are rejected
+type FileLoader struct {
+	BaseURI string
+	Root    string
+}
+
+// NewFileLoader creates a FileLoader serving uris starting with baseURI
+// from the root directory
+func NewFileLoader(baseURI, root string) *FileLoader {
+	return &FileLoader{
+		BaseURI: baseURI,
+		Root:    root,
+	}
+}
+
+// Load implements the RemoteSchemaLoader interface for FileLoader
+func (l *FileLoader) Load(ctx context.Context, uri string) ([]byte, error) {
+	if ctx != nil {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+	path, err := l.path(uri)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(path)
+}
+
+// path maps a uri to a file path within the root directory
+func (l *FileLoader) path(uri string) (string, error) {
+	base := l.BaseURI
+	if !strings.HasSuffix(base, "/") {
+		base += "/"
+	}
+	uri = strings.Split(uri, "#")[0]
+	if !strings.HasPrefix(uri, base) {
+		return "", fmt.Errorf("uri %s is outside of base uri %s", uri, l.BaseURI)
+	}
+	rel, err := url.PathUnescape(strings.TrimPrefix(uri, base))
+	if err != nil {
+		return "", err
+	}
+
+	root, err := filepath.Abs(l.Root)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(root, filepath.FromSlash(rel))
+	// compare relative to root so roots like "/" or "dir/" still contain
+	// their files, the root itself isn't a schema file either
+	if rel, err = filepath.Rel(root, path); err != nil {
+		return "", err
+	}
+	if rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("uri %s resolves outside of root directory %s", uri, l.Root)
+	}
+	return path, nil
+}
+
 // FileSchemaLoader loads a schema from a file URI
 func FileSchemaLoader(ctx context.Context, uri *url.URL, schema *Schema) error {
 	body, err := ioutil.ReadFile(uri.Path)
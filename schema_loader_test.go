@@ -3,13 +3,16 @@ package jsonschema_test
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/qri-io/jsonschema"
 )
@@ -114,3 +117,258 @@ func TestCustomSchemaLoader(t *testing.T) {
 	}
 
 }
+
+type countingLoader struct {
+	calls int
+}
+
+func (l *countingLoader) Load(ctx context.Context, uri string) ([]byte, error) {
+	l.calls++
+	if uri != "https://example.com/schemas/address.json" {
+		return nil, fmt.Errorf("unknown schema %s", uri)
+	}
+	return []byte(`{ "type": "object", "required": ["street"] }`), nil
+}
+
+func TestRemoteSchemaLoader(t *testing.T) {
+	loader := &countingLoader{}
+	registry := jsonschema.GetSchemaRegistry()
+	registry.SetLoader(loader)
+	defer registry.SetLoader(nil)
+
+	rs := &jsonschema.Schema{}
+	if err := json.Unmarshal([]byte(`{ "$ref": "https://example.com/schemas/address.json" }`), rs); err != nil {
+		t.Fatalf("unexpected error parsing schema: %s", err)
+	}
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		errs, err := rs.ValidateBytes(ctx, []byte(`{}`))
+		if err != nil {
+			t.Fatalf("unexpected error validating: %s", err)
+		}
+		if len(errs) != 1 {
+			t.Errorf("expected one error, got: %v", errs)
+		}
+	}
+	if loader.calls != 1 {
+		t.Errorf("expected remote schema to be loaded once, got %d loads", loader.calls)
+	}
+}
+
+func TestAddSchema(t *testing.T) {
+	loader := &countingLoader{}
+	registry := jsonschema.NewSchemaRegistry()
+	defer jsonschema.SetSchemaRegistry(jsonschema.SetSchemaRegistry(registry))
+	registry.SetLoader(loader)
+	defer registry.SetLoader(nil)
+
+	address := jsonschema.Must(`{
+		"$id": "https://example.com/docs/address.json",
+		"type": "object",
+		"properties": {
+			"country": { "$ref": "countries/country.json" }
+		},
+		"$defs": {
+			"country": {
+				"$id": "countries/country.json",
+				"$ref": "code.json"
+			},
+			"code": { "$id": "countries/code.json", "type": "string", "maxLength": 2 }
+		}
+	}`)
+	if err := registry.AddSchema(address); err != nil {
+		t.Fatalf("unexpected error adding schema: %s", err)
+	}
+	if err := registry.AddSchema(address); err != nil {
+		t.Errorf("expected adding a schema again to be a no-op, got: %s", err)
+	}
+
+	person := jsonschema.Must(`{
+		"$id": "https://example.com/docs/person.json",
+		"properties": {
+			"home": { "$ref": "address.json" },
+			"citizenship": { "$ref": "https://example.com/docs/countries/country.json" }
+		}
+	}`)
+	if err := registry.AddSchema(person); err != nil {
+		t.Fatalf("unexpected error adding schema: %s", err)
+	}
+
+	ctx := context.Background()
+	errs, err := person.ValidateBytes(ctx, []byte(`{ "home": { "country": "NL" }, "citizenship": "DE" }`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 0 {
+		t.Errorf("expected a valid instance, got: %v", errs)
+	}
+	errs, err = person.ValidateBytes(ctx, []byte(`{ "home": { "country": "NLD" }, "citizenship": 1 }`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 2 {
+		t.Errorf("expected 2 errors, got: %v", errs)
+	}
+	if loader.calls != 0 {
+		t.Errorf("expected added schemas to resolve without loading, got %d loads", loader.calls)
+	}
+
+	invalid := []struct {
+		schema string
+		err    string
+	}{
+		{`{ "type": "string" }`, "schema has no $id"},
+		{`{ "$id": "relative.json" }`, `$id "relative.json" is not an absolute URI`},
+		{`true`, "schema must be an object with an $id"},
+		{`{ "$id": "https://example.com/docs/person.json" }`, "a schema is already registered for https://example.com/docs/person.json"},
+	}
+	for i, c := range invalid {
+		err := registry.AddSchema(jsonschema.Must(c.schema))
+		if err == nil || err.Error() != c.err {
+			t.Errorf("case %d: expected error %q, got: %v", i, c.err, err)
+		}
+	}
+}
+
+func TestSchemaRegistryIsolation(t *testing.T) {
+	fresh := jsonschema.NewSchemaRegistry()
+	defer jsonschema.SetSchemaRegistry(jsonschema.SetSchemaRegistry(fresh))
+	if jsonschema.GetSchemaRegistry() != fresh {
+		t.Fatalf("expected the global registry to be replaced")
+	}
+
+	first := jsonschema.Must(`{ "$id": "https://example.com/isolation/first.json" }`)
+	if err := fresh.AddSchema(first); err != nil {
+		t.Fatal(err)
+	}
+	snapshot := fresh.Snapshot()
+
+	second := jsonschema.Must(`{ "$id": "https://example.com/isolation/second.json" }`)
+	if err := fresh.AddSchema(second); err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.GetKnown("https://example.com/isolation/second.json") != nil {
+		t.Errorf("expected the snapshot not to see schemas added after it")
+	}
+
+	fresh.Clear()
+	if fresh.GetKnown("https://example.com/isolation/first.json") != nil {
+		t.Errorf("expected clearing to drop added schemas")
+	}
+
+	fresh.Restore(snapshot)
+	if fresh.GetKnown("https://example.com/isolation/first.json") != first {
+		t.Errorf("expected restoring to bring back the schemas of the snapshot")
+	}
+	if fresh.GetKnown("https://example.com/isolation/second.json") != nil {
+		t.Errorf("expected restoring to drop schemas added after the snapshot")
+	}
+
+	// a restored registry doesn't share its lookups with the snapshot
+	if err := fresh.AddSchema(second); err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.GetKnown("https://example.com/isolation/second.json") != nil {
+		t.Errorf("expected the snapshot to stay unchanged after being restored")
+	}
+}
+
+func TestHTTPLoader(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/schema.json":
+			fmt.Fprintln(w, `{ "type": "string" }`)
+		case "/slow.json":
+			<-r.Context().Done()
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	loader := &jsonschema.HTTPLoader{Client: ts.Client()}
+	body, err := loader.Load(context.Background(), ts.URL+"/schema.json")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.Contains(string(body), `"string"`) {
+		t.Errorf("unexpected body: %s", body)
+	}
+
+	if _, err := loader.Load(context.Background(), ts.URL+"/missing.json"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("expected not found error, got: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := loader.Load(ctx, ts.URL+"/slow.json"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded error, got: %v", err)
+	}
+}
+
+func TestFileLoader(t *testing.T) {
+	loader := jsonschema.NewFileLoader("http://localhost:1234", "testdata/remotes")
+	ctx := context.Background()
+
+	cases := []struct {
+		uri string
+		err string
+	}{
+		{"http://localhost:1234/integer.json", ""},
+		{"http://localhost:1234/folder/folderInteger.json#/type", ""},
+		{"http://localhost:1234/missing.json", "no such file or directory"},
+		{"http://example.com/integer.json", "outside of base uri"},
+		{"http://localhost:1234/../schema_loader.go", "outside of root directory"},
+		{"http://localhost:1234/%2e%2e/%2e%2e/go.mod", "outside of root directory"},
+		{"http://localhost:1234/", "outside of root directory"},
+	}
+
+	for i, c := range cases {
+		_, err := loader.Load(ctx, c.uri)
+		if c.err == "" && err != nil {
+			t.Errorf("case %d unexpected error: %s", i, err)
+		} else if c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)) {
+			t.Errorf("case %d expected error containing %q, got: %v", i, c.err, err)
+		}
+	}
+
+	abs, err := filepath.Abs("testdata/remotes/integer.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := []struct {
+		root, uri string
+	}{
+		{"/", "file://" + filepath.ToSlash(abs)},
+		{"testdata/remotes/", "file:///integer.json"},
+	}
+	for _, c := range roots {
+		if _, err := jsonschema.NewFileLoader("file:///", c.root).Load(ctx, c.uri); err != nil {
+			t.Errorf("root %q unexpected error loading %s: %s", c.root, c.uri, err)
+		}
+	}
+
+	registry := jsonschema.GetSchemaRegistry()
+	registry.SetLoader(loader)
+	defer registry.SetLoader(nil)
+
+	rs := &jsonschema.Schema{}
+	if err := json.Unmarshal([]byte(`{
+		"$id": "http://localhost:1234/file-loader/root.json",
+		"properties": {
+			"a": { "$ref": "../integer.json" },
+			"b": { "$id": "../folder/", "$ref": "folderInteger.json" }
+		}
+	}`), rs); err != nil {
+		t.Fatalf("unexpected error parsing schema: %s", err)
+	}
+
+	errs, err := rs.ValidateBytes(ctx, []byte(`{ "a": "one", "b": "two" }`))
+	if err != nil {
+		t.Fatalf("unexpected error validating: %s", err)
+	}
+	if len(errs) != 2 {
+		t.Errorf("expected 2 errors, got: %v", errs)
+	}
+}
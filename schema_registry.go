@@ -2,42 +2,123 @@ package jsonschema
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/url"
 	"strings"
+	"sync"
 )
 
-var sr *SchemaRegistry
+var (
+	sr     *SchemaRegistry
+	srLock sync.Mutex
+)
 
 // SchemaRegistry maintains a lookup table between schema string references
-// and actual schemas
+// and actual schemas. It is safe for concurrent use
 type SchemaRegistry struct {
+	lock          sync.RWMutex
 	schemaLookup  map[string]*Schema
 	contextLookup map[string]*Schema
+	loader        RemoteSchemaLoader
+}
+
+// NewSchemaRegistry allocates a new, empty SchemaRegistry
+func NewSchemaRegistry() *SchemaRegistry {
+	return &SchemaRegistry{
+		schemaLookup:  map[string]*Schema{},
+		contextLookup: map[string]*Schema{},
+	}
 }
 
 // GetSchemaRegistry provides an accessor to a globally available schema registry
 func GetSchemaRegistry() *SchemaRegistry {
+	srLock.Lock()
+	defer srLock.Unlock()
 	if sr == nil {
-		sr = &SchemaRegistry{
-			schemaLookup:  map[string]*Schema{},
-			contextLookup: map[string]*Schema{},
-		}
+		sr = NewSchemaRegistry()
 	}
 	return sr
 }
 
 // ResetSchemaRegistry resets the main SchemaRegistry
 func ResetSchemaRegistry() {
+	srLock.Lock()
+	defer srLock.Unlock()
 	sr = nil
 }
 
+// SetSchemaRegistry replaces the globally available schema registry,
+// returning the previous one, so a test can use a fresh registry with
+//
+//	defer jsonschema.SetSchemaRegistry(jsonschema.SetSchemaRegistry(jsonschema.NewSchemaRegistry()))
+//
+// Schemas keep the references they resolved before the registry was replaced
+func SetSchemaRegistry(r *SchemaRegistry) *SchemaRegistry {
+	srLock.Lock()
+	defer srLock.Unlock()
+	prev := sr
+	sr = r
+	return prev
+}
+
+// Clear drops every schema of the registry, including fetched remote
+// schemas and those added with AddSchema, keeping its loader. Schemas keep
+// the references they resolved before the registry was cleared
+func (sr *SchemaRegistry) Clear() {
+	sr.lock.Lock()
+	defer sr.lock.Unlock()
+	sr.schemaLookup = map[string]*Schema{}
+	sr.contextLookup = map[string]*Schema{}
+}
+
+// Snapshot returns a copy of the registry, holding the same schemas and
+// loader, that later changes to either registry don't affect. Restore
+// returns the registry to the state of the snapshot
+func (sr *SchemaRegistry) Snapshot() *SchemaRegistry {
+	sr.lock.RLock()
+	defer sr.lock.RUnlock()
+	cp := &SchemaRegistry{loader: sr.loader}
+	if sr.schemaLookup != nil {
+		cp.schemaLookup = make(map[string]*Schema, len(sr.schemaLookup))
+		for uri, sch := range sr.schemaLookup {
+			cp.schemaLookup[uri] = sch
+		}
+	}
+	if sr.contextLookup != nil {
+		cp.contextLookup = make(map[string]*Schema, len(sr.contextLookup))
+		for uri, sch := range sr.contextLookup {
+			cp.contextLookup[uri] = sch
+		}
+	}
+	return cp
+}
+
+// Restore replaces the schemas and loader of the registry with those
+// of a snapshot taken with Snapshot, which can be restored again
+func (sr *SchemaRegistry) Restore(snapshot *SchemaRegistry) {
+	cp := snapshot.Snapshot()
+	sr.lock.Lock()
+	defer sr.lock.Unlock()
+	sr.schemaLookup = cp.schemaLookup
+	sr.contextLookup = cp.contextLookup
+	sr.loader = cp.loader
+}
+
 // Get fetches a schema from the top level context registry or fetches it from a remote
 func (sr *SchemaRegistry) Get(ctx context.Context, uri string) *Schema {
 	uri = strings.TrimRight(uri, "#")
+	sr.lock.RLock()
 	schema := sr.schemaLookup[uri]
+	sr.lock.RUnlock()
 	if schema == nil {
+		if deferFetch(ctx, uri) {
+			return nil
+		}
+		// schemas are fetched without holding the lock, a schema
+		// registered for uri in the meantime takes precedence
 		fetchedSchema := &Schema{}
-		err := FetchSchema(ctx, uri, fetchedSchema)
+		err := sr.fetch(ctx, uri, fetchedSchema)
 		if err != nil {
 			schemaDebug(fmt.Sprintf("[SchemaRegistry] Fetch error: %s", err.Error()))
 			return nil
@@ -47,21 +128,61 @@ func (sr *SchemaRegistry) Get(ctx context.Context, uri string) *Schema {
 		}
 		fetchedSchema.docPath = uri
 		// TODO(arqu): meta validate schema
-		schema = fetchedSchema
-		sr.schemaLookup[uri] = schema
+		sr.lock.Lock()
+		defer sr.lock.Unlock()
+		if schema = sr.schemaLookup[uri]; schema == nil {
+			schema = fetchedSchema
+			if sr.schemaLookup == nil {
+				sr.schemaLookup = map[string]*Schema{}
+			}
+			sr.schemaLookup[uri] = schema
+		}
 	}
 	return schema
 }
 
+// SetLoader assigns the loader used to fetch schemas missing from the registry.
+// A nil loader falls back to the scheme based loaders of the LoaderRegistry
+func (sr *SchemaRegistry) SetLoader(loader RemoteSchemaLoader) {
+	sr.lock.Lock()
+	defer sr.lock.Unlock()
+	sr.loader = loader
+}
+
+// fetch loads a remote schema using the registry loader
+func (sr *SchemaRegistry) fetch(ctx context.Context, uri string, schema *Schema) error {
+	sr.lock.RLock()
+	loader := sr.loader
+	sr.lock.RUnlock()
+	if loader == nil {
+		return FetchSchema(ctx, uri, schema)
+	}
+	if ctx != nil {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+	schemaDebug(fmt.Sprintf("[SchemaRegistry] Loading: %s", uri))
+	body, err := loader.Load(ctx, uri)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, schema)
+}
+
 // GetKnown fetches a schema from the top level context registry
 func (sr *SchemaRegistry) GetKnown(uri string) *Schema {
 	uri = strings.TrimRight(uri, "#")
+	sr.lock.RLock()
+	defer sr.lock.RUnlock()
 	return sr.schemaLookup[uri]
 }
 
 // GetLocal fetches a schema from the local context registry
 func (sr *SchemaRegistry) GetLocal(uri string) *Schema {
 	uri = strings.TrimRight(uri, "#")
+	sr.lock.RLock()
+	defer sr.lock.RUnlock()
 	return sr.contextLookup[uri]
 }
 
@@ -70,12 +191,100 @@ func (sr *SchemaRegistry) Register(sch *Schema) {
 	if sch.docPath == "" {
 		return
 	}
+	sr.lock.Lock()
+	defer sr.lock.Unlock()
+	if sr.schemaLookup == nil {
+		sr.schemaLookup = map[string]*Schema{}
+	}
 	sr.schemaLookup[sch.docPath] = sch
 }
 
+// AddSchema registers a schema document by its absolute $id, along with the
+// schema resources it embeds, so references to them resolve across documents
+// without being fetched. References are resolved against the registry
+// returned by GetSchemaRegistry
+func (sr *SchemaRegistry) AddSchema(s *Schema) error {
+	if s == nil || s.schemaType != schemaTypeObject {
+		return fmt.Errorf("schema must be an object with an $id")
+	}
+	uri, err := absoluteSchemaID(s.id)
+	if err != nil {
+		return err
+	}
+	sr.lock.Lock()
+	defer sr.lock.Unlock()
+	if err := sr.addSchema(uri, s); err != nil {
+		return err
+	}
+	s.docPath = uri
+	return sr.addResources(uri, s)
+}
+
+// addResources registers the schema resources embedded in a schema,
+// resolving their $id against the base URI of the enclosing resource
+func (sr *SchemaRegistry) addResources(base string, s *Schema) error {
+	for _, sub := range s.subschemas() {
+		if sub.schemaType != schemaTypeObject {
+			continue
+		}
+		subBase := base
+		if sub.isResource() {
+			uri, err := SafeResolveURL(base, sub.id)
+			if err != nil {
+				return fmt.Errorf("invalid $id %q: %s", sub.id, err.Error())
+			}
+			subBase = strings.TrimRight(uri, "#")
+			if err := sr.addSchema(subBase, sub); err != nil {
+				return err
+			}
+			// refs can reach the resource before its enclosing document
+			sub.docPath = subBase
+		}
+		if err := sr.addResources(subBase, sub); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addSchema registers a schema by uri, refusing to replace
+// a different schema already registered for it
+func (sr *SchemaRegistry) addSchema(uri string, s *Schema) error {
+	if sr.schemaLookup == nil {
+		sr.schemaLookup = map[string]*Schema{}
+	}
+	if prev, ok := sr.schemaLookup[uri]; ok && prev != s {
+		return fmt.Errorf("a schema is already registered for %s", uri)
+	}
+	sr.schemaLookup[uri] = s
+	return nil
+}
+
+// absoluteSchemaID returns the URI identifying a schema document,
+// erroring when the $id is missing or not absolute
+func absoluteSchemaID(id string) (string, error) {
+	if id == "" {
+		return "", fmt.Errorf("schema has no $id")
+	}
+	u, err := url.Parse(id)
+	if err != nil {
+		return "", fmt.Errorf("invalid $id %q: %s", id, err.Error())
+	}
+	if !u.IsAbs() {
+		return "", fmt.Errorf("$id %q is not an absolute URI", id)
+	}
+	u.Fragment = ""
+	return strings.TrimRight(u.String(), "#"), nil
+}
+
 // RegisterLocal registers a schema to a local context
 func (sr *SchemaRegistry) RegisterLocal(sch *Schema) {
+	sr.lock.Lock()
+	defer sr.lock.Unlock()
 	if sch.id != "" && IsLocalSchemaID(sch.id) {
+		if sr.contextLookup == nil {
+			sr.contextLookup = map[string]*Schema{}
+		}
 		sr.contextLookup[sch.id] = sch
 	}
 
@@ -87,4 +296,16 @@ func (sr *SchemaRegistry) RegisterLocal(sch *Schema) {
 		}
 		sr.contextLookup[anchorURI] = sch
 	}
+
+	// dynamic anchors are also addressable as plain anchors
+	if sch.HasKeyword("$dynamicAnchor") {
+		anchorKeyword := sch.keywords["$dynamicAnchor"].(*DynamicAnchor)
+		anchorURI := sch.docPath + "#" + string(*anchorKeyword)
+		if sr.contextLookup == nil {
+			sr.contextLookup = map[string]*Schema{}
+		}
+		if _, ok := sr.contextLookup[anchorURI]; !ok {
+			sr.contextLookup[anchorURI] = sch
+		}
+	}
 }
@@ -4,17 +4,27 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"math"
+	"math/big"
 	"path/filepath"
+	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/fxamacker/cbor/v2"
+	jptr "github.com/qri-io/jsonpointer"
 	"github.com/sergi/go-diff/diffmatchpatch"
 )
 
-func ExampleBasic() {
+func Example_basic() {
 	ctx := context.Background()
 	var schemaData = []byte(`{
 	"title": "Person",
@@ -135,6 +145,285 @@ func TestTopLevelType(t *testing.T) {
 	}
 }
 
+func TestBooleanSchemas(t *testing.T) {
+	cases := []struct {
+		schema, data string
+		errs         int
+	}{
+		{`true`, `{"a":1}`, 0},
+		{`false`, `{"a":1}`, 1},
+		{`{"allOf":[true,false]}`, `1`, 1},
+		{`{"allOf":[{"allOf":[false]}]}`, `1`, 1},
+		{`{"allOf":[true,{"allOf":[true]}]}`, `1`, 0},
+		{`{"items":true}`, `[1,2]`, 0},
+		{`{"items":false}`, `[]`, 0},
+		{`{"items":[true,false]}`, `[1,2]`, 1},
+		{`{"items":[true],"additionalItems":false}`, `[1,2]`, 1},
+		{`{"not":true}`, `1`, 1},
+		{`{"not":false}`, `1`, 0},
+		{`{"properties":{"a":false}}`, `{"a":1}`, 1},
+		{`{"additionalProperties":false}`, `{"a":1}`, 1},
+		{`{"propertyNames":false}`, `{"a":1}`, 1},
+		{`{"contains":false}`, `[1]`, 1},
+		{`{"if":true,"then":false}`, `1`, 1},
+		{`{"$defs":{"f":false},"$ref":"#/$defs/f"}`, `1`, 1},
+	}
+
+	for i, c := range cases {
+		rs := &Schema{}
+		if err := json.Unmarshal([]byte(c.schema), rs); err != nil {
+			t.Errorf("case %d: unmarshal schema: %s", i, err)
+			continue
+		}
+		errs, err := rs.ValidateBytes(context.Background(), []byte(c.data))
+		if err != nil {
+			t.Errorf("case %d: %s", i, err)
+			continue
+		}
+		if len(errs) != c.errs {
+			t.Errorf("case %d: %s expected %d errors, got: %v", i, c.schema, c.errs, errs)
+		}
+
+		data, err := json.Marshal(rs)
+		if err != nil {
+			t.Errorf("case %d: marshal schema: %s", i, err)
+			continue
+		}
+		if !jsonEqualBytes(t, data, []byte(c.schema)) {
+			t.Errorf("case %d: expected schema to round-trip. expected: %s, got: %s", i, c.schema, data)
+		}
+	}
+
+	errs, err := Must(`{"contains":false}`).ValidateBytes(context.Background(), []byte(`[1]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 1 || errs[0].Message != "must contain at least one of: false" {
+		t.Errorf("expected contains error to describe the false schema, got: %v", errs)
+	}
+}
+
+// jsonEqualBytes reports whether two JSON documents decode to equal values
+func jsonEqualBytes(t *testing.T, a, b []byte) bool {
+	var av, bv interface{}
+	if err := json.Unmarshal(a, &av); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &bv); err != nil {
+		t.Fatal(err)
+	}
+	return reflect.DeepEqual(av, bv)
+}
+
+func TestKeywordAccessors(t *testing.T) {
+	rs := Must(`{
+		"type": "object",
+		"properties": { "name": { "type": "string" } },
+		"required": ["name"]
+	}`)
+
+	props, ok := rs.Keyword("properties").(*Properties)
+	if !ok {
+		t.Fatalf("expected properties keyword, got: %#v", rs.Keyword("properties"))
+	}
+	if typ, ok := (*props)["name"].Keyword("type").(*Type); !ok || typ.String() != "string" {
+		t.Errorf("expected nested type keyword to be string, got: %#v", (*props)["name"].Keyword("type"))
+	}
+	if rs.Keyword("items") != nil {
+		t.Errorf("expected missing keyword to be nil")
+	}
+
+	keywords := rs.Keywords()
+	names := []string{}
+	for name := range keywords {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if strings.Join(names, ",") != "properties,required,type" {
+		t.Errorf("unexpected keywords: %v", names)
+	}
+	delete(keywords, "type")
+	if !rs.HasKeyword("type") {
+		t.Errorf("expected keywords map to be a copy")
+	}
+
+	var nilSchema *Schema
+	if nilSchema.Keyword("type") != nil || len(nilSchema.Keywords()) != 0 {
+		t.Errorf("expected nil schema to have no keywords")
+	}
+}
+
+func TestSubschemaAt(t *testing.T) {
+	rs := Must(`{
+		"title": "root",
+		"properties": {
+			"address": {
+				"title": "address",
+				"properties": { "zip": { "title": "zip" } }
+			},
+			"a/b": { "title": "escaped" }
+		},
+		"items": [ { "title": "first" }, true ],
+		"allOf": [ { "title": "allOf" } ],
+		"$defs": { "def": { "title": "def" } },
+		"minimum": 1
+	}`)
+
+	cases := []struct {
+		pointer, title string
+	}{
+		{"", "root"},
+		{"/properties/address", "address"},
+		{"/properties/address/properties/zip", "zip"},
+		{"/properties/a~1b", "escaped"},
+		{"/items/0", "first"},
+		{"/allOf/0", "allOf"},
+		{"/$defs/def", "def"},
+	}
+	for _, c := range cases {
+		ptr, err := jptr.Parse(c.pointer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sch, err := rs.SubschemaAt(ptr)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", c.pointer, err)
+			continue
+		}
+		if title, ok := sch.JSONProp("title").(*Title); !ok || string(*title) != c.title {
+			t.Errorf("%q: expected the schema titled %q, got: %v", c.pointer, c.title, sch.JSONProp("title"))
+		}
+	}
+
+	ptr, _ := jptr.Parse("/items/1")
+	if sch, err := rs.SubschemaAt(ptr); err != nil || sch.schemaType != schemaTypeTrue {
+		t.Errorf("expected the boolean schema at /items/1, got: %v %v", sch, err)
+	}
+
+	for _, pointer := range []string{"/properties", "/properties/missing", "/items/2", "/minimum", "/unknown/x"} {
+		ptr, err := jptr.Parse(pointer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = rs.SubschemaAt(ptr)
+		if expect := "no subschema at " + pointer; err == nil || err.Error() != expect {
+			t.Errorf("%q: expected error %q, got: %v", pointer, expect, err)
+		}
+	}
+}
+
+func TestResolveRef(t *testing.T) {
+	rs := Must(`{
+		"$id": "https://example.com/root.json",
+		"$defs": {
+			"address": { "$anchor": "addr", "type": "object", "properties": { "zip": { "type": "string" } } },
+			"a~b": { "type": "integer" },
+			"percent%": { "type": "null" },
+			"item": { "$id": "item.json", "$anchor": "self", "$defs": { "name": { "type": "string" } } }
+		}
+	}`)
+	at := func(ptr string) *Schema {
+		sch, err := rs.SubschemaAt(jptr.Pointer(strings.Split(ptr, "/")[1:]))
+		if err != nil {
+			t.Fatalf("unexpected error looking up %s: %s", ptr, err)
+		}
+		return sch
+	}
+
+	cases := []struct {
+		ref    string
+		expect *Schema
+	}{
+		{"", rs},
+		{"#", rs},
+		{"#/$defs/address", at("/$defs/address")},
+		{"#/$defs/address/properties/zip", at("/$defs/address/properties/zip")},
+		{"#addr", at("/$defs/address")},
+		{"#/$defs/a~0b", at("/$defs/a~b")},
+		{"#/$defs/percent%25", at("/$defs/percent%")},
+		{"root.json#/$defs/address", at("/$defs/address")},
+		{"item.json", at("/$defs/item")},
+		{"item.json#self", at("/$defs/item")},
+		{"https://example.com/item.json#/$defs/name", at("/$defs/item/$defs/name")},
+	}
+	for i, c := range cases {
+		got, err := rs.ResolveRef(c.ref)
+		if err != nil {
+			t.Errorf("case %d: unexpected error resolving %q: %s", i, c.ref, err)
+			continue
+		}
+		if got != c.expect {
+			t.Errorf("case %d: %q resolved to the wrong schema: %v", i, c.ref, got)
+		}
+	}
+
+	errCases := map[string]string{
+		"#/$defs/missing": "no subschema at /$defs/missing",
+		"#nope":           `no anchor "nope" in schema resource`,
+		// anchors are scoped to their schema resource
+		"#self":      `no anchor "self" in schema resource`,
+		"other.json": "no schema resource https://example.com/other.json in schema",
+	}
+	for ref, expect := range errCases {
+		if _, err := rs.ResolveRef(ref); err == nil || err.Error() != expect {
+			t.Errorf("%q: expected error %q, got: %v", ref, expect, err)
+		}
+	}
+
+	var nilSchema *Schema
+	if _, err := nilSchema.ResolveRef("#"); err == nil {
+		t.Errorf("expected an error resolving against a nil schema")
+	}
+}
+
+func TestSchemaEqual(t *testing.T) {
+	cases := []struct {
+		a, b  string
+		equal bool
+	}{
+		{`true`, `true`, true},
+		{`true`, `false`, false},
+		{`true`, `{}`, false},
+		{`{}`, `{ }`, true},
+		{`{"type": "string", "minLength": 1}`, `{"minLength":1,"type":"string"}`, true},
+		{`{"type": "string", "minLength": 1}`, `{"type": "string", "minLength": 2}`, false},
+		{`{"type": "string"}`, `{"type": "string", "minLength": 1}`, false},
+		{`{"maximum": 1}`, `{"maximum": 1.0}`, true},
+		{`{"type": ["string", "null"]}`, `{"type": ["null", "string"]}`, false},
+		{
+			`{"properties": {"a": {"type": "string"}, "b": {"enum": [1, {"c": true, "d": null}]}}}`,
+			`{"properties": {"b": {"enum": [1, {"d": null, "c": true}]}, "a": {"type": "string"}}}`,
+			true,
+		},
+		{`{"properties": {"a": {"type": "string"}}}`, `{"properties": {"a": {"type": "number"}}}`, false},
+		{`{"x-meta": {"a": 1, "b": 2}}`, `{"x-meta": {"b": 2, "a": 1}}`, true},
+		{`{"x-meta": 1}`, `{"x-meta": 2}`, false},
+	}
+	for i, c := range cases {
+		a, b := Must(c.a), Must(c.b)
+		if got := a.Equal(b); got != c.equal {
+			t.Errorf("case %d: expected %s and %s equal to be %t", i, c.a, c.b, c.equal)
+		}
+		if got := b.Equal(a); got != c.equal {
+			t.Errorf("case %d: expected equality to be symmetric", i)
+		}
+	}
+
+	rs := Must(`{"$id": "https://example.com/a", "$defs": {"b": {"pattern": "^a.c$"}}, "items": {"$ref": "#/$defs/b"}}`)
+	data, err := json.Marshal(rs)
+	if err != nil {
+		t.Fatalf("unexpected marshal error: %s", err)
+	}
+	if !rs.Equal(Must(string(data))) {
+		t.Errorf("expected a round trip to preserve the schema, got: %s", data)
+	}
+
+	var nilSchema *Schema
+	if !nilSchema.Equal(nil) || nilSchema.Equal(rs) || rs.Equal(nil) {
+		t.Errorf("expected nil schemas to only equal nil")
+	}
+}
+
 func TestParseUrl(t *testing.T) {
 	// Easy case, id is a standard URL
 	schemaObject := []byte(`{
@@ -231,16 +520,19 @@ func TestDraft3(t *testing.T) {
 
 		// wont fix
 		// "testdata/draft3/optional/bignum.json",
-		// "testdata/draft3/optional/ecmascript-regex.json",
+		"testdata/draft3/optional/ecmascript-regex.json",
 	})
 }
 
 func TestDraft4(t *testing.T) {
-	runJSONTests(t, []string{
+	registry := NewKeywordRegistry()
+	registry.LoadDraft4()
+	runDraftJSONTests(t, registry, []string{
 		"testdata/draft4/additionalItems.json",
 		"testdata/draft4/allOf.json",
 		"testdata/draft4/anyOf.json",
 		"testdata/draft4/default.json",
+		"testdata/draft4/dependencies.json",
 		"testdata/draft4/enum.json",
 		"testdata/draft4/format.json",
 		"testdata/draft4/maxItems.json",
@@ -259,35 +551,37 @@ func TestDraft4(t *testing.T) {
 		"testdata/draft4/required.json",
 		"testdata/draft4/type.json",
 		"testdata/draft4/uniqueItems.json",
+		"testdata/draft4/maximum.json",
+		"testdata/draft4/minimum.json",
+		"testdata/draft4/items.json",
+		"testdata/draft4/additionalProperties.json",
 
 		// disabled due to changes in spec
-		// "testdata/draft4/maximum.json",
-		// "testdata/draft4/minimum.json",
-		// "testdata/draft4/ref.json",
 		// "testdata/draft4/refRemote.json",
 		// "testdata/draft4/optional/zeroTerminatedFloats.json",
 
-		// TODO(arqu): implement this
+		// TODO: refs to unknown keys, ids with fragments and the
+		// draft4 meta-schema, which is fetched remotely
 		// "testdata/draft4/definitions.json",
-		// "testdata/draft4/dependencies.json",
-		// "testdata/draft4/items.json",
+		// "testdata/draft4/ref.json",
 
 		// wont fix
-		// "testdata/draft4/additionalProperties.json",
 		// "testdata/draft4/optional/bignum.json",
-		// "testdata/draft4/optional/ecmascript-regex.json",
+		"testdata/draft4/optional/ecmascript-regex.json",
 	})
 }
 
 func TestDraft6(t *testing.T) {
 	runJSONTests(t, []string{
 		"testdata/draft6/additionalItems.json",
+		"testdata/draft6/additionalProperties.json",
 		"testdata/draft6/allOf.json",
 		"testdata/draft6/anyOf.json",
 		"testdata/draft6/boolean_schema.json",
 		"testdata/draft6/const.json",
 		"testdata/draft6/contains.json",
 		"testdata/draft6/default.json",
+		"testdata/draft6/dependencies.json",
 		"testdata/draft6/enum.json",
 		"testdata/draft6/exclusiveMaximum.json",
 		"testdata/draft6/exclusiveMinimum.json",
@@ -316,15 +610,13 @@ func TestDraft6(t *testing.T) {
 
 		// TODO(arqu): implement this
 		// "testdata/draft6/definitions.json",
-		// "testdata/draft6/dependencies.json",
 		// "testdata/draft6/items.json",
 		// "testdata/draft6/ref.json",
 
 		// wont fix
-		// "testdata/draft6/additionalProperties.json",
 		// "testdata/draft6/refRemote.json",
 		// "testdata/draft6/optional/bignum.json",
-		// "testdata/draft6/optional/ecmascript-regex.json",
+		"testdata/draft6/optional/ecmascript-regex.json",
 	})
 }
 
@@ -344,12 +636,14 @@ func TestDraft7(t *testing.T) {
 
 	runJSONTests(t, []string{
 		"testdata/draft7/additionalItems.json",
+		"testdata/draft7/additionalProperties.json",
 		"testdata/draft7/allOf.json",
 		"testdata/draft7/anyOf.json",
 		"testdata/draft7/boolean_schema.json",
 		"testdata/draft7/const.json",
 		"testdata/draft7/contains.json",
 		"testdata/draft7/default.json",
+		"testdata/draft7/dependencies.json",
 		"testdata/draft7/enum.json",
 		"testdata/draft7/exclusiveMaximum.json",
 		"testdata/draft7/exclusiveMinimum.json",
@@ -374,6 +668,7 @@ func TestDraft7(t *testing.T) {
 		"testdata/draft7/type.json",
 		"testdata/draft7/uniqueItems.json",
 
+		"testdata/draft7/optional/content.json",
 		"testdata/draft7/optional/zeroTerminatedFloats.json",
 		"testdata/draft7/optional/format/date-time.json",
 		"testdata/draft7/optional/format/date.json",
@@ -384,6 +679,7 @@ func TestDraft7(t *testing.T) {
 		"testdata/draft7/optional/format/ipv4.json",
 		"testdata/draft7/optional/format/ipv6.json",
 		"testdata/draft7/optional/format/iri-reference.json",
+		"testdata/draft7/optional/format/iri.json",
 		"testdata/draft7/optional/format/json-pointer.json",
 		"testdata/draft7/optional/format/regex.json",
 		"testdata/draft7/optional/format/relative-json-pointer.json",
@@ -394,17 +690,13 @@ func TestDraft7(t *testing.T) {
 
 		// TODO(arqu): implement this
 		// "testdata/draft7/definitions.json",
-		// "testdata/draft7/dependencies.json",
 		// "testdata/draft7/items.json",
 		// "testdata/draft7/ref.json",
 
 		// wont fix
-		// "testdata/draft7/additionalProperties.json",
 		// "testdata/draft7/refRemote.json",
 		// "testdata/draft7/optional/bignum.json",
-		// "testdata/draft7/optional/content.json",
-		// "testdata/draft7/optional/ecmascript-regex.json",
-		// "testdata/draft7/optional/format/iri.json",
+		"testdata/draft7/optional/ecmascript-regex.json",
 	})
 }
 
@@ -424,7 +716,7 @@ func TestDraft2019_09(t *testing.T) {
 
 	runJSONTests(t, []string{
 		"testdata/draft2019-09/additionalItems.json",
-		// "testdata/draft2019-09/additionalProperties.json",
+		"testdata/draft2019-09/additionalProperties.json",
 		"testdata/draft2019-09/allOf.json",
 		"testdata/draft2019-09/anchor.json",
 		"testdata/draft2019-09/anyOf.json",
@@ -459,10 +751,11 @@ func TestDraft2019_09(t *testing.T) {
 		"testdata/draft2019-09/ref.json",
 		"testdata/draft2019-09/required.json",
 		"testdata/draft2019-09/type.json",
-		// "testdata/draft2019-09/unevaluatedProperties.json",
-		// "testdata/draft2019-09/unevaluatedItems.json",
+		"testdata/draft2019-09/unevaluatedProperties.json",
+		"testdata/draft2019-09/unevaluatedItems.json",
 		"testdata/draft2019-09/uniqueItems.json",
 
+		"testdata/draft2019-09/optional/content.json",
 		"testdata/draft2019-09/optional/zeroTerminatedFloats.json",
 		"testdata/draft2019-09/optional/format/date-time.json",
 		"testdata/draft2019-09/optional/format/date.json",
@@ -473,6 +766,7 @@ func TestDraft2019_09(t *testing.T) {
 		"testdata/draft2019-09/optional/format/ipv4.json",
 		"testdata/draft2019-09/optional/format/ipv6.json",
 		"testdata/draft2019-09/optional/format/iri-reference.json",
+		"testdata/draft2019-09/optional/format/iri.json",
 		"testdata/draft2019-09/optional/format/json-pointer.json",
 		"testdata/draft2019-09/optional/format/regex.json",
 		"testdata/draft2019-09/optional/format/relative-json-pointer.json",
@@ -481,30 +775,40 @@ func TestDraft2019_09(t *testing.T) {
 		"testdata/draft2019-09/optional/format/uri-template.json",
 		"testdata/draft2019-09/optional/format/uri.json",
 
-		// TODO(arqu): investigate further, test is modified because
-		// if does not formally validate and simply returns
-		// when no then or else is present
+		// variants of the upstream suites where if is paired with then
 		"testdata/draft2019-09/unevaluatedProperties_modified.json",
 		"testdata/draft2019-09/unevaluatedItems_modified.json",
 
-		// TODO(arqu): investigate further, test is modified because of inconsistent
-		// expectations from spec on how evaluated properties are tracked between
-		// additionalProperties and unevaluatedProperties
-		"testdata/draft2019-09/additionalProperties_modified.json",
-
 		// wont fix
 		// "testdata/draft2019-09/refRemote.json",
 		// "testdata/draft2019-09/optional/bignum.json",
-		// "testdata/draft2019-09/optional/content.json",
-		// "testdata/draft2019-09/optional/ecmascript-regex.json",
+		"testdata/draft2019-09/optional/ecmascript-regex.json",
 		// "testdata/draft2019-09/optional/refOfUnknownKeyword.json",
+	})
+}
+
+func TestUseNumberSuites(t *testing.T) {
+	runJSONTestSuites(t, []string{
+		"testdata/draft2019-09/const.json",
+		"testdata/draft2019-09/enum.json",
+		"testdata/draft2019-09/exclusiveMaximum.json",
+		"testdata/draft2019-09/exclusiveMinimum.json",
+		"testdata/draft2019-09/maximum.json",
+		"testdata/draft2019-09/minimum.json",
+		"testdata/draft2019-09/multipleOf.json",
+		"testdata/draft2019-09/type.json",
+		"testdata/draft2019-09/uniqueItems.json",
+		"testdata/draft2019-09/optional/bignum.json",
+		"testdata/draft2019-09/optional/zeroTerminatedFloats.json",
+	}, true, nil)
+}
 
-		// TODO(arqu): iri fails on IPV6 not having [] around the address
-		// which was a legal format in draft7
-		// introduced: https://github.com/json-schema-org/JSON-Schema-Test-Suite/commit/2146b02555b163da40ae98e60bf36b2c2f8d4bd0#diff-b2ca98716e146559819bc49635a149a9
-		// relevant RFC: https://tools.ietf.org/html/rfc3986#section-3.2.2
-		// relevant 'net/url' package discussion: https://github.com/golang/go/issues/31024
-		// "testdata/draft2019-09/optional/format/iri.json",
+func TestDraft2020_12(t *testing.T) {
+	runJSONTests(t, []string{
+		"testdata/draft2020-12/dynamicRef.json",
+		"testdata/draft2020-12/items.json",
+		"testdata/draft2020-12/prefixItems.json",
+		"testdata/draft2020-12/unevaluatedItems.json",
 	})
 }
 
@@ -524,6 +828,19 @@ type TestCase struct {
 }
 
 func runJSONTests(t *testing.T, testFilepaths []string) {
+	runJSONTestSuites(t, testFilepaths, false, nil)
+}
+
+// runDraftJSONTests runs suites of the JSON Schema Test Suite parsing their
+// schemas with a keyword registry, for drafts the suites don't declare
+func runDraftJSONTests(t *testing.T, registry *KeywordRegistry, testFilepaths []string) {
+	runJSONTestSuites(t, testFilepaths, false, registry)
+}
+
+// runJSONTestSuites runs suites of the JSON Schema Test Suite, optionally
+// decoding the test instances with numbers as json.Number and parsing
+// the schemas with a keyword registry other than the global one
+func runJSONTestSuites(t *testing.T, testFilepaths []string, useNumber bool, registry *KeywordRegistry) {
 	tests := 0
 	passed := 0
 	ctx := context.Background()
@@ -537,10 +854,35 @@ func runJSONTests(t *testing.T, testFilepaths []string) {
 				return
 			}
 
-			if err := json.Unmarshal(data, &testSets); err != nil {
+			dec := json.NewDecoder(bytes.NewReader(data))
+			if useNumber {
+				dec.UseNumber()
+			}
+			if err := dec.Decode(&testSets); err != nil {
 				t.Errorf("error unmarshaling test set %s from JSON: %s", base, err.Error())
 				return
 			}
+			if registry != nil {
+				rawSets := []struct {
+					Schema json.RawMessage `json:"schema"`
+				}{}
+				if err := json.Unmarshal(data, &rawSets); err != nil {
+					t.Errorf("error unmarshaling test set %s from JSON: %s", base, err.Error())
+					return
+				}
+				for i, raw := range rawSets {
+					if testSets[i].Schema, err = ParseSchema(raw.Schema, registry); err != nil {
+						t.Errorf("error parsing schema of test set %s: %s", base, err.Error())
+						return
+					}
+				}
+			}
+
+			if strings.Contains(path, "/format") || strings.Contains(path, "/ecmascript-regex") {
+				// the optional format suites expect format assertion
+				AssertFormat = true
+				defer func() { AssertFormat = false }()
+			}
 
 			for _, ts := range testSets {
 				sc := ts.Schema
@@ -553,6 +895,8 @@ func runJSONTests(t *testing.T, testFilepaths []string) {
 					validationState := sc.Validate(ctx, c.Data)
 					if validationState.IsValid() != c.Valid {
 						t.Errorf("%s: %s test case %d: %s. error: %s", base, ts.Description, i, c.Description, *validationState.Errs)
+					} else if sc.IsValid(ctx, c.Data) != c.Valid {
+						t.Errorf("%s: %s test case %d: %s. fail-fast validation returned a different result", base, ts.Description, i, c.Description)
 					} else {
 						passed++
 					}
@@ -594,6 +938,11 @@ func TestDataType(t *testing.T) {
 		{float32(42), "integer"},
 		{float32(42.0), "integer"},
 		{float32(42.5), "number"},
+		{json.Number("42"), "integer"},
+		{json.Number("42.0"), "integer"},
+		{json.Number("42.5"), "number"},
+		{json.Number("12345678910111213141516171819202122232425262728293031"), "integer"},
+		{json.Number("1e99999"), "integer"},
 		// special cases which should pass with type hints
 		{"true", "boolean"},
 		{4.0, "number"},
@@ -655,6 +1004,98 @@ func TestJSONCoding(t *testing.T) {
 	}
 }
 
+func TestMarshalKeywordOrder(t *testing.T) {
+	cases := []struct {
+		schema, expect string
+	}{
+		{`{"maximum": 3, "type": "integer", "$id": "http://example.com/a"}`,
+			`{"$id":"http://example.com/a","type":"integer","maximum":3}`},
+		{`{"z-extra": 1, "minLength": 2, "a-extra": {"b": 1, "a": 2}, "m-extra": null}`,
+			`{"minLength":2,"z-extra":1,"a-extra":{"b":1,"a":2},"m-extra":null}`},
+		{`{"additionalProperties": false, "properties": {"a": {"title": "a", "$comment": "b"}}}`,
+			`{"properties":{"a":{"title":"a","$comment":"b"}},"additionalProperties":false}`},
+	}
+
+	for i, c := range cases {
+		rs := &Schema{}
+		if err := json.Unmarshal([]byte(c.schema), rs); err != nil {
+			t.Errorf("case %d error unmarshaling from json: %s", i, err.Error())
+			continue
+		}
+		output, err := json.Marshal(rs)
+		if err != nil {
+			t.Errorf("case %d error marshaling to JSON: %s", i, err.Error())
+			continue
+		}
+		if string(output) != c.expect {
+			t.Errorf("case %d expected:\n%s\ngot:\n%s", i, c.expect, string(output))
+		}
+	}
+}
+
+// waitForDone is a keyword that blocks until the validation context is done
+type waitForDone struct {
+	calls *int
+}
+
+func (w *waitForDone) UnmarshalJSON(data []byte) error {
+	return nil
+}
+
+func (w *waitForDone) Register(uri string, registry *SchemaRegistry) {}
+
+func (w *waitForDone) Resolve(pointer jptr.Pointer, uri string) *Schema {
+	return nil
+}
+
+func (w *waitForDone) ValidateKeyword(ctx context.Context, currentState *ValidationState, data interface{}) {
+	*w.calls++
+	<-ctx.Done()
+}
+
+func TestValidateBytesContext(t *testing.T) {
+	calls := 0
+	RegisterKeyword("x-wait-for-done", func() Keyword {
+		return &waitForDone{calls: &calls}
+	})
+
+	rs := Must(`{ "items": { "x-wait-for-done": true, "type": "string" } }`)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	errs, err := rs.ValidateBytes(ctx, []byte(`[1, 2, 3, 4, 5]`))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected error to wrap context.DeadlineExceeded, got: %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("expected validation to stop after the deadline, keyword called %d times", calls)
+	}
+	if len(errs) != 1 {
+		t.Errorf("expected only the errors found before the deadline, got: %v", errs)
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Must(`{ "type": "string" }`).ValidateBytes(cancelled, []byte(`"a"`)); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected error to wrap context.Canceled, got: %v", err)
+	}
+
+	// a nil context is never cancelled
+	nilCtx := Must(`{ "$defs": { "str": { "type": "string" } }, "properties": { "a": { "$ref": "#/$defs/str" } } }`)
+	if errs, err := nilCtx.ValidateBytes(nil, []byte(`{ "a": 1 }`)); err != nil || len(errs) != 1 {
+		t.Errorf("expected one error validating bytes with a nil context, got: %v, %v", errs, err)
+	}
+	if errs, err := nilCtx.ValidateDecoded(nil, map[string]interface{}{"a": 1}); err != nil || len(errs) != 1 {
+		t.Errorf("expected one error validating decoded data with a nil context, got: %v, %v", errs, err)
+	}
+	if _, errs, err := nilCtx.ValidateCoerced(nil, map[string]interface{}{"a": "b"}, nil); err != nil || len(errs) != 0 {
+		t.Errorf("expected no errors validating coerced data with a nil context, got: %v, %v", errs, err)
+	}
+	if _, err := nilCtx.Compile(nil); err != nil {
+		t.Errorf("unexpected error compiling with a nil context: %s", err)
+	}
+}
+
 func TestValidateBytes(t *testing.T) {
 	ctx := context.Background()
 	cases := []struct {
@@ -712,61 +1153,2318 @@ func TestValidateBytes(t *testing.T) {
 	}
 }
 
-func BenchmarkAdditionalItems(b *testing.B) {
-	runBenchmark(b,
-		func(sampleSize int) (string, interface{}) {
-			data := make([]interface{}, sampleSize)
-			for i := 0; i < sampleSize; i++ {
-				data[i] = float64(i)
+func TestParallelValidation(t *testing.T) {
+	ctx := context.Background()
+	var props strings.Builder
+	data := map[string]interface{}{}
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("p%02d", i)
+		if i > 0 {
+			props.WriteString(",")
+		}
+		props.WriteString(fmt.Sprintf(`"%s": { "$ref": "#/$defs/list" }`, key))
+		items := []interface{}{}
+		for j := 0; j < 100; j++ {
+			var item interface{} = float64(j)
+			if (i+j)%37 == 0 {
+				item = "x"
 			}
-			return `{
-				"items": {},
-				"additionalItems": false
-			}`, data
-		},
-	)
+			items = append(items, item)
+		}
+		data[key] = items
+	}
+	rs := Must(`{
+		"$defs": { "list": { "items": { "type": "integer", "format": "int32" } } },
+		"properties": {` + props.String() + `},
+		"unevaluatedProperties": false
+	}`)
+
+	sequential, err := rs.ValidateDecoded(ctx, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(sequential, func(i, j int) bool { return sequential[i].PropertyPath < sequential[j].PropertyPath })
+	if len(sequential) == 0 {
+		t.Fatal("expected errors")
+	}
+
+	opts := &ValidationOptions{Parallel: true, ParallelWorkers: 4}
+	var first []KeyError
+	for run := 0; run < 3; run++ {
+		state := rs.ValidateWithOptions(ctx, data, opts)
+		errs := *state.Errs
+		if run == 0 {
+			first = errs
+		} else if !reflect.DeepEqual(errs, first) {
+			t.Fatalf("run %d: expected errors in the same order as the first run", run)
+		}
+		if errs[0].PropertyPath != "/p00/0" || errs[len(errs)-1].PropertyPath != "/p99/86" {
+			t.Errorf("run %d: expected errors in instance order, got: %v", run, errs)
+		}
+		sorted := append([]KeyError{}, errs...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i].PropertyPath < sorted[j].PropertyPath })
+		if !reflect.DeepEqual(sorted, sequential) {
+			t.Fatalf("run %d: expected the errors of sequential validation.\nexpected: %v\ngot: %v", run, sequential, sorted)
+		}
+		if len(state.Annotations()) == 0 {
+			t.Errorf("run %d: expected the annotations of the branches", run)
+		}
+	}
+
+	errs, err := rs.ValidateBytesWithOptions(ctx, []byte(`{ "p00": ["x", "y"] }`), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 2 {
+		t.Errorf("expected values below ParallelThreshold to be validated, got: %v", errs)
+	}
+
+	state := rs.ValidateWithOptions(ctx, data, &ValidationOptions{Parallel: true, FailFast: true})
+	if state.IsValid() || len(*state.Errs) >= len(sequential) {
+		t.Errorf("expected fail fast to stop parallel validation early, got %d errors", len(*state.Errs))
+	}
 }
 
-func BenchmarkAdditionalProperties(b *testing.B) {
-	runBenchmark(b,
-		func(sampleSize int) (string, interface{}) {
-			data := make(map[string]interface{}, sampleSize)
-			for i := 0; i < sampleSize; i++ {
-				p := fmt.Sprintf("p%v", i)
-				data[p] = struct{}{}
-			}
-			d, err := json.Marshal(data)
-			if err != nil {
-				b.Errorf("unable to marshal data: %v", err)
-				return "", nil
+func TestConcurrentValidation(t *testing.T) {
+	ctx := context.Background()
+	address := Must(`{
+		"$id": "https://example.com/concurrent/address.json",
+		"type": "object",
+		"properties": { "street": { "type": "string" } },
+		"required": ["street"]
+	}`)
+	if GetSchemaRegistry().GetKnown("https://example.com/concurrent/address.json") == nil {
+		if err := GetSchemaRegistry().AddSchema(address); err != nil {
+			t.Fatal(err)
+		}
+	}
+	schemas := map[string]*Schema{
+		"ref": Must(`{
+			"$id": "https://example.com/concurrent/person.json",
+			"type": "object",
+			"properties": {
+				"name": { "$ref": "#name" },
+				"age": { "$ref": "#/$defs/age" },
+				"address": { "$ref": "address.json" },
+				"street": { "$ref": "address.json#/properties/street" },
+				"tags": { "type": "array", "items": { "type": "string", "pattern": "^[a-z]+$" } }
+			},
+			"$defs": {
+				"name": { "$anchor": "name", "type": "string", "minLength": 1 },
+				"age": { "type": "integer", "minimum": 0 }
+			},
+			"unevaluatedProperties": false
+		}`),
+		"recursiveRef": Must(`{
+			"$schema": "https://json-schema.org/draft/2019-09/schema",
+			"$id": "https://example.com/concurrent/tree.json",
+			"$recursiveAnchor": true,
+			"type": "object",
+			"properties": {
+				"value": { "type": "number" },
+				"children": { "type": "array", "items": { "$recursiveRef": "#" } }
 			}
-			return `{
-				"properties": ` + string(d) + `,
-				"additionalProperties": false
-			}`, data
+		}`),
+		"dynamicRef": Must(`{
+			"$schema": "https://json-schema.org/draft/2020-12/schema",
+			"$id": "https://example.com/concurrent/list.json",
+			"$dynamicAnchor": "item",
+			"type": ["object", "string"],
+			"properties": { "items": { "type": "array", "items": { "$dynamicRef": "#item" } } }
+		}`),
+	}
+	instances := map[string][]string{
+		"ref": {
+			`{ "name": "a", "age": 3, "address": { "street": "b" }, "tags": ["c"] }`,
+			`{ "name": "", "age": -1, "address": {}, "street": 1, "tags": ["C", 1], "extra": true }`,
 		},
-	)
-}
+		"recursiveRef": {
+			`{ "value": 1, "children": [{ "value": 2, "children": [{ "value": 3 }] }] }`,
+			`{ "value": "1", "children": [{ "value": 2, "children": [{ "value": "3" }] }] }`,
+		},
+		"dynamicRef": {
+			`{ "items": ["a", { "items": ["b"] }] }`,
+			`{ "items": ["a", { "items": [1] }, 2] }`,
+		},
+	}
 
-func BenchmarkConst(b *testing.B) {
-	runBenchmark(b,
-		func(sampleSize int) (string, interface{}) {
-			data := make(map[string]interface{}, sampleSize)
-			for i := 0; i < sampleSize; i++ {
-				data[fmt.Sprintf("p%v", i)] = fmt.Sprintf("p%v", 2*i)
+	const goroutines = 8
+	results := make([]map[string][]KeyError, goroutines)
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			results[g] = map[string][]KeyError{}
+			for name, sch := range schemas {
+				for i, inst := range instances[name] {
+					opts := &ValidationOptions{Parallel: g%2 == 0}
+					errs, err := sch.ValidateBytesWithOptions(ctx, []byte(inst), opts)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					results[g][fmt.Sprintf("%s/%d", name, i)] = sortedErrors(errs)
+				}
 			}
-			d, err := json.Marshal(data)
+		}(g)
+	}
+	wg.Wait()
+
+	for name, sch := range schemas {
+		for i, inst := range instances[name] {
+			key := fmt.Sprintf("%s/%d", name, i)
+			expect, err := sch.ValidateBytes(ctx, []byte(inst))
 			if err != nil {
-				b.Errorf("unable to marshal data: %v", err)
-				return "", nil
+				t.Fatal(err)
 			}
-			return `{
-				"const": ` + string(d) + `
-			}`, data
-		},
-	)
-}
-
+			expect = sortedErrors(expect)
+			if i == 0 && len(expect) != 0 {
+				t.Errorf("%s: expected a valid instance, got: %v", key, expect)
+			}
+			if i == 1 && len(expect) == 0 {
+				t.Errorf("%s: expected an invalid instance", key)
+			}
+			for g := range results {
+				if !reflect.DeepEqual(results[g][key], expect) {
+					t.Errorf("%s: goroutine %d expected errors: %v, got: %v", key, g, expect, results[g][key])
+				}
+			}
+		}
+	}
+}
+
+// sortedErrors orders errors by message, properties are validated in no
+// particular order
+func sortedErrors(errs []KeyError) []KeyError {
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return errs
+}
+
+func TestScalarFastPath(t *testing.T) {
+	ctx := context.Background()
+	cases := []struct {
+		schema string
+		scalar bool
+	}{
+		{`true`, true},
+		{`false`, false},
+		{`{ "type": "string", "maxLength": 3, "minLength": 1, "pattern": "^[a-z]*$", "title": "t" }`, true},
+		{`{ "type": ["integer", "null"], "minimum": 0, "exclusiveMaximum": 10 }`, true},
+		{`{ "maximum": 5, "exclusiveMinimum": -5, "description": "d", "default": 1 }`, true},
+		{`{ "enum": ["a", 1, null, { "b": [2] }] }`, true},
+		{`{ "const": 1.0, "$comment": "c" }`, true},
+		{`{ "type": "string", "format": "email" }`, true},
+		{`{ "type": "boolean" }`, true},
+		{`{ "type": "string", "properties": { "a": {} } }`, false},
+		{`{ "$defs": { "a": { "type": "string" } }, "$ref": "#/$defs/a" }`, false},
+		{`{ "multipleOf": 2 }`, false},
+	}
+	instances := []interface{}{
+		nil, true, "", "ab", "abcd", "AB", "true", "user@example.com", "nope",
+		0.0, 1.0, 4.5, 5.0, 10.0, -6.0, json.Number("1"), []interface{}{},
+		map[string]interface{}{"b": []interface{}{2.0}},
+	}
+
+	check := func() {
+		for _, c := range cases {
+			rs := Must(c.schema)
+			rs.prepare(ctx)
+			if rs.scalar != c.scalar {
+				t.Errorf("%s: expected scalar %t", c.schema, c.scalar)
+			}
+			for _, inst := range instances {
+				valid := rs.Validate(ctx, inst).IsValid()
+				if fast := rs.validScalar(ctx, inst); fast && !valid {
+					t.Errorf("%s: expected %v to be invalid", c.schema, inst)
+				} else if c.scalar && fast != valid {
+					t.Errorf("%s: expected %v to be valid", c.schema, inst)
+				}
+				errs, err := rs.ValidateDecoded(ctx, inst)
+				if err != nil || len(errs) != len(*rs.Validate(ctx, inst).Errs) {
+					t.Errorf("%s: expected the errors of Validate for %v, got: %v %v", c.schema, inst, errs, err)
+				}
+			}
+		}
+	}
+	check()
+	AssertFormat = true
+	defer func() { AssertFormat = false }()
+	check()
+}
+
+func TestValidateDecoded(t *testing.T) {
+	ctx := context.Background()
+	rs := Must(`{
+		"type": "object",
+		"properties": { "tags": { "type": "array", "items": { "type": "string" } } },
+		"required": ["name"]
+	}`)
+
+	data := map[string]interface{}{
+		"tags": []interface{}{"a", 1.0},
+	}
+	errs, err := rs.ValidateDecoded(ctx, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{
+		`/: {"tags":["a",1]} "name" value is required`,
+		`/tags/1: 1 type should be string, got integer`,
+	}
+	if len(errs) != len(expect) {
+		t.Fatalf("error length mismatch. expected: %d, got: %v", len(expect), errs)
+	}
+	for i, e := range errs {
+		if e.Error() != expect[i] {
+			t.Errorf("error %d mismatch. expected: '%s', got: '%s'", i, expect[i], e.Error())
+		}
+	}
+
+	bytesErrs, err := rs.ValidateBytes(ctx, []byte(`{"tags":["a",1]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(errs, bytesErrs) {
+		t.Errorf("expected the same errors as ValidateBytes, got: %v and %v", errs, bytesErrs)
+	}
+
+	// validation states are reused, which must leave returned errors intact
+	for i := 0; i < 3; i++ {
+		if valid, err := rs.ValidateDecoded(ctx, map[string]interface{}{"name": "a"}); err != nil || len(valid) != 0 {
+			t.Fatalf("expected a valid instance, got: %v %v", valid, err)
+		}
+	}
+	for i, e := range errs {
+		if e.Error() != expect[i] {
+			t.Errorf("error %d changed by a later validation. expected: '%s', got: '%s'", i, expect[i], e.Error())
+		}
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := rs.ValidateDecoded(cancelled, data); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected error to wrap context.Canceled, got: %v", err)
+	}
+}
+
+func TestValidateErr(t *testing.T) {
+	ctx := context.Background()
+	rs := Must(`{
+		"type": "object",
+		"properties": { "tags": { "type": "array", "items": { "type": "string" } } },
+		"required": ["name"]
+	}`)
+
+	if err := rs.ValidateErr(ctx, map[string]interface{}{"name": "a"}); err != nil {
+		t.Errorf("expected a valid instance to return nil, got: %v", err)
+	}
+
+	data := map[string]interface{}{"tags": []interface{}{"a", 1.0}}
+	err := rs.ValidateErr(ctx, data)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected a *ValidationError, got: %#v", err)
+	}
+	expect := `/: {"tags":["a",1]} "name" value is required (and 1 more errors)`
+	if err.Error() != expect {
+		t.Errorf("message mismatch. expected: %q, got: %q", expect, err.Error())
+	}
+	errs, _ := rs.ValidateDecoded(ctx, data)
+	if !reflect.DeepEqual(verr.Errors(), errs) {
+		t.Errorf("expected the errors of ValidateDecoded, got: %v", verr.Errors())
+	}
+
+	unwrapped := verr.Unwrap()
+	if len(unwrapped) != 2 || !errors.Is(unwrapped[0], ErrRequired) || !errors.Is(unwrapped[1], ErrType) {
+		t.Errorf("expected the unwrapped errors to be the KeyErrors, got: %v", unwrapped)
+	}
+
+	single := &ValidationError{errs: errs[:1]}
+	if single.Error() != errs[0].Error() {
+		t.Errorf("expected a single error message to be the KeyError message, got: %q", single.Error())
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := rs.ValidateErr(cancelled, data); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected error to wrap context.Canceled, got: %v", err)
+	}
+}
+
+type goAddress struct {
+	Street string `json:"street"`
+	Zip    string `json:"zip,omitempty"`
+}
+
+type goPerson struct {
+	Name      string      `json:"name,omitempty"`
+	Age       int64       `json:"age"`
+	Addresses []goAddress `json:"addresses"`
+	Secret    string      `json:"-"`
+	Role      goRole      `json:"role"`
+}
+
+type goRole int
+
+func (r goRole) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fmt.Sprintf("role-%d", r))
+}
+
+func TestValidateGoValue(t *testing.T) {
+	ctx := context.Background()
+	rs := Must(`{
+		"type": "object",
+		"properties": {
+			"age": { "maximum": 9007199254740992 },
+			"addresses": { "items": { "required": ["zip"] } },
+			"role": { "pattern": "^role-" }
+		},
+		"required": ["name", "Secret"]
+	}`)
+
+	errs, err := rs.ValidateGoValue(ctx, goPerson{
+		Age:       9007199254740993,
+		Addresses: []goAddress{{Street: "a", Zip: "1"}, {Street: "b"}},
+		Secret:    "hidden",
+		Role:      2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := []string{}
+	for _, e := range errs {
+		paths = append(paths, e.PropertyPath)
+	}
+	expect := []string{"/", "/", "/age", "/addresses/1"}
+	sort.Strings(paths)
+	sort.Strings(expect)
+	if !reflect.DeepEqual(paths, expect) {
+		t.Errorf("error paths mismatch. expected: %v, got: %v", expect, paths)
+	}
+
+	if _, err := rs.ValidateGoValue(ctx, map[string]interface{}{"f": func() {}}); err == nil {
+		t.Errorf("expected an error converting a value that can't be marshaled")
+	}
+}
+
+func TestApplyDefaults(t *testing.T) {
+	ctx := context.Background()
+	rs := Must(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"properties": {
+			"port": { "type": "integer", "default": 8080 },
+			"tls": {
+				"default": {},
+				"properties": {
+					"enabled": { "default": false },
+					"ciphers": { "default": ["a", "b"] }
+				}
+			},
+			"servers": {
+				"items": { "$ref": "#/$defs/server" }
+			},
+			"pair": {
+				"prefixItems": [ { "properties": { "first": { "default": 1 } } } ],
+				"items": { "properties": { "rest": { "default": 2 } } }
+			}
+		},
+		"allOf": [
+			{ "properties": { "name": { "default": "app" } } }
+		],
+		"$defs": {
+			"server": { "properties": { "weight": { "default": 1 } } }
+		}
+	}`)
+
+	var input interface{}
+	if err := json.Unmarshal([]byte(`{
+		"port": 9090,
+		"servers": [ {}, { "weight": 5 } ],
+		"pair": [ {}, {}, { "rest": 3 } ]
+	}`), &input); err != nil {
+		t.Fatal(err)
+	}
+	before, err := json.Marshal(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := rs.ApplyDefaults(ctx, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expect interface{}
+	if err := json.Unmarshal([]byte(`{
+		"port": 9090,
+		"name": "app",
+		"tls": { "enabled": false, "ciphers": ["a", "b"] },
+		"servers": [ { "weight": 1 }, { "weight": 5 } ],
+		"pair": [ { "first": 1 }, { "rest": 2 }, { "rest": 3 } ]
+	}`), &expect); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expect, got) {
+		t.Errorf("defaults mismatch.\nexpected: %v\ngot:      %v", expect, got)
+	}
+	if after, _ := json.Marshal(input); string(after) != string(before) {
+		t.Errorf("expected ApplyDefaults to leave its input untouched, got: %s", after)
+	}
+
+	// defaults are copied, so changes to the result never reach the schema
+	got.(map[string]interface{})["tls"].(map[string]interface{})["ciphers"].([]interface{})[0] = "z"
+	again, err := rs.ApplyDefaults(ctx, map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := again.(map[string]interface{})["tls"].(map[string]interface{})["ciphers"].([]interface{})[0]; c != "a" {
+		t.Errorf("expected the schema default to be unchanged, got: %v", c)
+	}
+
+	inPlace := map[string]interface{}{}
+	if _, err := rs.ApplyDefaultsInPlace(ctx, inPlace); err != nil {
+		t.Fatal(err)
+	}
+	if inPlace["port"] != 8080.0 {
+		t.Errorf("expected ApplyDefaultsInPlace to modify its input, got: %v", inPlace)
+	}
+
+	if _, err := Must(`{"$ref": "#/$defs/missing"}`).ApplyDefaults(ctx, map[string]interface{}{}); err == nil {
+		t.Error("expected an error for an unresolvable reference")
+	}
+
+	// items beyond an empty or short tuple get no defaults
+	tuple, err := Must(`{ "items": [] }`).ApplyDefaults(ctx, []interface{}{1.0, 2.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tuple, []interface{}{1.0, 2.0}) {
+		t.Errorf("expected an empty tuple to leave the array unchanged, got: %v", tuple)
+	}
+	tuple, err = Must(`{ "items": [ { "default": {} }, { "properties": { "a": { "default": 1 } } } ] }`).ApplyDefaults(ctx, []interface{}{map[string]interface{}{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tuple, []interface{}{map[string]interface{}{}}) {
+		t.Errorf("expected the items of a shorter array to be left alone, got: %v", tuple)
+	}
+
+	data, err := json.Marshal(Must(`{"default": {"a": [1]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"default":{"a":[1]}}` {
+		t.Errorf("expected default to round-trip, got: %s", data)
+	}
+}
+
+func TestValidateCoerced(t *testing.T) {
+	ctx := context.Background()
+	rs := Must(`{
+		"properties": {
+			"page": { "type": "integer", "minimum": 1 },
+			"ratio": { "type": "number" },
+			"debug": { "type": "boolean" },
+			"name": { "type": "string" },
+			"either": { "type": ["integer", "string"] },
+			"tags": { "items": { "type": "integer" } },
+			"choice": { "anyOf": [ { "type": "integer", "minimum": 10 }, { "const": "5" } ] },
+			"count": { "allOf": [ { "type": "integer" }, { "minimum": 5 } ] },
+			"size": { "$ref": "#/$defs/size", "maximum": 10 },
+			"cond": { "if": { "type": "integer" }, "then": { "minimum": 100 }, "else": { "type": "string" } }
+		},
+		"$defs": { "size": { "type": "number" } }
+	}`)
+
+	input := map[string]interface{}{
+		"page":   "42",
+		"ratio":  "-1.5e2",
+		"debug":  "false",
+		"name":   "7",
+		"either": "3",
+		"tags":   []interface{}{"1", "2"},
+		"choice": "5",
+		"count":  "6",
+		"size":   "2.5",
+		"cond":   "5",
+	}
+	doc, errs, err := rs.ValidateCoerced(ctx, input, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 0 {
+		t.Errorf("expected coerced values to be valid, got: %v", errs)
+	}
+	expect := map[string]interface{}{
+		"page":   42.0,
+		"ratio":  -150.0,
+		"debug":  false,
+		"name":   "7",
+		"either": "3",
+		"tags":   []interface{}{1.0, 2.0},
+		"choice": "5",
+		"count":  6.0,
+		"size":   2.5,
+		"cond":   "5",
+	}
+	if !reflect.DeepEqual(expect, doc) {
+		t.Errorf("coerced document mismatch.\nexpected: %v\ngot:      %v", expect, doc)
+	}
+	// the coerced document is the one that was validated
+	if errs, err := rs.ValidateDecoded(ctx, doc); err != nil || len(errs) != 0 {
+		t.Errorf("expected the coerced document to be valid, got: %v, %v", errs, err)
+	}
+	if input["page"] != "42" {
+		t.Errorf("expected the input to be left untouched, got: %v", input)
+	}
+
+	cases := []struct {
+		data   interface{}
+		errors []string
+	}{
+		{map[string]interface{}{"page": "0"}, []string{`/page: 0 must be greater than or equal to 1`}},
+		{map[string]interface{}{"page": "1.5"}, []string{`/page: "1.5" type should be integer, got string`}},
+		{map[string]interface{}{"page": "0x10"}, []string{`/page: "0x10" type should be integer, got string`}},
+		{map[string]interface{}{"ratio": "NaN"}, []string{`/ratio: "NaN" type should be number, got string`}},
+		{map[string]interface{}{"ratio": "1 "}, []string{`/ratio: "1 " type should be number, got string`}},
+		{map[string]interface{}{"debug": "yes"}, []string{`/debug: "yes" type should be boolean, got string`}},
+		{map[string]interface{}{"count": "1"}, []string{`/count: 1 must be greater than or equal to 5`}},
+		{map[string]interface{}{"size": "11"}, []string{`/size: 11 must be less than or equal to 10`}},
+	}
+	for i, c := range cases {
+		_, errs, err := rs.ValidateCoerced(ctx, c.data, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(errs) != len(c.errors) {
+			t.Errorf("case %d: expected %d errors, got: %v", i, len(c.errors), errs)
+			continue
+		}
+		for j, e := range errs {
+			if e.Error() != c.errors[j] {
+				t.Errorf("case %d: error %d mismatch. expected: '%s', got: '%s'", i, j, c.errors[j], e.Error())
+			}
+		}
+	}
+
+	doc, errs, err = Must(`{"type": "integer"}`).ValidateCoerced(ctx, "12345678901234567890123", &ValidationOptions{UseNumber: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 0 || doc != json.Number("12345678901234567890123") {
+		t.Errorf("expected a json.Number, got: %#v %v", doc, errs)
+	}
+
+	state := rs.ValidateWithOptions(ctx, map[string]interface{}{"page": "0"}, nil)
+	if len(*state.Errs) != 1 {
+		t.Errorf("expected strings not to be coerced by default, got: %v", *state.Errs)
+	}
+}
+
+func TestTraceFunc(t *testing.T) {
+	rs := Must(`{
+		"$id": "https://example.com/trace.json",
+		"properties": {
+			"a": { "$ref": "#/$defs/str" },
+			"b": { "minimum": 0 }
+		},
+		"$defs": { "str": { "type": "string" } }
+	}`)
+	trace := []string{}
+	opts := &ValidationOptions{TraceFunc: func(event TraceEvent) {
+		kind := "enter"
+		if event.Kind == TraceExit {
+			kind = fmt.Sprintf("exit %t", event.Valid)
+		}
+		trace = append(trace, fmt.Sprintf("%s %s %s", kind, event.KeywordLocation, event.InstanceLocation))
+	}}
+
+	state := rs.ValidateWithOptions(context.Background(), map[string]interface{}{"a": 1.0}, opts)
+	if len(*state.Errs) != 1 {
+		t.Fatalf("expected 1 error, got: %v", *state.Errs)
+	}
+	expect := []string{
+		"enter /$id ",
+		"exit true /$id ",
+		"enter /$defs ",
+		"exit true /$defs ",
+		"enter /properties ",
+		"enter /properties/a/$ref /a",
+		"enter /properties/a/$ref/type /a",
+		"exit false /properties/a/$ref/type /a",
+		"exit false /properties/a/$ref /a",
+		"exit false /properties ",
+	}
+	if !reflect.DeepEqual(trace, expect) {
+		t.Errorf("trace mismatch.\nexpected: %q\ngot:      %q", expect, trace)
+	}
+
+	var last TraceEvent
+	opts.TraceFunc = func(event TraceEvent) { last = event }
+	rs.ValidateWithOptions(context.Background(), map[string]interface{}{"b": 1.0}, opts)
+	if last.Keyword != "properties" || last.AbsoluteKeywordLocation != "https://example.com/trace.json#/properties" || !last.Valid {
+		t.Errorf("unexpected last event: %+v", last)
+	}
+}
+
+func TestTreatNullAsAbsent(t *testing.T) {
+	ctx := context.Background()
+	rs := Must(`{
+		"required": ["id", "name"],
+		"properties": { "name": { "type": ["string", "null"] } }
+	}`)
+	doc := []byte(`{"id": 1, "name": null}`)
+
+	errs, err := rs.ValidateBytes(ctx, doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 0 {
+		t.Errorf("expected a null property to be present by default, got: %v", errs)
+	}
+
+	opts := &ValidationOptions{TreatNullAsAbsent: true}
+	errs, err = rs.ValidateBytesWithOptions(ctx, doc, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 1 || errs[0].Message != `"name" value is required` {
+		t.Errorf("expected the null property to be missing, got: %v", errs)
+	}
+	if errs, _ := rs.ValidateBytesWithOptions(ctx, []byte(`{"id": 0, "name": ""}`), opts); len(errs) != 0 {
+		t.Errorf("expected zero values to stay present, got: %v", errs)
+	}
+}
+
+func TestRejectDuplicateKeys(t *testing.T) {
+	ctx := context.Background()
+	rs := Must(`{ "properties": { "role": { "const": "user" } } }`)
+	opts := &ValidationOptions{RejectDuplicateKeys: true}
+
+	cases := []struct {
+		doc   string
+		paths []string
+	}{
+		{`{"role": "user", "name": "a"}`, nil},
+		{`{"role": "user", "role": "admin"}`, []string{"/role"}},
+		{`{"a": {"b": 1, "b": 2}, "c": [{"d": 1}, {"d": 1, "e": 2, "d": 3}]}`, []string{"/a/b", "/c/1/d"}},
+		{`{"a/b": 1, "a/b": 2, "a": {"a": 1}}`, []string{"/a~1b"}},
+		{`[{"x": 1}, {"x": 2}]`, nil},
+	}
+	for i, c := range cases {
+		_, err := rs.ValidateBytesWithOptions(ctx, []byte(c.doc), opts)
+		if c.paths == nil {
+			if err != nil {
+				t.Errorf("case %d: unexpected error: %s", i, err)
+			}
+			continue
+		}
+		var dupErr *DuplicateKeysError
+		if !errors.As(err, &dupErr) {
+			t.Errorf("case %d: expected a DuplicateKeysError, got: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(dupErr.Paths, c.paths) {
+			t.Errorf("case %d: duplicate paths mismatch. expected: %v, got: %v", i, c.paths, dupErr.Paths)
+		}
+	}
+
+	// by default the last value wins
+	errs, err := rs.ValidateBytes(ctx, []byte(`{"role": "user", "role": "admin"}`))
+	if err != nil || len(errs) != 1 {
+		t.Errorf("expected the last duplicate value to be validated, got: %v, %v", errs, err)
+	}
+	if _, err := rs.ValidateBytesWithOptions(ctx, []byte(`{"a": 1, "a": `), opts); err == nil {
+		t.Errorf("expected an error for invalid JSON")
+	}
+}
+
+func TestStrictIntegerType(t *testing.T) {
+	ctx := context.Background()
+	integer := Must(`{ "type": "integer" }`)
+	number := Must(`{ "type": "number" }`)
+	strict := &ValidationOptions{StrictIntegerType: true}
+
+	cases := []struct {
+		doc           string
+		lenient, want int
+	}{
+		{`1`, 0, 0},
+		{`-0`, 0, 0},
+		{`9007199254740993`, 0, 0},
+		{`1.0`, 0, 1},
+		{`1e2`, 0, 1},
+		{`1.5`, 1, 1},
+	}
+	for _, c := range cases {
+		errs, err := integer.ValidateBytes(ctx, []byte(c.doc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(errs) != c.lenient {
+			t.Errorf("%s: expected %d errors by default, got: %v", c.doc, c.lenient, errs)
+		}
+		if errs, err = integer.ValidateBytesWithOptions(ctx, []byte(c.doc), strict); err != nil {
+			t.Fatal(err)
+		}
+		if len(errs) != c.want {
+			t.Errorf("%s: expected %d errors with StrictIntegerType, got: %v", c.doc, c.want, errs)
+		}
+		if errs, err = number.ValidateBytesWithOptions(ctx, []byte(c.doc), strict); err != nil || len(errs) != 0 {
+			t.Errorf("%s: expected a valid number with StrictIntegerType, got: %v %v", c.doc, errs, err)
+		}
+	}
+
+	errs, err := integer.ValidateBytesWithOptions(ctx, []byte(`1.0`), strict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 1 || errs[0].Message != "type should be integer, got number" {
+		t.Errorf("expected a type error naming the number, got: %v", errs)
+	}
+	if state := integer.ValidateWithOptions(ctx, json.Number("2.0"), strict); state.IsValid() {
+		t.Errorf("expected a json.Number with a fraction to be invalid")
+	}
+	if state := integer.ValidateWithOptions(ctx, 2.0, strict); !state.IsValid() {
+		t.Errorf("expected a float64 to be judged by its value, got: %v", *state.Errs)
+	}
+}
+
+func TestValidateExamples(t *testing.T) {
+	ctx := context.Background()
+	rs := Must(`{
+		"type": "object",
+		"properties": {
+			"age": { "type": "integer", "minimum": 0, "default": 0, "examples": [3, -1, "old"] },
+			"email": { "$ref": "#/$defs/email", "example": "nobody" },
+			"tags": { "type": "array", "items": { "type": "string" }, "default": ["a", 1] }
+		},
+		"$defs": { "email": { "type": "string", "pattern": "@" } },
+		"examples": [{ "age": 1, "email": "a@b" }]
+	}`)
+
+	got := []string{}
+	for _, e := range rs.ValidateExamples(ctx) {
+		got = append(got, fmt.Sprintf("%s %s", e.Error(), e.KeywordLocation))
+	}
+	expect := []string{
+		`/properties/age/examples/1: -1 must be greater than or equal to 0 /properties/age/minimum`,
+		`/properties/age/examples/2: "old" type should be integer, got string /properties/age/type`,
+		`/properties/email/example: "nobody" regexp pattern @ mismatch on string: nobody /properties/email/$ref/pattern`,
+		`/properties/tags/default/1: 1 type should be string, got integer /properties/tags/items/type`,
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("error mismatch.\nexpected: %v\ngot: %v", expect, got)
+	}
+
+	if errs := Must(`{ "type": "string", "examples": ["a"] }`).ValidateExamples(ctx); len(errs) != 0 {
+		t.Errorf("expected valid examples, got: %v", errs)
+	}
+}
+
+func TestValidateSchema(t *testing.T) {
+	ctx := context.Background()
+	cases := []struct {
+		doc    string
+		errors []string
+	}{
+		{`{ "type": "object", "properties": { "a": { "type": "string", "minLength": 1 } } }`, nil},
+		{`true`, nil},
+		{`{ "type": "object", "minLength": -1, "properties": { "a": { "required": "a" } } }`, []string{
+			`/minLength: -1 must be greater than or equal to 0`,
+			`/properties/a/required: "a" type should be array, got string`,
+		}},
+		{`{ "$schema": "http://json-schema.org/draft-07/schema#", "required": "a" }`, []string{
+			`/required: "a" type should be array, got string`,
+		}},
+		{`{ "$schema": "http://json-schema.org/draft-04/schema#", "minimum": 1, "exclusiveMinimum": 1 }`, []string{
+			`/exclusiveMinimum: 1 type should be boolean, got integer`,
+		}},
+		{`{ "$schema": "https://json-schema.org/draft/2020-12/schema", "$defs": { "a": { "prefixItems": {} } } }`, []string{
+			`/$defs/a/prefixItems: {} type should be array, got object`,
+		}},
+	}
+	for i, c := range cases {
+		errs, err := ValidateSchema(ctx, []byte(c.doc))
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %s", i, err)
+			continue
+		}
+		got := []string{}
+		for _, e := range sortedErrors(errs) {
+			got = append(got, e.Error())
+		}
+		if !reflect.DeepEqual(got, append([]string{}, c.errors...)) {
+			t.Errorf("case %d: error mismatch.\nexpected: %v\ngot: %v", i, c.errors, got)
+		}
+	}
+
+	for _, doc := range []string{`{`, `{ "$schema": "https://example.com/schema" }`} {
+		if _, err := ValidateSchema(ctx, []byte(doc)); err == nil {
+			t.Errorf("expected %s to be an error", doc)
+		}
+	}
+}
+
+func TestInstanceLocation(t *testing.T) {
+	rs := Must(`{
+		"required": ["x"],
+		"properties": { "a/b": { "items": { "properties": { "m~n": { "type": "string" } } } } }
+	}`)
+	errs, err := rs.ValidateBytes(context.Background(), []byte(`{ "a/b": [{}, { "m~n": 1 }] }`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{"", "/a~1b/1/m~0n"}
+	locations := []string{}
+	for _, e := range errs {
+		locations = append(locations, e.InstanceLocation)
+	}
+	sort.Strings(locations)
+	if !reflect.DeepEqual(locations, expect) {
+		t.Errorf("instance locations mismatch. expected: %q, got: %q", expect, locations)
+	}
+	for _, e := range errs {
+		ptr, err := jptr.Parse(e.InstanceLocation)
+		if err != nil {
+			t.Errorf("expected %q to parse as a JSON pointer, got: %s", e.InstanceLocation, err)
+			continue
+		}
+		if _, err := ptr.Eval(map[string]interface{}{"a/b": []interface{}{map[string]interface{}{}, map[string]interface{}{"m~n": 1.0}}}); err != nil {
+			t.Errorf("expected %q to resolve against the instance, got: %s", e.InstanceLocation, err)
+		}
+	}
+}
+
+func TestValidateStream(t *testing.T) {
+	ctx := context.Background()
+	cases := []struct {
+		schema, doc string
+		errors      []string
+	}{
+		{`{ "type": "array", "items": { "type": "integer" } }`, `[1, 2, 3]`, []string{}},
+		{`{ "type": "array", "items": { "type": "integer" } }`, ` [1, "a", {}]`,
+			[]string{`/1: "a" type should be integer, got string`, `/2: {} type should be integer, got object`}},
+		{`{ "type": "array", "items": { "$ref": "#/$defs/pos" }, "$defs": { "pos": { "minimum": 0 } } }`, `[1, -1]`,
+			[]string{`/1: -1 must be greater than or equal to 0`}},
+		// documents that aren't streamed are validated in full
+		{`{ "type": "array", "items": { "type": "integer" } }`, `{}`, []string{`/: {} type should be array, got object`}},
+		{`{ "type": "array", "maxItems": 1, "items": { "type": "integer" } }`, `[1, 2]`,
+			[]string{`/: [1,2] array length 2 exceeds 1 max`}},
+	}
+
+	for i, c := range cases {
+		rs := &Schema{}
+		if err := rs.UnmarshalJSON([]byte(c.schema)); err != nil {
+			t.Errorf("case %d schema is invalid: %s", i, err.Error())
+			continue
+		}
+
+		errs, err := rs.ValidateStream(ctx, strings.NewReader(c.doc))
+		if err != nil {
+			t.Errorf("case %d error validating: %s", i, err)
+			continue
+		}
+		if len(errs) != len(c.errors) {
+			t.Errorf("case %d: error length mismatch. expected: %d, got: %v", i, len(c.errors), errs)
+			continue
+		}
+		bytesErrs, _ := rs.ValidateBytes(ctx, []byte(c.doc))
+		for j, e := range errs {
+			if e.Error() != c.errors[j] {
+				t.Errorf("case %d: validation error %d mismatch. expected: '%s', got: '%s'", i, j, c.errors[j], e.Error())
+			}
+			if e.KeywordLocation != bytesErrs[j].KeywordLocation {
+				t.Errorf("case %d: keyword location %d mismatch. expected: '%s', got: '%s'", i, j, bytesErrs[j].KeywordLocation, e.KeywordLocation)
+			}
+		}
+	}
+
+	rs := Must(`{ "type": "array", "items": {} }`)
+	if _, err := rs.ValidateStream(ctx, strings.NewReader(`[1, 2] 3`)); err == nil {
+		t.Errorf("expected trailing data to be an error")
+	}
+	if _, err := rs.ValidateStream(ctx, strings.NewReader(`[1, 2`)); err == nil {
+		t.Errorf("expected truncated array to be an error")
+	}
+}
+
+func TestValidateYAML(t *testing.T) {
+	ctx := context.Background()
+	rs := Must(`{
+		"type": "object",
+		"properties": {
+			"name": { "type": "string" },
+			"replicas": { "type": "integer", "maximum": 5 },
+			"ports": { "type": "array", "items": { "type": "integer" } },
+			"labels": { "type": "object", "additionalProperties": { "type": "string" } },
+			"created": { "type": "string" }
+		},
+		"required": ["name"]
+	}`)
+
+	cases := []struct {
+		doc    string
+		errors []string
+	}{
+		{`
+name: web
+replicas: 3
+ports: [80, 443]
+labels:
+  tier: frontend
+created: 2021-01-02T03:04:05Z
+`, nil},
+		{`
+replicas: 9
+ports:
+  - 80
+  - http
+labels:
+  1: 2
+`, []string{
+			`/: {"labels":{"1":2},"p... "name" value is required`,
+			`/labels/1: 2 type should be string, got integer`,
+			`/ports/1: "http" type should be integer, got string`,
+			`/replicas: 9 must be less than or equal to 5`,
+		}},
+	}
+	for i, c := range cases {
+		errs, err := rs.ValidateYAML(ctx, []byte(c.doc))
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %s", i, err)
+			continue
+		}
+		got := []string{}
+		for _, e := range sortedErrors(errs) {
+			got = append(got, e.Error())
+		}
+		if len(got) != len(c.errors) {
+			t.Errorf("case %d: error length mismatch. expected: %v, got: %v", i, c.errors, got)
+			continue
+		}
+		for j := range got {
+			if got[j] != c.errors[j] {
+				t.Errorf("case %d: error %d mismatch. expected: '%s', got: '%s'", i, j, c.errors[j], got[j])
+			}
+		}
+	}
+
+	for _, doc := range []string{"name: [", "name: .nan", "? [a, b]\n: c"} {
+		if _, err := rs.ValidateYAML(ctx, []byte(doc)); err == nil {
+			t.Errorf("expected %q to be an error", doc)
+		}
+	}
+}
+
+func TestValidateCBOR(t *testing.T) {
+	ctx := context.Background()
+	rs := Must(`{
+		"type": "object",
+		"properties": {
+			"id": { "type": "integer", "minimum": 0 },
+			"count": { "type": "integer" },
+			"total": { "type": "integer", "maximum": 100000000000000000000 },
+			"readings": { "type": "array", "items": { "type": "number" } },
+			"payload": { "type": "string", "contentEncoding": "base64" }
+		}
+	}`)
+
+	big64 := new(big.Int).Lsh(big.NewInt(1), 64)
+	cases := []struct {
+		item   interface{}
+		errors []string
+	}{
+		{map[string]interface{}{
+			"id":       uint64(7),
+			"count":    3.0,
+			"total":    big64,
+			"readings": []interface{}{1.5, int64(-2), float32(0.25)},
+			"payload":  []byte("raw"),
+		}, nil},
+		{map[string]interface{}{
+			"id":       int64(-1),
+			"count":    2.5,
+			"total":    new(big.Int).Mul(big64, big.NewInt(10)),
+			"readings": []interface{}{"x"},
+		}, []string{
+			`/count: 2.5 type should be integer, got number`,
+			`/id: -1 must be greater than or equal to 0`,
+			`/readings/0: "x" type should be number, got string`,
+			`/total: 18446744073709551616... must be less than or equal to 1e+20`,
+		}},
+	}
+	for i, c := range cases {
+		data, err := cbor.Marshal(c.item)
+		if err != nil {
+			t.Fatal(err)
+		}
+		errs, err := rs.ValidateCBOR(ctx, data)
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %s", i, err)
+			continue
+		}
+		got := []string{}
+		for _, e := range sortedErrors(errs) {
+			got = append(got, e.Error())
+		}
+		if len(got) != len(c.errors) {
+			t.Errorf("case %d: error length mismatch. expected: %v, got: %v", i, c.errors, got)
+			continue
+		}
+		for j := range got {
+			if got[j] != c.errors[j] {
+				t.Errorf("case %d: error %d mismatch. expected: '%s', got: '%s'", i, j, c.errors[j], got[j])
+			}
+		}
+	}
+
+	for _, item := range []interface{}{
+		map[interface{}]interface{}{1: "a"},
+		map[string]interface{}{"readings": []interface{}{math.NaN()}},
+	} {
+		data, err := cbor.Marshal(item)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := rs.ValidateCBOR(ctx, data); err == nil {
+			t.Errorf("expected %v to be an error", item)
+		}
+	}
+	if _, err := rs.ValidateCBOR(ctx, []byte{0xa1}); err == nil {
+		t.Errorf("expected truncated CBOR to be an error")
+	}
+}
+
+func TestDraftSelection(t *testing.T) {
+	ctx := context.Background()
+	cases := []struct {
+		schema string
+		draft  Draft
+		data   string
+		valid  bool
+	}{
+		{`{ "dependentRequired": { "a": ["b"] } }`, Draft2019_09, `{ "a": 1 }`, false},
+		{`{
+			"$schema": "https://json-schema.org/draft/2019-09/schema",
+			"dependentRequired": { "a": ["b"] }
+		}`, Draft2019_09, `{ "a": 1 }`, false},
+		{`{
+			"$schema": "http://json-schema.org/draft-07/schema#",
+			"dependentRequired": { "a": ["b"] }
+		}`, Draft7, `{ "a": 1 }`, true},
+		{`{
+			"$schema": "http://json-schema.org/draft-07/schema#",
+			"dependencies": { "a": ["b"] }
+		}`, Draft7, `{ "a": 1 }`, false},
+		{`{
+			"$schema": "http://json-schema.org/draft-07/schema#",
+			"properties": { "foo": { "dependentRequired": { "a": ["b"] } } }
+		}`, Draft7, `{ "foo": { "a": 1 } }`, true},
+		{`{
+			"$schema": "https://json-schema.org/draft/2020-12/schema",
+			"properties": { "foo": { "maxContains": 1, "contains": { "const": 1 } } }
+		}`, Draft2020_12, `{ "foo": [1, 1] }`, false},
+		{`{
+			"$schema": "https://example.com/custom-meta-schema",
+			"dependentRequired": { "a": ["b"] }
+		}`, DefaultDraft, `{ "a": 1 }`, false},
+		// unknown drafts don't pick up the keywords of the newest draft
+		{`{
+			"$schema": "http://json-schema.org/draft-06/schema#",
+			"prefixItems": [ { "type": "string" } ]
+		}`, DefaultDraft, `[1]`, true},
+		{`{
+			"$schema": "http://json-schema.org/draft-04/schema#",
+			"minimum": 1, "exclusiveMinimum": true
+		}`, Draft4, `1`, false},
+		// $ref ignores its siblings before 2019-09 and is evaluated with them after
+		{`{
+			"$schema": "http://json-schema.org/draft-07/schema#",
+			"definitions": { "str": { "type": "string" } },
+			"properties": { "a": { "$ref": "#/definitions/str", "maxLength": 1 } }
+		}`, Draft7, `{ "a": "bc" }`, true},
+		{`{
+			"$schema": "http://json-schema.org/draft-07/schema#",
+			"definitions": { "str": { "type": "string" } },
+			"properties": { "a": { "$ref": "#/definitions/str", "maxLength": 1 } }
+		}`, Draft7, `{ "a": 1 }`, false},
+		{`{
+			"$schema": "https://json-schema.org/draft/2019-09/schema",
+			"$defs": { "str": { "type": "string" } },
+			"properties": { "a": { "$ref": "#/$defs/str", "maxLength": 1 } }
+		}`, Draft2019_09, `{ "a": "bc" }`, false},
+		{`{
+			"$schema": "https://json-schema.org/draft/2020-12/schema",
+			"$defs": { "str": { "type": "string" } },
+			"properties": { "a": { "$ref": "#/$defs/str", "maxLength": 1 } }
+		}`, Draft2020_12, `{ "a": "bc" }`, false},
+	}
+
+	for i, c := range cases {
+		rs := &Schema{}
+		if err := json.Unmarshal([]byte(c.schema), rs); err != nil {
+			t.Errorf("case %d unexpected error parsing schema: %s", i, err)
+			continue
+		}
+		if rs.Draft() != c.draft {
+			t.Errorf("case %d draft mismatch. expected: %s, got: %s", i, c.draft, rs.Draft())
+		}
+		errs, err := rs.ValidateBytes(ctx, []byte(c.data))
+		if err != nil {
+			t.Errorf("case %d unexpected error validating: %s", i, err)
+			continue
+		}
+		if (len(errs) == 0) != c.valid {
+			t.Errorf("case %d validity mismatch. expected valid: %t, got errors: %v", i, c.valid, errs)
+		}
+	}
+
+	rs := Must(`{ "$schema": "https://example.com/custom-meta-schema" }`)
+	state := rs.Validate(ctx, map[string]interface{}{})
+	annotations := state.Annotations()
+	if len(annotations) != 1 || annotations[0].Keyword != "$schema" {
+		t.Errorf("expected a single $schema warning annotation, got: %v", annotations)
+	}
+
+	sub := Must(`{
+		"$schema": "http://json-schema.org/draft-07/schema#",
+		"items": { "properties": { "foo": {} } }
+	}`).keywords["items"].(*Items).Schemas[0]
+	if sub.Draft() != Draft7 {
+		t.Errorf("expected subschema to inherit draft-07, got: %s", sub.Draft())
+	}
+
+	deep := Must(`{ "$schema": "http://json-schema.org/draft-07/schema#", ` + nestedItems(50, `{ "dependencies": { "a": ["b"] } }`) + ` }`)
+	errs, err := deep.ValidateBytes(ctx, []byte(strings.Repeat("[", 51)+`{ "a": 1 }`+strings.Repeat("]", 51)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 1 {
+		t.Errorf("expected deeply nested subschemas to inherit draft-07, got errors: %v", errs)
+	}
+
+	// tuples are declared with prefixItems in 2020-12, so the array form of items is an error
+	for _, schema := range []string{
+		`{ "$schema": "https://json-schema.org/draft/2020-12/schema", "items": [ { "type": "string" } ] }`,
+		`{ "$schema": "https://json-schema.org/draft/2020-12/schema", "properties": { "a": { "items": [ {} ] } } }`,
+	} {
+		if err := json.Unmarshal([]byte(schema), &Schema{}); err == nil {
+			t.Errorf("expected array form of items to be rejected under 2020-12: %s", schema)
+		}
+	}
+	if err := json.Unmarshal([]byte(`{ "$schema": "https://json-schema.org/draft/2019-09/schema", "items": [ {} ] }`), &Schema{}); err != nil {
+		t.Errorf("unexpected error parsing array form of items under 2019-09: %s", err)
+	}
+}
+
+// nestedItems returns an items keyword nesting leaf depth schemas down
+func nestedItems(depth int, leaf string) string {
+	return strings.Repeat(`"items": { `, depth) + `"items": ` + leaf + strings.Repeat(` }`, depth)
+}
+
+func TestDraft4Keywords(t *testing.T) {
+	ctx := context.Background()
+	cases := []struct {
+		schema, data string
+		valid        bool
+	}{
+		{`{ "minimum": 1, "exclusiveMinimum": true }`, `1`, false},
+		{`{ "minimum": 1, "exclusiveMinimum": true }`, `1.5`, true},
+		{`{ "minimum": 1, "exclusiveMinimum": true }`, `0`, false},
+		{`{ "minimum": 1, "exclusiveMinimum": false }`, `1`, true},
+		{`{ "maximum": 1, "exclusiveMaximum": true }`, `1`, false},
+		{`{ "maximum": 1, "exclusiveMaximum": true }`, `0.5`, true},
+		// without a minimum or maximum the booleans are ignored
+		{`{ "exclusiveMinimum": true, "exclusiveMaximum": true }`, `1`, true},
+		{`{ "items": { "maximum": 1, "exclusiveMaximum": true } }`, `[0, 1]`, false},
+		// $ref replaces its sibling keywords
+		{`{
+			"definitions": { "int": { "type": "integer" } },
+			"properties": { "a": { "$ref": "#/definitions/int", "maximum": 0 } }
+		}`, `{ "a": 1 }`, true},
+		{`{
+			"definitions": { "int": { "type": "integer" } },
+			"properties": { "a": { "$ref": "#/definitions/int", "maximum": 0 } }
+		}`, `{ "a": "b" }`, false},
+		// schemas are identified by id rather than $id
+		{`{
+			"id": "http://example.com/root.json",
+			"properties": { "a": { "$ref": "item.json" } },
+			"definitions": { "item": { "id": "item.json", "type": "string" } }
+		}`, `{ "a": 1 }`, false},
+		// keywords introduced after draft4 are unknown
+		{`{ "const": 1, "contains": { "const": 2 }, "if": false }`, `[3]`, true},
+	}
+
+	registry := NewKeywordRegistry()
+	registry.LoadDraft4()
+	for i, c := range cases {
+		detected := &Schema{}
+		if err := json.Unmarshal([]byte(`{"$schema": "http://json-schema.org/draft-04/schema#",`+c.schema[1:]), detected); err != nil {
+			t.Fatalf("case %d: unexpected error parsing schema: %s", i, err)
+		}
+		explicit, err := ParseSchema([]byte(c.schema), registry)
+		if err != nil {
+			t.Fatalf("case %d: unexpected error parsing schema: %s", i, err)
+		}
+		for name, rs := range map[string]*Schema{"detected": detected, "explicit": explicit} {
+			errs, err := rs.ValidateBytes(ctx, []byte(c.data))
+			if err != nil {
+				t.Fatalf("case %d %s: unexpected error validating: %s", i, name, err)
+			}
+			if (len(errs) == 0) != c.valid {
+				t.Errorf("case %d %s: expected valid to be %t, got errors: %v", i, name, c.valid, errs)
+			}
+		}
+	}
+
+	errs, err := Must(`{
+		"$schema": "http://json-schema.org/draft-04/schema#",
+		"minimum": 1, "exclusiveMinimum": true
+	}`).ValidateBytes(ctx, []byte(`1`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 1 || errs[0].Message != "1 must be greater than 1" || errs[0].Keyword != "exclusiveMinimum" {
+		t.Errorf("expected an exclusiveMinimum error, got: %v", errs)
+	}
+}
+
+func TestOutputUnit(t *testing.T) {
+	rs := Must(`{
+		"properties": {
+			"a": { "type": "string" },
+			"b": { "items": { "type": "integer" } },
+			"c": { "$ref": "#/$defs/c" }
+		},
+		"required": ["d"],
+		"$defs": { "c": { "minimum": 3 } }
+	}`)
+	var doc interface{}
+	if err := json.Unmarshal([]byte(`{ "a": 1, "b": [1, "x"], "c": 1 }`), &doc); err != nil {
+		t.Fatal(err)
+	}
+	state := rs.Validate(context.Background(), doc)
+
+	cases := []struct {
+		format string
+		expect string
+	}{
+		{OutputFlag, `{"valid":false,"keywordLocation":"","instanceLocation":""}`},
+		{OutputBasic, `{"valid":false,"keywordLocation":"","instanceLocation":"","errors":[` +
+			`{"valid":false,"keywordLocation":"/properties/a/type","instanceLocation":"/a","error":"type should be string, got integer"},` +
+			`{"valid":false,"keywordLocation":"/properties/b/items/type","instanceLocation":"/b/1","error":"type should be integer, got string"},` +
+			`{"valid":false,"keywordLocation":"/properties/c/$ref/minimum","instanceLocation":"/c","error":"must be greater than or equal to 3"},` +
+			`{"valid":false,"keywordLocation":"/required","instanceLocation":"","error":"\"d\" value is required"}]}`},
+		{OutputDetailed, `{"valid":false,"keywordLocation":"","instanceLocation":"","errors":[` +
+			`{"valid":false,"keywordLocation":"/properties","instanceLocation":"","errors":[` +
+			`{"valid":false,"keywordLocation":"/properties/a/type","instanceLocation":"/a","error":"type should be string, got integer"},` +
+			`{"valid":false,"keywordLocation":"/properties/b/items/type","instanceLocation":"/b/1","error":"type should be integer, got string"},` +
+			`{"valid":false,"keywordLocation":"/properties/c/$ref/minimum","instanceLocation":"/c","error":"must be greater than or equal to 3"}]},` +
+			`{"valid":false,"keywordLocation":"/required","instanceLocation":"","error":"\"d\" value is required"}]}`},
+		{OutputVerbose, `{"valid":false,"keywordLocation":"","instanceLocation":"","errors":[` +
+			`{"valid":false,"keywordLocation":"/properties","instanceLocation":"","errors":[` +
+			`{"valid":false,"keywordLocation":"/properties/a","instanceLocation":"/a","errors":[` +
+			`{"valid":false,"keywordLocation":"/properties/a/type","instanceLocation":"/a","error":"type should be string, got integer"}]},` +
+			`{"valid":false,"keywordLocation":"/properties/b","instanceLocation":"/b/1","errors":[` +
+			`{"valid":false,"keywordLocation":"/properties/b/items","instanceLocation":"/b/1","errors":[` +
+			`{"valid":false,"keywordLocation":"/properties/b/items/type","instanceLocation":"/b/1","error":"type should be integer, got string"}]}]},` +
+			`{"valid":false,"keywordLocation":"/properties/c","instanceLocation":"/c","errors":[` +
+			`{"valid":false,"keywordLocation":"/properties/c/$ref","instanceLocation":"/c","errors":[` +
+			`{"valid":false,"keywordLocation":"/properties/c/$ref/minimum","instanceLocation":"/c","error":"must be greater than or equal to 3"}]}]}]},` +
+			`{"valid":false,"keywordLocation":"/required","instanceLocation":"","error":"\"d\" value is required"}]}`},
+	}
+
+	for _, c := range cases {
+		unit, err := state.OutputUnit(c.format)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", c.format, err)
+			continue
+		}
+		// properties are evaluated in map order
+		sortOutputUnit(&unit)
+		got, err := json.Marshal(unit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != c.expect {
+			t.Errorf("%s output mismatch.\nexpected: %s\ngot:      %s", c.format, c.expect, got)
+		}
+	}
+
+	if _, err := state.OutputUnit("unknown"); err == nil {
+		t.Errorf("expected error for unknown output format")
+	}
+
+	valid := rs.Validate(context.Background(), map[string]interface{}{"d": true})
+	unit, err := valid.OutputUnit(OutputDetailed)
+	if err != nil || !unit.Valid || len(unit.Errors) != 0 {
+		t.Errorf("expected valid output without errors, got: %v %v", unit, err)
+	}
+}
+
+func TestAbsoluteKeywordLocation(t *testing.T) {
+	rs := Must(`{
+		"$id": "https://example.com/locations.json",
+		"properties": {
+			"a": { "$ref": "#/$defs/a" },
+			"b": { "$ref": "#named" },
+			"c": { "$ref": "item.json" },
+			"d": { "maxLength": 1 }
+		},
+		"$defs": {
+			"a": { "minimum": 3 },
+			"b": { "$anchor": "named", "type": "string" },
+			"c": { "$id": "item.json", "properties": { "x": { "type": "null" } } }
+		}
+	}`)
+	doc := map[string]interface{}{
+		"a": 1,
+		"b": 1,
+		"c": map[string]interface{}{"x": 1},
+		"d": "xx",
+	}
+
+	expect := map[string][2]string{
+		"/a":   {"/properties/a/$ref/minimum", "https://example.com/locations.json#/$defs/a/minimum"},
+		"/b":   {"/properties/b/$ref/type", "https://example.com/locations.json#/$defs/b/type"},
+		"/c/x": {"/properties/c/$ref/properties/x/type", "https://example.com/item.json#/properties/x/type"},
+		"/d":   {"/properties/d/maxLength", "https://example.com/locations.json#/properties/d/maxLength"},
+	}
+
+	errs := *rs.Validate(context.Background(), doc).Errs
+	if len(errs) != len(expect) {
+		t.Fatalf("expected %d errors, got: %v", len(expect), errs)
+	}
+	for _, err := range errs {
+		locations, ok := expect[err.PropertyPath]
+		if !ok {
+			t.Errorf("unexpected error: %s", err)
+			continue
+		}
+		if err.KeywordLocation != locations[0] {
+			t.Errorf("%s: expected keyword location %q, got %q", err.PropertyPath, locations[0], err.KeywordLocation)
+		}
+		if err.AbsoluteKeywordLocation != locations[1] {
+			t.Errorf("%s: expected absolute keyword location %q, got %q", err.PropertyPath, locations[1], err.AbsoluteKeywordLocation)
+		}
+	}
+
+	// schemas without a base URI have no absolute location
+	errs = *Must(`{ "minimum": 3 }`).Validate(context.Background(), 1).Errs
+	if len(errs) != 1 || errs[0].AbsoluteKeywordLocation != "" {
+		t.Errorf("expected a single error without an absolute location, got: %v", errs)
+	}
+}
+
+func TestMessageOverrides(t *testing.T) {
+	rs := Must(`{
+		"properties": {
+			"age": { "minimum": 18 },
+			"name": { "maxLength": 3 },
+			"tags": { "type": "array" }
+		}
+	}`)
+	opts := &ValidationOptions{
+		MessageOverrides: map[string]string{
+			"minimum":   "{path} must be at least {limit}, got {value}",
+			"maxLength": "{value} is longer than {limit} characters",
+		},
+	}
+	doc := map[string]interface{}{"age": 16, "name": "Alice", "tags": "x"}
+
+	expect := map[string]string{
+		"/age":  "/age must be at least 18, got 16",
+		"/name": "Alice is longer than 3 characters",
+		"/tags": "type should be array, got string",
+	}
+	errs := *rs.ValidateWithOptions(context.Background(), doc, opts).Errs
+	if len(errs) != len(expect) {
+		t.Fatalf("expected %d errors, got: %v", len(expect), errs)
+	}
+	for _, err := range errs {
+		if err.Message != expect[err.PropertyPath] {
+			t.Errorf("%s: expected message %q, got %q", err.PropertyPath, expect[err.PropertyPath], err.Message)
+		}
+	}
+
+	// without options the default messages are kept
+	errs = *rs.Validate(context.Background(), map[string]interface{}{"age": 16}).Errs
+	if len(errs) != 1 || errs[0].Message != "must be greater than or equal to 18" {
+		t.Errorf("expected default message, got: %v", errs)
+	}
+}
+
+func TestMaxKeywordErrStringLenOption(t *testing.T) {
+	ctx := context.Background()
+	rs := Must(`{ "properties": { "a": { "maxLength": 3 }, "b": { "const": "abcdefghijklmnopqrstuvwxyz" } } }`)
+	doc := map[string]interface{}{"a": "abcdefghijklmnopqrstuvwxyz"}
+	conDoc := map[string]interface{}{"b": "a"}
+
+	cases := []struct {
+		opts        *ValidationOptions
+		expect, con string
+	}{
+		{nil, `/a: "abcdefghijklmnopqrs... max length of 3 characters exceeded: abcdefghijklmnopqrstuvwxyz`, `/b: "a" must equal "abcdefghijklmnopqrs...`},
+		{&ValidationOptions{MaxKeywordErrStringLen: 5}, `/a: "abcd... max length of 3 characters exceeded: abcdefghijklmnopqrstuvwxyz`, `/b: "a" must equal "abcd...`},
+		{&ValidationOptions{MaxKeywordErrStringLen: -1}, `/a: "abcdefghijklmnopqrstuvwxyz" max length of 3 characters exceeded: abcdefghijklmnopqrstuvwxyz`, `/b: "a" must equal "abcdefghijklmnopqrstuvwxyz"`},
+	}
+	for i, c := range cases {
+		errs := *rs.ValidateWithOptions(ctx, doc, c.opts).Errs
+		if len(errs) != 1 || errs[0].Error() != c.expect {
+			t.Errorf("case %d: expected error %q, got: %v", i, c.expect, errs)
+		}
+		errs = *rs.ValidateWithOptions(ctx, conDoc, c.opts).Errs
+		if len(errs) != 1 || errs[0].Error() != c.con {
+			t.Errorf("case %d: expected error %q, got: %v", i, c.con, errs)
+		}
+	}
+
+	if got := InvalidValueStringN("abcdef", 3); got != `"ab...` {
+		t.Errorf("expected a truncated value, got: %s", got)
+	}
+}
+
+// frenchFormatter is an example ErrorFormatter translating messages to French
+type frenchFormatter struct{}
+
+func (frenchFormatter) Format(keyword string, e *KeyError) string {
+	switch keyword {
+	case "minimum":
+		return fmt.Sprintf("doit être supérieur ou égal à %v", e.Limit)
+	case "maxLength":
+		return fmt.Sprintf("ne doit pas dépasser %v caractères", e.Limit)
+	case "required":
+		return fmt.Sprintf("la propriété %q est obligatoire", e.Limit)
+	case "type":
+		return fmt.Sprintf("doit être de type %v", e.Limit)
+	}
+	return e.Message
+}
+
+func TestErrorFormatter(t *testing.T) {
+	schema := `{
+		"properties": {
+			"age": { "minimum": 18 },
+			"name": { "maxLength": 3 },
+			"tags": { "type": "array" },
+			"id": { "const": 1 }
+		},
+		"required": ["email"]
+	}`
+	doc := map[string]interface{}{"age": 16, "name": "Alice", "tags": "x", "id": 2}
+	french := map[string]string{
+		"/":     `la propriété "email" est obligatoire`,
+		"/age":  "doit être supérieur ou égal à 18",
+		"/name": "ne doit pas dépasser 3 caractères",
+		"/tags": "doit être de type array",
+		"/id":   "must equal 1",
+	}
+	english := map[string]string{
+		"/":     `"email" value is required`,
+		"/age":  "must be greater than or equal to 18",
+		"/name": "max length of 3 characters exceeded: Alice",
+		"/tags": "type should be array, got string",
+		"/id":   "must equal 1",
+	}
+
+	check := func(name string, errs []KeyError, expect map[string]string) {
+		t.Helper()
+		if len(errs) != len(expect) {
+			t.Fatalf("%s: expected %d errors, got: %v", name, len(expect), errs)
+		}
+		for _, err := range errs {
+			if err.Message != expect[err.PropertyPath] {
+				t.Errorf("%s: %s: expected message %q, got %q", name, err.PropertyPath, expect[err.PropertyPath], err.Message)
+			}
+		}
+	}
+
+	rs := Must(schema)
+	rs.SetErrorFormatter(frenchFormatter{})
+	check("schema formatter", *rs.Validate(context.Background(), doc).Errs, french)
+	check("default formatter", *Must(schema).Validate(context.Background(), doc).Errs, english)
+
+	SetErrorFormatter(frenchFormatter{})
+	defer SetErrorFormatter(nil)
+	check("global formatter", *Must(schema).Validate(context.Background(), doc).Errs, french)
+
+	// message overrides take precedence over the formatter
+	opts := &ValidationOptions{MessageOverrides: map[string]string{"minimum": "trop jeune"}}
+	errs := *Must(schema).ValidateWithOptions(context.Background(), doc, opts).Errs
+	for _, err := range errs {
+		if err.PropertyPath == "/age" && err.Message != "trop jeune" {
+			t.Errorf("expected override to take precedence, got: %q", err.Message)
+		}
+	}
+}
+
+func TestValidationStateClone(t *testing.T) {
+	parent := NewValidationState(Must(`{}`))
+	child := parent.Clone()
+	child.AddError("a", "branch error")
+	child.AddAnnotation("format", "email", "value has format email")
+	child.SetEvaluatedKey("a")
+	child.SetEvaluatedIndex(2)
+	if len(*parent.Errs) != 0 || len(parent.Annotations()) != 0 || parent.IsEvaluatedKey("a") || parent.IsEvaluatedIndex(2) {
+		t.Fatal("expected a cloned state to be isolated from its parent")
+	}
+
+	parent.Merge(child)
+	if len(*parent.Errs) != 0 {
+		t.Errorf("expected merge to leave the branch errors to the caller, got: %v", *parent.Errs)
+	}
+	if len(parent.Annotations()) != 1 {
+		t.Errorf("expected merge to fold in the branch annotations, got: %v", parent.Annotations())
+	}
+	if !parent.IsEvaluatedKey("a") || !parent.IsEvaluatedIndex(2) {
+		t.Error("expected merge to fold in the evaluated properties and items")
+	}
+
+	// only the annotations of passing branches are kept
+	state := Must(`{"anyOf": [
+		{ "deprecated": true, "type": "string" },
+		{ "format": "email" }
+	]}`).Validate(context.Background(), 1.0)
+	if len(*state.Errs) != 0 {
+		t.Fatal(*state.Errs)
+	}
+	annotations := state.Annotations()
+	if len(annotations) != 1 || annotations[0].Keyword != "format" {
+		t.Errorf("expected only the annotations of the passing anyOf branch, got: %v", annotations)
+	}
+}
+
+func TestFailFast(t *testing.T) {
+	rs := Must(`{
+		"allOf": [
+			{ "properties": { "a": { "type": "string" }, "b": { "type": "string" } } },
+			{ "required": ["c"] }
+		],
+		"items": { "type": "string" }
+	}`)
+	ctx := context.Background()
+	doc := map[string]interface{}{"a": 1, "b": 2}
+
+	if errs := *rs.Validate(ctx, doc).Errs; len(errs) != 3 {
+		t.Errorf("expected all 3 errors by default, got: %v", errs)
+	}
+	if errs := *rs.ValidateWithOptions(ctx, doc, &ValidationOptions{FailFast: true}).Errs; len(errs) != 1 {
+		t.Errorf("expected a single error in fail-fast mode, got: %v", errs)
+	}
+
+	if errs := *rs.ValidateWithOptions(ctx, []interface{}{1, 2, 3}, &ValidationOptions{FailFast: true}).Errs; len(errs) != 1 {
+		t.Errorf("expected a single error in fail-fast mode, got: %v", errs)
+	}
+
+	if rs.IsValid(ctx, doc) {
+		t.Errorf("expected document to be invalid")
+	}
+	if !rs.IsValid(ctx, map[string]interface{}{"a": "1", "b": "2", "c": 3}) {
+		t.Errorf("expected document to be valid")
+	}
+}
+
+func TestParseSchema(t *testing.T) {
+	ctx := context.Background()
+	registry := NewKeywordRegistry()
+	registry.LoadDraft2019_09()
+	registry.RegisterKeyword("x-scoped-foo", newIsFoo)
+
+	data := []byte(`{
+		"type": "object",
+		"properties": {
+			"a": { "x-scoped-foo": true },
+			"b": { "items": { "x-scoped-foo": true } }
+		}
+	}`)
+	rs, err := ParseSchema(data, registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kr.IsRegisteredKeyword("x-scoped-foo") {
+		t.Errorf("expected the scoped keyword to stay out of the global registry")
+	}
+
+	errs, err := rs.ValidateBytes(ctx, []byte(`{ "a": "bar", "b": ["foo", "baz"] }`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 2 {
+		t.Errorf("expected 2 errors from the scoped keyword, got: %v", errs)
+	}
+
+	global := &Schema{}
+	if err := json.Unmarshal(data, global); err != nil {
+		t.Fatal(err)
+	}
+	errs, err = global.ValidateBytes(ctx, []byte(`{ "a": "bar", "b": ["foo", "baz"] }`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 0 {
+		t.Errorf("expected the globally parsed schema to ignore the scoped keyword, got: %v", errs)
+	}
+
+	if _, err := ParseSchema([]byte(`{ "pattern": "[a" }`), registry); err == nil {
+		t.Errorf("expected an error parsing an invalid schema")
+	}
+}
+
+func TestStrictKeywords(t *testing.T) {
+	cases := []struct {
+		schema  string
+		unknown []string
+	}{
+		{`{ "type": "object", "properties": { "age": { "minimum": 0 } } }`, []string{}},
+		{`{ "properties": { "age": { "minimun": 3, "maximum": 10 } }, "requird": ["age"] }`, []string{"/requird", "/properties/age/minimun"}},
+		{`{ "x-internal": true, "example": 1, "items": { "x-owner": "a", "maxItem": 1 } }`, []string{"/items/maxItem"}},
+		{`{ "$schema": "https://json-schema.org/draft/2020-12/schema", "prefixItems": [ { "minContain": 1 } ] }`, []string{"/prefixItems/0/minContain"}},
+		{`{ "$schema": "http://json-schema.org/draft-04/schema#", "properties": { "a": { "const": 1, "maximum": 2 } } }`, []string{"/properties/a/const"}},
+		{`true`, []string{}},
+	}
+	for i, c := range cases {
+		if got := Must(c.schema).UnknownKeywords(); !reflect.DeepEqual(got, c.unknown) {
+			t.Errorf("case %d: unknown keywords mismatch. expected: %v, got: %v", i, c.unknown, got)
+		}
+	}
+
+	defer func() { StrictKeywords = false }()
+	StrictKeywords = true
+	typo := []byte(`{ "properties": { "age": { "minimun": 3 } } }`)
+	_, err := ParseSchema(typo, nil)
+	var unknownErr *UnknownKeywordsError
+	if !errors.As(err, &unknownErr) || !reflect.DeepEqual(unknownErr.Keywords, []string{"/properties/age/minimun"}) {
+		t.Errorf("expected an UnknownKeywordsError, got: %v", err)
+	}
+	if _, err := NewSchemaCache(0).Parse(typo); !errors.As(err, &unknownErr) {
+		t.Errorf("expected the cache to reject unknown keywords, got: %v", err)
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("expected Must to panic on unknown keywords")
+			}
+		}()
+		Must(string(typo))
+	}()
+
+	// keywords of a scoped registry are known to the subschemas using them
+	registry := NewKeywordRegistry()
+	registry.LoadDraft2019_09()
+	registry.RegisterKeyword("scopedFoo", newIsFoo)
+	if _, err := ParseSchema([]byte(`{ "properties": { "a": { "scopedFoo": true } } }`), registry); err != nil {
+		t.Errorf("expected scoped keywords to be known, got: %v", err)
+	}
+}
+
+func TestSchemaCache(t *testing.T) {
+	cache := NewSchemaCache(2)
+	a := []byte(`{ "type": "string" }`)
+	b := []byte(`{ "type": "number" }`)
+	c := []byte(`{ "type": "object" }`)
+
+	first, err := cache.Parse(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := cache.Parse(append([]byte(nil), a...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Errorf("expected identical documents to share a parsed schema")
+	}
+	if _, err := cache.Parse([]byte(`{ "type": `)); err == nil {
+		t.Errorf("expected an error parsing invalid JSON")
+	}
+	if cache.Len() != 1 {
+		t.Errorf("expected 1 cached schema, got: %d", cache.Len())
+	}
+
+	// c evicts b, the least recently used schema
+	for _, data := range [][]byte{b, a, c} {
+		if _, err := cache.Parse(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if cache.Len() != 2 {
+		t.Errorf("expected 2 cached schemas, got: %d", cache.Len())
+	}
+	if again, _ := cache.Parse(a); again != first {
+		t.Errorf("expected the recently used schema to stay cached")
+	}
+
+	cache.SetMaxEntries(1)
+	if cache.Len() != 1 {
+		t.Errorf("expected 1 cached schema after shrinking, got: %d", cache.Len())
+	}
+	cache.Purge()
+	if cache.Len() != 0 {
+		t.Errorf("expected an empty cache after purging, got: %d", cache.Len())
+	}
+	if again, _ := cache.Parse(a); again == first {
+		t.Errorf("expected a purged document to be parsed again")
+	}
+
+	rs, err := ParseCached(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached, _ := ParseCached(a); cached != rs {
+		t.Errorf("expected ParseCached to use the global cache")
+	}
+}
+
+func TestCachedValidator(t *testing.T) {
+	ctx := context.Background()
+	v := NewCachedValidator(Must(`{ "properties": { "a": { "type": "string" } } }`), nil, 2)
+	a := []byte(`{"a": 1}`)
+	b := []byte(`{"a": "b"}`)
+	c := []byte(`{"a": true}`)
+
+	first, err := v.ValidateBytes(ctx, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 1 {
+		t.Fatalf("expected 1 error, got: %v", first)
+	}
+	first[0].Message = "changed"
+
+	// a cached result is returned without validating again, so even a
+	// cancelled context doesn't abort it
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	second, err := v.ValidateBytes(cancelled, append([]byte(nil), a...))
+	if err != nil {
+		t.Fatalf("expected the cached result, got error: %s", err)
+	}
+	if len(second) != 1 || second[0].Message != "type should be string, got integer" {
+		t.Errorf("expected the cached errors to be unchanged by callers, got: %v", second)
+	}
+	if _, err := v.ValidateBytes(cancelled, b); err == nil {
+		t.Errorf("expected an uncached validation to be aborted by the context")
+	}
+	if _, err := v.ValidateBytes(ctx, []byte(`{"a": `)); err == nil {
+		t.Errorf("expected an error validating invalid JSON")
+	}
+	if v.Len() != 1 {
+		t.Errorf("expected 1 cached result, got: %d", v.Len())
+	}
+
+	// c evicts b, the least recently validated document
+	for _, data := range [][]byte{b, a, c} {
+		if _, err := v.ValidateBytes(ctx, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if v.Len() != 2 {
+		t.Errorf("expected 2 cached results, got: %d", v.Len())
+	}
+	if _, err := v.ValidateBytes(cancelled, b); err == nil {
+		t.Errorf("expected the evicted document to be validated again")
+	}
+	if errs, err := v.ValidateBytes(cancelled, a); err != nil || len(errs) != 1 {
+		t.Errorf("expected the recently validated document to stay cached, got: %v, %v", errs, err)
+	}
+
+	v.Purge()
+	if v.Len() != 0 {
+		t.Errorf("expected no cached results after purging, got: %d", v.Len())
+	}
+}
+
+func TestCompile(t *testing.T) {
+	ctx := context.Background()
+	rs := Must(`{
+		"$defs": {
+			"node": {
+				"type": "object",
+				"properties": {
+					"value": { "type": "integer" },
+					"children": { "type": "array", "items": { "$ref": "#/$defs/node" } }
+				}
+			}
+		},
+		"$ref": "#/$defs/node"
+	}`)
+	compiled, err := rs.Compile(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error compiling schema: %s", err)
+	}
+	if compiled.Schema() != rs {
+		t.Errorf("expected compiled schema to wrap the original schema")
+	}
+
+	cases := []struct {
+		doc   string
+		valid bool
+	}{
+		{`{ "value": 1, "children": [ { "value": 2, "children": [] } ] }`, true},
+		{`{ "value": 1, "children": [ { "value": "2" } ] }`, false},
+	}
+	for i, c := range cases {
+		errs, err := compiled.ValidateBytes(ctx, []byte(c.doc))
+		if err != nil {
+			t.Errorf("case %d error validating: %s", i, err)
+			continue
+		}
+		if (len(errs) == 0) != c.valid {
+			t.Errorf("case %d validity mismatch. expected: %t, got errors: %v", i, c.valid, errs)
+		}
+	}
+
+	_, err = Must(`{ "properties": { "a": { "$ref": "#/$defs/missing" } } }`).Compile(ctx)
+	if err == nil || err.Error() != "failed to resolve schema for ref #/$defs/missing" {
+		t.Errorf("expected unresolvable ref error, got: %v", err)
+	}
+
+	// compiled schemas must behave like the schemas they were compiled from
+	for _, path := range []string{
+		"testdata/draft2019-09/anchor.json",
+		"testdata/draft2019-09/unevaluatedProperties.json",
+		"testdata/draft2020-12/dynamicRef.json",
+	} {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testSets := []*TestSet{}
+		if err := json.Unmarshal(data, &testSets); err != nil {
+			t.Fatal(err)
+		}
+		for _, ts := range testSets {
+			compiled, err := ts.Schema.Compile(ctx)
+			if err != nil {
+				t.Errorf("%s: %s: unexpected error compiling schema: %s", path, ts.Description, err)
+				continue
+			}
+			for i, c := range ts.Tests {
+				if state := compiled.Validate(ctx, c.Data); state.IsValid() != c.Valid {
+					t.Errorf("%s: %s test case %d: %s. error: %s", path, ts.Description, i, c.Description, *state.Errs)
+				}
+			}
+		}
+	}
+}
+
+// blockingLoader serves remote schemas from memory, preparing another
+// schema before returning each one
+type blockingLoader struct {
+	schemas map[string]string
+	other   *Schema
+}
+
+func (l *blockingLoader) Load(ctx context.Context, uri string) ([]byte, error) {
+	schema, ok := l.schemas[uri]
+	if !ok {
+		return nil, fmt.Errorf("unknown schema %s", uri)
+	}
+	done := make(chan struct{})
+	go func() {
+		l.other.Validate(ctx, 1)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		return nil, fmt.Errorf("preparing another schema blocked while fetching %s", uri)
+	}
+	return []byte(schema), nil
+}
+
+func TestCompileRemote(t *testing.T) {
+	ctx := context.Background()
+	registry := NewSchemaRegistry()
+	defer SetSchemaRegistry(SetSchemaRegistry(registry))
+	registry.SetLoader(&blockingLoader{
+		schemas: map[string]string{
+			"https://example.com/a.json": `{ "properties": { "b": { "$ref": "b.json" } } }`,
+			"https://example.com/b.json": `{ "type": "integer" }`,
+		},
+		other: Must(`{ "type": "integer" }`),
+	})
+
+	rs := Must(`{ "$id": "https://example.com/root.json", "$ref": "a.json" }`)
+	compiled, err := rs.Compile(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error compiling schema: %s", err)
+	}
+	if atomic.LoadUint32(&rs.prepared) != 1 {
+		t.Errorf("expected compiled schema to be prepared")
+	}
+	errs, err := compiled.ValidateBytes(ctx, []byte(`{ "b": "1" }`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 1 {
+		t.Errorf("expected remote schemas to be resolved, got errors: %v", errs)
+	}
+
+	_, err = Must(`{ "$id": "https://example.com/other.json", "$ref": "missing.json" }`).Compile(ctx)
+	if err == nil || err.Error() != "failed to resolve schema for ref missing.json" {
+		t.Errorf("expected unresolvable ref error, got: %v", err)
+	}
+}
+
+func TestCompileRefCycle(t *testing.T) {
+	ctx := context.Background()
+	cases := []struct {
+		schema string
+		err    string
+	}{
+		{`{
+			"$ref": "#/$defs/a",
+			"$defs": {
+				"a": { "$ref": "#/$defs/b" },
+				"b": { "$ref": "#/$defs/a" }
+			}
+		}`, "infinite $ref cycle: #/$defs/a -> #/$defs/b -> #/$defs/a"},
+		{`{
+			"$ref": "#/$defs/a",
+			"$defs": {
+				"a": { "allOf": [ { "$ref": "#" } ] }
+			}
+		}`, "infinite $ref cycle: # -> #/$defs/a -> #/$defs/a/allOf/0 -> #"},
+		{`{
+			"properties": {
+				"b": { "$ref": "#/$defs/b" }
+			},
+			"$defs": {
+				"b": { "if": { "$ref": "#/$defs/b" } }
+			}
+		}`, "infinite $ref cycle: #/$defs/b -> #/$defs/b/if -> #/$defs/b"},
+		// recursion through a keyword that descends into the instance is allowed
+		{`{ "properties": { "next": { "$ref": "#" } } }`, ""},
+		{`{
+			"$ref": "#/$defs/a",
+			"$defs": {
+				"a": { "items": { "$ref": "#/$defs/b" } },
+				"b": { "anyOf": [ { "$ref": "#/$defs/a" } ] }
+			}
+		}`, ""},
+	}
+
+	for i, c := range cases {
+		_, err := Must(c.schema).Compile(ctx)
+		if c.err == "" && err != nil {
+			t.Errorf("case %d: unexpected error: %s", i, err)
+		} else if c.err != "" && (err == nil || err.Error() != c.err) {
+			t.Errorf("case %d: expected error %q, got: %v", i, c.err, err)
+		}
+	}
+}
+
+func TestAnchors(t *testing.T) {
+	ctx := context.Background()
+	rs := Must(`{
+		"$id": "https://example.com/tree",
+		"properties": {
+			"root": { "$ref": "#node" },
+			"leaf": { "$ref": "https://example.com/leaf#node" }
+		},
+		"$defs": {
+			"node": { "$anchor": "node", "type": "object" },
+			"leaf": {
+				"$id": "https://example.com/leaf",
+				"$defs": { "node": { "$anchor": "node", "type": "string" } }
+			}
+		}
+	}`)
+	if _, err := rs.Compile(ctx); err != nil {
+		t.Fatalf("expected the same anchor in separate schema resources to compile, got: %s", err)
+	}
+	errs, err := rs.ValidateBytes(ctx, []byte(`{"root": {}, "leaf": "x"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 0 {
+		t.Errorf("expected anchors to resolve within their schema resource, got: %v", errs)
+	}
+	errs, err = rs.ValidateBytes(ctx, []byte(`{"root": "x", "leaf": {}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 2 {
+		t.Errorf("expected 2 errors, got: %v", errs)
+	}
+
+	dup := Must(`{
+		"$id": "https://example.com/dup",
+		"$ref": "#node",
+		"$defs": {
+			"a": { "$anchor": "node" },
+			"b": { "$anchor": "node" }
+		}
+	}`)
+	expect := `duplicate anchor "node" in schema resource "https://example.com/dup"`
+	if _, err := dup.Compile(ctx); err == nil || err.Error() != expect {
+		t.Errorf("expected error %q, got: %v", expect, err)
+	}
+	errs, err = dup.ValidateBytes(ctx, []byte(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 1 || errs[0].Message != `duplicate anchor "node" in schema resource` {
+		t.Errorf("expected a duplicate anchor error, got: %v", errs)
+	}
+}
+
+func TestIDRebasing(t *testing.T) {
+	ctx := context.Background()
+	rs := Must(`{
+		"$id": "https://example.com/rebase/root.json",
+		"properties": {
+			"nested": { "$ref": "nested/schema.json" },
+			"lexical": {
+				"$id": "a/",
+				"properties": {
+					"b": { "$id": "b/", "properties": { "x": { "$ref": "leaf.json" } } }
+				}
+			},
+			"root": { "$ref": "leaf.json" }
+		},
+		"$defs": {
+			"nested": {
+				"$id": "nested/schema.json",
+				"$ref": "leaf.json"
+			},
+			"nestedLeaf": { "$id": "nested/leaf.json", "type": "string" },
+			"lexicalLeaf": { "$id": "a/b/leaf.json", "type": "boolean" },
+			"rootLeaf": { "$id": "leaf.json", "type": "number" }
+		}
+	}`)
+
+	cases := []struct {
+		data   string
+		errors []string
+	}{
+		{`{"nested": "a", "lexical": {"b": {"x": true}}, "root": 1}`, nil},
+		{`{"nested": 1}`, []string{`/nested: 1 type should be string, got integer`}},
+		{`{"lexical": {"b": {"x": 1}}}`, []string{`/lexical/b/x: 1 type should be boolean, got integer`}},
+		{`{"root": "a"}`, []string{`/root: "a" type should be number, got string`}},
+	}
+	for i, c := range cases {
+		errs, err := rs.ValidateBytes(ctx, []byte(c.data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(errs) != len(c.errors) {
+			t.Errorf("case %d: expected %d errors, got: %v", i, len(c.errors), errs)
+			continue
+		}
+		for j, e := range errs {
+			if e.Error() != c.errors[j] {
+				t.Errorf("case %d: error %d mismatch. expected: '%s', got: '%s'", i, j, c.errors[j], e.Error())
+			}
+		}
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	ctx := context.Background()
+	rs := Must(`{ "type": "array", "items": { "$ref": "#" } }`)
+
+	var doc interface{} = []interface{}{}
+	for i := 0; i < 50; i++ {
+		doc = []interface{}{doc, []interface{}{}}
+	}
+
+	if errs := *rs.Validate(ctx, doc).Errs; len(errs) != 0 {
+		t.Errorf("expected nested document to be valid by default, got: %v", errs)
+	}
+	errs := *rs.ValidateWithOptions(ctx, doc, &ValidationOptions{MaxDepth: 20}).Errs
+	if len(errs) == 0 {
+		t.Fatalf("expected nested document to exceed the maximum depth")
+	}
+	for _, err := range errs {
+		if err.Message != "maximum validation depth of 20 exceeded" {
+			t.Errorf("unexpected error: %s", err)
+		}
+	}
+	if !rs.ValidateWithOptions(ctx, doc, &ValidationOptions{MaxDepth: 102}).IsValid() {
+		t.Errorf("expected nested document to be within the maximum depth")
+	}
+
+	// a pure reference cycle reports an error instead of overflowing the stack
+	cyclic := Must(`{ "$defs": { "a": { "$ref": "#" } }, "$ref": "#/$defs/a" }`)
+	errs = *cyclic.ValidateWithOptions(ctx, "foo", &ValidationOptions{MaxDepth: 100}).Errs
+	if len(errs) != 1 || errs[0].Message != "maximum validation depth of 100 exceeded" {
+		t.Errorf("expected a single depth error, got: %v", errs)
+	}
+}
+
+func sortOutputUnit(u *OutputUnit) {
+	sort.Slice(u.Errors, func(i, j int) bool {
+		return u.Errors[i].KeywordLocation < u.Errors[j].KeywordLocation
+	})
+	for i := range u.Errors {
+		sortOutputUnit(&u.Errors[i])
+	}
+}
+
+func TestVocabulary(t *testing.T) {
+	cases := []struct {
+		schema string
+		err    string
+	}{
+		{`{ "$vocabulary": { "https://json-schema.org/draft/2019-09/vocab/core": true } }`, ""},
+		{`{ "$vocabulary": { "https://example.com/vocab/unknown": false } }`, ""},
+		{`{ "$vocabulary": { "https://example.com/vocab/unknown": true } }`,
+			`error unmarshaling $vocabulary from json: /$vocabulary: "https://example.com... required vocabulary is not supported`},
+		{`{ "$vocabulary": { "urn:c": true, "urn:b": true, "urn:a": true, "https://json-schema.org/draft/2019-09/vocab/core": true } }`,
+			`error unmarshaling $vocabulary from json: /$vocabulary: "urn:a" required vocabulary is not supported`},
+	}
+
+	for i, c := range cases {
+		for j := 0; j < 10; j++ {
+			rs := &Schema{}
+			err := rs.UnmarshalJSON([]byte(c.schema))
+			if c.err == "" && err != nil {
+				t.Errorf("case %d unexpected error: %s", i, err)
+			} else if c.err != "" && (err == nil || err.Error() != c.err) {
+				t.Errorf("case %d error mismatch. expected: %q, got: %v", i, c.err, err)
+			}
+		}
+	}
+
+	RegisterVocabulary("https://example.com/vocab/custom")
+	rs := &Schema{}
+	if err := rs.UnmarshalJSON([]byte(`{ "$vocabulary": { "https://example.com/vocab/custom": true } }`)); err != nil {
+		t.Errorf("expected registered vocabulary to be supported, got: %s", err)
+	}
+}
+
+func TestDependentKeywords(t *testing.T) {
+	ctx := context.Background()
+	cases := []struct {
+		schema string
+		input  string
+		errors []string
+	}{
+		{`{
+			"properties": {
+				"billing": {
+					"dependentRequired": { "card": ["address", "name"] }
+				}
+			}
+		}`,
+			`{ "billing": { "card": "1234", "name": null } }`,
+			[]string{
+				`/billing/address: {"card":"1234","name... "address" property is required by "card"`,
+			}},
+		{`{
+			"$defs": { "billing": { "required": ["address"] } },
+			"dependentSchemas": { "card": { "$ref": "#/$defs/billing" } }
+		}`,
+			`{ "card": "1234" }`,
+			[]string{
+				`/: {"card":"1234"} "address" value is required`,
+			}},
+		{`{
+			"dependentSchemas": { "card": { "required": ["address"] } },
+			"properties": { "other": { "$ref": "#/dependentSchemas/card" } }
+		}`,
+			`{ "other": {} }`,
+			[]string{
+				`/other: {} "address" value is required`,
+			}},
+	}
+
+	for i, c := range cases {
+		rs := &Schema{}
+		if err := rs.UnmarshalJSON([]byte(c.schema)); err != nil {
+			t.Errorf("case %d error parsing %s", i, err.Error())
+			continue
+		}
+
+		errors, err := rs.ValidateBytes(ctx, []byte(c.input))
+		if err != nil {
+			t.Errorf("case %d error validating: %s", i, err.Error())
+			continue
+		}
+
+		if len(errors) != len(c.errors) {
+			t.Errorf("case %d: error length mismatch. expected: '%d', got: '%d'", i, len(c.errors), len(errors))
+			t.Errorf("%v", errors)
+			continue
+		}
+
+		for j, e := range errors {
+			if e.Error() != c.errors[j] {
+				t.Errorf("case %d: validation error %d mismatch. expected: '%s', got: '%s'", i, j, c.errors[j], e.Error())
+				continue
+			}
+		}
+	}
+}
+
+func BenchmarkParseNestedDraft(b *testing.B) {
+	data := []byte(`{ "$schema": "http://json-schema.org/draft-07/schema#", ` + nestedItems(100, `{}`) + ` }`)
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseSchema(data, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAdditionalItems(b *testing.B) {
+	runBenchmark(b,
+		func(sampleSize int) (string, interface{}) {
+			data := make([]interface{}, sampleSize)
+			for i := 0; i < sampleSize; i++ {
+				data[i] = float64(i)
+			}
+			return `{
+				"items": {},
+				"additionalItems": false
+			}`, data
+		},
+	)
+}
+
+func BenchmarkAdditionalProperties(b *testing.B) {
+	runBenchmark(b,
+		func(sampleSize int) (string, interface{}) {
+			data := make(map[string]interface{}, sampleSize)
+			for i := 0; i < sampleSize; i++ {
+				p := fmt.Sprintf("p%v", i)
+				data[p] = struct{}{}
+			}
+			d, err := json.Marshal(data)
+			if err != nil {
+				b.Errorf("unable to marshal data: %v", err)
+				return "", nil
+			}
+			return `{
+				"properties": ` + string(d) + `,
+				"additionalProperties": false
+			}`, data
+		},
+	)
+}
+
+func BenchmarkConst(b *testing.B) {
+	runBenchmark(b,
+		func(sampleSize int) (string, interface{}) {
+			data := make(map[string]interface{}, sampleSize)
+			for i := 0; i < sampleSize; i++ {
+				data[fmt.Sprintf("p%v", i)] = fmt.Sprintf("p%v", 2*i)
+			}
+			d, err := json.Marshal(data)
+			if err != nil {
+				b.Errorf("unable to marshal data: %v", err)
+				return "", nil
+			}
+			return `{
+				"const": ` + string(d) + `
+			}`, data
+		},
+	)
+}
+
 func BenchmarkContains(b *testing.B) {
 	runBenchmark(b,
 		func(sampleSize int) (string, interface{}) {
@@ -824,6 +3522,29 @@ func BenchmarkEnum(b *testing.B) {
 	)
 }
 
+func BenchmarkEnumLargeStrings(b *testing.B) {
+	values := make([]string, 5000)
+	for i := range values {
+		values[i] = fmt.Sprintf("value-%d", i)
+	}
+	d, err := json.Marshal(values)
+	if err != nil {
+		b.Fatal(err)
+	}
+	rs := Must(`{ "enum": ` + string(d) + ` }`)
+	ctx := context.Background()
+	currentState := NewValidationState(rs)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		currentState.ClearState()
+		rs.ValidateKeyword(ctx, currentState, values[len(values)-1])
+	}
+	b.StopTimer()
+	if !currentState.IsValid() {
+		b.Errorf("error running benchmark: %s", *currentState.Errs)
+	}
+}
+
 func BenchmarkMaximum(b *testing.B) {
 	runBenchmark(b, func(sampleSize int) (string, interface{}) {
 		return `{
@@ -964,6 +3685,20 @@ func BenchmarkPattern(b *testing.B) {
 	)
 }
 
+func BenchmarkPatternProperties(b *testing.B) {
+	runBenchmark(b,
+		func(sampleSize int) (string, interface{}) {
+			data := make(map[string]interface{}, sampleSize)
+			for i := 0; i < sampleSize; i++ {
+				data[fmt.Sprintf("p%v", i)] = fmt.Sprintf("p%v", i)
+			}
+			return `{
+				"patternProperties": { "^p[0-9]+$": { "pattern": "^p" } }
+			}`, data
+		},
+	)
+}
+
 func BenchmarkType(b *testing.B) {
 	runBenchmark(b,
 		func(sampleSize int) (string, interface{}) {
@@ -1007,6 +3742,92 @@ func BenchmarkType(b *testing.B) {
 	)
 }
 
+func BenchmarkValidateObject(b *testing.B) {
+	runValidateBenchmark(b, `{
+		"type": "object",
+		"properties": {
+			"name": { "type": "string", "minLength": 1 },
+			"age": { "type": "integer", "minimum": 0 },
+			"email": { "type": "string", "pattern": "@" },
+			"address": {
+				"type": "object",
+				"properties": {
+					"street": { "type": "string" },
+					"city": { "type": "string" }
+				},
+				"required": ["street", "city"]
+			}
+		},
+		"required": ["name", "age"],
+		"additionalProperties": false
+	}`, `{
+		"name": "Rosalind",
+		"age": 37,
+		"email": "rosalind@example.com",
+		"address": { "street": "12 Kings Parade", "city": "Cambridge" }
+	}`)
+}
+
+func BenchmarkValidateArray(b *testing.B) {
+	runValidateBenchmark(b, `{
+		"type": "array",
+		"items": { "type": "number", "minimum": 0 },
+		"minItems": 1,
+		"uniqueItems": true,
+		"contains": { "const": 3 }
+	}`, `[1, 2, 3, 4, 5, 6, 7, 8, 9, 10]`)
+}
+
+func BenchmarkValidateRef(b *testing.B) {
+	runValidateBenchmark(b, `{
+		"$defs": {
+			"node": {
+				"type": "object",
+				"properties": {
+					"value": { "type": "integer" },
+					"children": { "type": "array", "items": { "$ref": "#/$defs/node" } }
+				}
+			}
+		},
+		"$ref": "#/$defs/node"
+	}`, `{
+		"value": 1,
+		"children": [
+			{ "value": 2, "children": [{ "value": 3 }, { "value": 4 }] },
+			{ "value": 5 }
+		]
+	}`)
+}
+
+// runValidateBenchmark measures validating a document against a schema
+// through Schema.ValidateDecoded, reporting allocations
+func BenchmarkValidateScalar(b *testing.B) {
+	runValidateBenchmark(b, `{ "type": "string", "maxLength": 10, "pattern": "^[a-z]+$" }`, `"hello"`)
+}
+
+func runValidateBenchmark(b *testing.B, schema, doc string) {
+	ctx := context.Background()
+	rs := &Schema{}
+	if err := json.Unmarshal([]byte(schema), rs); err != nil {
+		b.Fatalf("error parsing schema: %s", err)
+	}
+	var data interface{}
+	if err := json.Unmarshal([]byte(doc), &data); err != nil {
+		b.Fatalf("error parsing document: %s", err)
+	}
+	if state := rs.Validate(ctx, data); !state.IsValid() {
+		b.Fatalf("document is invalid: %v", *state.Errs)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := rs.ValidateDecoded(ctx, data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 func runBenchmark(b *testing.B, dataFn func(sampleSize int) (string, interface{})) {
 	ctx := context.Background()
 	for _, sampleSize := range []int{1, 10, 100, 1000} {
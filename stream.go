@@ -0,0 +1,123 @@
+package jsonschema
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+)
+
+// streamableKeywords lists the keywords of a root array schema that
+// can be checked while decoding one element at a time
+var streamableKeywords = map[string]bool{
+	"$schema":     true,
+	"$id":         true,
+	"$comment":    true,
+	"$defs":       true,
+	"definitions": true,
+	"title":       true,
+	"description": true,
+	"default":     true,
+	"examples":    true,
+	"deprecated":  true,
+	"readOnly":    true,
+	"writeOnly":   true,
+	"type":        true,
+	"items":       true,
+}
+
+// ValidateStream performs schema validation against JSON read from r. When
+// the schema is an array schema validating its elements with a single items
+// subschema, elements are decoded and validated one at a time, without
+// holding the whole array in memory. Otherwise the document is read
+// in full and validated like ValidateBytes
+func (s *Schema) ValidateStream(ctx context.Context, r io.Reader) ([]KeyError, error) {
+	ctx = backgroundIfNil(ctx)
+	br := bufio.NewReader(r)
+	items, ok := s.streamItems()
+	if ok {
+		ok = peekArray(br)
+	}
+	if !ok {
+		data, err := ioutil.ReadAll(br)
+		if err != nil {
+			return nil, fmt.Errorf("error reading JSON: %w", err)
+		}
+		return s.ValidateBytes(ctx, data)
+	}
+
+	s.prepare(ctx)
+	currentState := NewValidationState(s)
+	s.enterState(currentState)
+	if currentState.pushDynamicScope(s) {
+		defer currentState.popDynamicScope()
+	}
+	currentState.setKeyword("items")
+	subState := currentState.NewSubState()
+	subState.DescendBase("items")
+	subState.DescendRelative("items")
+
+	dec := json.NewDecoder(br)
+	if _, err := dec.Token(); err != nil {
+		return nil, fmt.Errorf("error parsing JSON stream: %w", err)
+	}
+	for i := 0; dec.More(); i++ {
+		if err := ctx.Err(); err != nil {
+			return *currentState.Errs, fmt.Errorf("validation aborted: %w", err)
+		}
+		var elem interface{}
+		if err := dec.Decode(&elem); err != nil {
+			return *currentState.Errs, fmt.Errorf("error parsing JSON stream: %w", err)
+		}
+		subState.ClearState()
+		subState.DescendInstanceFromState(currentState, strconv.Itoa(i))
+		items.ValidateKeyword(ctx, subState, elem)
+	}
+	if _, err := dec.Token(); err != nil {
+		return *currentState.Errs, fmt.Errorf("error parsing JSON stream: %w", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return *currentState.Errs, fmt.Errorf("error parsing JSON stream: unexpected data after top-level array")
+	}
+	return *currentState.Errs, nil
+}
+
+// streamItems returns the items subschema of an array schema
+// whose keywords can all be checked one element at a time
+func (s *Schema) streamItems() (*Schema, bool) {
+	if s.schemaType != schemaTypeObject || s.TopLevelType() != "array" {
+		return nil, false
+	}
+	for keyword := range s.keywords {
+		if !streamableKeywords[keyword] {
+			return nil, false
+		}
+	}
+	items, ok := s.keywords["items"].(*Items)
+	if !ok || !items.single {
+		return nil, false
+	}
+	return items.Schemas[0], true
+}
+
+// peekArray reports whether the next JSON value in br is an array,
+// without consuming it
+func peekArray(br *bufio.Reader) bool {
+	for n := 1; ; n++ {
+		buf, _ := br.Peek(n)
+		if len(buf) < n {
+			return false
+		}
+		switch buf[n-1] {
+		case ' ', '\t', '\n', '\r':
+			continue
+		case '[':
+			return true
+		default:
+			return false
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package jsonschema
+
+import (
+	"fmt"
+	"strings"
+
+	jptr "github.com/qri-io/jsonpointer"
+)
+
+// StrictKeywords makes Must, ParseSchema and ParseCached fail with an
+// *UnknownKeywordsError when a schema holds keywords its draft doesn't
+// define, so a typo such as "minimun" doesn't silently drop a constraint.
+// Vendor extensions prefixed with x- and the example annotation of OpenAPI
+// are allowed. Schema.UnmarshalJSON also parses the subschemas of a
+// document, before their draft is known, so it doesn't apply the check.
+// Call UnknownKeywords after decoding a schema with encoding/json instead
+var StrictKeywords = false
+
+// UnknownKeywordsError reports the keywords of a schema that are neither
+// registered for its draft nor a vendor extension
+type UnknownKeywordsError struct {
+	// Keywords are the JSON pointers to the unknown keywords
+	Keywords []string
+}
+
+// Error implements the error interface for UnknownKeywordsError
+func (e *UnknownKeywordsError) Error() string {
+	return fmt.Sprintf("unknown keywords: %s", strings.Join(e.Keywords, ", "))
+}
+
+// UnknownKeywords returns the JSON pointers to the keywords of the schema
+// and its subschemas that aren't registered for their draft, which are kept
+// as plain values and never checked, such as /properties/age/minimun.
+// Keywords prefixed with x- and example are left out
+func (s *Schema) UnknownKeywords() []string {
+	unknown := []string{}
+	s.Walk(func(path jptr.Pointer, sch *Schema) error {
+		for _, key := range sch.extraOrder {
+			if isExtensionKeyword(key) {
+				continue
+			}
+			unknown = append(unknown, childPointer(path, key).String())
+		}
+		return nil
+	})
+	return unknown
+}
+
+// isExtensionKeyword reports whether an unregistered keyword is a vendor
+// extension or an annotation commonly found in schemas
+func isExtensionKeyword(key string) bool {
+	return strings.HasPrefix(key, "x-") || key == "example"
+}
+
+// checkStrictKeywords reports the unknown keywords of a parsed
+// schema as an error when StrictKeywords is set
+func (s *Schema) checkStrictKeywords() error {
+	if !StrictKeywords {
+		return nil
+	}
+	if unknown := s.UnknownKeywords(); len(unknown) > 0 {
+		return &UnknownKeywordsError{Keywords: unknown}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package jsonschema
+
+// TraceKind tells whether a TraceEvent enters or exits a keyword
+type TraceKind int
+
+const (
+	// TraceEnter is sent before a keyword checks the instance
+	TraceEnter TraceKind = iota
+	// TraceExit is sent after a keyword checked the instance,
+	// with Valid reporting its result
+	TraceExit
+)
+
+// TraceEvent describes a step of a validation run, sent to the
+// TraceFunc of the ValidationOptions
+type TraceEvent struct {
+	Kind TraceKind
+	// Keyword is the name of the keyword, such as properties
+	Keyword string
+	// KeywordLocation is the JSON pointer to the keyword, following the
+	// path taken through the schema including references, as in KeyError
+	KeywordLocation string
+	// AbsoluteKeywordLocation is the absolute URI of the keyword,
+	// empty when its schema resource has no base URI
+	AbsoluteKeywordLocation string
+	// InstanceLocation is the JSON pointer to the value being checked
+	InstanceLocation string
+	// Valid reports whether the keyword, including the subschemas it
+	// applies, added no errors. It is always true for TraceEnter events
+	Valid bool
+}
+
+// traceFunc returns the tracer of a validation run, nil if there is none
+func (o *ValidationOptions) traceFunc() func(event TraceEvent) {
+	if o == nil {
+		return nil
+	}
+	return o.TraceFunc
+}
+
+// traceKeyword sends the enter and exit events of the keyword set on
+// currentState to trace around calling validate. Callers only build the
+// validate closure once they have checked the run has a tracer
+func traceKeyword(currentState *ValidationState, trace func(event TraceEvent), validate func()) {
+	event := TraceEvent{
+		Kind:                    TraceEnter,
+		Keyword:                 currentState.keyword,
+		KeywordLocation:         currentState.KeywordLocation(),
+		AbsoluteKeywordLocation: currentState.AbsoluteKeywordLocation(),
+		InstanceLocation:        currentState.InstanceLocation.String(),
+		Valid:                   true,
+	}
+	trace(event)
+	errs := len(*currentState.Errs)
+	validate()
+	event.Kind = TraceExit
+	event.Valid = len(*currentState.Errs) == errs
+	trace(event)
+}
@@ -1,5 +1,11 @@
 package jsonschema
 
+import (
+	"sort"
+
+	jptr "github.com/qri-io/jsonpointer"
+)
+
 // JSONPather makes validators traversible by JSON-pointers,
 // which is required to support references in JSON schemas.
 type JSONPather interface {
@@ -33,3 +39,48 @@ func walkJSON(elem interface{}, fn func(elem interface{}) error) error {
 
 	return nil
 }
+
+// Walk calls fn for the schema and every subschema nested in its keywords,
+// such as properties, items, allOf or $defs, passing the JSON pointer to
+// each schema from s. References are not followed, the schemas they point
+// to are visited at their own location. Children are visited in sorted
+// order of their keys. An error returned by fn aborts the walk
+func (s *Schema) Walk(fn func(path jptr.Pointer, s *Schema) error) error {
+	var walk func(elem interface{}, path jptr.Pointer) error
+	walk = func(elem interface{}, path jptr.Pointer) error {
+		if sk, ok := elem.(SchemaKeyword); ok {
+			if err := fn(path, sk.GetSchema()); err != nil {
+				return err
+			}
+		}
+		con, ok := elem.(JSONContainer)
+		if !ok {
+			return nil
+		}
+		children := con.JSONChildren()
+		keys := make([]string, 0, len(children))
+		for key := range children {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if err := walk(children[key], childPointer(path, key)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return walk(s, jptr.NewPointer())
+}
+
+// childPointer returns a copy of path extended with the key of a child
+// element. The "." key used by containers wrapping a single schema,
+// like items, doesn't add a token
+func childPointer(path jptr.Pointer, key string) jptr.Pointer {
+	child := make(jptr.Pointer, 0, len(path)+1)
+	child = append(child, path...)
+	if key != "." {
+		child = append(child, key)
+	}
+	return child
+}
@@ -2,8 +2,12 @@ package jsonschema
 
 import (
 	"context"
+	"errors"
 	"io/ioutil"
+	"strings"
 	"testing"
+
+	jptr "github.com/qri-io/jsonpointer"
 )
 
 func TestSchemaDeref(t *testing.T) {
@@ -49,7 +53,7 @@ func TestReferenceTraversal(t *testing.T) {
 	}
 
 	elements := 0
-	expectElements := 35
+	expectElements := 36
 	refs := 0
 	expectRefs := 7
 	walkJSON(rs, func(elem interface{}) error {
@@ -104,3 +108,63 @@ func TestReferenceTraversal(t *testing.T) {
 	}
 
 }
+
+func TestWalk(t *testing.T) {
+	rs := Must(`{
+		"$defs": { "name": { "type": "string" } },
+		"properties": {
+			"name": { "$ref": "#/$defs/name" },
+			"tags": { "items": { "type": "string" } },
+			"pair": { "items": [ true, { "type": "integer" } ] }
+		},
+		"allOf": [ { "required": ["name"] } ],
+		"not": { "$ref": "#" }
+	}`)
+
+	paths := []string{}
+	err := rs.Walk(func(path jptr.Pointer, s *Schema) error {
+		paths = append(paths, path.String())
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expect := []string{
+		"",
+		"/$defs/name",
+		"/allOf/0",
+		"/not",
+		"/properties/name",
+		"/properties/pair",
+		"/properties/pair/items/0",
+		"/properties/pair/items/1",
+		"/properties/tags",
+		"/properties/tags/items",
+	}
+	if strings.Join(paths, ",") != strings.Join(expect, ",") {
+		t.Errorf("walk order mismatch.\nexpected: %v\ngot:      %v", expect, paths)
+	}
+
+	for _, p := range paths {
+		ptr, _ := jptr.Parse(p)
+		if p != "" && rs.Resolve(ptr, "") == nil {
+			t.Errorf("expected walked path %q to resolve", p)
+		}
+	}
+
+	abort := errors.New("abort")
+	visited := 0
+	err = rs.Walk(func(path jptr.Pointer, s *Schema) error {
+		visited++
+		if s.HasKeyword("$ref") {
+			return abort
+		}
+		return nil
+	})
+	if err != abort {
+		t.Errorf("expected walk to return the callback error, got: %v", err)
+	}
+	if visited != 4 {
+		t.Errorf("expected walk to stop at the first reference, visited %d schemas", visited)
+	}
+}
@@ -0,0 +1,215 @@
+package jsonschema
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ValidationOptions configures a single validation run
+type ValidationOptions struct {
+	// MessageOverrides maps keyword names to message templates that replace
+	// the default error message of the keyword. Templates can reference the
+	// placeholders {value}, {limit} and {path}
+	MessageOverrides map[string]string
+	// FailFast stops validation after the first error is recorded,
+	// rather than collecting all errors
+	FailFast bool
+	// MaxDepth limits how deeply subschemas can be nested during
+	// validation, zero uses DefaultMaxDepth
+	MaxDepth int
+	// UseNumber decodes the numbers of instances validated with
+	// ValidateBytesWithOptions as json.Number rather than float64, so
+	// numeric keywords, const and enum compare them exactly even beyond
+	// the precision of float64. The limits of numeric keywords in the
+	// schema itself are still float64
+	UseNumber bool
+	// StrictIntegerType makes the integer type only accept numbers written
+	// without a fraction or exponent, rejecting 1.0 and 1e2 that count as
+	// integers by default. ValidateBytesWithOptions decodes numbers as
+	// json.Number to keep how they were written, numbers passed as float64
+	// don't record it and are still judged by their value
+	StrictIntegerType bool
+	// RejectDuplicateKeys makes ValidateBytesWithOptions fail with a
+	// *DuplicateKeysError, before validating, when an object of the
+	// document repeats a key. encoding/json otherwise keeps the last
+	// value, so the schema and a later processor could disagree on it
+	RejectDuplicateKeys bool
+	// TreatNullAsAbsent makes required count properties whose value is null
+	// as missing, matching APIs that send null for optional fields left
+	// unset. The specification counts them as present, so it is off by default
+	TreatNullAsAbsent bool
+	// Mode is the direction of the data being validated. ModeRead rejects
+	// values of writeOnly schemas and ModeWrite rejects values of readOnly
+	// schemas, while the default ModeNone treats both as annotations
+	Mode ValidationMode
+	// Coerce converts string instances to the integer, number or boolean
+	// type of their schema before validating them, so form and query
+	// string values validate as the types they represent. Strings that
+	// don't parse as the type fail validation with the usual type error.
+	// The types of allOf and $ref subschemas apply to the whole schema, so
+	// {"allOf": [{"type": "integer"}, {"minimum": 5}]} coerces "1" before
+	// checking it against both. ValidateCoerced returns the document
+	// holding the coerced values
+	Coerce bool
+	// CountGraphemes makes minLength and maxLength count user-perceived
+	// characters, such as an emoji with a skin tone or a letter with a
+	// combining accent, rather than code points as the specification
+	// requires. Grapheme clusters are approximated with the Unicode tables
+	// of the standard library, rather than the full segmentation data of
+	// Unicode Standard Annex #29, so rare scripts may count differently
+	CountGraphemes bool
+	// MaxKeywordErrStringLen overrides the global MaxKeywordErrStringLen,
+	// truncating the invalid values printed in errors of the validation run.
+	// Zero uses the global and -1 disables output trimming
+	MaxKeywordErrStringLen int
+	// Parallel validates the values of properties, and the items of an
+	// array matched by a single items schema, on concurrent goroutines
+	// once there are at least ParallelThreshold of them. Their errors are
+	// reported in the order of their keys or indexes
+	Parallel bool
+	// TraceFunc, when set, is called as each keyword is entered and
+	// exited, with its keyword and instance locations and, on exit,
+	// whether it passed. Validating with Parallel calls it from
+	// concurrent goroutines. Unset, tracing costs nothing
+	TraceFunc func(event TraceEvent)
+	// ParallelWorkers bounds the goroutines a Parallel validation run
+	// starts, zero uses runtime.GOMAXPROCS
+	ParallelWorkers int
+}
+
+// ValidationMode is the direction of the data being validated,
+// which readOnly and writeOnly are enforced against
+type ValidationMode int
+
+const (
+	// ModeNone enforces neither readOnly nor writeOnly
+	ModeNone ValidationMode = iota
+	// ModeRead validates data read from its owning authority,
+	// such as a response, in which writeOnly values are not allowed
+	ModeRead
+	// ModeWrite validates data written to its owning authority,
+	// such as a request, in which readOnly values are not allowed
+	ModeWrite
+)
+
+// DefaultMaxDepth is the maximum nesting of subschemas during validation
+// when ValidationOptions don't set one. It guards recursive schemas
+// against deeply nested instances exhausting the stack
+var DefaultMaxDepth = 10000
+
+// maxDepth returns the maximum subschema nesting for a validation run
+func (o *ValidationOptions) maxDepth() int {
+	if o == nil || o.MaxDepth <= 0 {
+		return DefaultMaxDepth
+	}
+	return o.MaxDepth
+}
+
+// mode returns the direction of the data being validated
+func (o *ValidationOptions) mode() ValidationMode {
+	if o == nil {
+		return ModeNone
+	}
+	return o.Mode
+}
+
+// strictIntegerType reports whether the integer type rejects
+// numbers written with a fraction or exponent
+func (o *ValidationOptions) strictIntegerType() bool {
+	return o != nil && o.StrictIntegerType
+}
+
+// treatNullAsAbsent reports whether required counts null properties as missing
+func (o *ValidationOptions) treatNullAsAbsent() bool {
+	return o != nil && o.TreatNullAsAbsent
+}
+
+// coerce reports whether string instances are coerced to the type of their schema
+func (o *ValidationOptions) coerce() bool {
+	return o != nil && o.Coerce
+}
+
+// maxErrStringLen returns the length invalid values are truncated at in errors
+func (o *ValidationOptions) maxErrStringLen() int {
+	if o == nil || o.MaxKeywordErrStringLen == 0 {
+		return MaxKeywordErrStringLen
+	}
+	return o.MaxKeywordErrStringLen
+}
+
+// messageOverride returns the message template for a given keyword, if any
+func (o *ValidationOptions) messageOverride(keyword string) (string, bool) {
+	if o == nil || o.MessageOverrides == nil {
+		return "", false
+	}
+	tmpl, ok := o.MessageOverrides[keyword]
+	return tmpl, ok
+}
+
+// formatMessageTemplate fills in the placeholders of a message template
+// with the details of a KeyError
+func formatMessageTemplate(tmpl string, err KeyError) string {
+	value := ""
+	if str, ok := err.InvalidValue.(string); ok {
+		value = str
+	} else if err.InvalidValue != nil {
+		value = InvalidValueStringN(err.InvalidValue, err.valueLen())
+	}
+	limit := ""
+	if err.Limit != nil {
+		limit = fmt.Sprintf("%v", err.Limit)
+	}
+	return strings.NewReplacer(
+		"{value}", value,
+		"{limit}", limit,
+		"{path}", err.PropertyPath,
+	).Replace(tmpl)
+}
+
+// IsValid reports whether the data is valid against the schema,
+// stopping at the first error found
+func (s *Schema) IsValid(ctx context.Context, data interface{}) bool {
+	return s.ValidateWithOptions(ctx, data, &ValidationOptions{FailFast: true}).IsValid()
+}
+
+// ValidateBytesWithOptions performs schema validation against a slice of
+// json byte data, configuring the validation run with the provided options
+func (s *Schema) ValidateBytesWithOptions(ctx context.Context, data []byte, opts *ValidationOptions) ([]KeyError, error) {
+	ctx = backgroundIfNil(ctx)
+	if opts != nil && opts.RejectDuplicateKeys {
+		if err := checkDuplicateKeys(data); err != nil {
+			return nil, fmt.Errorf("error parsing JSON bytes: %w", err)
+		}
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if opts != nil && (opts.UseNumber || opts.StrictIntegerType) {
+		dec.UseNumber()
+	}
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("error parsing JSON bytes: %w", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("error parsing JSON bytes: invalid character after top-level value")
+	}
+	errs := s.validateErrs(ctx, doc, opts)
+	if err := ctx.Err(); err != nil {
+		return errs, fmt.Errorf("validation aborted: %w", err)
+	}
+	return errs, nil
+}
+
+// ValidateWithOptions uses the schema to check an instance, configuring
+// the validation run with the provided options
+func (s *Schema) ValidateWithOptions(ctx context.Context, data interface{}, opts *ValidationOptions) *ValidationState {
+	ctx = backgroundIfNil(ctx)
+	currentState := NewValidationState(s)
+	currentState.Options = opts
+	currentState.workers = newWorkerPool(opts)
+	s.ValidateKeyword(ctx, currentState, data)
+	return currentState
+}
@@ -1,13 +1,18 @@
 package jsonschema
 
 import (
+	"sort"
+	"strings"
+	"sync"
+
 	jptr "github.com/qri-io/jsonpointer"
 )
 
 // ValidationState holds the schema validation state
 // The aim is to have one global validation state
-// and use local sub states when evaluating parallel branches
-// TODO(arqu): make sure this is safe for concurrent use
+// and use local sub states when evaluating parallel branches.
+// A state belongs to a single validation and isn't safe for concurrent use,
+// validations running concurrently against the same schema each use their own
 type ValidationState struct {
 	Local                *Schema
 	Root                 *Schema
@@ -20,13 +25,50 @@ type ValidationState struct {
 	LocalRegistry        *SchemaRegistry
 	LocalKeywordRegistry *KeywordRegistry
 
+	// Options configures the validation run, nil for defaults
+	Options *ValidationOptions
+	// formatter renders error messages, nil for the global formatter
+	formatter ErrorFormatter
+
 	EvaluatedPropertyNames      *map[string]bool
 	LocalEvaluatedPropertyNames *map[string]bool
 	LastEvaluatedIndex          int
 	LocalLastEvaluatedIndex     int
-	Misc                        map[string]interface{}
+	// evaluatedIndexes marks the array items evaluated by any keyword,
+	// including indexes matched by contains
+	evaluatedIndexes *indexSet
+	Misc             map[string]interface{}
 
-	Errs *[]KeyError
+	Errs        *[]KeyError
+	annotations *[]Annotation
+	// coercions maps the instance locations of strings coerced to
+	// the type of their schema to the coerced values
+	coercions *map[string]interface{}
+	// dynamicScope tracks the schema resources entered during
+	// evaluation, outermost first
+	dynamicScope *[]*Schema
+	// keyword and keywordBase track the keyword being evaluated
+	// and the location of the schema it belongs to, keywordBaseURI and
+	// keywordBaseRelative the same location within its schema resource
+	keyword             string
+	keywordBase         *jptr.Pointer
+	keywordBaseURI      string
+	keywordBaseRelative *jptr.Pointer
+	// depth is the number of schemas being evaluated
+	// from the root to the current one
+	depth int
+	// workers runs the branches of a parallel validation run,
+	// nil when validating sequentially
+	workers *workerPool
+	// recursiveRefs marks the $recursiveRef keywords being evaluated
+	// at an instance location, guarding against infinite recursion
+	recursiveRefs *map[recursiveVisit]bool
+	// propertyNames, localPropertyNames and indexes hold the evaluated
+	// property and item sets a cleared state points to, so clearing the
+	// state for every property or item a keyword validates reuses them
+	propertyNames      map[string]bool
+	localPropertyNames map[string]bool
+	indexes            indexSet
 }
 
 // NewValidationState creates a new ValidationState with the provided location pointers and data instance
@@ -34,19 +76,94 @@ func NewValidationState(s *Schema) *ValidationState {
 	tmpBRLprt := jptr.NewPointer()
 	tmpRLprt := jptr.NewPointer()
 	tmpILprt := jptr.NewPointer()
-	return &ValidationState{
-		Root:                        s,
-		BaseRelativeLocation:        &tmpBRLprt,
-		RelativeLocation:            &tmpRLprt,
-		InstanceLocation:            &tmpILprt,
-		LocalRegistry:               &SchemaRegistry{},
-		LastEvaluatedIndex:          -1,
-		LocalLastEvaluatedIndex:     -1,
-		EvaluatedPropertyNames:      &map[string]bool{},
-		LocalEvaluatedPropertyNames: &map[string]bool{},
-		Misc:                        map[string]interface{}{},
-		Errs:                        &[]KeyError{},
+	var formatter ErrorFormatter
+	if s != nil {
+		formatter = s.errorFormatter
+	}
+	vs := &ValidationState{
+		Root:                 s,
+		BaseRelativeLocation: &tmpBRLprt,
+		RelativeLocation:     &tmpRLprt,
+		InstanceLocation:     &tmpILprt,
+		LocalRegistry:        &SchemaRegistry{},
+		formatter:            formatter,
+		Misc:                 map[string]interface{}{},
+		Errs:                 &[]KeyError{},
+		annotations:          &[]Annotation{},
+		coercions:            &map[string]interface{}{},
+		dynamicScope:         &[]*Schema{},
+	}
+	vs.ClearState()
+	return vs
+}
+
+// statePool holds root validation states for reuse by validations which
+// only return the errors they collect, sparing the allocation of the
+// buffers of a new state for every validated instance
+var statePool sync.Pool
+
+// getValidationState returns a root validation state for s from statePool,
+// creating one if the pool is empty. Release it with putValidationState
+// once its errors have been copied out
+func getValidationState(s *Schema) *ValidationState {
+	vs, ok := statePool.Get().(*ValidationState)
+	if !ok {
+		return NewValidationState(s)
+	}
+	vs.Root = s
+	vs.formatter = nil
+	if s != nil {
+		vs.formatter = s.errorFormatter
 	}
+	return vs
+}
+
+// putValidationState empties a root validation state, keeping its buffers,
+// and returns it to statePool. vs must not be used afterwards
+func putValidationState(vs *ValidationState) {
+	errs, annotations, scope := *vs.Errs, *vs.annotations, *vs.dynamicScope
+	for i := range errs {
+		errs[i] = KeyError{}
+	}
+	for i := range annotations {
+		annotations[i] = Annotation{}
+	}
+	for i := range scope {
+		scope[i] = nil
+	}
+	*vs.Errs, *vs.annotations, *vs.dynamicScope = errs[:0], annotations[:0], scope[:0]
+	*vs.BaseRelativeLocation = (*vs.BaseRelativeLocation)[:0]
+	*vs.RelativeLocation = (*vs.RelativeLocation)[:0]
+	*vs.InstanceLocation = (*vs.InstanceLocation)[:0]
+	for loc := range *vs.coercions {
+		delete(*vs.coercions, loc)
+	}
+	for key := range vs.Misc {
+		delete(vs.Misc, key)
+	}
+	for id := range vs.LocalRegistry.schemaLookup {
+		delete(vs.LocalRegistry.schemaLookup, id)
+	}
+	for id := range vs.LocalRegistry.contextLookup {
+		delete(vs.LocalRegistry.contextLookup, id)
+	}
+
+	*vs = ValidationState{
+		BaseRelativeLocation: vs.BaseRelativeLocation,
+		RelativeLocation:     vs.RelativeLocation,
+		InstanceLocation:     vs.InstanceLocation,
+		LocalRegistry:        vs.LocalRegistry,
+		Misc:                 vs.Misc,
+		Errs:                 vs.Errs,
+		annotations:          vs.annotations,
+		coercions:            vs.coercions,
+		dynamicScope:         vs.dynamicScope,
+		propertyNames:        vs.propertyNames,
+		localPropertyNames:   vs.localPropertyNames,
+		indexes:              vs.indexes,
+	}
+	vs.ClearState()
+	statePool.Put(vs)
 }
 
 // NewSubState creates a new ValidationState from an existing ValidationState
@@ -57,22 +174,98 @@ func (vs *ValidationState) NewSubState() *ValidationState {
 		RecursiveAnchor:             vs.RecursiveAnchor,
 		LastEvaluatedIndex:          vs.LastEvaluatedIndex,
 		LocalLastEvaluatedIndex:     vs.LocalLastEvaluatedIndex,
+		evaluatedIndexes:            vs.evaluatedIndexes,
 		BaseURI:                     vs.BaseURI,
 		InstanceLocation:            vs.InstanceLocation,
 		RelativeLocation:            vs.RelativeLocation,
-		BaseRelativeLocation:        vs.RelativeLocation,
+		BaseRelativeLocation:        vs.BaseRelativeLocation,
 		LocalRegistry:               vs.LocalRegistry,
+		Options:                     vs.Options,
+		formatter:                   vs.formatter,
 		EvaluatedPropertyNames:      vs.EvaluatedPropertyNames,
 		LocalEvaluatedPropertyNames: vs.LocalEvaluatedPropertyNames,
 		Misc:                        map[string]interface{}{},
 		Errs:                        vs.Errs,
+		annotations:                 vs.annotations,
+		coercions:                   vs.coercions,
+		dynamicScope:                vs.dynamicScope,
+		keyword:                     vs.keyword,
+		keywordBase:                 vs.keywordBase,
+		keywordBaseURI:              vs.keywordBaseURI,
+		keywordBaseRelative:         vs.keywordBaseRelative,
+		depth:                       vs.depth,
+		workers:                     vs.workers,
+		recursiveRefs:               vs.recursiveRefs,
+	}
+}
+
+// Clone creates a child ValidationState to evaluate a subschema as an isolated
+// branch. The child shares the configuration and locations of vs but collects
+// its own errors, annotations, coercions and evaluated properties and items,
+// which are only seen by vs once the child is merged back with Merge
+func (vs *ValidationState) Clone() *ValidationState {
+	child := vs.NewSubState()
+	child.ClearState()
+	child.Errs = &[]KeyError{}
+	child.annotations = &[]Annotation{}
+	child.coercions = &map[string]interface{}{}
+	return child
+}
+
+// branch creates a child ValidationState like Clone that can be used on
+// another goroutine than vs, with its own copies of the dynamic scope,
+// local registry and recursion guard vs shares with its sub states
+func (vs *ValidationState) branch() *ValidationState {
+	child := vs.Clone()
+	scope := append([]*Schema{}, *vs.dynamicScope...)
+	child.dynamicScope = &scope
+	child.LocalRegistry = vs.LocalRegistry.Snapshot()
+	if vs.recursiveRefs != nil {
+		visits := make(map[recursiveVisit]bool, len(*vs.recursiveRefs))
+		for visit, ok := range *vs.recursiveRefs {
+			visits[visit] = ok
+		}
+		child.recursiveRefs = &visits
+	}
+	return child
+}
+
+// Merge folds the annotations, coercions and evaluated properties and items of
+// a branch created with Clone into vs, typically once the branch is known to be
+// valid. The errors of the branch are left to the caller to report
+func (vs *ValidationState) Merge(child *ValidationState) {
+	vs.mergeResults(child)
+	vs.UpdateEvaluatedPropsAndItems(child)
+}
+
+// mergeResults folds the annotations and coercions of a child state into vs
+func (vs *ValidationState) mergeResults(child *ValidationState) {
+	if child.annotations != nil && len(*child.annotations) > 0 {
+		if vs.annotations == nil {
+			vs.annotations = &[]Annotation{}
+		}
+		*vs.annotations = append(*vs.annotations, *child.annotations...)
+	}
+	if child.coercions != nil && len(*child.coercions) > 0 {
+		if vs.coercions == nil {
+			vs.coercions = &map[string]interface{}{}
+		}
+		for loc, val := range *child.coercions {
+			(*vs.coercions)[loc] = val
+		}
 	}
 }
 
 // ClearState resets a schema to it's core elements
 func (vs *ValidationState) ClearState() {
-	vs.EvaluatedPropertyNames = &map[string]bool{}
-	vs.LocalEvaluatedPropertyNames = &map[string]bool{}
+	clearSet(vs.propertyNames)
+	clearSet(vs.localPropertyNames)
+	vs.indexes = vs.indexes[:0]
+	vs.EvaluatedPropertyNames = &vs.propertyNames
+	vs.LocalEvaluatedPropertyNames = &vs.localPropertyNames
+	vs.evaluatedIndexes = &vs.indexes
+	vs.LastEvaluatedIndex = -1
+	vs.LocalLastEvaluatedIndex = -1
 	if len(vs.Misc) > 0 {
 		vs.Misc = map[string]interface{}{}
 	}
@@ -80,6 +273,12 @@ func (vs *ValidationState) ClearState() {
 
 // SetEvaluatedKey updates the evaluation properties of the current state
 func (vs *ValidationState) SetEvaluatedKey(key string) {
+	if *vs.EvaluatedPropertyNames == nil {
+		*vs.EvaluatedPropertyNames = map[string]bool{}
+	}
+	if *vs.LocalEvaluatedPropertyNames == nil {
+		*vs.LocalEvaluatedPropertyNames = map[string]bool{}
+	}
 	(*vs.EvaluatedPropertyNames)[key] = true
 	(*vs.LocalEvaluatedPropertyNames)[key] = true
 }
@@ -100,13 +299,70 @@ func (vs *ValidationState) IsLocallyEvaluatedKey(key string) bool {
 func (vs *ValidationState) SetEvaluatedIndex(i int) {
 	vs.LastEvaluatedIndex = i
 	vs.LocalLastEvaluatedIndex = i
+	vs.evaluatedIndexes.add(i)
+}
+
+// IsEvaluatedIndex checks if the array item at index i is evaluated against the state context
+func (vs *ValidationState) IsEvaluatedIndex(i int) bool {
+	return vs.evaluatedIndexes.has(i)
+}
+
+// EvaluatedProperties returns the names of the properties of the instance
+// that keywords of the schema, or of subschemas applied in place such as
+// allOf, evaluated, in sorted order. These are the properties
+// unevaluatedProperties doesn't apply to
+func (vs *ValidationState) EvaluatedProperties() []string {
+	if vs.EvaluatedPropertyNames == nil {
+		return []string{}
+	}
+	names := make([]string, 0, len(*vs.EvaluatedPropertyNames))
+	for key := range *vs.EvaluatedPropertyNames {
+		names = append(names, key)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// EvaluatedItems returns the indexes of the array items of the instance
+// that keywords of the schema, or of subschemas applied in place, evaluated,
+// including the items matched by contains, in ascending order. These are
+// the items unevaluatedItems doesn't apply to
+func (vs *ValidationState) EvaluatedItems() []int {
+	if vs.evaluatedIndexes == nil {
+		return []int{}
+	}
+	return vs.evaluatedIndexes.list()
+}
+
+// derived returns the data the keyword being evaluated derived from the JSON
+// it was parsed from, or nil if there is none
+func (vs *ValidationState) derived() interface{} {
+	if vs.Local == nil {
+		return nil
+	}
+	return vs.Local.derived[vs.keyword]
+}
+
+// CurrentSchema returns the schema whose keywords are being evaluated, so a
+// keyword can consult the values of its siblings
+func (vs *ValidationState) CurrentSchema() *Schema {
+	return vs.Local
+}
+
+// ContainsCount returns the number of array items matched by the contains
+// keyword of the current schema, and whether contains was evaluated
+func (vs *ValidationState) ContainsCount() (int, bool) {
+	count, ok := vs.Misc["containsCount"].(int)
+	return count, ok
 }
 
 // UpdateEvaluatedPropsAndItems is a utility function to join evaluated properties and set the
-// current evaluation position index
+// current evaluation position index. It is meant for in-place applicators, whose subschemas
+// apply to the same instance. The locally evaluated properties are left untouched as they
+// only account for the keywords of the current schema
 func (vs *ValidationState) UpdateEvaluatedPropsAndItems(subState *ValidationState) {
 	joinSets(vs.EvaluatedPropertyNames, *subState.EvaluatedPropertyNames)
-	joinSets(vs.LocalEvaluatedPropertyNames, *subState.LocalEvaluatedPropertyNames)
+	vs.evaluatedIndexes.join(*subState.evaluatedIndexes)
 	if subState.LastEvaluatedIndex > vs.LastEvaluatedIndex {
 		vs.LastEvaluatedIndex = subState.LastEvaluatedIndex
 	}
@@ -123,24 +379,148 @@ func copySet(input map[string]bool) map[string]bool {
 	return copy
 }
 
+func clearSet(set map[string]bool) {
+	for k := range set {
+		delete(set, k)
+	}
+}
+
 func joinSets(consumer *map[string]bool, supplier map[string]bool) {
+	if *consumer == nil && len(supplier) > 0 {
+		*consumer = map[string]bool{}
+	}
 	for k, v := range supplier {
 		(*consumer)[k] = v
 	}
 }
 
+// indexSet is a bitset of array indexes
+type indexSet []uint64
+
+func (s *indexSet) add(i int) {
+	if i < 0 {
+		return
+	}
+	word := i / 64
+	for len(*s) <= word {
+		*s = append(*s, 0)
+	}
+	(*s)[word] |= 1 << uint(i%64)
+}
+
+func (s indexSet) has(i int) bool {
+	word := i / 64
+	return i >= 0 && word < len(s) && s[word]&(1<<uint(i%64)) != 0
+}
+
+// list returns the indexes in the set in ascending order
+func (s indexSet) list() []int {
+	indexes := []int{}
+	for word, w := range s {
+		for bit := 0; w != 0; bit++ {
+			if w&1 != 0 {
+				indexes = append(indexes, word*64+bit)
+			}
+			w >>= 1
+		}
+	}
+	return indexes
+}
+
+func (s *indexSet) join(supplier indexSet) {
+	for len(*s) < len(supplier) {
+		*s = append(*s, 0)
+	}
+	for i, w := range supplier {
+		(*s)[i] |= w
+	}
+}
+
 // AddError creates and appends a KeyError to errs of the current state
 func (vs *ValidationState) AddError(data interface{}, msg string) {
+	vs.addError(data, nil, msg)
+}
+
+// AddErrorWithLimit creates and appends a KeyError to errs of the current
+// state, recording the limit the keyword checked the data against
+func (vs *ValidationState) AddErrorWithLimit(data, limit interface{}, msg string) {
+	vs.addError(data, limit, msg)
+}
+
+func (vs *ValidationState) addError(data, limit interface{}, msg string) {
 	schemaDebug("[AddError] Error: %s", msg)
-	instancePath := vs.InstanceLocation.String()
+	instanceLocation := vs.InstanceLocation.String()
+	instancePath := instanceLocation
 	if len(instancePath) == 0 {
 		instancePath = "/"
 	}
-	*vs.Errs = append(*vs.Errs, KeyError{
-		PropertyPath: instancePath,
-		InvalidValue: data,
-		Message:      msg,
-	})
+	err := KeyError{
+		PropertyPath:            instancePath,
+		InstanceLocation:        instanceLocation,
+		InvalidValue:            data,
+		Message:                 msg,
+		Limit:                   limit,
+		KeywordLocation:         vs.KeywordLocation(),
+		AbsoluteKeywordLocation: vs.AbsoluteKeywordLocation(),
+		Keyword:                 vs.keyword,
+	}
+	if vs.Options != nil {
+		err.maxValueLen = vs.Options.MaxKeywordErrStringLen
+	}
+	formatter := vs.formatter
+	if formatter == nil {
+		formatter = getErrorFormatter()
+	}
+	err.Message = formatter.Format(vs.keyword, &err)
+	if tmpl, ok := vs.Options.messageOverride(vs.keyword); ok {
+		err.Message = formatMessageTemplate(tmpl, err)
+	}
+	*vs.Errs = append(*vs.Errs, err)
+}
+
+// setKeyword marks the keyword of the current schema being evaluated
+func (vs *ValidationState) setKeyword(keyword string) {
+	vs.keyword = keyword
+	vs.keywordBase = vs.RelativeLocation
+	vs.keywordBaseURI = vs.BaseURI
+	vs.keywordBaseRelative = vs.BaseRelativeLocation
+}
+
+// KeywordLocation returns the JSON pointer to the keyword being evaluated,
+// following the path taken through the schema including references
+func (vs *ValidationState) KeywordLocation() string {
+	if vs.keywordBase == nil {
+		if vs.RelativeLocation == nil {
+			return ""
+		}
+		return vs.RelativeLocation.String()
+	}
+	return descendantString(*vs.keywordBase, vs.keyword)
+}
+
+// AbsoluteKeywordLocation returns the absolute URI of the keyword being
+// evaluated, made of the base URI of the schema resource and the location
+// of the keyword within it. It is empty when the resource has no base URI
+func (vs *ValidationState) AbsoluteKeywordLocation() string {
+	if vs.keywordBaseURI == "" || vs.keywordBaseRelative == nil {
+		return ""
+	}
+	base := strings.SplitN(vs.keywordBaseURI, "#", 2)[0]
+	return base + "#" + descendantString(*vs.keywordBaseRelative, vs.keyword)
+}
+
+// descendantString renders a descendant of the pointer without
+// writing into the backing array shared with other pointers
+func descendantString(ptr jptr.Pointer, token string) string {
+	res := make(jptr.Pointer, 0, len(ptr)+1)
+	res = append(res, ptr...)
+	return append(res, token).String()
+}
+
+// stopEarly reports whether the remaining evaluation of the current state can
+// be skipped because fail-fast is enabled and an error was already recorded
+func (vs *ValidationState) stopEarly() bool {
+	return vs.Options != nil && vs.Options.FailFast && len(*vs.Errs) > 0
 }
 
 // AddSubErrors appends a list of KeyError to the current state
@@ -151,6 +531,97 @@ func (vs *ValidationState) AddSubErrors(errs ...KeyError) {
 	*vs.Errs = append(*vs.Errs, errs...)
 }
 
+// addKeyErrors appends the errors returned by a KeywordE. Errors without a
+// PropertyPath are created like AddError, defaulting their invalid value to data
+func (vs *ValidationState) addKeyErrors(data interface{}, errs []KeyError) {
+	for _, err := range errs {
+		if err.PropertyPath != "" {
+			vs.AddSubErrors(err)
+			continue
+		}
+		value := err.InvalidValue
+		if value == nil {
+			value = data
+		}
+		vs.addError(value, err.Limit, err.Message)
+	}
+}
+
+// AddAnnotation creates and appends an Annotation to the annotations of the current state
+func (vs *ValidationState) AddAnnotation(keyword string, value interface{}, msg string) {
+	schemaDebug("[AddAnnotation] %s: %s", keyword, msg)
+	if vs.annotations == nil {
+		vs.annotations = &[]Annotation{}
+	}
+	instancePath := vs.InstanceLocation.String()
+	if len(instancePath) == 0 {
+		instancePath = "/"
+	}
+	*vs.annotations = append(*vs.annotations, Annotation{
+		PropertyPath:    instancePath,
+		Keyword:         keyword,
+		KeywordLocation: vs.KeywordLocation(),
+		Value:           value,
+		Message:         msg,
+	})
+}
+
+// Annotations returns the annotations collected during validation
+func (vs *ValidationState) Annotations() []Annotation {
+	if vs.annotations == nil {
+		return nil
+	}
+	return *vs.annotations
+}
+
+// currentResource returns the schema resource identified by the current
+// base URI, falling back to the root schema
+func (vs *ValidationState) currentResource() *Schema {
+	if vs.BaseURI != "" {
+		if sch := GetSchemaRegistry().GetKnown(vs.BaseURI); sch != nil {
+			return sch
+		}
+	}
+	return vs.Root
+}
+
+// pushDynamicScope enters a schema resource, returning false if
+// the resource is already part of the dynamic scope
+func (vs *ValidationState) pushDynamicScope(resource *Schema) bool {
+	if vs.dynamicScope == nil {
+		vs.dynamicScope = &[]*Schema{}
+	}
+	for _, sch := range *vs.dynamicScope {
+		if sch == resource {
+			return false
+		}
+	}
+	*vs.dynamicScope = append(*vs.dynamicScope, resource)
+	return true
+}
+
+// popDynamicScope leaves the innermost schema resource of the dynamic scope
+func (vs *ValidationState) popDynamicScope() {
+	if vs.dynamicScope == nil || len(*vs.dynamicScope) == 0 {
+		return
+	}
+	*vs.dynamicScope = (*vs.dynamicScope)[:len(*vs.dynamicScope)-1]
+}
+
+// resolveDynamicAnchor returns the outermost schema resource in the dynamic
+// scope declaring the given $dynamicAnchor along with the matching schema
+func (vs *ValidationState) resolveDynamicAnchor(name string) (*Schema, *Schema) {
+	if vs.dynamicScope == nil {
+		return nil, nil
+	}
+	for _, resource := range *vs.dynamicScope {
+		if sch := resource.findDynamicAnchor(name); sch != nil {
+			return resource, sch
+		}
+	}
+	return nil, nil
+}
+
 // IsValid returns if the current state is valid
 func (vs *ValidationState) IsValid() bool {
 	if vs.Errs == nil {
@@ -179,8 +650,10 @@ func (vs *ValidationState) DescendRelative(token ...string) {
 
 // DescendRelativeFromState descends the relative pointer relative to the provided state
 func (vs *ValidationState) DescendRelativeFromState(base *ValidationState, token ...string) {
-	newPtr := base.InstanceLocation.RawDescendant(token...)
-	vs.RelativeLocation = &newPtr
+	if base.RelativeLocation != nil {
+		newPtr := base.RelativeLocation.RawDescendant(token...)
+		vs.RelativeLocation = &newPtr
+	}
 }
 
 // DescendInstance descends the instance pointer relative to itself
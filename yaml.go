@@ -0,0 +1,105 @@
+package jsonschema
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ValidateYAML performs schema validation against a YAML document. The
+// document is converted to the JSON data model the keywords expect:
+// mappings become objects keyed by strings, integers are kept as
+// json.Number and timestamps become RFC 3339 strings, so error paths point
+// into the YAML document the way they would into its JSON equivalent. Only
+// the first document of a multi-document stream is validated
+func (s *Schema) ValidateYAML(ctx context.Context, data []byte) ([]KeyError, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("error parsing YAML bytes: %w", err)
+	}
+	value, err := fromYAML(doc)
+	if err != nil {
+		return nil, fmt.Errorf("error converting YAML to JSON: %w", err)
+	}
+	return s.ValidateDecoded(ctx, value)
+}
+
+// fromYAML converts a value decoded by the YAML decoder to the
+// value encoding/json would decode from its JSON equivalent
+func fromYAML(v interface{}) (interface{}, error) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		obj := make(map[string]interface{}, len(val))
+		for key, elem := range val {
+			conv, err := fromYAML(elem)
+			if err != nil {
+				return nil, err
+			}
+			obj[key] = conv
+		}
+		return obj, nil
+	case map[interface{}]interface{}:
+		obj := make(map[string]interface{}, len(val))
+		for key, elem := range val {
+			name, err := yamlKey(key)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := obj[name]; ok {
+				return nil, fmt.Errorf("mapping has more than one key %q", name)
+			}
+			conv, err := fromYAML(elem)
+			if err != nil {
+				return nil, err
+			}
+			obj[name] = conv
+		}
+		return obj, nil
+	case []interface{}:
+		arr := make([]interface{}, len(val))
+		for i, elem := range val {
+			conv, err := fromYAML(elem)
+			if err != nil {
+				return nil, err
+			}
+			arr[i] = conv
+		}
+		return arr, nil
+	case int:
+		return json.Number(strconv.Itoa(val)), nil
+	case int64:
+		return json.Number(strconv.FormatInt(val, 10)), nil
+	case uint64:
+		return json.Number(strconv.FormatUint(val, 10)), nil
+	case float64:
+		if math.IsInf(val, 0) || math.IsNaN(val) {
+			return nil, fmt.Errorf("%v can't be represented in JSON", val)
+		}
+		return val, nil
+	case time.Time:
+		return val.Format(time.RFC3339Nano), nil
+	case nil, bool, string:
+		return val, nil
+	}
+	return nil, fmt.Errorf("unsupported YAML value %v of type %T", v, v)
+}
+
+// yamlKey returns the object key for a scalar YAML mapping key
+func yamlKey(key interface{}) (string, error) {
+	switch k := key.(type) {
+	case string:
+		return k, nil
+	case nil:
+		return "null", nil
+	case bool, int, int64, uint64, float64:
+		return fmt.Sprint(k), nil
+	case time.Time:
+		return k.Format(time.RFC3339Nano), nil
+	}
+	return "", fmt.Errorf("unsupported YAML mapping key %v of type %T", key, key)
+}